@@ -0,0 +1,341 @@
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * 用户表，保存所有的 ACL 用户
+ * default 用户总是存在，未认证的连接以 default 用户的身份执行命令
+ */
+
+const DefaultUser = "default"
+
+var (
+	ErrNoAclFile     = errors.New("This Redis instance is not configured to use an ACL file")
+	errDelDefault    = errors.New("The 'default' user cannot be removed")
+	errInvalidName   = errors.New("Usernames can't contain spaces or null characters")
+	errDuplicateUser = errors.New("Duplicate user found")
+)
+
+var (
+	mu    sync.RWMutex
+	users = map[string]*User{DefaultUser: makeDefaultUser("")}
+	// aclFile ACL 文件的路径，为空时不能执行 ACL SAVE 和 ACL LOAD
+	aclFile string
+	// defaultPassword 即 requirepass，ACL 文件中没有 default 用户时使用
+	defaultPassword string
+)
+
+// makeDefaultUser 可以执行所有命令，访问所有 key，password 为空时不需要密码
+func makeDefaultUser(password string) *User {
+	u := makeUser(DefaultUser)
+	for _, rule := range []string{"on", "~*", "&*", "+@all"} {
+		_ = u.setRule(rule)
+	}
+	if password == "" {
+		_ = u.setRule("nopass")
+	} else {
+		_ = u.setRule(">" + password)
+	}
+	return u
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\r\n\x00")
+}
+
+// Setup 初始化用户表，filename 不存在时视为空文件
+func Setup(filename string, requirepass string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	aclFile, defaultPassword = filename, requirepass
+	if filename == "" {
+		users = map[string]*User{DefaultUser: makeDefaultUser(requirepass)}
+		return nil
+	}
+	loaded, err := loadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		users = map[string]*User{DefaultUser: makeDefaultUser(requirepass)}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	users = loaded
+	return nil
+}
+
+// loadFile 读取 ACL 文件，每行一个用户，格式为 "user <name> <rules...>"，有错误时返回所有错误
+func loadFile(filename string) (map[string]*User, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	loaded := make(map[string]*User)
+	errs := make([]error, 0)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			errs = append(errs, fmt.Errorf("%s:%d: line should start with user keyword", filename, lineNum))
+			continue
+		}
+		name := fields[1]
+		if _, ok := loaded[name]; ok {
+			errs = append(errs, fmt.Errorf("%s:%d: %v '%s'", filename, lineNum, errDuplicateUser, name))
+			continue
+		}
+		u := makeUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.setRule(rule); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %v. Error in ACL modifier '%s'", filename, lineNum, err, rule))
+				break
+			}
+		}
+		loaded[name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if _, ok := loaded[DefaultUser]; !ok {
+		loaded[DefaultUser] = makeDefaultUser(defaultPassword)
+	}
+	return loaded, nil
+}
+
+// Load 重新读取 ACL 文件，文件有错误时保留当前的用户
+func Load() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if aclFile == "" {
+		return ErrNoAclFile
+	}
+	loaded, err := loadFile(aclFile)
+	if err != nil {
+		return err
+	}
+	users = loaded
+	return nil
+}
+
+// Save 将所有用户写入 ACL 文件，先写临时文件再重命名，避免写入中断损坏原文件
+func Save() error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if aclFile == "" {
+		return ErrNoAclFile
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(aclFile), filepath.Base(aclFile)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	writer := bufio.NewWriter(tmpFile)
+	for _, u := range sortedUsers() {
+		_, _ = writer.WriteString(u.Describe() + "\n")
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), aclFile)
+}
+
+// GetUser 返回的用户不会再被修改，可以在不加锁的情况下使用
+func GetUser(name string) *User {
+	mu.RLock()
+	defer mu.RUnlock()
+	return users[name]
+}
+
+// SetUser 创建或修改用户，所有规则都生效或者都不生效
+func SetUser(name string, rules []string) error {
+	if !validName(name) {
+		return errInvalidName
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	u, ok := users[name]
+	if ok {
+		u = u.clone()
+	} else {
+		u = makeUser(name)
+	}
+	for _, rule := range rules {
+		if err := u.setRule(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %v", rule, err)
+		}
+	}
+	users[name] = u
+	return nil
+}
+
+// DelUser 删除用户，返回删除的数量，default 用户不能删除
+func DelUser(names ...string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, errDelDefault
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := users[name]; ok {
+			delete(users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func sortedUsers() []*User {
+	result := make([]*User, 0, len(users))
+	for _, u := range users {
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Users 返回按用户名排序的所有用户
+func Users() []*User {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sortedUsers()
+}
+
+// Authenticate 用户不存在、被禁用或密码错误时返回 nil
+func Authenticate(name string, password string) *User {
+	u := GetUser(name)
+	if u == nil || !u.enabled || !u.CheckPassword(password) {
+		return nil
+	}
+	return u
+}
+
+// SetDefaultPassword 修改 requirepass 时同步修改 default 用户的密码
+func SetDefaultPassword(password string) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultPassword = password
+	u := users[DefaultUser].clone()
+	if password == "" {
+		_ = u.setRule("nopass")
+	} else {
+		_ = u.setRule("resetpass")
+		_ = u.setRule(">" + password)
+	}
+	users[DefaultUser] = u
+}
+
+/* ---- ACL LOG ---- */
+
+const (
+	maxLogEntries = 128
+	// 相同的拒绝在这段时间内合并为一条记录
+	logGroupingInterval = 60 * time.Second
+)
+
+const (
+	ReasonCommand = "command"
+	ReasonKey     = "key"
+	ReasonAuth    = "auth"
+)
+
+// LogEntry 一条权限拒绝或认证失败的记录
+type LogEntry struct {
+	Count      int
+	Reason     string
+	Context    string
+	Object     string
+	Username   string
+	ClientInfo string
+	EntryID    int64
+	Created    time.Time
+	Updated    time.Time
+}
+
+var (
+	logMu sync.Mutex
+	// 最新的记录在前
+	logEntries []*LogEntry
+	nextLogID  int64
+)
+
+// AddLog 记录一次拒绝，object 为命令名、key 或者认证失败的用户名
+func AddLog(reason string, object string, username string, clientInfo string) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	now := time.Now()
+	for _, e := range logEntries {
+		if e.Reason == reason && e.Object == object && e.Username == username &&
+			now.Sub(e.Updated) < logGroupingInterval {
+			e.Count++
+			e.Updated = now
+			e.ClientInfo = clientInfo
+			return
+		}
+	}
+	entry := &LogEntry{
+		Count:      1,
+		Reason:     reason,
+		Context:    "toplevel",
+		Object:     object,
+		Username:   username,
+		ClientInfo: clientInfo,
+		EntryID:    nextLogID,
+		Created:    now,
+		Updated:    now,
+	}
+	nextLogID++
+	logEntries = append([]*LogEntry{entry}, logEntries...)
+	if len(logEntries) > maxLogEntries {
+		logEntries = logEntries[:maxLogEntries]
+	}
+}
+
+// Logs 返回最新的 count 条记录
+func Logs(count int) []LogEntry {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if count > len(logEntries) {
+		count = len(logEntries)
+	}
+	result := make([]LogEntry, count)
+	for i := 0; i < count; i++ {
+		result[i] = *logEntries[i]
+	}
+	return result
+}
+
+func ResetLog() {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logEntries = nil
+}
@@ -0,0 +1,117 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_User(t *testing.T) {
+	u := makeUser("alice")
+	for _, rule := range []string{"on", ">secret", "~cache:*", "&news.*", "+@read", "-@dangerous", "+set", "-get"} {
+		if err := u.setRule(rule); err != nil {
+			t.Fatalf("setRule(%s) err: %v", rule, err)
+		}
+	}
+	if !u.CheckPassword("secret") || u.CheckPassword("wrong") {
+		t.Errorf("CheckPassword() err")
+	}
+	categories := []string{"read", "string", "fast"}
+	if !u.CanExecute("STRLEN", categories) || u.CanExecute("get", categories) || !u.CanExecute("set", nil) {
+		t.Errorf("CanExecute() err: %s", u.Commands())
+	}
+	if u.CanExecute("keys", []string{"read", "dangerous"}) || u.CanExecute("del", []string{"write"}) {
+		t.Errorf("CanExecute() err: %s", u.Commands())
+	}
+	if !u.CanAccessKey("cache:1") || u.CanAccessKey("user:1") || u.CanAccessAllKeys() || u.Channels() != "&news.*" {
+		t.Errorf("CanAccessKey() err")
+	}
+	// +@all 覆盖之前的规则，同一个命令只保留最后一条规则
+	_ = u.setRule("+get")
+	if strings.Count(u.Commands(), "get") != 1 {
+		t.Errorf("addCommandRule() err: %s", u.Commands())
+	}
+	_ = u.setRule("+@all")
+	if u.Commands() != "+@all" {
+		t.Errorf("addCommandRule() err: %s", u.Commands())
+	}
+
+	for _, rule := range []string{"+@nosuch", "#abc", "<nosuch", "%R~*", "+get|key"} {
+		if err := u.setRule(rule); err == nil {
+			t.Errorf("setRule(%s) should fail", rule)
+		}
+	}
+	_ = u.setRule("allkeys")
+	if !u.CanAccessAllKeys() {
+		t.Errorf("CanAccessAllKeys() err: %s", u.Keys())
+	}
+	if err := u.setRule("~user:*"); err == nil {
+		t.Errorf("setRule() should reject pattern after allkeys")
+	}
+	_ = u.setRule("reset")
+	if u.enabled || u.CanAccessKey("a") || u.CanExecute("get", nil) || u.CheckPassword("secret") {
+		t.Errorf("reset err: %s", u.Describe())
+	}
+}
+
+func Test_Registry(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "users.acl")
+	if err := Setup(filename, "foobared"); err != nil {
+		t.Fatalf("Setup() err: %v", err)
+	}
+	if Authenticate(DefaultUser, "foobared") == nil || Authenticate(DefaultUser, "") != nil {
+		t.Errorf("Authenticate() default user err")
+	}
+	// 有错误的规则不会生效
+	if err := SetUser("alice", []string{"on", ">pw", "+@nosuch"}); err == nil || GetUser("alice") != nil {
+		t.Errorf("SetUser() should be atomic")
+	}
+	if err := SetUser("alice", []string{"on", ">pw", "~cache:*", "+@read"}); err != nil {
+		t.Fatalf("SetUser() err: %v", err)
+	}
+	if Authenticate("alice", "pw") == nil {
+		t.Errorf("Authenticate() err")
+	}
+	if err := Save(); err != nil {
+		t.Fatalf("Save() err: %v", err)
+	}
+	want := GetUser("alice").Describe()
+	if n, err := DelUser("alice", "nosuch"); n != 1 || err != nil {
+		t.Errorf("DelUser() err: %d, %v", n, err)
+	}
+	if _, err := DelUser(DefaultUser); err == nil {
+		t.Errorf("DelUser() should not delete default user")
+	}
+	if err := Load(); err != nil {
+		t.Fatalf("Load() err: %v", err)
+	}
+	if u := GetUser("alice"); u == nil || u.Describe() != want {
+		t.Errorf("Load() err: %v", u)
+	}
+
+	// 文件有错误时保留当前的用户
+	_ = os.WriteFile(filename, []byte("user bob on +@nosuch\nbob\n"), 0644)
+	err := Load()
+	if err == nil || len(strings.Split(err.Error(), "\n")) != 2 || GetUser("alice") == nil {
+		t.Errorf("Load() should report all errors: %v", err)
+	}
+	SetDefaultPassword("")
+	if !GetUser(DefaultUser).NoPass() {
+		t.Errorf("SetDefaultPassword() err")
+	}
+}
+
+func Test_Log(t *testing.T) {
+	ResetLog()
+	AddLog(ReasonCommand, "set", "alice", "addr=a")
+	AddLog(ReasonCommand, "set", "alice", "addr=b")
+	AddLog(ReasonKey, "user:1", "alice", "addr=a")
+	entries := Logs(10)
+	if len(entries) != 2 || entries[0].Reason != ReasonKey || entries[1].Count != 2 || entries[1].ClientInfo != "addr=b" {
+		t.Errorf("Logs() err: %+v", entries)
+	}
+	if len(Logs(1)) != 1 {
+		t.Errorf("Logs() count err")
+	}
+}
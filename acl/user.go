@@ -0,0 +1,364 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/jiangh156/godis/lib/wildcard"
+	"strings"
+)
+
+// Categories 所有的命令分类，与 Redis 相同，另外包含各个扩展数据类型的分类
+var Categories = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string", "bitmap", "hyperloglog",
+	"geo", "stream", "pubsub", "admin", "fast", "slow", "blocking", "dangerous", "connection",
+	"transaction", "scripting", "json", "bloom", "cuckoo", "cms", "topk", "timeseries",
+}
+
+var (
+	errSyntax        = errors.New("Syntax error")
+	errUnknownName   = errors.New("Unknown command or category name in ACL")
+	errNoSuchPass    = errors.New("The password you are trying to remove from the user does not exist")
+	errBadHash       = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	errAfterAllKeys  = errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	errAfterAllChans = errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+)
+
+// commandExists 检查命令是否存在，由服务器注册
+var commandExists = func(cmdName string) bool {
+	return true
+}
+
+// SetCommandChecker 注册检查命令是否存在的函数，SETUSER 拒绝不存在的命令
+func SetCommandChecker(checker func(cmdName string) bool) {
+	commandExists = checker
+}
+
+type pattern struct {
+	src     string
+	matcher *wildcard.Pattern
+}
+
+func makePattern(src string) *pattern {
+	return &pattern{
+		src:     src,
+		matcher: wildcard.CompilePattern(src),
+	}
+}
+
+/*
+ * User ACL 用户
+ * 用户发布后不再修改，SETUSER 修改的是副本，保证并发读取的安全
+ */
+type User struct {
+	Name    string
+	enabled bool
+	nopass  bool
+	// 密码的 SHA256，保持添加的顺序
+	passwords []string
+	// 命令规则，如 +@all, -@dangerous, +get，按顺序生效，后面的规则覆盖前面的
+	commands []string
+	keys     []*pattern
+	// 频道的模式，没有发布订阅命令，只为兼容 Redis 的 ACL 规则而保存
+	channels []*pattern
+}
+
+// makeUser 新用户默认禁用，没有密码，不能执行任何命令
+func makeUser(name string) *User {
+	return &User{
+		Name:     name,
+		commands: []string{"-@all"},
+	}
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.commands = append([]string(nil), u.commands...)
+	c.keys = append([]*pattern(nil), u.keys...)
+	c.channels = append([]*pattern(nil), u.channels...)
+	return &c
+}
+
+func (u *User) Enabled() bool {
+	return u.enabled
+}
+
+func (u *User) NoPass() bool {
+	return u.nopass
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckPassword 使用常量时间比较密码的哈希
+func (u *User) CheckPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := []byte(hashPassword(password))
+	matched := false
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(p)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func validHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *User) addPassword(hash string) {
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+	u.nopass = false
+}
+
+func (u *User) removePassword(hash string) error {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errNoSuchPass
+}
+
+func isAllPattern(patterns []*pattern) bool {
+	return len(patterns) == 1 && patterns[0].src == "*"
+}
+
+func addPattern(patterns []*pattern, src string, errAfterAll error) ([]*pattern, error) {
+	if src == "*" {
+		return []*pattern{makePattern(src)}, nil
+	}
+	if isAllPattern(patterns) {
+		return nil, errAfterAll
+	}
+	for _, p := range patterns {
+		if p.src == src {
+			return patterns, nil
+		}
+	}
+	return append(patterns, makePattern(src)), nil
+}
+
+func validCategory(category string) bool {
+	if category == "all" {
+		return true
+	}
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// addCommandRule 添加命令规则，+@all 和 -@all 覆盖之前所有的规则
+func (u *User) addCommandRule(rule string) error {
+	name := strings.ToLower(rule[1:])
+	rule = rule[:1] + name
+	if strings.HasPrefix(name, "@") {
+		if !validCategory(name[1:]) {
+			return errUnknownName
+		}
+		if name == "@all" {
+			u.commands = []string{rule}
+			return nil
+		}
+	} else {
+		if strings.Contains(name, "|") || !commandExists(name) {
+			return errUnknownName
+		}
+		// 同一个命令只保留最后一条规则
+		for i := 0; i < len(u.commands); i++ {
+			if u.commands[i][1:] == name {
+				u.commands = append(u.commands[:i], u.commands[i+1:]...)
+				i--
+			}
+		}
+	}
+	u.commands = append(u.commands, rule)
+	return nil
+}
+
+// setRule 修改用户的一条规则，规则的语法与 Redis 的 ACL SETUSER 相同
+func (u *User) setRule(rule string) error {
+	var err error
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.nopass = true
+		u.passwords = nil
+	case lower == "resetpass":
+		u.nopass = false
+		u.passwords = nil
+	case lower == "allkeys":
+		u.keys = []*pattern{makePattern("*")}
+	case lower == "resetkeys":
+		u.keys = nil
+	case lower == "allchannels":
+		u.channels = []*pattern{makePattern("*")}
+	case lower == "resetchannels":
+		u.channels = nil
+	case lower == "allcommands":
+		u.commands = []string{"+@all"}
+	case lower == "nocommands":
+		u.commands = []string{"-@all"}
+	case lower == "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "nocommands", "off"} {
+			_ = u.setRule(r)
+		}
+	case rule == "":
+		return errSyntax
+	case rule[0] == '>':
+		u.addPassword(hashPassword(rule[1:]))
+	case rule[0] == '<':
+		return u.removePassword(hashPassword(rule[1:]))
+	case rule[0] == '#':
+		if !validHash(rule[1:]) {
+			return errBadHash
+		}
+		u.addPassword(rule[1:])
+	case rule[0] == '!':
+		if !validHash(rule[1:]) {
+			return errBadHash
+		}
+		return u.removePassword(rule[1:])
+	case rule[0] == '~':
+		u.keys, err = addPattern(u.keys, rule[1:], errAfterAllKeys)
+	case rule[0] == '&':
+		u.channels, err = addPattern(u.channels, rule[1:], errAfterAllChans)
+	case len(rule) > 1 && (rule[0] == '+' || rule[0] == '-'):
+		err = u.addCommandRule(rule)
+	default:
+		return errSyntax
+	}
+	return err
+}
+
+// CanExecute 用户能否执行命令，categories 为命令所属的分类
+func (u *User) CanExecute(cmdName string, categories []string) bool {
+	cmdName = strings.ToLower(cmdName)
+	allowed := false
+	for _, rule := range u.commands {
+		target := rule[1:]
+		matched := false
+		switch {
+		case target == "@all":
+			matched = true
+		case target[0] == '@':
+			for _, c := range categories {
+				if c == target[1:] {
+					matched = true
+					break
+				}
+			}
+		default:
+			matched = target == cmdName
+		}
+		if matched {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+func matchAny(patterns []*pattern, s string) bool {
+	for _, p := range patterns {
+		if p.matcher.IsMatch(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessKey 用户能否访问 key
+func (u *User) CanAccessKey(key string) bool {
+	return matchAny(u.keys, key)
+}
+
+// CanAccessAllKeys 用户能否访问所有 key，即 allkeys 或 ~*
+func (u *User) CanAccessAllKeys() bool {
+	return isAllPattern(u.keys)
+}
+
+// Flags 返回 ACL GETUSER 中的 flags
+func (u *User) Flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Passwords 返回密码的哈希
+func (u *User) Passwords() []string {
+	return append([]string(nil), u.passwords...)
+}
+
+// Commands 返回命令规则的描述
+func (u *User) Commands() string {
+	return strings.Join(u.commands, " ")
+}
+
+func describePatterns(patterns []*pattern, prefix string) string {
+	items := make([]string, len(patterns))
+	for i, p := range patterns {
+		items[i] = prefix + p.src
+	}
+	return strings.Join(items, " ")
+}
+
+// Keys 返回 key 模式的描述，如 "~cache:* ~session:*"
+func (u *User) Keys() string {
+	return describePatterns(u.keys, "~")
+}
+
+// Channels 返回频道模式的描述
+func (u *User) Channels() string {
+	return describePatterns(u.channels, "&")
+}
+
+// Describe 返回用户的规则，格式与 ACL LIST 和 ACL 文件相同，可以通过 SETUSER 还原
+func (u *User) Describe() string {
+	items := []string{"user", u.Name}
+	items = append(items, u.Flags()...)
+	for _, p := range u.passwords {
+		items = append(items, "#"+p)
+	}
+	if len(u.keys) > 0 {
+		items = append(items, u.Keys())
+	}
+	if len(u.channels) > 0 {
+		items = append(items, u.Channels())
+	} else {
+		items = append(items, "resetchannels")
+	}
+	items = append(items, u.Commands())
+	return strings.Join(items, " ")
+}
@@ -3,6 +3,7 @@ package cluster
 import (
 	"context"
 	"errors"
+	"github.com/jiangh156/godis/config"
 	"github.com/jiangh156/godis/redis/client"
 	pool "github.com/jolestar/go-commons-pool/v2"
 )
@@ -18,6 +19,17 @@ func (cluster *connectionFactory) MakeObject(ctx context.Context) (*pool.PooledO
 		return nil, err
 	}
 	c.Start()
+	// 没有单独配置 peerauth 时，集群中的节点使用相同的 requirepass
+	password := config.Properties.PeerAuth
+	if password == "" {
+		password = config.Requirepass()
+	}
+	if password != "" {
+		if err := c.Auth(config.Properties.PeerUser, password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
 	return pool.NewPooledObject(c), nil
 }
 
@@ -30,8 +42,10 @@ func (cluster *connectionFactory) DestroyObject(ctx context.Context, object *poo
 	return nil
 }
 
+// ValidateObject 借出时检查，重连或重新认证失败的客户端会被销毁
 func (cluster *connectionFactory) ValidateObject(ctx context.Context, object *pool.PooledObject) bool {
-	return true
+	c, ok := object.Object.(*client.Client)
+	return ok && !c.Broken()
 }
 
 func (cluster *connectionFactory) ActivateObject(ctx context.Context, object *pool.PooledObject) error {
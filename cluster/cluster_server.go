@@ -41,7 +41,10 @@ func MakeClusterServer() *ClusterServer {
 	ctx := context.Background()
 	// 使用连接池初始化peer结点
 	for _, peer := range config.Properties.Peers {
-		cluster.peerConnection[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, &connectionFactory{Peer: peer})
+		poolConfig := pool.NewDefaultPoolConfig()
+		// 借出时检查连接是否可用，检查不需要网络请求
+		poolConfig.TestOnBorrow = true
+		cluster.peerConnection[peer] = pool.NewObjectPool(ctx, &connectionFactory{Peer: peer}, poolConfig)
 	}
 	return cluster
 }
@@ -43,7 +43,10 @@ func (cluster *ClusterServer) relay(peer string, c redis.Connection, args [][]by
 		return protocol.MakeErrReply("ERR" + err.Error())
 	}
 	defer cluster.returnPeerClient(peer, peerClient)
-	peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex())))
+	// 节点的数据库数量不一致时SELECT可能失败
+	if reply := peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex()))); protocol.IsErrorReply(reply) {
+		return reply
+	}
 	return peerClient.Send(args)
 }
 
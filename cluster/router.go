@@ -11,11 +11,13 @@ func makeRouter() map[string]CmdFunc {
 	routerMap["get"] = defaultFunc
 	routerMap["getset"] = defaultFunc
 	routerMap["ping"] = ping
+	routerMap["info"] = ping // 只返回本节点的信息
+	routerMap["config"] = ping
 	routerMap["rename"] = rename
 	routerMap["renamenx"] = rename
 	routerMap["flushdb"] = flushdb
 	routerMap["del"] = del
-	routerMap["Select"] = execSelect
+	routerMap["select"] = execSelect
 	return routerMap
 }
 
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/jiangh156/godis/acl"
 	"github.com/jiangh156/godis/config"
 	"github.com/jiangh156/godis/lib/logger"
 	"github.com/jiangh156/godis/redis/server"
 	"github.com/jiangh156/godis/tcp"
+	"os"
 )
 
 var banner = `
@@ -24,13 +28,26 @@ func main() {
 		Ext:        ".log",
 		TimeFormat: "2006-01-01",
 	})
-	config.SetupConfig("redis.yml")
+	if err := config.Setup(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Println("invalid config:")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger.SetLevel(config.Properties.LogLevel)
+	if err := acl.Setup(config.Properties.AclFile, config.Properties.Requirepass); err != nil {
+		fmt.Println("invalid acl file:")
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	//handler := server.MakeRedisHandler()
 	handler := server.MakeRedisHandler()
 	err := tcp.ListenAndServeWithSignal(&tcp.Config{
 		Address: config.Properties.Bind,
 		Port:    config.Properties.Port,
-		MaxConn: 10,
+		MaxConn: config.Properties.MaxClients,
 	}, handler)
 	if err != nil {
 		fmt.Println(err)
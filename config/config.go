@@ -1,9 +1,8 @@
 package config
 
 import (
-	"bufio"
+	"fmt"
 	"log"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -14,86 +13,104 @@ type PropertyHolder struct {
 	Port           int    `cfg:"port"`           //监听端口
 	AppendOnly     bool   `cfg:"appendOnly"`     //是否启用AOF（Append-Only File）持久化
 	AppendFilename string `cfg:"appendFilename"` //AOF文件的文件名
+	AppendFsync    string `cfg:"appendfsync"`    //AOF刷盘策略: always, everysec, no
 	MaxClients     int    `cfg:"maxClients"`     //最大客户端数量
 	Requirepass    string `cfg:"requirepass"`    //密码
-	Databases      int    `cfg:"databases`       //数据库数量
+	AclFile        string `cfg:"aclfile"`        //ACL用户文件，为空时不能执行 ACL SAVE 和 ACL LOAD
+	Databases      int    `cfg:"databases"`      //数据库数量
+	MaxMemory      int    `cfg:"maxmemory"`      //最大内存，单位字节，0表示不限制
+	Timeout        int    `cfg:"timeout"`        //客户端空闲超时时间，单位秒，0表示不超时
+	LogLevel       string `cfg:"loglevel"`       //日志级别: debug, info, warning, error
 
-	Peers []string `cfg:"peers"` //其他节点的地址列表
-	Self  string   `cfg:"self"`  //本身的地址
+	Peers    []string `cfg:"peers"`    //其他节点的地址列表
+	Self     string   `cfg:"self"`     //本身的地址
+	PeerUser string   `cfg:"peeruser"` //连接其他节点时认证的用户名，为空时使用 default 用户
+	PeerAuth string   `cfg:"peerauth"` //连接其他节点时认证的密码，为空时使用 requirepass
+
+	// 紧凑编码的转换阈值，超过阈值后转换为哈希表/跳表编码
+	HashMaxListpackEntries int `cfg:"hash-max-listpack-entries"` //哈希使用listpack编码的最大字段数
+	HashMaxListpackValue   int `cfg:"hash-max-listpack-value"`   //哈希使用listpack编码的字段和值的最大长度
+	SetMaxIntsetEntries    int `cfg:"set-max-intset-entries"`    //集合使用intset编码的最大成员数
+	ZSetMaxListpackEntries int `cfg:"zset-max-listpack-entries"` //有序集合使用listpack编码的最大成员数
+	ZSetMaxListpackValue   int `cfg:"zset-max-listpack-value"`   //有序集合使用listpack编码的成员最大长度
+	HllSparseMaxBytes      int `cfg:"hll-sparse-max-bytes"`      //HyperLogLog使用sparse编码的最大字节数
+
+	LfuLogFactor int `cfg:"lfu-log-factor"` //LFU计数器的对数因子，越大计数器增长越慢
+	LfuDecayTime int `cfg:"lfu-decay-time"` //LFU计数器衰减的周期，单位分钟
 }
 
 var Properties *PropertyHolder
 
 func init() {
 	Properties = &PropertyHolder{
-		Bind:       "127.0.0.1",
-		Port:       6379,
-		AppendOnly: false, //默认关闭AOF持久化
+		Bind:           "127.0.0.1",
+		Port:           6379,
+		AppendOnly:     false, //默认关闭AOF持久化
+		AppendFilename: "appendonly.aof",
+		AppendFsync:    "everysec",
+		MaxClients:     10000,
+		Databases:      16,
+		LogLevel:       "info",
+
+		HashMaxListpackEntries: 128,
+		HashMaxListpackValue:   64,
+		SetMaxIntsetEntries:    512,
+		ZSetMaxListpackEntries: 128,
+		ZSetMaxListpackValue:   64,
+		HllSparseMaxBytes:      3000,
+
+		LfuLogFactor: 10,
+		LfuDecayTime: 1,
 	}
+	defaults = *Properties
 }
 
-func loadConfig(filename string) *PropertyHolder {
-	config := Properties
-	file, err := os.Open(filename)
-	if err != nil {
-		log.Fatalln(err)
-		return config
-	}
-	//读取文件，获取kv对
-	kvMap := make(map[string]string)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) == 0 || (len(line) > 0 && line[0] == '#') { // 改行为空或为注释
-			continue
+// setValue 将字符串形式的配置转换为字段的类型并赋值
+func setValue(fieldVal reflect.Value, name string, value string) error {
+	switch fieldVal.Kind() {
+	case reflect.String:
+		if options, ok := enumConfigs[name]; ok {
+			value = strings.ToLower(value)
+			if !contains(options, value) {
+				return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(options, ", "))
+			}
 		}
-		index := strings.IndexAny(line, " ")
-		if index > 0 && index < len(line)-1 {
-			key := line[0 : index-1]
-			value := strings.Trim(line[index+1:], " ")
-			kvMap[strings.ToLower(key)] = value
+		fieldVal.SetString(value)
+	case reflect.Int:
+		var intValue int64
+		var err error
+		if name == "maxmemory" {
+			intValue, err = parseMemory(value)
+		} else {
+			intValue, err = strconv.ParseInt(value, 10, 64)
 		}
-	}
-	t := reflect.TypeOf(Properties) //Properties是指针
-	v := reflect.ValueOf(Properties)
-	n := t.Elem().NumField()
-	for i := 0; i < n; i++ {
-		field := t.Elem().Field(i)
-		fieldVal := v.Elem().Field(i)
-		key, ok := field.Tag.Lookup("cfg")
-		if !ok {
-			key = field.Name
+		if err != nil || intValue < 0 {
+			return fmt.Errorf("argument couldn't be parsed into an integer: %s", value)
 		}
-		value, ok := kvMap[strings.ToLower(key)]
-		if ok { // 存在cfg tag
-			switch field.Type.Kind() {
-			case reflect.String:
-				fieldVal.SetString(value)
-			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err != nil {
-					log.Fatalln(err)
-					return config
-				}
-				fieldVal.SetInt(intValue)
-			case reflect.Bool:
-				boolValue, err := strconv.ParseBool(value)
-				if err != nil {
-					log.Fatalln(err)
-					return config
-				}
-				fieldVal.SetBool(boolValue)
-			case reflect.Slice:
-				if field.Type.Elem().Kind() == reflect.String {
-					sliceValue := strings.Split(value, ",")
-					fieldVal.Set(reflect.ValueOf(sliceValue))
+		fieldVal.SetInt(intValue)
+	case reflect.Bool:
+		boolValue, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		fieldVal.SetBool(boolValue)
+	case reflect.Slice:
+		if fieldVal.Type().Elem().Kind() == reflect.String {
+			sliceValue := make([]string, 0)
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					sliceValue = append(sliceValue, item)
 				}
 			}
+			fieldVal.Set(reflect.ValueOf(sliceValue))
 		}
 	}
-	return config
+	return nil
 }
 
+// SetupConfig 从指定的配置文件加载配置，出错时退出
 func SetupConfig(filename string) {
-	Properties = loadConfig(filename)
+	if err := Setup([]string{"--config", filename}); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * 配置的优先级从低到高: 默认值 < 配置文件 < GODIS_* 环境变量 < 命令行参数
+ * 配置文件通过 --config 或 GODIS_CONFIG 指定，都没有时尝试读取当前目录下的 redis.yml
+ */
+
+const (
+	envPrefix         = "GODIS_"
+	defaultConfigFile = "redis.yml"
+)
+
+// envName 返回配置对应的环境变量名，如 hash-max-listpack-entries 对应 GODIS_HASH_MAX_LISTPACK_ENTRIES
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// unquote 去掉值两侧的引号，双引号中支持转义字符
+func unquote(value string) (string, error) {
+	if len(value) < 2 {
+		return value, nil
+	}
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		return strconv.Unquote(value)
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// stripComment 去掉行尾的注释，引号中的 # 不是注释
+func stripComment(value string) string {
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.LastIndexByte(value, value[0]); end > 0 {
+			return value[:end+1]
+		}
+		return value
+	}
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// splitLine 拆分 YAML 风格的 "key: value" 或 redis.conf 风格的 "key value"
+func splitLine(line string) (string, string) {
+	if i := strings.IndexByte(line, ':'); i > 0 && !strings.ContainsAny(line[:i], " \t") &&
+		(i == len(line)-1 || line[i+1] == ' ' || line[i+1] == '\t') {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	if i := strings.IndexAny(line, " \t"); i > 0 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
+
+/*
+ * parseConfig 解析配置文件，返回配置名到值的映射
+ * 列表可以写成逗号分隔的字符串、YAML 的 [a, b] 或者多行的 "- a"，统一转换为逗号分隔的字符串
+ */
+func parseConfig(reader io.Reader) (map[string]string, []error) {
+	kvMap := make(map[string]string)
+	errs := make([]error, 0)
+	// 正在读取多行列表的配置
+	listKey := ""
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line == "---" {
+			continue
+		}
+		if line == "-" || strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				errs = append(errs, fmt.Errorf("line %d: unexpected list item", lineNum))
+				continue
+			}
+			item, err := unquote(stripComment(strings.TrimSpace(line[1:])))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("line %d: %v", lineNum, err))
+				continue
+			}
+			if kvMap[listKey] != "" {
+				kvMap[listKey] += ","
+			}
+			kvMap[listKey] += item
+			continue
+		}
+		listKey = ""
+		key, value := splitLine(line)
+		key = strings.ToLower(key)
+		if _, ok := kvMap[key]; ok {
+			errs = append(errs, fmt.Errorf("line %d: duplicate option '%s'", lineNum, key))
+			continue
+		}
+		value = stripComment(value)
+		if value == "" {
+			// 值为空时后面可能是多行的列表
+			listKey = key
+			kvMap[key] = ""
+			continue
+		}
+		if value[0] == '[' && value[len(value)-1] == ']' {
+			items := make([]string, 0)
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				item, err := unquote(strings.TrimSpace(item))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("line %d: %v", lineNum, err))
+					continue
+				}
+				items = append(items, item)
+			}
+			kvMap[key] = strings.Join(items, ",")
+			continue
+		}
+		value, err := unquote(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", lineNum, err))
+			continue
+		}
+		kvMap[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return kvMap, errs
+}
+
+// apply 将配置写入 holder，source 用于错误信息中标明配置的来源
+func apply(holder *PropertyHolder, kvMap map[string]string, source string) []error {
+	names := make([]string, 0, len(kvMap))
+	for name := range kvMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, 0)
+	for _, name := range names {
+		fieldVal, ok := lookupField(holder, name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown option '%s'", source, name))
+			continue
+		}
+		value := kvMap[name]
+		if value == "" && fieldVal.Kind() != reflect.Slice && fieldVal.Kind() != reflect.String {
+			errs = append(errs, fmt.Errorf("%s: missing value for '%s'", source, name))
+			continue
+		}
+		if err := setValue(fieldVal, name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value for '%s': %v", source, name, err))
+		}
+	}
+	return errs
+}
+
+// validAddr 检查地址是否为 host:port 的格式
+func validAddr(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// validate 检查配置之间的取值范围和依赖关系
+func validate(holder *PropertyHolder) []error {
+	errs := make([]error, 0)
+	if holder.Port < 1 || holder.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", holder.Port))
+	}
+	if holder.Databases < 1 {
+		errs = append(errs, fmt.Errorf("databases must be at least 1, got %d", holder.Databases))
+	}
+	if holder.AppendOnly && holder.AppendFilename == "" {
+		errs = append(errs, errors.New("appendfilename must be set when appendonly is enabled"))
+	}
+	if holder.Self != "" && !validAddr(holder.Self) {
+		errs = append(errs, fmt.Errorf("self must be in the form host:port, got '%s'", holder.Self))
+	}
+	if len(holder.Peers) > 0 && holder.Self == "" {
+		errs = append(errs, errors.New("self must be set when peers is set"))
+	}
+	seen := make(map[string]bool)
+	for _, peer := range holder.Peers {
+		switch {
+		case !validAddr(peer):
+			errs = append(errs, fmt.Errorf("peer must be in the form host:port, got '%s'", peer))
+		case peer == holder.Self:
+			errs = append(errs, fmt.Errorf("peers must not contain self '%s'", peer))
+		case seen[peer]:
+			errs = append(errs, fmt.Errorf("duplicate peer '%s'", peer))
+		}
+		seen[peer] = true
+	}
+	return errs
+}
+
+/*
+ * Setup 按优先级加载配置，args 为命令行参数(不含程序名)
+ * 每个配置都有同名的命令行参数，如 --port 6380, --hash-max-listpack-entries 256
+ * 所有错误一起返回，出错时 Properties 保持不变
+ */
+func Setup(args []string) error {
+	holder := defaults
+	t := reflect.TypeOf(&holder).Elem()
+	v := reflect.ValueOf(&holder).Elem()
+
+	fs := flag.NewFlagSet("godis", flag.ContinueOnError)
+	filename := fs.String("config", "", "path of the config file")
+	for i := 0; i < t.NumField(); i++ {
+		name := configName(t.Field(i))
+		fs.String(name, "", fmt.Sprintf("overrides '%s' (default %q)", name, formatValue(v.Field(i))))
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument '%s'", fs.Arg(0))
+	}
+
+	errs := make([]error, 0)
+	// 配置文件
+	if *filename == "" {
+		*filename = os.Getenv(envPrefix + "CONFIG")
+	}
+	if *filename == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			*filename = defaultConfigFile
+		}
+	}
+	if *filename != "" {
+		file, err := os.Open(*filename)
+		if err != nil {
+			return err
+		}
+		kvMap, parseErrs := parseConfig(file)
+		_ = file.Close()
+		for _, err := range parseErrs {
+			errs = append(errs, fmt.Errorf("%s: %v", *filename, err))
+		}
+		errs = append(errs, apply(&holder, kvMap, *filename)...)
+	}
+	// 环境变量
+	envMap := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		name := configName(t.Field(i))
+		if value, ok := os.LookupEnv(envName(name)); ok {
+			envMap[name] = value
+		}
+	}
+	errs = append(errs, apply(&holder, envMap, "environment")...)
+	// 命令行参数
+	flagMap := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			flagMap[f.Name] = f.Value.String()
+		}
+	})
+	errs = append(errs, apply(&holder, flagMap, "command line")...)
+
+	errs = append(errs, validate(&holder)...)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	Properties = &holder
+	configFile = *filename
+	return nil
+}
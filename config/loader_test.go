@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseConfig(t *testing.T) {
+	content := `# comment
+bind 0.0.0.0
+port: 6380 # trailing comment
+requirepass: "a#b"
+peers:
+  - 127.0.0.1:6381
+  - "127.0.0.1:6382"
+self: 127.0.0.1:6380
+maxClients:
+`
+	kvMap, errs := parseConfig(strings.NewReader(content))
+	want := map[string]string{
+		"bind":        "0.0.0.0",
+		"port":        "6380",
+		"requirepass": "a#b",
+		"peers":       "127.0.0.1:6381,127.0.0.1:6382",
+		"self":        "127.0.0.1:6380",
+		"maxclients":  "",
+	}
+	if len(errs) != 0 || !reflect.DeepEqual(kvMap, want) {
+		t.Errorf("parseConfig() err: %v, %v", kvMap, errs)
+	}
+	kvMap, _ = parseConfig(strings.NewReader("peers: [127.0.0.1:6381, '127.0.0.1:6382']\n"))
+	if kvMap["peers"] != "127.0.0.1:6381,127.0.0.1:6382" {
+		t.Errorf("parseConfig() err: %v", kvMap)
+	}
+	if _, errs := parseConfig(strings.NewReader("- a\nport 1\nport 2\n")); len(errs) != 2 {
+		t.Errorf("parseConfig() should report all errors: %v", errs)
+	}
+}
+
+func Test_Setup(t *testing.T) {
+	defer func(p *PropertyHolder, f string) {
+		Properties, configFile = p, f
+	}(Properties, configFile)
+
+	filename := filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(filename, []byte("port 6380\ndatabases 8\nappendonly yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GODIS_PORT", "6381")
+	t.Setenv("GODIS_DATABASES", "4")
+	if err := Setup([]string{"--config", filename, "--port", "6382"}); err != nil {
+		t.Fatalf("Setup() err: %v", err)
+	}
+	if Properties.Port != 6382 || Properties.Databases != 4 || !Properties.AppendOnly {
+		t.Errorf("Setup() precedence err: %+v", Properties)
+	}
+
+	// 出错时报告所有错误并保留原有配置
+	old := Properties
+	err := Setup([]string{"--config", filename, "--port", "0", "--databases", "x", "--peers", "a"})
+	if err == nil || len(strings.Split(err.Error(), "\n")) != 4 || Properties != old {
+		t.Errorf("Setup() should report all errors: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/jiangh156/godis/lib/wildcard"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * 运行时读取和修改配置，供 CONFIG 命令使用
+ * 配置名为 cfg tag 的小写形式
+ */
+
+// configFile 启动时加载的配置文件，CONFIG REWRITE 写回该文件
+var configFile string
+
+// defaults 默认配置，CONFIG REWRITE 不写出与默认值相同且文件中没有的配置
+var defaults PropertyHolder
+
+// mutableConfigs 可以在运行时安全修改的配置
+var mutableConfigs = map[string]bool{
+	"appendonly":  true,
+	"appendfsync": true,
+	"maxmemory":   true,
+	"requirepass": true,
+	"timeout":     true,
+	"loglevel":    true,
+}
+
+// enumConfigs 取值有限的配置
+var enumConfigs = map[string][]string{
+	"appendfsync": {"always", "everysec", "no"},
+	"loglevel":    {"debug", "info", "warning", "error"},
+}
+
+var ErrNoConfigFile = errors.New("the server is running without a config file")
+
+// mu 保护 mutableConfigs 中的配置，Set 持有写锁，其他协程通过下面的函数读取
+var mu sync.RWMutex
+
+func AppendOnly() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Properties.AppendOnly
+}
+
+func AppendFsync() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Properties.AppendFsync
+}
+
+func MaxMemory() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Properties.MaxMemory
+}
+
+func Requirepass() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Properties.Requirepass
+}
+
+func Timeout() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Properties.Timeout
+}
+
+func contains(options []string, value string) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBool 同时支持 yes/no 和 true/false
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("argument must be 'yes' or 'no': %s", value)
+	}
+	return b, nil
+}
+
+// parseMemory 解析带单位的内存大小，如 100mb, 1gb
+func parseMemory(value string) (int64, error) {
+	value = strings.ToLower(value)
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(value, unit.suffix), 10, 64)
+			return n * unit.scale, err
+		}
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// configName 返回字段对应的配置名
+func configName(field reflect.StructField) string {
+	key, ok := field.Tag.Lookup("cfg")
+	if !ok {
+		key = field.Name
+	}
+	return strings.ToLower(key)
+}
+
+// lookupField 根据配置名查找字段
+func lookupField(holder *PropertyHolder, name string) (reflect.Value, bool) {
+	t := reflect.TypeOf(holder).Elem()
+	v := reflect.ValueOf(holder).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		if configName(t.Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func formatValue(fieldVal reflect.Value) string {
+	switch fieldVal.Kind() {
+	case reflect.Bool:
+		if fieldVal.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Int:
+		return strconv.FormatInt(fieldVal.Int(), 10)
+	case reflect.Slice:
+		return strings.Join(fieldVal.Interface().([]string), ",")
+	}
+	return fieldVal.String()
+}
+
+// Get 返回匹配 pattern 的配置，结果按配置名排序，名称和值交替排列
+func Get(pattern string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	matcher := wildcard.CompilePattern(strings.ToLower(pattern))
+	t := reflect.TypeOf(Properties).Elem()
+	v := reflect.ValueOf(Properties).Elem()
+	names := make([]string, 0)
+	values := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		name := configName(t.Field(i))
+		if matcher.IsMatch(name) {
+			names = append(names, name)
+			values[name] = formatValue(v.Field(i))
+		}
+	}
+	sort.Strings(names)
+	result := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		result = append(result, name, values[name])
+	}
+	return result
+}
+
+// Set 修改运行时配置，只允许修改 mutableConfigs 中的配置
+func Set(name string, value string) error {
+	name = strings.ToLower(name)
+	fieldVal, ok := lookupField(Properties, name)
+	if !ok {
+		return fmt.Errorf("unknown option '%s'", name)
+	}
+	if !mutableConfigs[name] {
+		return fmt.Errorf("can't set immutable config '%s'", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return setValue(fieldVal, name, value)
+}
+
+// Rewrite 将当前配置写回配置文件，保留注释和原有的顺序
+func Rewrite() error {
+	if configFile == "" {
+		return ErrNoConfigFile
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	file, err := os.Open(configFile)
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0)
+	written := make(map[string]bool)
+	// 重写的配置后面原有的多行列表项需要删除
+	skipItems := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			lines = append(lines, line)
+			continue
+		}
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if !skipItems {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		skipItems = false
+		key := strings.Fields(trimmed)[0]
+		name := strings.ToLower(strings.TrimSuffix(key, ":"))
+		fieldVal, ok := lookupField(Properties, name)
+		// 未知的配置或重复的配置保持原样
+		if !ok || written[name] {
+			lines = append(lines, line)
+			continue
+		}
+		written[name] = true
+		skipItems = true
+		lines = append(lines, rewriteLine(key, formatValue(fieldVal)))
+	}
+	_ = file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// 文件中没有且与默认值不同的配置追加到文件末尾
+	t := reflect.TypeOf(Properties).Elem()
+	v := reflect.ValueOf(Properties).Elem()
+	d := reflect.ValueOf(&defaults).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name := configName(t.Field(i))
+		if written[name] || reflect.DeepEqual(v.Field(i).Interface(), d.Field(i).Interface()) {
+			continue
+		}
+		lines = append(lines, rewriteLine(name+":", formatValue(v.Field(i))))
+	}
+	// 先写入临时文件再替换，避免写入中途失败破坏配置文件
+	tmpFile := configFile + ".tmp"
+	content := strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, configFile)
+}
+
+// rewriteLine 按原有的格式 "key: value" 或 "key value" 生成配置行
+func rewriteLine(key string, value string) string {
+	if value == "" {
+		return key
+	}
+	return key + " " + quoteValue(value)
+}
+
+// quoteValue 值会被当作注释、引号、列表或者首尾有空白时加上双引号，读取时由 unquote 还原
+func quoteValue(value string) string {
+	if strings.ContainsAny(value[:1], "\"'[ \t") || strings.ContainsAny(value[len(value)-1:], " \t") ||
+		strings.Contains(value, " #") || strings.Contains(value, "\t#") || strings.ContainsAny(value, "\r\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Rewrite(t *testing.T) {
+	defer func(p *PropertyHolder, f string) {
+		Properties, configFile = p, f
+	}(Properties, configFile)
+
+	filename := filepath.Join(t.TempDir(), "redis.yml")
+	content := "# peers\npeers:\n  - 127.0.0.1:6381\n  # old peer\n  - 127.0.0.1:6382\nself: 127.0.0.1:6380\nport: 6380\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Setup([]string{"--config", filename}); err != nil {
+		t.Fatalf("Setup() err: %v", err)
+	}
+	Properties.Peers = []string{"127.0.0.1:6383"}
+	if err := Set("requirepass", ` pass #1 "x" `); err != nil {
+		t.Fatalf("Set() err: %v", err)
+	}
+	if err := Rewrite(); err != nil {
+		t.Fatalf("Rewrite() err: %v", err)
+	}
+	// 原有的列表项被删除，包含注释符号和引号的值可以原样读回
+	data, _ := os.ReadFile(filename)
+	if strings.Contains(string(data), "- 127.0.0.1") || !strings.Contains(string(data), "# old peer") {
+		t.Errorf("Rewrite() err: %s", data)
+	}
+	if err := Setup([]string{"--config", filename}); err != nil {
+		t.Fatalf("Setup() err: %v\n%s", err, data)
+	}
+	if len(Properties.Peers) != 1 || Properties.Peers[0] != "127.0.0.1:6383" || Properties.Requirepass != ` pass #1 "x" ` {
+		t.Errorf("Rewrite() err: %q, %q", Properties.Peers, Properties.Requirepass)
+	}
+}
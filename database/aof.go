@@ -1,21 +1,29 @@
 package database
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/jiangh156/godis/config"
 	"github.com/jiangh156/godis/lib/logger"
 	"github.com/jiangh156/godis/redis/parser"
 	"github.com/jiangh156/godis/redis/protocol"
 	"io"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// 加载aof文件
-func LoadAof() {
+// 加载aof文件，文件中引用了超出配置的数据库时返回错误
+func LoadAof() error {
 	currentDB := 0
 	var server = RedisServerInstance
+	defer server.aofLoading.Set(false)
 
-	aofFile := server.DBSet[0].aofFile
+	aofFile := server.aofFile
+	if aofFile == nil {
+		return nil
+	}
 
 	ch := parser.ParseStream(aofFile)
 	for payload := range ch {
@@ -23,8 +31,7 @@ func LoadAof() {
 			// conn close
 			logger.Warn(payload.Err.Error())
 			if payload.Err == io.EOF {
-				RedisServerInstance.aofLoading.Set(false)
-				return
+				return nil
 			}
 		} else {
 			// payload.Data is null
@@ -41,45 +48,169 @@ func LoadAof() {
 			case *protocol.MultiBulkReply:
 				args = payload.Data.(*protocol.MultiBulkReply).Args
 			}
+			cmdName := strings.ToLower(string(args[0]))
+			for _, arg := range dbIndexArgs(cmdName, args) {
+				index, err := strconv.Atoi(string(arg))
+				if err == nil && (index < 0 || index >= len(server.DBSet)) {
+					return fmt.Errorf("aof references DB %d, but only %d databases are configured", index, len(server.DBSet))
+				}
+			}
 			// handle select
-			if strings.ToLower(string(args[0])) == "select" {
+			if cmdName == "select" {
 				dbNum, err := strconv.ParseInt(string(args[1]), 10, 64)
 				if err != nil {
 					logger.Warn(err.Error())
 					continue
 				}
 				currentDB = int(dbNum)
+			} else if cmdName == "swapdb" || cmdName == "flushall" {
+				// 涉及多个数据库的命令由server执行
+				server.Exec(nil, args)
 			} else {
 				// handle common
-				server.DBSet[currentDB].Exec(nil, args)
+				server.execOnDB(currentDB, nil, args)
 			}
 		}
 	}
+	return nil
+}
+
+// aofPayload 写入AOF文件的命令及其所在的数据库
+type aofPayload struct {
+	dbIndex int
+	cmdLine *protocol.MultiBulkReply
 }
 
 func (db *DB) addAof(args *protocol.MultiBulkReply) {
 	if config.Properties.AppendOnly && db.aofChan != nil && !RedisServerInstance.aofLoading.Get() {
-		db.aofChan <- args
+		db.aofChan <- &aofPayload{dbIndex: db.index, cmdLine: args}
 	}
 }
 
-func (db *DB) handleAof() {
-	if !config.Properties.AppendOnly {
-		return
-	}
+/*
+ * handleAof 将所有数据库的命令写入同一个AOF文件，数据库改变时先写入 SELECT
+ * currentDB 为文件末尾所在的数据库，未知时为 -1
+ */
+func (s *SingleServer) handleAof(ch chan *aofPayload, file *os.File, currentDB int, done chan struct{}) {
+	defer close(done)
+	// appendfsync 为 everysec 时每秒刷盘一次
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
 		select {
-		case reply := <-db.aofChan:
-			_, err := db.aofFile.Write(reply.ToBytes())
+		case p, ok := <-ch:
+			if !ok {
+				_ = file.Sync()
+				return
+			}
+			if p.dbIndex != currentDB {
+				selectCmd := protocol.MakeMultiBulkReply([][]byte{[]byte("select"), []byte(strconv.Itoa(p.dbIndex))})
+				_, _ = file.Write(selectCmd.ToBytes())
+				currentDB = p.dbIndex
+			}
+			_, err := file.Write(p.cmdLine.ToBytes())
 			if err != nil {
 				logger.Warn(err.Error())
 			}
-			db.aofFile.Write([]byte("\r\n"))
-			db.aofFile.Sync()
+			s.aofWriteErr.Set(err != nil)
+			file.Write([]byte("\r\n"))
+			if config.AppendFsync() == "always" {
+				file.Sync()
+			}
+		case <-ticker.C:
+			if config.AppendFsync() == "everysec" {
+				file.Sync()
+			}
 		}
 	}
 }
 
+/*
+ * openAof 打开AOF文件并启动写入协程，调用时需要持有所有数据库的锁
+ * 已经打开时先等待之前的写入协程写完队列中的命令
+ */
+func (s *SingleServer) openAof(currentDB int) error {
+	file, err := os.OpenFile(config.Properties.AppendFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	s.closeAof()
+	s.aofFile = file
+	s.aofChan = make(chan *aofPayload, aofQueueSize)
+	s.aofDone = make(chan struct{})
+	for _, db := range s.DBSet {
+		db.aofChan = s.aofChan
+	}
+	go s.handleAof(s.aofChan, file, currentDB, s.aofDone)
+	return nil
+}
+
+// closeAof 停止写入协程并关闭AOF文件，调用时需要持有所有数据库的锁
+func (s *SingleServer) closeAof() {
+	if s.aofChan == nil {
+		return
+	}
+	for _, db := range s.DBSet {
+		db.aofChan = nil
+	}
+	close(s.aofChan)
+	<-s.aofDone
+	_ = s.aofFile.Close()
+	s.aofChan, s.aofFile, s.aofDone = nil, nil, nil
+}
+
+/*
+ * enableAof 运行时开启AOF，调用时需要持有所有数据库的锁，快照和打开文件之间的写命令不会丢失
+ * 先将当前的数据集以 RESTORE 命令写入新的AOF文件，之后的写命令追加在其后
+ * 有 key 不能序列化时返回错误，不修改原来的AOF文件
+ */
+func (s *SingleServer) enableAof() error {
+	// 之前开启过AOF时，先写完队列中的命令再截断文件
+	s.closeAof()
+	buf := &bytes.Buffer{}
+	currentDB := -1
+	for i, db := range s.DBSet {
+		if db.Data.Len() == 0 {
+			continue
+		}
+		buf.Write(db.makeAofCmd("select", [][]byte{[]byte(strconv.Itoa(i))}).ToBytes())
+		currentDB = i
+		var dumpErr error
+		db.Data.ForEach(func(key string, val any) bool {
+			payload, err := dumpValue(val.(*DataEntity).Data)
+			if err != nil {
+				dumpErr = fmt.Errorf("can not serialize key '%s': %v", key, err)
+				return false
+			}
+			args := [][]byte{[]byte(key), []byte("0"), payload, []byte("REPLACE")}
+			if expireTime := db.ttlOf(key); expireTime != nil {
+				args[1] = []byte(strconv.FormatInt(expireTime.UnixMilli(), 10))
+				args = append(args, []byte("ABSTTL"))
+			}
+			buf.Write(db.makeAofCmd("restore", args).ToBytes())
+			return true
+		})
+		if dumpErr != nil {
+			return dumpErr
+		}
+	}
+	// 截断而不是替换文件，之前打开的文件仍然有效
+	file, err := os.OpenFile(config.Properties.AppendFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	_ = file.Close()
+	return s.openAof(currentDB)
+}
+
 func (db *DB) makeAofCmd(cmd string, args [][]byte) *protocol.MultiBulkReply {
 	result := make([][]byte, len(args)+1)
 	copy(result[1:], args)
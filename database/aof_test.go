@@ -0,0 +1,158 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/lib/logger"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setupAof 使用临时的AOF文件，测试结束后恢复配置
+func setupAof(t *testing.T) {
+	old := *config.Properties
+	config.Properties.AppendFilename = filepath.Join(t.TempDir(), "appendonly.aof")
+	config.Properties.AppendFsync = "always"
+	// 读到文件末尾时会输出警告
+	logger.SetLevel("error")
+	t.Cleanup(func() {
+		*config.Properties = old
+		logger.SetLevel("debug")
+	})
+}
+
+// reloadAof 使用当前的AOF文件启动一个新的服务器
+func reloadAof(t *testing.T) *SingleServer {
+	config.Properties.AppendOnly = true
+	return makeTestServer(t)
+}
+
+func Test_EnableAof(t *testing.T) {
+	setupAof(t)
+	s := makeTestServer(t)
+	conn0, conn1 := &fakeConn{}, &fakeConn{dbIndex: 1}
+	exec(s, conn0, "set a 1")
+	exec(s, conn0, "hset h f v")
+	exec(s, conn1, "sadd s x y")
+	exec(s, conn1, "set ttl v")
+	exec(s, conn1, "expire ttl 100")
+	// 开启AOF的同时写入，快照和AOF文件之间不会丢失写命令
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn := &fakeConn{}
+		for i := 0; i < 200; i++ {
+			exec(s, conn, "rpush list "+strconv.Itoa(i))
+		}
+	}()
+	if reply := exec(s, conn0, "config set appendonly yes"); reply != "+OK\r\n" {
+		t.Fatalf("config set err: %q", reply)
+	}
+	wg.Wait()
+	exec(s, conn1, "set b 2")
+	// 关闭时写完队列中的命令
+	s.Close()
+
+	s2 := reloadAof(t)
+	testCases := []struct {
+		conn *fakeConn
+		line string
+		want string
+	}{
+		{&fakeConn{}, "get a", "$1\r\n1\r\n"},
+		{&fakeConn{}, "hget h f", "$1\r\nv\r\n"},
+		{&fakeConn{}, "llen list", ":200\r\n"},
+		{&fakeConn{dbIndex: 1}, "scard s", ":2\r\n"},
+		{&fakeConn{dbIndex: 1}, "get b", "$1\r\n2\r\n"},
+	}
+	for _, tc := range testCases {
+		if reply := exec(s2, tc.conn, tc.line); reply != tc.want {
+			t.Errorf("%s err: %q, want: %q", tc.line, reply, tc.want)
+		}
+	}
+	if s2.DBSet[1].ttlOf("ttl") == nil {
+		t.Errorf("restore ttl err")
+	}
+}
+
+func Test_EnableAofDumpError(t *testing.T) {
+	setupAof(t)
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "set a 1")
+	// 不能序列化的 value
+	s.DBSet[0].Put("bad", &DataEntity{Data: 42})
+	if reply := exec(s, conn, "config set appendonly yes"); !strings.HasPrefix(reply, "-ERR CONFIG SET failed") {
+		t.Errorf("config set should fail: %q", reply)
+	}
+	if reply := exec(s, conn, "config get appendonly"); reply != "*2\r\n$10\r\nappendonly\r\n$2\r\nno\r\n" {
+		t.Errorf("config set should rollback: %q", reply)
+	}
+	if _, err := os.Stat(config.Properties.AppendFilename); !os.IsNotExist(err) {
+		t.Errorf("aof file should not be created")
+	}
+}
+
+func Test_AofReplay(t *testing.T) {
+	setupAof(t)
+	s := reloadAof(t)
+	conn := &fakeConn{}
+	for i := 0; i < 20; i++ {
+		exec(s, conn, "sadd s "+strconv.Itoa(i))
+	}
+	// 随机弹出的成员和相对的过期时间在AOF中记录为确定的结果
+	setup := []string{
+		"spop s 5",
+		"spop s",
+		"hset h a 1",
+		"hset h b 2",
+		"hexpire h 100 FIELDS 1 a",
+		"zadd z 1 a 2 b 3 c",
+		"zpopmin z",
+		"rpush l a b c",
+		"lpop l",
+		"rpop l",
+	}
+	for _, line := range setup {
+		if reply := exec(s, conn, line); reply[0] == '-' {
+			t.Fatalf("%s err: %q", line, reply)
+		}
+	}
+	checks := []string{"sort s", "hkeys h", "zrange z 0 -1 WITHSCORES", "lrange l 0 -1"}
+	want := make([]string, len(checks))
+	for i, line := range checks {
+		want[i] = exec(s, conn, line)
+	}
+	s.Close()
+
+	s2 := reloadAof(t)
+	for i, line := range checks {
+		if reply := exec(s2, conn, line); reply != want[i] {
+			t.Errorf("%s err: %q, want: %q", line, reply, want[i])
+		}
+	}
+	if reply := exec(s2, conn, "httl h FIELDS 2 a b"); reply != "*2\r\n:100\r\n:-1\r\n" && reply != "*2\r\n:99\r\n:-1\r\n" {
+		t.Errorf("httl err: %q", reply)
+	}
+}
+
+func Test_AofDatabaseOutOfRange(t *testing.T) {
+	setupAof(t)
+	aof := "*2\r\n$6\r\nSELECT\r\n$1\r\n5\r\n*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\n1\r\n"
+	if err := os.WriteFile(config.Properties.AppendFilename, []byte(aof), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config.Properties.Databases = 4
+	s := makeTestServer(t)
+	// 服务器启动时加载失败会退出，这里直接调用 LoadAof
+	if err := s.openAof(-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadAof(); err == nil || !strings.Contains(err.Error(), "DB 5") {
+		t.Errorf("LoadAof() err: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"math"
+	"strconv"
+	"time"
+)
+
+// 阻塞命令(如 BZPOPMIN)在 key 上等待，写命令修改 key 后通过 signalKey 唤醒等待者
+
+// watchKeys 在 keys 上注册一个等待通道
+func (db *DB) watchKeys(keys []string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	db.blockingMu.Lock()
+	defer db.blockingMu.Unlock()
+	for _, key := range keys {
+		waiters, ok := db.blockingKeys[key]
+		if !ok {
+			waiters = make(map[chan struct{}]struct{})
+			db.blockingKeys[key] = waiters
+		}
+		waiters[ch] = struct{}{}
+	}
+	return ch
+}
+
+func (db *DB) unwatchKeys(keys []string, ch chan struct{}) {
+	db.blockingMu.Lock()
+	defer db.blockingMu.Unlock()
+	for _, key := range keys {
+		waiters, ok := db.blockingKeys[key]
+		if !ok {
+			continue
+		}
+		delete(waiters, ch)
+		if len(waiters) == 0 {
+			delete(db.blockingKeys, key)
+		}
+	}
+}
+
+// signalKey 唤醒所有在 key 上等待的客户端，被唤醒的客户端需要自行重试
+func (db *DB) signalKey(key string) {
+	db.blockingMu.Lock()
+	defer db.blockingMu.Unlock()
+	for ch := range db.blockingKeys[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// signalAll 唤醒所有在该数据库上等待的客户端
+func (db *DB) signalAll() {
+	db.blockingMu.Lock()
+	defer db.blockingMu.Unlock()
+	for _, waiters := range db.blockingKeys {
+		for ch := range waiters {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// blockedCount 返回正在该数据库上等待的客户端数量
+func (db *DB) blockedCount() int {
+	db.blockingMu.Lock()
+	defer db.blockingMu.Unlock()
+	clients := make(map[chan struct{}]struct{})
+	for _, waiters := range db.blockingKeys {
+		for ch := range waiters {
+			clients[ch] = struct{}{}
+		}
+	}
+	return len(clients)
+}
+
+/*
+ * blockUntil 反复调用 try 直到其返回非 nil 的结果或超时
+ * try 返回 nil 时表示没有可用的数据，需要等待 keys 被修改
+ * timeout 为 0 时一直等待, 超时返回 nil
+ * 调用时需要持有数据库的锁
+ */
+func (db *DB) blockUntil(keys []string, timeout time.Duration, try func() redis.Reply) redis.Reply {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		ch := db.watchKeys(keys)
+		reply := try()
+		if reply != nil {
+			db.unwatchKeys(keys, ch)
+			return reply
+		}
+		// 等待时释放数据库的锁，其他客户端才能修改 key
+		db.mu.Unlock()
+		timeout := false
+		select {
+		case <-ch:
+		case <-deadline:
+			timeout = true
+		}
+		db.mu.Lock()
+		db.unwatchKeys(keys, ch)
+		if timeout {
+			return nil
+		}
+	}
+}
+
+// parseBlockingTimeout 解析以秒为单位的超时时间，支持小数
+func parseBlockingTimeout(arg []byte) (time.Duration, redis.Reply) {
+	timeout, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return 0, protocol.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return 0, protocol.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
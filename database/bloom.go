@@ -0,0 +1,280 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/bloom"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+)
+
+func (db *DB) getAsBloom(key string) (*bloom.Bloom, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	b, ok := entity.Data.(*bloom.Bloom)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return b, nil
+}
+
+// getOrInitBloom key 不存在时使用默认参数创建
+func (db *DB) getOrInitBloom(key string) (*bloom.Bloom, redis.ErrReply) {
+	b, errReply := db.getAsBloom(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if b == nil {
+		b = bloom.Make(bloom.DefaultErrorRate, bloom.DefaultCapacity, bloom.DefaultExpansion)
+		db.Put(key, &DataEntity{
+			Data: b,
+		})
+	}
+	return b, nil
+}
+
+func (db *DB) getAsCuckoo(key string) (*bloom.Cuckoo, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	c, ok := entity.Data.(*bloom.Cuckoo)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return c, nil
+}
+
+// BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+func execBFReserve(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR bad error rate")
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return protocol.MakeErrReply("ERR (0 < error rate range < 1)")
+	}
+	capacity, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR bad capacity")
+	}
+	if capacity <= 0 {
+		return protocol.MakeErrReply("ERR (capacity should be larger than 0)")
+	}
+	var expansion int64 = bloom.DefaultExpansion
+	hasExpansion, nonScaling := false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "EXPANSION":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			expansion, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR bad expansion")
+			}
+			if expansion < 1 {
+				return protocol.MakeErrReply("ERR expansion should be greater or equal to 1")
+			}
+			hasExpansion = true
+			i++
+		case "NONSCALING":
+			nonScaling = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if hasExpansion && nonScaling {
+		return protocol.MakeErrReply("ERR Nonscaling filters cannot expand")
+	}
+	if nonScaling {
+		expansion = 0
+	}
+	if !bloom.ValidSize(errorRate, uint64(capacity)) {
+		return protocol.MakeErrReply(bloom.ErrTooLarge.Error())
+	}
+	if _, exists := db.Get(key); exists {
+		return protocol.MakeErrReply("ERR item exists")
+	}
+	db.Put(key, &DataEntity{
+		Data: bloom.Make(errorRate, uint64(capacity), uint64(expansion)),
+	})
+	aofReply := db.makeAofCmd("bf.reserve", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+// BF.ADD key item
+func execBFAdd(db *DB, args [][]byte) redis.Reply {
+	b, errReply := db.getOrInitBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	added, err := b.Add(args[1])
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	aofReply := db.makeAofCmd("bf.add", args)
+	db.addAof(aofReply)
+	if added {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// BF.MADD key item [item ...]
+func execBFMAdd(db *DB, args [][]byte) redis.Reply {
+	b, errReply := db.getOrInitBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		added, err := b.Add(item)
+		if err != nil {
+			result[i] = protocol.MakeErrReply(err.Error())
+		} else if added {
+			result[i] = protocol.MakeIntReply(1)
+		} else {
+			result[i] = protocol.MakeIntReply(0)
+		}
+	}
+	aofReply := db.makeAofCmd("bf.madd", args)
+	db.addAof(aofReply)
+	return protocol.MakeMultiRawReply(result)
+}
+
+// BF.EXISTS key item
+func execBFExists(db *DB, args [][]byte) redis.Reply {
+	b, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if b != nil && b.Exists(args[1]) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// BF.MEXISTS key item [item ...]
+func execBFMExists(db *DB, args [][]byte) redis.Reply {
+	b, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		if b != nil && b.Exists(item) {
+			result[i] = protocol.MakeIntReply(1)
+		} else {
+			result[i] = protocol.MakeIntReply(0)
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// BF.INFO key [CAPACITY | SIZE | FILTERS | ITEMS | EXPANSION]
+func execBFInfo(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return protocol.MakeArgNumErrReply("bf.info")
+	}
+	b, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if b == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	var expansion redis.Reply = protocol.MakeIntReply(int64(b.Expansion()))
+	if b.Expansion() == 0 {
+		expansion = protocol.MakeNullBulkReply()
+	}
+	fields := []struct {
+		name  string
+		arg   string
+		value redis.Reply
+	}{
+		{"Capacity", "CAPACITY", protocol.MakeIntReply(int64(b.Capacity()))},
+		{"Size", "SIZE", protocol.MakeIntReply(int64(b.Size()))},
+		{"Number of filters", "FILTERS", protocol.MakeIntReply(int64(b.Filters()))},
+		{"Number of items inserted", "ITEMS", protocol.MakeIntReply(int64(b.Count()))},
+		{"Expansion rate", "EXPANSION", expansion},
+	}
+	if len(args) == 2 {
+		arg := strings.ToUpper(string(args[1]))
+		for _, field := range fields {
+			if field.arg == arg {
+				return protocol.MakeMultiRawReply([]redis.Reply{field.value})
+			}
+		}
+		return protocol.MakeErrReply("ERR Invalid information value")
+	}
+	result := make([]redis.Reply, 0, 2*len(fields))
+	for _, field := range fields {
+		result = append(result, protocol.MakeStatusReply(field.name), field.value)
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// CF.ADD key item
+func execCFAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	c, errReply := db.getAsCuckoo(key)
+	if errReply != nil {
+		return errReply
+	}
+	if c == nil {
+		c = bloom.MakeCuckoo(bloom.DefaultCuckooCapacity)
+		db.Put(key, &DataEntity{
+			Data: c,
+		})
+	}
+	c.Add(args[1])
+	aofReply := db.makeAofCmd("cf.add", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(1)
+}
+
+// CF.DEL key item
+func execCFDel(db *DB, args [][]byte) redis.Reply {
+	c, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if c == nil {
+		return protocol.MakeErrReply("ERR Not found")
+	}
+	if !c.Delete(args[1]) {
+		return protocol.MakeIntReply(0)
+	}
+	aofReply := db.makeAofCmd("cf.del", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(1)
+}
+
+// CF.EXISTS key item
+func execCFExists(db *DB, args [][]byte) redis.Reply {
+	c, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if c != nil && c.Exists(args[1]) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+func init() {
+	RegisterCommand("BF.Reserve", execBFReserve, -4)
+	RegisterCommand("BF.Add", execBFAdd, 3)
+	RegisterCommand("BF.MAdd", execBFMAdd, -3)
+	RegisterCommand("BF.Exists", execBFExists, 3)
+	RegisterCommand("BF.MExists", execBFMExists, -3)
+	RegisterCommand("BF.Info", execBFInfo, -2)
+	RegisterCommand("CF.Add", execCFAdd, 3)
+	RegisterCommand("CF.Del", execCFDel, 3)
+	RegisterCommand("CF.Exists", execCFExists, 3)
+}
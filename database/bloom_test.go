@@ -0,0 +1,23 @@
+package database
+
+import "testing"
+
+func Test_BFReserveLimits(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"bf.reserve bf 0.01 9223372036854775807", "-ERR filter capacity is too large\r\n"},
+		{"bf.reserve bf 0.000001 1000000000", "-ERR filter capacity is too large\r\n"},
+		{"exists bf", ":0\r\n"},
+		{"bf.reserve bf 0.01 1000", "+OK\r\n"},
+		{"bf.add bf a", ":1\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
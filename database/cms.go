@@ -0,0 +1,169 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/cms"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+)
+
+const cmsTooLarge = "ERR CMS: width/depth is too large"
+
+func (db *DB) getAsCMS(key string) (*cms.CountMinSketch, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, protocol.MakeErrReply("ERR CMS: key does not exist")
+	}
+	sketch, ok := entity.Data.(*cms.CountMinSketch)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return sketch, nil
+}
+
+func (db *DB) putCMS(key string, sketch *cms.CountMinSketch) redis.Reply {
+	if _, exists := db.Get(key); exists {
+		return protocol.MakeErrReply("ERR CMS: key already exists")
+	}
+	db.Put(key, &DataEntity{
+		Data: sketch,
+	})
+	return nil
+}
+
+// CMS.INITBYDIM key width depth
+func execCMSInitByDim(db *DB, args [][]byte) redis.Reply {
+	width, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil || width == 0 {
+		return protocol.MakeErrReply("ERR CMS: invalid width")
+	}
+	depth, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil || depth == 0 {
+		return protocol.MakeErrReply("ERR CMS: invalid depth")
+	}
+	if !cms.ValidSize(width, depth) {
+		return protocol.MakeErrReply(cmsTooLarge)
+	}
+	if errReply := db.putCMS(string(args[0]), cms.Make(width, depth)); errReply != nil {
+		return errReply
+	}
+	aofReply := db.makeAofCmd("cms.initbydim", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+// CMS.INITBYPROB key error probability
+func execCMSInitByProb(db *DB, args [][]byte) redis.Reply {
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		return protocol.MakeErrReply("ERR CMS: invalid overestimation value")
+	}
+	probability, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || probability <= 0 || probability >= 1 {
+		return protocol.MakeErrReply("ERR CMS: invalid prob value")
+	}
+	width, depth, ok := cms.SizeByProb(errorRate, probability)
+	if !ok {
+		return protocol.MakeErrReply(cmsTooLarge)
+	}
+	if errReply := db.putCMS(string(args[0]), cms.Make(width, depth)); errReply != nil {
+		return errReply
+	}
+	aofReply := db.makeAofCmd("cms.initbyprob", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+// CMS.INCRBY key item increment [item increment ...]
+func execCMSIncrBy(db *DB, args [][]byte) redis.Reply {
+	pairs := args[1:]
+	if len(pairs)%2 != 0 {
+		return protocol.MakeArgNumErrReply("cms.incrby")
+	}
+	sketch, errReply := db.getAsCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	// 先解析全部增量，保证命令的原子性
+	increments := make([]uint64, len(pairs)/2)
+	for i := range increments {
+		increment, err := strconv.ParseUint(string(pairs[2*i+1]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR CMS: Cannot parse number")
+		}
+		increments[i] = increment
+	}
+	result := make([]redis.Reply, len(increments))
+	for i, increment := range increments {
+		result[i] = protocol.MakeIntReply(int64(sketch.IncrBy(pairs[2*i], increment)))
+	}
+	aofReply := db.makeAofCmd("cms.incrby", args)
+	db.addAof(aofReply)
+	return protocol.MakeMultiRawReply(result)
+}
+
+// CMS.QUERY key item [item ...]
+func execCMSQuery(db *DB, args [][]byte) redis.Reply {
+	sketch, errReply := db.getAsCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		result[i] = protocol.MakeIntReply(int64(sketch.Query(item)))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// CMS.MERGE destination numKeys source [source ...] [WEIGHTS weight [weight ...]]
+func execCMSMerge(db *DB, args [][]byte) redis.Reply {
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-2 {
+		return protocol.MakeErrReply("ERR CMS: invalid numkeys")
+	}
+	weights := make([]uint64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	rest := args[2+numKeys:]
+	if len(rest) > 0 {
+		if strings.ToUpper(string(rest[0])) != "WEIGHTS" || len(rest)-1 != numKeys {
+			return protocol.MakeSyntaxErrReply()
+		}
+		for i, arg := range rest[1:] {
+			weight, err := strconv.ParseUint(string(arg), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR CMS: invalid weight value")
+			}
+			weights[i] = weight
+		}
+	}
+	dest, errReply := db.getAsCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	sketches := make([]*cms.CountMinSketch, numKeys)
+	for i, arg := range args[2 : 2+numKeys] {
+		sketch, errReply := db.getAsCMS(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if sketch.Width() != dest.Width() || sketch.Depth() != dest.Depth() {
+			return protocol.MakeErrReply("ERR CMS: width/depth is not equal")
+		}
+		sketches[i] = sketch
+	}
+	dest.Merge(sketches, weights)
+	aofReply := db.makeAofCmd("cms.merge", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("CMS.InitByDim", execCMSInitByDim, 4)
+	RegisterCommand("CMS.InitByProb", execCMSInitByProb, 4)
+	RegisterCommand("CMS.IncrBy", execCMSIncrBy, -4)
+	RegisterCommand("CMS.Query", execCMSQuery, -3)
+	RegisterCommand("CMS.Merge", execCMSMerge, -4)
+}
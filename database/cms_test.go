@@ -0,0 +1,28 @@
+package database
+
+import "testing"
+
+func Test_SketchSizeLimits(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"cms.initbydim c 9223372036854775807 9223372036854775807", "-ERR CMS: width/depth is too large\r\n"},
+		{"cms.initbydim c 4294967296 4294967296", "-ERR CMS: width/depth is too large\r\n"},
+		{"cms.initbyprob c 0.000000001 0.0000000001", "-ERR CMS: width/depth is too large\r\n"},
+		{"cms.initbyprob c 0.001 0.01", "+OK\r\n"},
+		{"topk.reserve t 9223372036854775807", "-ERR TopK: k is too large\r\n"},
+		{"topk.reserve t 3 9223372036854775807 9223372036854775807 0.9", "-ERR TopK: width/depth is too large\r\n"},
+		{"topk.reserve t 3 4294967296 4294967296 0.9", "-ERR TopK: width/depth is too large\r\n"},
+		{"exists c t", ":1\r\n"},
+		{"topk.reserve t 3 100 5 0.9", "+OK\r\n"},
+		{"topk.add t a", "*1\r\n$-1\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * 命令的元数据，ACL 根据它检查用户能否执行命令和访问 key
+ * categories 为命令所属的 ACL 分类(不含@)
+ * key 的位置与 Redis 的 COMMAND INFO 相同: 第一个 key、最后一个 key(负数从末尾计算)和步长，位置从命令名之后的 1 开始
+ * key 的位置不固定的命令使用 keys 函数提取
+ */
+type commandInfo struct {
+	categories []string
+	firstKey   int
+	lastKey    int
+	keyStep    int
+	keys       func(args [][]byte) [][]byte
+}
+
+func makeInfo(categories string, firstKey int, lastKey int, keyStep int) *commandInfo {
+	return &commandInfo{
+		categories: strings.Fields(categories),
+		firstKey:   firstKey,
+		lastKey:    lastKey,
+		keyStep:    keyStep,
+	}
+}
+
+func makeInfoWithKeys(categories string, keys func(args [][]byte) [][]byte) *commandInfo {
+	return &commandInfo{
+		categories: strings.Fields(categories),
+		keys:       keys,
+	}
+}
+
+// numKeysAt 处理 "numkeys key [key ...]" 形式的参数，withDest 为 true 时第一个参数是目标 key
+func numKeysAt(pos int, withDest bool) func(args [][]byte) [][]byte {
+	return func(args [][]byte) [][]byte {
+		keys := make([][]byte, 0)
+		if withDest && len(args) > 1 {
+			keys = append(keys, args[1])
+		}
+		if pos >= len(args) {
+			return keys
+		}
+		n, err := strconv.Atoi(string(args[pos]))
+		if err != nil || n < 0 {
+			return keys
+		}
+		end := pos + 1 + n
+		if end > len(args) {
+			end = len(args)
+		}
+		return append(keys, args[pos+1:end]...)
+	}
+}
+
+// streamKeys 处理 XREAD 和 XREADGROUP 的 "STREAMS key [key ...] id [id ...]"
+// 跳过 GROUP group consumer 和选项的值，组名或消费者名为 STREAMS 时不会误判
+func streamKeys(args [][]byte) [][]byte {
+	i := 1
+	if i < len(args) && strings.ToUpper(string(args[i])) == "GROUP" {
+		i += 3
+	}
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT", "BLOCK":
+			i++
+		case "STREAMS":
+			rest := args[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
+
+// sortKeys 返回 SORT 的源 key 和 STORE 的目标 key
+func sortKeys(args [][]byte) [][]byte {
+	if len(args) < 2 {
+		return nil
+	}
+	keys := [][]byte{args[1]}
+	for i := 2; i+1 < len(args); i++ {
+		if strings.ToUpper(string(args[i])) == "STORE" {
+			keys = append(keys, args[i+1])
+		}
+	}
+	return keys
+}
+
+var commandInfos = map[string]*commandInfo{
+	// 连接和服务器
+	"ping":     makeInfo("fast connection", 0, 0, 0),
+	"select":   makeInfo("fast connection", 0, 0, 0),
+	"swapdb":   makeInfo("keyspace write fast dangerous", 0, 0, 0),
+	"flushall": makeInfo("keyspace write slow dangerous", 0, 0, 0),
+	"info":     makeInfo("slow dangerous", 0, 0, 0),
+	"config":   makeInfo("admin slow dangerous", 0, 0, 0),
+
+	// key
+	"del":       makeInfo("keyspace write slow", 1, -1, 1),
+	"unlink":    makeInfo("keyspace write fast", 1, -1, 1),
+	"exists":    makeInfo("keyspace read fast", 1, -1, 1),
+	"keys":      makeInfo("keyspace read slow dangerous", 0, 0, 0),
+	"flushdb":   makeInfo("keyspace write slow dangerous", 0, 0, 0),
+	"type":      makeInfo("keyspace read fast", 1, 1, 1),
+	"rename":    makeInfo("keyspace write slow", 1, 2, 1),
+	"renamenx":  makeInfo("keyspace write fast", 1, 2, 1),
+	"expire":    makeInfo("keyspace write fast", 1, 1, 1),
+	"object":    makeInfo("keyspace read slow", 2, 2, 1),
+	"touch":     makeInfo("keyspace read fast", 1, -1, 1),
+	"randomkey": makeInfo("keyspace read slow", 0, 0, 0),
+	"dbsize":    makeInfo("keyspace read fast", 0, 0, 0),
+	"copy":      makeInfo("keyspace write slow", 1, 2, 1),
+	"move":      makeInfo("keyspace write fast", 1, 1, 1),
+	"dump":      makeInfo("keyspace read slow", 1, 1, 1),
+	"restore":   makeInfo("keyspace write slow dangerous", 1, 1, 1),
+	"sort":      makeInfoWithKeys("write set sortedset list slow dangerous", sortKeys),
+	"sort_ro":   makeInfoWithKeys("read set sortedset list slow dangerous", sortKeys),
+
+	// 字符串
+	"get":    makeInfo("read string fast", 1, 1, 1),
+	"set":    makeInfo("write string slow", 1, 1, 1),
+	"setnx":  makeInfo("write string fast", 1, 1, 1),
+	"getset": makeInfo("write string fast", 1, 1, 1),
+	"strlen": makeInfo("read string fast", 1, 1, 1),
+	"setex":  makeInfo("write string slow", 1, 1, 1),
+
+	// 列表
+	"lpush":  makeInfo("write list fast", 1, 1, 1),
+	"rpush":  makeInfo("write list fast", 1, 1, 1),
+	"lpop":   makeInfo("write list fast", 1, 1, 1),
+	"rpop":   makeInfo("write list fast", 1, 1, 1),
+	"llen":   makeInfo("read list fast", 1, 1, 1),
+	"lindex": makeInfo("read list slow", 1, 1, 1),
+	"lrange": makeInfo("read list slow", 1, 1, 1),
+	"lset":   makeInfo("write list slow", 1, 1, 1),
+	"lrem":   makeInfo("write list slow", 1, 1, 1),
+
+	// 哈希
+	"hset":         makeInfo("write hash fast", 1, 1, 1),
+	"hget":         makeInfo("read hash fast", 1, 1, 1),
+	"hdel":         makeInfo("write hash fast", 1, 1, 1),
+	"hkeys":        makeInfo("read hash slow", 1, 1, 1),
+	"hexpire":      makeInfo("write hash fast", 1, 1, 1),
+	"hpexpire":     makeInfo("write hash fast", 1, 1, 1),
+	"hexpireat":    makeInfo("write hash fast", 1, 1, 1),
+	"hpexpireat":   makeInfo("write hash fast", 1, 1, 1),
+	"httl":         makeInfo("read hash fast", 1, 1, 1),
+	"hpttl":        makeInfo("read hash fast", 1, 1, 1),
+	"hexpiretime":  makeInfo("read hash fast", 1, 1, 1),
+	"hpexpiretime": makeInfo("read hash fast", 1, 1, 1),
+	"hpersist":     makeInfo("write hash fast", 1, 1, 1),
+
+	// 集合
+	"sadd":        makeInfo("write set fast", 1, 1, 1),
+	"smembers":    makeInfo("read set slow", 1, 1, 1),
+	"srem":        makeInfo("write set fast", 1, 1, 1),
+	"sismember":   makeInfo("read set fast", 1, 1, 1),
+	"smismember":  makeInfo("read set fast", 1, 1, 1),
+	"scard":       makeInfo("read set fast", 1, 1, 1),
+	"srandmember": makeInfo("read set slow", 1, 1, 1),
+	"spop":        makeInfo("write set fast", 1, 1, 1),
+	"smove":       makeInfo("write set fast", 1, 2, 1),
+	"sinter":      makeInfo("read set slow", 1, -1, 1),
+	"sinterstore": makeInfo("write set slow", 1, -1, 1),
+	"sintercard":  makeInfoWithKeys("read set slow", numKeysAt(1, false)),
+	"sdiff":       makeInfo("read set slow", 1, -1, 1),
+	"sdiffstore":  makeInfo("write set slow", 1, -1, 1),
+	"sunion":      makeInfo("read set slow", 1, -1, 1),
+	"sunionstore": makeInfo("write set slow", 1, -1, 1),
+
+	// 有序集合
+	"zadd":             makeInfo("write sortedset fast", 1, 1, 1),
+	"zincrby":          makeInfo("write sortedset fast", 1, 1, 1),
+	"zscore":           makeInfo("read sortedset fast", 1, 1, 1),
+	"zmscore":          makeInfo("read sortedset fast", 1, 1, 1),
+	"zrandmember":      makeInfo("read sortedset slow", 1, 1, 1),
+	"zrank":            makeInfo("read sortedset fast", 1, 1, 1),
+	"zrevrank":         makeInfo("read sortedset fast", 1, 1, 1),
+	"zcard":            makeInfo("read sortedset fast", 1, 1, 1),
+	"zrange":           makeInfo("read sortedset slow", 1, 1, 1),
+	"zrangestore":      makeInfo("write sortedset slow", 1, 2, 1),
+	"zrevrange":        makeInfo("read sortedset slow", 1, 1, 1),
+	"zcount":           makeInfo("read sortedset fast", 1, 1, 1),
+	"zrangebyscore":    makeInfo("read sortedset slow", 1, 1, 1),
+	"zrevrangebyscore": makeInfo("read sortedset slow", 1, 1, 1),
+	"zremrangebyscore": makeInfo("write sortedset slow", 1, 1, 1),
+	"zremrangebyrank":  makeInfo("write sortedset slow", 1, 1, 1),
+	"zrangebylex":      makeInfo("read sortedset slow", 1, 1, 1),
+	"zrevrangebylex":   makeInfo("read sortedset slow", 1, 1, 1),
+	"zlexcount":        makeInfo("read sortedset fast", 1, 1, 1),
+	"zremrangebylex":   makeInfo("write sortedset slow", 1, 1, 1),
+	"zrem":             makeInfo("write sortedset fast", 1, 1, 1),
+	"zpopmin":          makeInfo("write sortedset fast", 1, 1, 1),
+	"zpopmax":          makeInfo("write sortedset fast", 1, 1, 1),
+	"zmpop":            makeInfoWithKeys("write sortedset slow", numKeysAt(1, false)),
+	"bzpopmin":         makeInfo("write sortedset fast blocking", 1, -2, 1),
+	"bzpopmax":         makeInfo("write sortedset fast blocking", 1, -2, 1),
+	"zunion":           makeInfoWithKeys("read sortedset slow", numKeysAt(1, false)),
+	"zinter":           makeInfoWithKeys("read sortedset slow", numKeysAt(1, false)),
+	"zdiff":            makeInfoWithKeys("read sortedset slow", numKeysAt(1, false)),
+	"zunionstore":      makeInfoWithKeys("write sortedset slow", numKeysAt(2, true)),
+	"zinterstore":      makeInfoWithKeys("write sortedset slow", numKeysAt(2, true)),
+	"zdiffstore":       makeInfoWithKeys("write sortedset slow", numKeysAt(2, true)),
+
+	// 流
+	"xadd":       makeInfo("write stream fast", 1, 1, 1),
+	"xlen":       makeInfo("read stream fast", 1, 1, 1),
+	"xrange":     makeInfo("read stream slow", 1, 1, 1),
+	"xrevrange":  makeInfo("read stream slow", 1, 1, 1),
+	"xdel":       makeInfo("write stream fast", 1, 1, 1),
+	"xtrim":      makeInfo("write stream slow", 1, 1, 1),
+	"xread":      makeInfoWithKeys("read stream slow blocking", streamKeys),
+	"xgroup":     makeInfo("write stream slow", 2, 2, 1),
+	"xreadgroup": makeInfoWithKeys("write stream slow blocking", streamKeys),
+	"xack":       makeInfo("write stream fast", 1, 1, 1),
+	"xpending":   makeInfo("read stream slow", 1, 1, 1),
+	"xclaim":     makeInfo("write stream fast", 1, 1, 1),
+	"xautoclaim": makeInfo("write stream fast", 1, 1, 1),
+
+	// HyperLogLog
+	"pfadd":   makeInfo("write hyperloglog fast", 1, 1, 1),
+	"pfcount": makeInfo("read hyperloglog slow", 1, -1, 1),
+	"pfmerge": makeInfo("write hyperloglog slow", 1, -1, 1),
+
+	// 地理位置
+	"geoadd":         makeInfo("write geo slow", 1, 1, 1),
+	"geodist":        makeInfo("read geo slow", 1, 1, 1),
+	"geopos":         makeInfo("read geo slow", 1, 1, 1),
+	"geohash":        makeInfo("read geo slow", 1, 1, 1),
+	"geosearch":      makeInfo("read geo slow", 1, 1, 1),
+	"geosearchstore": makeInfo("write geo slow", 1, 2, 1),
+
+	// JSON
+	"json.set":       makeInfo("write json slow", 1, 1, 1),
+	"json.get":       makeInfo("read json slow", 1, 1, 1),
+	"json.del":       makeInfo("write json slow", 1, 1, 1),
+	"json.numincrby": makeInfo("write json slow", 1, 1, 1),
+	"json.strappend": makeInfo("write json slow", 1, 1, 1),
+	"json.arrappend": makeInfo("write json slow", 1, 1, 1),
+	"json.arrpop":    makeInfo("write json slow", 1, 1, 1),
+	"json.objkeys":   makeInfo("read json slow", 1, 1, 1),
+	"json.type":      makeInfo("read json slow", 1, 1, 1),
+
+	// 布隆过滤器和布谷鸟过滤器
+	"bf.reserve": makeInfo("write bloom fast", 1, 1, 1),
+	"bf.add":     makeInfo("write bloom fast", 1, 1, 1),
+	"bf.madd":    makeInfo("write bloom fast", 1, 1, 1),
+	"bf.exists":  makeInfo("read bloom fast", 1, 1, 1),
+	"bf.mexists": makeInfo("read bloom fast", 1, 1, 1),
+	"bf.info":    makeInfo("read bloom fast", 1, 1, 1),
+	"cf.add":     makeInfo("write cuckoo fast", 1, 1, 1),
+	"cf.del":     makeInfo("write cuckoo fast", 1, 1, 1),
+	"cf.exists":  makeInfo("read cuckoo fast", 1, 1, 1),
+
+	// Count-Min Sketch 和 Top-K
+	"cms.initbydim":  makeInfo("write cms fast", 1, 1, 1),
+	"cms.initbyprob": makeInfo("write cms fast", 1, 1, 1),
+	"cms.incrby":     makeInfo("write cms fast", 1, 1, 1),
+	"cms.query":      makeInfo("read cms fast", 1, 1, 1),
+	"cms.merge":      makeInfoWithKeys("write cms slow", numKeysAt(2, true)),
+	"topk.reserve":   makeInfo("write topk fast", 1, 1, 1),
+	"topk.add":       makeInfo("write topk slow", 1, 1, 1),
+	"topk.incrby":    makeInfo("write topk slow", 1, 1, 1),
+	"topk.query":     makeInfo("read topk fast", 1, 1, 1),
+	"topk.list":      makeInfo("read topk slow", 1, 1, 1),
+
+	// 时间序列
+	"ts.create":     makeInfo("write timeseries fast", 1, 1, 1),
+	"ts.add":        makeInfo("write timeseries fast", 1, 1, 1),
+	"ts.madd":       makeInfo("write timeseries fast", 1, -1, 3),
+	"ts.range":      makeInfo("read timeseries slow", 1, 1, 1),
+	"ts.revrange":   makeInfo("read timeseries slow", 1, 1, 1),
+	"ts.mrange":     makeInfo("read timeseries slow", 0, 0, 0),
+	"ts.createrule": makeInfo("write timeseries slow", 1, 2, 1),
+}
+
+// oomSafeCommands 只会删除或修改数据、不会占用更多内存的写命令，超过 maxmemory 时仍然可以执行
+var oomSafeCommands = map[string]bool{
+	"del": true, "unlink": true, "flushdb": true, "flushall": true, "swapdb": true,
+	"expire": true, "move": true, "rename": true, "renamenx": true,
+	"lpop": true, "rpop": true, "lrem": true,
+	"hdel": true, "hexpire": true, "hpexpire": true, "hexpireat": true, "hpexpireat": true, "hpersist": true,
+	"srem": true, "spop": true, "smove": true,
+	"zrem": true, "zpopmin": true, "zpopmax": true, "zmpop": true, "bzpopmin": true, "bzpopmax": true,
+	"zremrangebyscore": true, "zremrangebyrank": true, "zremrangebylex": true,
+	"xdel": true, "xtrim": true, "xack": true,
+	"json.del": true, "json.arrpop": true, "cf.del": true,
+}
+
+// commandDenyOOM 超过 maxmemory 时是否拒绝执行命令，与 Redis 的 denyoom 标记相同，会占用内存的写命令被拒绝
+func commandDenyOOM(cmdName string) bool {
+	info, ok := commandInfos[cmdName]
+	if !ok || oomSafeCommands[cmdName] {
+		return false
+	}
+	for _, c := range info.categories {
+		if c == "write" {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandCategories 返回命令所属的 ACL 分类，未知的命令返回 nil
+func CommandCategories(cmdName string) []string {
+	info, ok := commandInfos[strings.ToLower(cmdName)]
+	if !ok {
+		return nil
+	}
+	return info.categories
+}
+
+// CommandKeys 返回命令行中的所有 key，args 包含命令名
+func CommandKeys(args [][]byte) [][]byte {
+	info, ok := commandInfos[strings.ToLower(string(args[0]))]
+	if !ok {
+		return nil
+	}
+	if info.keys != nil {
+		return info.keys(args)
+	}
+	if info.firstKey <= 0 {
+		return nil
+	}
+	last := info.lastKey
+	if last < 0 {
+		last += len(args)
+	}
+	keys := make([][]byte, 0)
+	for i := info.firstKey; i <= last && i < len(args); i += info.keyStep {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// CommandAccessesAllKeys 命令是否会访问参数中没有的 key，如 TS.MRANGE 按标签匹配的序列、SORT 的 BY 和 GET 模式，
+// 无法逐个检查 key 的权限，ACL 要求用户可以访问所有 key
+func CommandAccessesAllKeys(args [][]byte) bool {
+	switch strings.ToLower(string(args[0])) {
+	case "ts.mrange":
+		return true
+	case "sort", "sort_ro":
+		for i := 2; i+1 < len(args); i++ {
+			switch strings.ToUpper(string(args[i])) {
+			case "BY":
+				if strings.Contains(string(args[i+1]), "*") {
+					return true
+				}
+				i++
+			case "GET":
+				if string(args[i+1]) != "#" {
+					return true
+				}
+				i++
+			case "STORE":
+				i++
+			case "LIMIT":
+				i += 2
+			}
+		}
+	}
+	return false
+}
+
+// CommandsInCategory 返回分类中的所有命令，按名称排序
+func CommandsInCategory(category string) []string {
+	names := make([]string, 0)
+	for name, info := range commandInfos {
+		for _, c := range info.categories {
+			if c == category {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CommandExists 命令是否由数据库执行
+func CommandExists(cmdName string) bool {
+	cmdName = strings.ToLower(cmdName)
+	if _, ok := cmdTable[cmdName]; ok {
+		return true
+	}
+	_, ok := serverCmdTable[cmdName]
+	return ok
+}
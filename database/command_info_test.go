@@ -0,0 +1,61 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/lib/utils"
+	"strings"
+	"testing"
+)
+
+func Test_CommandInfos(t *testing.T) {
+	// 没有元数据的命令不能通过 ACL 检查，新增命令时必须同时添加
+	for name := range cmdTable {
+		if _, ok := commandInfos[name]; !ok {
+			t.Errorf("commandInfos missing '%s'", name)
+		}
+	}
+	for name := range serverCmdTable {
+		if _, ok := commandInfos[name]; !ok {
+			t.Errorf("commandInfos missing '%s'", name)
+		}
+	}
+	for name := range commandInfos {
+		if !CommandExists(name) {
+			t.Errorf("commandInfos has unknown command '%s'", name)
+		}
+	}
+}
+
+func Test_CommandAccessesAllKeys(t *testing.T) {
+	tests := map[string]bool{
+		"ts.mrange - + FILTER a=b":                       true,
+		"sort list BY weight_* GET #":                    true,
+		"sort list GET # GET obj_*->name":                true,
+		"sort list BY nosort GET # LIMIT 0 10 STORE dst": false,
+		"sort_ro list ALPHA DESC":                        false,
+		"get key":                                        false,
+	}
+	for line, want := range tests {
+		if got := CommandAccessesAllKeys(utils.ToCmdLine(strings.Fields(line)...)); got != want {
+			t.Errorf("CommandAccessesAllKeys(%s) err: %v", line, got)
+		}
+	}
+}
+
+func Test_StreamKeys(t *testing.T) {
+	tests := map[string]string{
+		"xread COUNT 2 STREAMS a b 0 0":                            "a b",
+		"xread BLOCK 0 STREAMS a $":                                "a",
+		"xreadgroup GROUP streams c STREAMS a >":                   "a",
+		"xreadgroup GROUP g streams COUNT 1 NOACK STREAMS a b > >": "a b",
+		"xreadgroup GROUP g c":                                     "",
+	}
+	for line, want := range tests {
+		keys := make([]string, 0)
+		for _, key := range CommandKeys(utils.ToCmdLine(strings.Fields(line)...)) {
+			keys = append(keys, string(key))
+		}
+		if got := strings.Join(keys, " "); got != want {
+			t.Errorf("CommandKeys(%s) err: %q, want: %q", line, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/acl"
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/lib/logger"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strings"
+)
+
+var configHelp = []string{
+	"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET <pattern> [<pattern> ...]",
+	"    Return parameters matching the glob-like <pattern> and their values.",
+	"SET <directive> <value> [<directive> <value> ...]",
+	"    Set the configuration <directive> to <value>.",
+	"RESETSTAT",
+	"    Reset statistics reported by the INFO command.",
+	"REWRITE",
+	"    Rewrite the configuration file.",
+	"HELP",
+	"    Print this help.",
+}
+
+// CONFIG GET|SET|RESETSTAT|REWRITE|HELP
+func (s *SingleServer) execConfig(conn redis.Connection, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToUpper(string(args[1]))
+	switch subCmd {
+	case "GET":
+		if len(args) < 3 {
+			return protocol.MakeArgNumErrReply("config|get")
+		}
+		return execConfigGet(args[2:])
+	case "SET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return protocol.MakeArgNumErrReply("config|set")
+		}
+		return s.execConfigSet(args[2:])
+	case "RESETSTAT":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("config|resetstat")
+		}
+		s.stats.reset()
+		return protocol.MakeOkReply()
+	case "REWRITE":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("config|rewrite")
+		}
+		if err := config.Rewrite(); err != nil {
+			return protocol.MakeErrReply("ERR Rewriting config file: " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	case "HELP":
+		result := make([][]byte, len(configHelp))
+		for i, line := range configHelp {
+			result[i] = []byte(line)
+		}
+		return protocol.MakeMultiBulkReply(result)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[1]) + "'. Try CONFIG HELP.")
+}
+
+// CONFIG GET pattern [pattern ...]
+func execConfigGet(patterns [][]byte) redis.Reply {
+	seen := make(map[string]bool)
+	result := make([][]byte, 0)
+	for _, pattern := range patterns {
+		pairs := config.Get(string(pattern))
+		for i := 0; i < len(pairs); i += 2 {
+			if seen[pairs[i]] {
+				continue
+			}
+			seen[pairs[i]] = true
+			result = append(result, []byte(pairs[i]), []byte(pairs[i+1]))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+/*
+ * CONFIG SET parameter value [parameter value ...]
+ * 所有参数要么全部修改成功，要么全部恢复为原来的值
+ */
+func (s *SingleServer) execConfigSet(args [][]byte) redis.Reply {
+	// 修改配置时阻塞所有命令，开启AOF时快照之后的写命令都会写入AOF文件
+	unlock := s.lockAllDBs()
+	defer unlock()
+	oldValues := make(map[string]string)
+	names := make([]string, 0, len(args)/2)
+	rollback := func() {
+		for _, name := range names {
+			_ = config.Set(name, oldValues[name])
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		if _, ok := oldValues[name]; ok {
+			rollback()
+			return protocol.MakeErrReply("ERR CONFIG SET failed - duplicate parameter '" + name + "'")
+		}
+		if old := config.Get(name); len(old) == 2 {
+			oldValues[name] = old[1]
+		}
+		if err := config.Set(name, string(args[i+1])); err != nil {
+			rollback()
+			return protocol.MakeErrReply("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " + err.Error())
+		}
+		names = append(names, name)
+	}
+	// 部分配置修改后需要立即生效
+	if oldValues["appendonly"] == "no" && config.Properties.AppendOnly {
+		if err := s.enableAof(); err != nil {
+			rollback()
+			return protocol.MakeErrReply("ERR CONFIG SET failed (possibly related to argument 'appendonly') - " + err.Error())
+		}
+	} else if oldValues["appendonly"] == "yes" && !config.Properties.AppendOnly {
+		s.closeAof()
+	}
+	if _, ok := oldValues["loglevel"]; ok {
+		logger.SetLevel(config.Properties.LogLevel)
+	}
+	if _, ok := oldValues["requirepass"]; ok {
+		acl.SetDefaultPassword(config.Properties.Requirepass)
+	}
+	return protocol.MakeOkReply()
+}
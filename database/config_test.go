@@ -0,0 +1,72 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func Test_Config(t *testing.T) {
+	old := *config.Properties
+	t.Cleanup(func() {
+		*config.Properties = old
+	})
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"config get maxmem*", "*2\r\n$9\r\nmaxmemory\r\n$1\r\n0\r\n"},
+		{"config set timeout 10 maxmemory 1gb", "+OK\r\n"},
+		{"config get timeout maxmemory timeout", "*4\r\n$7\r\ntimeout\r\n$2\r\n10\r\n$9\r\nmaxmemory\r\n$10\r\n1073741824\r\n"},
+		// 有一个参数出错时所有参数都恢复为原来的值
+		{"config set timeout 20 loglevel nope", "-ERR CONFIG SET failed (possibly related to argument 'loglevel') - argument(s) must be one of the following: debug, info, warning, error\r\n"},
+		{"config get timeout", "*2\r\n$7\r\ntimeout\r\n$2\r\n10\r\n"},
+		{"config set timeout 5 TIMEOUT 6", "-ERR CONFIG SET failed - duplicate parameter 'timeout'\r\n"},
+		{"config set port 1", "-ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config 'port'\r\n"},
+		{"config set nosuch 1", "-ERR CONFIG SET failed (possibly related to argument 'nosuch') - unknown option 'nosuch'\r\n"},
+		{"config set timeout", string(protocol.MakeArgNumErrReply("config|set").ToBytes())},
+		{"config set maxmemory 0", "+OK\r\n"},
+		{"config rewrite", "-ERR Rewriting config file: the server is running without a config file\r\n"},
+		{"config nosuch", "-ERR unknown subcommand 'nosuch'. Try CONFIG HELP.\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+	if config.Properties.Timeout != 10 {
+		t.Errorf("config set err: timeout=%d", config.Properties.Timeout)
+	}
+}
+
+func Test_ConfigSetConcurrent(t *testing.T) {
+	setupAof(t)
+	s := reloadAof(t)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	// 修改配置与读取配置的命令、AOF写入协程并发执行，使用 -race 检查
+	go func() {
+		defer wg.Done()
+		conn := &fakeConn{}
+		for i := 0; i < 100; i++ {
+			exec(s, conn, "config set maxmemory 1gb appendfsync everysec loglevel error")
+			exec(s, conn, "config set maxmemory 0 appendfsync always loglevel warning")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		conn := &fakeConn{}
+		for i := 0; i < 100; i++ {
+			exec(s, conn, "set k "+strconv.Itoa(i))
+			exec(s, conn, "info memory persistence")
+		}
+	}()
+	wg.Wait()
+	if reply := exec(s, &fakeConn{}, "get k"); reply != "$2\r\n99\r\n" {
+		t.Errorf("get err: %q", reply)
+	}
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/bloom"
+	"github.com/jiangh156/godis/datastruct/cms"
+	Hash "github.com/jiangh156/godis/datastruct/hash"
+	"github.com/jiangh156/godis/datastruct/jsondoc"
+	List "github.com/jiangh156/godis/datastruct/list"
+	Set "github.com/jiangh156/godis/datastruct/set"
+	"github.com/jiangh156/godis/datastruct/sortedset"
+	"github.com/jiangh156/godis/datastruct/stream"
+	"github.com/jiangh156/godis/datastruct/timeseries"
+	"github.com/jiangh156/godis/datastruct/topk"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func copyBytes(b []byte) []byte {
+	result := make([]byte, len(b))
+	copy(result, b)
+	return result
+}
+
+// deepCopy 复制value，复制后与原value不共享任何可修改的数据
+func deepCopy(data any) (any, bool) {
+	switch val := data.(type) {
+	case []byte:
+		return copyBytes(val), true
+	case List.List:
+		list := List.Make()
+		val.ForEach(func(i int, v any) bool {
+			list.Add(copyBytes(v.([]byte)))
+			return true
+		})
+		return list, true
+	case *Hash.Hash:
+		hash := Hash.Make()
+		val.ForEach(func(field string, v []byte) bool {
+			hash.Put(field, copyBytes(v))
+			if expireTime, ok := val.ExpireTime(field); ok {
+				hash.Expire(field, expireTime)
+			}
+			return true
+		})
+		return hash, true
+	case *Set.Set:
+		set := Set.Make()
+		val.ForEach(func(member string) bool {
+			set.Add(member)
+			return true
+		})
+		return set, true
+	case *sortedset.SortedSet:
+		zSet := sortedset.Make()
+		val.ForEach(0, val.Len(), false, func(element *sortedset.Element) bool {
+			zSet.Add(element.Member, element.Score)
+			return true
+		})
+		return zSet, true
+	case *jsondoc.Document:
+		return &jsondoc.Document{Root: jsondoc.Clone(val.Root)}, true
+	case *bloom.Bloom:
+		raw, _ := val.MarshalBinary()
+		filter := &bloom.Bloom{}
+		if err := filter.UnmarshalBinary(raw); err != nil {
+			return nil, false
+		}
+		return filter, true
+	case *bloom.Cuckoo:
+		raw, _ := val.MarshalBinary()
+		filter := &bloom.Cuckoo{}
+		if err := filter.UnmarshalBinary(raw); err != nil {
+			return nil, false
+		}
+		return filter, true
+	case *stream.Stream:
+		return val.Clone(), true
+	case *cms.CountMinSketch:
+		return val.Clone(), true
+	case *topk.TopK:
+		return val.Clone(), true
+	case *timeseries.Series:
+		return val.Clone(), true
+	}
+	return nil, false
+}
+
+// parseDBIndex 解析数据库编号，返回对应的数据库
+func parseDBIndex(arg []byte) (*DB, redis.Reply) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if RedisServerInstance == nil || index < 0 || index >= len(RedisServerInstance.DBSet) {
+		return nil, protocol.MakeErrReply("ERR DB index is out of range")
+	}
+	return RedisServerInstance.DBSet[index], nil
+}
+
+// putWithTTL 写入目标数据库，并设置过期时间
+func (db *DB) putWithTTL(key string, entity *DataEntity, expireTime *time.Time) {
+	db.Put(key, entity)
+	db.Persist(key)
+	if expireTime != nil {
+		db.Expire(key, *expireTime)
+	}
+	if hash, ok := entity.Data.(*Hash.Hash); ok && hash.HasExpires() {
+		db.trackHashFieldTTL(key)
+	}
+	db.signalKey(key)
+}
+
+// ttlOf 返回key的过期时间，没有过期时间时返回nil
+func (db *DB) ttlOf(key string) *time.Time {
+	raw, ok := db.TTLMap.Get(key)
+	if !ok {
+		return nil
+	}
+	expireTime := raw.(time.Time)
+	return &expireTime
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func execCopy(db *DB, args [][]byte) redis.Reply {
+	srcKey, destKey := string(args[0]), string(args[1])
+	destDB := db
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "DB":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			var errReply redis.Reply
+			destDB, errReply = parseDBIndex(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			i++
+		case "REPLACE":
+			replace = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if destDB == db && srcKey == destKey {
+		return protocol.MakeErrReply("ERR source and destination objects are the same")
+	}
+	entity, exists := db.Get(srcKey)
+	if !exists || db.IsExpire(srcKey) {
+		return protocol.MakeIntReply(0)
+	}
+	if _, exists := destDB.Get(destKey); exists && !destDB.IsExpire(destKey) && !replace {
+		return protocol.MakeIntReply(0)
+	}
+	data, ok := deepCopy(entity.Data)
+	if !ok {
+		return protocol.MakeErrReply("ERR COPY is not supported for this data type")
+	}
+	destDB.putWithTTL(destKey, &DataEntity{Data: data}, db.ttlOf(srcKey))
+	aofReply := db.makeAofCmd("copy", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(1)
+}
+
+// MOVE key db
+func execMove(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	destDB, errReply := parseDBIndex(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if destDB == db {
+		return protocol.MakeErrReply("ERR source and destination objects are the same")
+	}
+	entity, exists := db.Get(key)
+	if !exists || db.IsExpire(key) {
+		return protocol.MakeIntReply(0)
+	}
+	if _, exists := destDB.Get(key); exists && !destDB.IsExpire(key) {
+		return protocol.MakeIntReply(0)
+	}
+	expireTime := db.ttlOf(key)
+	db.Remove(key)
+	db.Persist(key)
+	destDB.putWithTTL(key, entity, expireTime)
+	aofReply := db.makeAofCmd("move", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(1)
+}
+
+func init() {
+	RegisterCommand("Copy", execCopy, -3)
+	RegisterCommand("Move", execMove, 3)
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"testing"
+)
+
+func Test_CopyAllTypes(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	setup := []string{
+		"set str v",
+		"rpush list a b",
+		"hset hash f v",
+		"sadd set a b",
+		"zadd zset 1 a",
+		"xadd stream 1-1 f v",
+		"xgroup create stream g 0",
+		"xreadgroup group g c streams stream >",
+		"bf.add bf a",
+		"cf.add cf a",
+		"cms.initbydim cms 10 2",
+		"cms.incrby cms a 3",
+		"topk.reserve topk 2",
+		"topk.add topk a",
+		"json.set json $ {\"a\":1}",
+		"ts.add ts 1 1.5",
+	}
+	for _, line := range setup {
+		if reply := exec(s, conn, line); reply[0] == '-' {
+			t.Fatalf("%s err: %q", line, reply)
+		}
+	}
+	for _, key := range []string{"str", "list", "hash", "set", "zset", "stream", "bf", "cf", "cms", "topk", "json", "ts"} {
+		if reply := exec(s, conn, "copy "+key+" "+key+"2 db 1"); reply != ":1\r\n" {
+			t.Errorf("copy %s err: %q", key, reply)
+		}
+	}
+	// 修改原 key 不影响副本
+	modify := []string{
+		"xadd stream 2-1 f v",
+		"xack stream g 1-1",
+		"cms.incrby cms a 1",
+		"topk.add topk b",
+		"ts.add ts 2 2.5",
+	}
+	for _, line := range modify {
+		exec(s, conn, line)
+	}
+	db1 := &fakeConn{dbIndex: 1}
+	testCases := map[string]string{
+		"xlen stream2":       ":1\r\n",
+		"xpending stream2 g": "*4\r\n:1\r\n$3\r\n1-1\r\n$3\r\n1-1\r\n*1\r\n*2\r\n$1\r\nc\r\n$1\r\n1\r\n",
+		"cms.query cms2 a":   "*1\r\n:3\r\n",
+		"topk.list topk2":    "*1\r\n$1\r\na\r\n",
+		"ts.range ts2 - +":   "*1\r\n*2\r\n:1\r\n$3\r\n1.5\r\n",
+		"bf.exists bf2 a":    ":1\r\n",
+		"cf.exists cf2 a":    ":1\r\n",
+		"json.get json2 $.a": "$3\r\n[1]\r\n",
+		"type stream2":       "+stream\r\n",
+		"type ts2":           "+TSDB-TYPE\r\n",
+		"zrange zset2 0 -1":  "*1\r\n$1\r\na\r\n",
+		"hget hash2 f":       "$1\r\nv\r\n",
+		"lrange list2 0 -1":  "*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		"scard set2":         ":2\r\n",
+		"get str2":           "$1\r\nv\r\n",
+	}
+	for line, want := range testCases {
+		if reply := exec(s, db1, line); reply != want {
+			t.Errorf("%s err: %q, want: %q", line, reply, want)
+		}
+	}
+}
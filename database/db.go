@@ -4,9 +4,10 @@ import (
 	"github.com/jiangh156/godis/config"
 	"github.com/jiangh156/godis/datastruct/dict"
 	"github.com/jiangh156/godis/interface/redis"
-	"github.com/jiangh156/godis/lib/logger"
 	"github.com/jiangh156/godis/redis/protocol"
-	"os"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,32 +19,112 @@ type ExecFunc func(db *DB, args [][]byte) redis.Reply
 type CmdLine [][]byte
 type DataEntity struct {
 	Data any
+	// 最近一次访问的时间戳，单位毫秒
+	lastAccess int64
+	// 对数访问频率计数器，随空闲时间衰减
+	freq uint32
 }
+
+// LFU计数器的初始值，避免新写入的key马上被当作冷数据
+const lfuInitVal = 5
+
+// init 初始化访问元数据，已初始化的entity(如rename)保留原有的元数据
+func (entity *DataEntity) init() {
+	if entity == nil || atomic.LoadInt64(&entity.lastAccess) != 0 {
+		return
+	}
+	atomic.StoreUint32(&entity.freq, lfuInitVal)
+	atomic.StoreInt64(&entity.lastAccess, time.Now().UnixMilli())
+}
+
+// touch 记录一次访问，计数器为近似值，并发访问时允许丢失更新
+func (entity *DataEntity) touch() {
+	if entity == nil {
+		return
+	}
+	now := time.Now().UnixMilli()
+	counter := lfuLogIncr(entity.decayedFreq(now))
+	atomic.StoreUint32(&entity.freq, counter)
+	atomic.StoreInt64(&entity.lastAccess, now)
+}
+
+// IdleTime 返回空闲的秒数
+func (entity *DataEntity) IdleTime() int64 {
+	return (time.Now().UnixMilli() - atomic.LoadInt64(&entity.lastAccess)) / 1000
+}
+
+// Freq 返回衰减后的访问频率计数器
+func (entity *DataEntity) Freq() uint32 {
+	return entity.decayedFreq(time.Now().UnixMilli())
+}
+
+// setIdleTime 按空闲秒数回推访问时间，用于RESTORE IDLETIME
+func (entity *DataEntity) setIdleTime(seconds int64) {
+	atomic.StoreInt64(&entity.lastAccess, time.Now().UnixMilli()-seconds*1000)
+}
+
+// setFreq 设置访问频率计数器，用于RESTORE FREQ
+func (entity *DataEntity) setFreq(freq uint32) {
+	atomic.StoreUint32(&entity.freq, freq)
+}
+
+// decayedFreq 每经过lfu-decay-time分钟计数器减1
+func (entity *DataEntity) decayedFreq(now int64) uint32 {
+	counter := atomic.LoadUint32(&entity.freq)
+	decayTime := int64(config.Properties.LfuDecayTime)
+	if decayTime <= 0 {
+		return counter
+	}
+	periods := (now - atomic.LoadInt64(&entity.lastAccess)) / (decayTime * int64(time.Minute/time.Millisecond))
+	if periods >= int64(counter) {
+		return 0
+	}
+	return counter - uint32(periods)
+}
+
+// lfuLogIncr 计数器越大增长的概率越低，最大为255
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= 255 {
+		return 255
+	}
+	baseVal := 0.0
+	if counter > lfuInitVal {
+		baseVal = float64(counter - lfuInitVal)
+	}
+	p := 1.0 / (baseVal*float64(config.Properties.LfuLogFactor) + 1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
+
 type DB struct {
-	index  int
+	index int
+	// 同一个数据库上的命令串行执行，值的数据结构本身不是并发安全的
+	mu     sync.Mutex
 	Data   dict.Dict
 	TTLMap dict.Dict
+	// 含有字段级过期时间的哈希key
+	hashTTLKeys dict.Dict
+	// 阻塞命令正在等待的key
+	blockingMu   sync.Mutex
+	blockingKeys map[string]map[chan struct{}]struct{}
 
-	aofChan     chan *protocol.MultiBulkReply
-	aofFile     *os.File
-	aofFilename string
+	// 所有数据库共用服务器的AOF写入队列，未开启AOF时为nil
+	aofChan chan *aofPayload
+	// 关闭后停止后台的定期清理
+	closed chan struct{}
 }
 
 func MakeDB() *DB {
 	db := &DB{
-		Data:   dict.MakeSyncDict(),
-		TTLMap: dict.MakeSyncDict(),
-	}
-	if config.Properties.AppendOnly {
-		aofFile, err := os.OpenFile(config.Properties.AppendFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
-		if err != nil {
-			logger.Warn(err.Error())
-		} else {
-			db.aofFile = aofFile
-			db.aofChan = make(chan *protocol.MultiBulkReply, aofQueueSize)
-		}
-		go db.handleAof()
+		Data:         dict.MakeSyncDict(),
+		TTLMap:       dict.MakeSyncDict(),
+		hashTTLKeys:  dict.MakeSyncDict(),
+		blockingKeys: make(map[string]map[chan struct{}]struct{}),
+		closed:       make(chan struct{}),
 	}
+	go db.activeExpireHashFields()
 	return db
 }
 func (db *DB) Expire(key string, expireTime time.Time) {
@@ -87,6 +168,13 @@ func (db *DB) CleanExpire() {
 }
 
 func (db *DB) Close() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	select {
+	case <-db.closed:
+	default:
+		close(db.closed)
+	}
 	db.Data.Clear()
 }
 
@@ -122,6 +210,17 @@ func validateCommand(c *command, cmdLine CmdLine) bool {
 }
 
 func (db *DB) Get(key string) (entity *DataEntity, exists bool) {
+	raw, exists := db.Data.Get(key)
+	if !exists {
+		return nil, false
+	}
+	entity, _ = raw.(*DataEntity)
+	entity.touch()
+	return entity, true
+}
+
+// peek 获取entity但不更新访问元数据，用于OBJECT等内省命令
+func (db *DB) peek(key string) (entity *DataEntity, exists bool) {
 	raw, exists := db.Data.Get(key)
 	if !exists {
 		return nil, false
@@ -130,14 +229,17 @@ func (db *DB) Get(key string) (entity *DataEntity, exists bool) {
 	return entity, true
 }
 func (db *DB) Put(key string, val *DataEntity) (result int) {
+	val.init()
 	result = db.Data.Put(key, val)
 	return result
 }
 func (db *DB) PutIfExists(key string, val *DataEntity) (result int) {
+	val.init()
 	result = db.Data.PutIfExists(key, val)
 	return result
 }
 func (db *DB) PutIfAbsent(key string, val *DataEntity) (result int) {
+	val.init()
 	result = db.Data.PutIfAbsent(key, val)
 	return result
 }
@@ -162,4 +264,5 @@ func (db *DB) Removes(keys ...string) (result int) {
 func (db *DB) Flush() {
 	db.Data.Clear()
 	db.TTLMap.Clear()
+	db.hashTTLKeys.Clear()
 }
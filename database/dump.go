@@ -0,0 +1,869 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/jiangh156/godis/datastruct/bloom"
+	"github.com/jiangh156/godis/datastruct/cms"
+	Hash "github.com/jiangh156/godis/datastruct/hash"
+	"github.com/jiangh156/godis/datastruct/jsondoc"
+	List "github.com/jiangh156/godis/datastruct/list"
+	Set "github.com/jiangh156/godis/datastruct/set"
+	"github.com/jiangh156/godis/datastruct/sortedset"
+	"github.com/jiangh156/godis/datastruct/stream"
+	"github.com/jiangh156/godis/datastruct/timeseries"
+	"github.com/jiangh156/godis/datastruct/topk"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/lib/rdb"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errDumpNotSupported = errors.New("ERR DUMP is not supported for this data type")
+
+// 扩展数据类型以模块类型序列化，类型名与 TYPE 命令的结果相同
+const (
+	moduleBloom      = "MBbloom--"
+	moduleCuckoo     = "MBbloomCF"
+	moduleCMS        = "CMSk-TYPE"
+	moduleTopK       = "TopK-TYPE"
+	moduleJSON       = "ReJSON-RL"
+	moduleTimeSeries = "TSDB-TYPE"
+)
+
+// dumpValue 序列化value，只使用各版本 Redis 都能读取的编码
+func dumpValue(data any) ([]byte, error) {
+	e := rdb.MakeEncoder()
+	switch val := data.(type) {
+	case []byte:
+		e.WriteType(rdb.TypeString)
+		e.WriteString(val)
+	case List.List:
+		e.WriteType(rdb.TypeList)
+		e.WriteLength(uint64(val.Len()))
+		val.ForEach(func(i int, v any) bool {
+			e.WriteString(v.([]byte))
+			return true
+		})
+	case *Set.Set:
+		members := val.ToSlice()
+		e.WriteType(rdb.TypeSet)
+		e.WriteLength(uint64(len(members)))
+		for _, member := range members {
+			e.WriteString([]byte(member))
+		}
+	case *sortedset.SortedSet:
+		e.WriteType(rdb.TypeZSet2)
+		e.WriteLength(uint64(val.Len()))
+		val.ForEach(0, val.Len(), false, func(element *sortedset.Element) bool {
+			e.WriteString([]byte(element.Member))
+			e.WriteDouble(element.Score)
+			return true
+		})
+	case *Hash.Hash:
+		dumpHash(e, val)
+	case *stream.Stream:
+		dumpStream(e, val)
+	case *bloom.Bloom:
+		raw, _ := val.MarshalBinary()
+		e.WriteModule(moduleBloom, raw)
+	case *bloom.Cuckoo:
+		raw, _ := val.MarshalBinary()
+		e.WriteModule(moduleCuckoo, raw)
+	case *cms.CountMinSketch:
+		raw, _ := val.MarshalBinary()
+		e.WriteModule(moduleCMS, raw)
+	case *topk.TopK:
+		raw, _ := val.MarshalBinary()
+		e.WriteModule(moduleTopK, raw)
+	case *jsondoc.Document:
+		e.WriteModule(moduleJSON, jsondoc.Marshal(val.Root))
+	case *timeseries.Series:
+		raw, _ := val.MarshalBinary()
+		e.WriteModule(moduleTimeSeries, raw)
+	default:
+		return nil, errDumpNotSupported
+	}
+	return e.Payload(), nil
+}
+
+// dumpHash 含有字段过期时间时，记录最小的过期时间和每个字段相对它的偏移
+func dumpHash(e *rdb.Encoder, hash *Hash.Hash) {
+	fields := make([]string, 0, hash.Len())
+	values := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, val []byte) bool {
+		fields = append(fields, field)
+		values = append(values, val)
+		return true
+	})
+	if !hash.HasExpires() {
+		e.WriteType(rdb.TypeHash)
+		e.WriteLength(uint64(len(fields)))
+		for i, field := range fields {
+			e.WriteString([]byte(field))
+			e.WriteString(values[i])
+		}
+		return
+	}
+	expires := make([]int64, len(fields))
+	var minExpire int64
+	for i, field := range fields {
+		if expireTime, ok := hash.ExpireTime(field); ok {
+			expires[i] = expireTime.UnixMilli()
+			if minExpire == 0 || expires[i] < minExpire {
+				minExpire = expires[i]
+			}
+		}
+	}
+	e.WriteType(rdb.TypeHashMetadata)
+	e.WriteMillis(minExpire)
+	e.WriteLength(uint64(len(fields)))
+	for i, field := range fields {
+		if expires[i] == 0 {
+			e.WriteLength(0)
+		} else {
+			e.WriteLength(uint64(expires[i] - minExpire + 1))
+		}
+		e.WriteString([]byte(field))
+		e.WriteString(values[i])
+	}
+}
+
+func readStrings(d *rdb.Decoder, n uint64) ([][]byte, error) {
+	result := make([][]byte, 0)
+	for i := uint64(0); i < n; i++ {
+		s, err := d.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// readPacked 读取ziplist/listpack/intset编码的元素
+func readPacked(d *rdb.Decoder, parse func([]byte) ([][]byte, error)) ([][]byte, error) {
+	raw, err := d.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	return parse(raw)
+}
+
+// restoreValue 反序列化value，支持 Redis 7 之前的 ziplist 和之后的 listpack 编码
+func restoreValue(payload []byte) (any, error) {
+	d, err := rdb.MakeDecoder(payload)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := d.ReadType()
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	switch typ {
+	case rdb.TypeString:
+		result, err = d.ReadString()
+	case rdb.TypeList, rdb.TypeListZiplist, rdb.TypeListQuicklist, rdb.TypeListQuicklist2:
+		result, err = restoreList(d, typ)
+	case rdb.TypeSet, rdb.TypeSetIntset, rdb.TypeSetListpack:
+		result, err = restoreSet(d, typ)
+	case rdb.TypeZSet, rdb.TypeZSet2, rdb.TypeZSetZiplist, rdb.TypeZSetListpack:
+		result, err = restoreSortedSet(d, typ)
+	case rdb.TypeHash, rdb.TypeHashZiplist, rdb.TypeHashListpack, rdb.TypeHashMetadata:
+		result, err = restoreHash(d, typ)
+	case rdb.TypeStreamListpacks, rdb.TypeStreamListpacks2, rdb.TypeStreamListpacks3:
+		result, err = restoreStream(d, typ)
+	case rdb.TypeModule2:
+		result, err = restoreModule(d)
+	default:
+		return nil, rdb.ErrBadFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !d.Done() {
+		return nil, rdb.ErrBadFormat
+	}
+	return result, nil
+}
+
+func restoreList(d *rdb.Decoder, typ byte) (List.List, error) {
+	var elements [][]byte
+	switch typ {
+	case rdb.TypeListZiplist:
+		entries, err := readPacked(d, rdb.ParseZiplist)
+		if err != nil {
+			return nil, err
+		}
+		elements = entries
+	case rdb.TypeList, rdb.TypeListQuicklist, rdb.TypeListQuicklist2:
+		n, err := d.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < n; i++ {
+			var entries [][]byte
+			switch typ {
+			case rdb.TypeList:
+				entries, err = readStrings(d, 1)
+			case rdb.TypeListQuicklist:
+				entries, err = readPacked(d, rdb.ParseZiplist)
+			default:
+				// quicklist2 的节点可能是单个大元素或 listpack
+				container, lenErr := d.ReadLength()
+				if lenErr != nil {
+					return nil, lenErr
+				}
+				if container == rdb.QuicklistNodePlain {
+					entries, err = readStrings(d, 1)
+				} else {
+					entries, err = readPacked(d, rdb.ParseListpack)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, entries...)
+		}
+	}
+	list := List.Make()
+	for _, element := range elements {
+		list.Add(element)
+	}
+	return list, nil
+}
+
+func restoreSet(d *rdb.Decoder, typ byte) (*Set.Set, error) {
+	var members [][]byte
+	var err error
+	switch typ {
+	case rdb.TypeSetIntset:
+		members, err = readPacked(d, rdb.ParseIntset)
+	case rdb.TypeSetListpack:
+		members, err = readPacked(d, rdb.ParseListpack)
+	default:
+		var n uint64
+		if n, err = d.ReadLength(); err == nil {
+			members, err = readStrings(d, n)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	set := Set.Make()
+	for _, member := range members {
+		set.Add(string(member))
+	}
+	return set, nil
+}
+
+func restoreSortedSet(d *rdb.Decoder, typ byte) (*sortedset.SortedSet, error) {
+	zSet := sortedset.Make()
+	if typ == rdb.TypeZSetZiplist || typ == rdb.TypeZSetListpack {
+		parse := rdb.ParseListpack
+		if typ == rdb.TypeZSetZiplist {
+			parse = rdb.ParseZiplist
+		}
+		entries, err := readPacked(d, parse)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries)%2 != 0 {
+			return nil, rdb.ErrBadFormat
+		}
+		for i := 0; i < len(entries); i += 2 {
+			score, err := strconv.ParseFloat(string(entries[i+1]), 64)
+			if err != nil {
+				return nil, rdb.ErrBadFormat
+			}
+			zSet.Add(string(entries[i]), score)
+		}
+		return zSet, nil
+	}
+	n, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		member, err := d.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if typ == rdb.TypeZSet2 {
+			score, err = d.ReadDouble()
+		} else {
+			score, err = d.ReadStringDouble()
+		}
+		if err != nil {
+			return nil, err
+		}
+		zSet.Add(string(member), score)
+	}
+	return zSet, nil
+}
+
+func restoreHash(d *rdb.Decoder, typ byte) (*Hash.Hash, error) {
+	hash := Hash.Make()
+	if typ == rdb.TypeHashZiplist || typ == rdb.TypeHashListpack {
+		parse := rdb.ParseListpack
+		if typ == rdb.TypeHashZiplist {
+			parse = rdb.ParseZiplist
+		}
+		entries, err := readPacked(d, parse)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries)%2 != 0 {
+			return nil, rdb.ErrBadFormat
+		}
+		for i := 0; i < len(entries); i += 2 {
+			hash.Put(string(entries[i]), entries[i+1])
+		}
+		return hash, nil
+	}
+	var minExpire int64
+	if typ == rdb.TypeHashMetadata {
+		var err error
+		if minExpire, err = d.ReadMillis(); err != nil {
+			return nil, err
+		}
+	}
+	n, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		var expire uint64
+		if typ == rdb.TypeHashMetadata {
+			if expire, err = d.ReadLength(); err != nil {
+				return nil, err
+			}
+		}
+		pair, err := readStrings(d, 2)
+		if err != nil {
+			return nil, err
+		}
+		field := string(pair[0])
+		hash.Put(field, pair[1])
+		if expire != 0 {
+			hash.Expire(field, time.UnixMilli(minExpire+int64(expire)-1))
+		}
+	}
+	return hash, nil
+}
+
+/*
+ * stream 的编码与 Redis 7.2 相同:
+ * 消息按 ID 分成若干个 listpack 节点，节点的 key 为第一条消息的 ID(主ID)，
+ * 节点中依次为 count, deleted, 主字段数, 主字段..., 0，之后每条消息为
+ * flags, ms 差值, seq 差值, [字段数, 字段, 值...] 或 [值...], lp-count
+ */
+
+const (
+	// 每个 listpack 节点的消息数，与 Redis 的 stream-node-max-entries 默认值相同
+	streamNodeEntries = 100
+
+	streamItemDeleted    = 1
+	streamItemSameFields = 2
+)
+
+// encodeStreamID 16 字节大端，与 Redis 的 streamEncodeID 相同
+func encodeStreamID(id stream.ID) []byte {
+	b := binary.BigEndian.AppendUint64(nil, id.Ms)
+	return binary.BigEndian.AppendUint64(b, id.Seq)
+}
+
+func decodeStreamID(b []byte) (stream.ID, error) {
+	if len(b) != 16 {
+		return stream.ID{}, rdb.ErrBadFormat
+	}
+	return stream.ID{Ms: binary.BigEndian.Uint64(b), Seq: binary.BigEndian.Uint64(b[8:])}, nil
+}
+
+func writeStreamID(e *rdb.Encoder, id stream.ID) {
+	e.WriteLength(id.Ms)
+	e.WriteLength(id.Seq)
+}
+
+func readStreamID(d *rdb.Decoder) (stream.ID, error) {
+	ms, err := d.ReadLength()
+	if err != nil {
+		return stream.ID{}, err
+	}
+	seq, err := d.ReadLength()
+	if err != nil {
+		return stream.ID{}, err
+	}
+	return stream.ID{Ms: ms, Seq: seq}, nil
+}
+
+// streamNodeElements 返回一个节点中 listpack 的元素，字段与第一条消息相同的消息只保存值
+func streamNodeElements(entries []*stream.Entry) [][]byte {
+	itoa := func(v uint64) []byte {
+		return []byte(strconv.FormatUint(v, 10))
+	}
+	master := entries[0]
+	masterFields := make([]string, 0, len(master.Fields)/2)
+	for i := 0; i < len(master.Fields); i += 2 {
+		masterFields = append(masterFields, master.Fields[i])
+	}
+	elements := [][]byte{itoa(uint64(len(entries))), itoa(0), itoa(uint64(len(masterFields)))}
+	for _, field := range masterFields {
+		elements = append(elements, []byte(field))
+	}
+	elements = append(elements, itoa(0))
+	for _, entry := range entries {
+		sameFields := len(entry.Fields) == len(master.Fields)
+		for i := 0; sameFields && i < len(entry.Fields); i += 2 {
+			sameFields = entry.Fields[i] == master.Fields[i]
+		}
+		flags := 0
+		if sameFields {
+			flags = streamItemSameFields
+		}
+		// 差值按 int64 保存，seq 的差值可能为负数
+		elements = append(elements, itoa(uint64(flags)),
+			[]byte(strconv.FormatInt(int64(entry.ID.Ms-master.ID.Ms), 10)),
+			[]byte(strconv.FormatInt(int64(entry.ID.Seq-master.ID.Seq), 10)))
+		count := len(entry.Fields)/2 + 3
+		if sameFields {
+			for i := 1; i < len(entry.Fields); i += 2 {
+				elements = append(elements, []byte(entry.Fields[i]))
+			}
+		} else {
+			elements = append(elements, itoa(uint64(len(entry.Fields)/2)))
+			for _, f := range entry.Fields {
+				elements = append(elements, []byte(f))
+			}
+			count += len(entry.Fields)/2 + 1
+		}
+		elements = append(elements, itoa(uint64(count)))
+	}
+	return elements
+}
+
+// entriesRead 估计消费者组已经读取的消息数，只用于 Redis 计算 lag，无法确定时返回 0
+func entriesRead(s *stream.Stream, group *stream.Group) int64 {
+	if !group.LastID.Less(s.LastID()) {
+		return s.EntriesAdded()
+	}
+	if s.MaxDeletedID() != stream.MinID {
+		return 0
+	}
+	var n int64
+	s.ForEach(stream.MinID, group.LastID, false, func(entry *stream.Entry) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func dumpStream(e *rdb.Encoder, s *stream.Stream) {
+	entries := s.Range(stream.MinID, stream.MaxID, 0, false)
+	e.WriteType(rdb.TypeStreamListpacks3)
+	e.WriteLength(uint64((len(entries) + streamNodeEntries - 1) / streamNodeEntries))
+	for i := 0; i < len(entries); i += streamNodeEntries {
+		end := i + streamNodeEntries
+		if end > len(entries) {
+			end = len(entries)
+		}
+		e.WriteString(encodeStreamID(entries[i].ID))
+		e.WriteString(rdb.MakeListpack(streamNodeElements(entries[i:end])))
+	}
+	e.WriteLength(uint64(s.Len()))
+	writeStreamID(e, s.LastID())
+	firstID := stream.MinID
+	if len(entries) > 0 {
+		firstID = entries[0].ID
+	}
+	writeStreamID(e, firstID)
+	writeStreamID(e, s.MaxDeletedID())
+	e.WriteLength(uint64(s.EntriesAdded()))
+
+	names := s.GroupNames()
+	e.WriteLength(uint64(len(names)))
+	for _, name := range names {
+		group, _ := s.GetGroup(name)
+		e.WriteString([]byte(name))
+		writeStreamID(e, group.LastID)
+		e.WriteLength(uint64(entriesRead(s, group)))
+		// 消费者组的待确认列表，之后每个消费者只保存自己的待确认消息ID
+		consumerPending := make(map[string][]stream.ID)
+		e.WriteLength(uint64(group.PendingLen()))
+		group.ForEachPending(stream.MinID, func(pe *stream.PendingEntry) bool {
+			e.WriteRaw(encodeStreamID(pe.ID))
+			e.WriteMillis(pe.DeliveryTime.UnixMilli())
+			e.WriteLength(uint64(pe.DeliveryCount))
+			consumerPending[pe.Consumer] = append(consumerPending[pe.Consumer], pe.ID)
+			return true
+		})
+		consumers := group.ConsumerNames()
+		e.WriteLength(uint64(len(consumers)))
+		for _, consumerName := range consumers {
+			consumer, _ := group.GetConsumer(consumerName)
+			e.WriteString([]byte(consumerName))
+			e.WriteMillis(consumer.SeenTime.UnixMilli())
+			e.WriteMillis(consumer.SeenTime.UnixMilli())
+			e.WriteLength(uint64(len(consumerPending[consumerName])))
+			for _, id := range consumerPending[consumerName] {
+				e.WriteRaw(encodeStreamID(id))
+			}
+		}
+	}
+}
+
+// parseStreamNode 解析一个 listpack 节点，跳过标记为删除的消息
+func parseStreamNode(master stream.ID, elements [][]byte) ([]*stream.Entry, error) {
+	pos := 0
+	var err error
+	next := func() []byte {
+		if pos >= len(elements) {
+			err = rdb.ErrBadFormat
+			return nil
+		}
+		pos++
+		return elements[pos-1]
+	}
+	// 整数按 int64 读取，负数的差值转换为 uint64 后相加得到正确的结果
+	nextInt := func() uint64 {
+		v, parseErr := strconv.ParseInt(string(next()), 10, 64)
+		if parseErr != nil && err == nil {
+			err = rdb.ErrBadFormat
+		}
+		return uint64(v)
+	}
+	nextInt() // count
+	nextInt() // deleted
+	n := nextInt()
+	if err != nil || n > uint64(len(elements)) {
+		return nil, rdb.ErrBadFormat
+	}
+	masterFields := make([]string, n)
+	for i := range masterFields {
+		masterFields[i] = string(next())
+	}
+	if nextInt() != 0 || err != nil {
+		return nil, rdb.ErrBadFormat
+	}
+	entries := make([]*stream.Entry, 0)
+	for pos < len(elements) && err == nil {
+		flags := nextInt()
+		id := stream.ID{Ms: master.Ms + nextInt(), Seq: master.Seq + nextInt()}
+		var fields []string
+		if flags&streamItemSameFields != 0 {
+			fields = make([]string, 0, len(masterFields)*2)
+			for _, field := range masterFields {
+				fields = append(fields, field, string(next()))
+			}
+		} else {
+			n = nextInt()
+			if n > uint64(len(elements)) {
+				return nil, rdb.ErrBadFormat
+			}
+			fields = make([]string, 0, n*2)
+			for i := uint64(0); i < n*2; i++ {
+				fields = append(fields, string(next()))
+			}
+		}
+		nextInt() // lp-count
+		if flags&streamItemDeleted == 0 {
+			entries = append(entries, &stream.Entry{ID: id, Fields: fields})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// restoreStream 支持 Redis 5.0 之后的所有 stream 编码
+func restoreStream(d *rdb.Decoder, typ byte) (*stream.Stream, error) {
+	s := stream.Make()
+	nodes, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		key, err := d.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		master, err := decodeStreamID(key)
+		if err != nil {
+			return nil, err
+		}
+		elements, err := readPacked(d, rdb.ParseListpack)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseStreamNode(master, elements)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if s.Add(entry.ID, entry.Fields) != nil {
+				return nil, rdb.ErrBadFormat
+			}
+		}
+	}
+	length, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	lastID, err := readStreamID(d)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(s.Len()) != length || !s.SetLastID(lastID) {
+		return nil, rdb.ErrBadFormat
+	}
+	if typ >= rdb.TypeStreamListpacks2 {
+		if _, err := readStreamID(d); err != nil { // first id 可以由消息得到
+			return nil, err
+		}
+		maxDeletedID, err := readStreamID(d)
+		if err != nil {
+			return nil, err
+		}
+		entriesAdded, err := d.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		s.SetMaxDeletedID(maxDeletedID)
+		s.SetEntriesAdded(int64(entriesAdded))
+	}
+
+	groups, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		name, err := d.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		groupLastID, err := readStreamID(d)
+		if err != nil {
+			return nil, err
+		}
+		if typ >= rdb.TypeStreamListpacks2 {
+			if _, err := d.ReadLength(); err != nil { // entries read
+				return nil, err
+			}
+		}
+		group, ok := s.CreateGroup(string(name), groupLastID)
+		if !ok {
+			return nil, rdb.ErrBadFormat
+		}
+		pendingCount, err := d.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		pending := make(map[stream.ID]*stream.PendingEntry)
+		for j := uint64(0); j < pendingCount; j++ {
+			raw, err := d.ReadRaw(16)
+			if err != nil {
+				return nil, err
+			}
+			id, _ := decodeStreamID(raw)
+			deliveryTime, err := d.ReadMillis()
+			if err != nil {
+				return nil, err
+			}
+			deliveryCount, err := d.ReadLength()
+			if err != nil {
+				return nil, err
+			}
+			pending[id] = &stream.PendingEntry{
+				ID:            id,
+				DeliveryTime:  time.UnixMilli(deliveryTime),
+				DeliveryCount: int64(deliveryCount),
+			}
+		}
+		consumers, err := d.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < consumers; j++ {
+			consumerName, err := d.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			seenTime, err := d.ReadMillis()
+			if err != nil {
+				return nil, err
+			}
+			if typ >= rdb.TypeStreamListpacks3 {
+				if _, err := d.ReadMillis(); err != nil { // active time
+					return nil, err
+				}
+			}
+			if _, ok := group.CreateConsumer(string(consumerName), time.UnixMilli(seenTime)); !ok {
+				return nil, rdb.ErrBadFormat
+			}
+			n, err := d.ReadLength()
+			if err != nil {
+				return nil, err
+			}
+			for k := uint64(0); k < n; k++ {
+				raw, err := d.ReadRaw(16)
+				if err != nil {
+					return nil, err
+				}
+				id, _ := decodeStreamID(raw)
+				pe, ok := pending[id]
+				if !ok || pe.Consumer != "" {
+					return nil, rdb.ErrBadFormat
+				}
+				pe.Consumer = string(consumerName)
+				group.SetPending(pe)
+			}
+		}
+		// 与 Redis 相同，每条待确认消息都必须属于一个消费者
+		if group.PendingLen() != int64(len(pending)) {
+			return nil, rdb.ErrBadFormat
+		}
+	}
+	return s, nil
+}
+
+// DUMP key
+func execDump(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	entity, exists := db.Get(key)
+	if !exists || db.IsExpire(key) {
+		return protocol.MakeNullBulkReply()
+	}
+	payload, err := dumpValue(entity.Data)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	return protocol.MakeBulkReply(payload)
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func execRestore(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return protocol.MakeErrReply("ERR Invalid TTL value, must be >= 0")
+	}
+	var replace, absTTL bool
+	idleTime, freq := int64(-1), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME":
+			if i+1 >= len(args) || freq >= 0 {
+				return protocol.MakeSyntaxErrReply()
+			}
+			idleTime, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || idleTime < 0 {
+				return protocol.MakeErrReply("ERR Invalid IDLETIME value, must be >= 0")
+			}
+			i++
+		case "FREQ":
+			if i+1 >= len(args) || idleTime >= 0 {
+				return protocol.MakeSyntaxErrReply()
+			}
+			freq, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || freq < 0 || freq > 255 {
+				return protocol.MakeErrReply("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			i++
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if _, exists := db.Get(key); exists && !db.IsExpire(key) && !replace {
+		return protocol.MakeErrReply("BUSYKEY Target key name already exists.")
+	}
+	data, err := restoreValue(args[2])
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	var expireTime *time.Time
+	if ttl > 0 {
+		t := time.UnixMilli(ttl)
+		if !absTTL {
+			t = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		expireTime = &t
+	}
+	// 已经过期的value直接丢弃
+	if expireTime != nil && !expireTime.After(time.Now()) {
+		db.Remove(key)
+		db.Persist(key)
+	} else {
+		entity := &DataEntity{Data: data}
+		db.putWithTTL(key, entity, expireTime)
+		if idleTime >= 0 {
+			entity.setIdleTime(idleTime)
+		}
+		if freq >= 0 {
+			entity.setFreq(uint32(freq))
+		}
+	}
+	// 相对过期时间转换为绝对时间，保证重放结果一致
+	aofArgs := make([][]byte, len(args))
+	copy(aofArgs, args)
+	if expireTime != nil {
+		aofArgs[1] = []byte(strconv.FormatInt(expireTime.UnixMilli(), 10))
+		if !absTTL {
+			aofArgs = append(aofArgs, []byte("ABSTTL"))
+		}
+	}
+	aofReply := db.makeAofCmd("restore", aofArgs)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("Dump", execDump, 2)
+	RegisterCommand("Restore", execRestore, -4)
+}
+
+// restoreModule 只能读取 godis 序列化的扩展数据类型
+func restoreModule(d *rdb.Decoder) (any, error) {
+	name, data, err := d.ReadModule()
+	if err != nil {
+		return nil, err
+	}
+	var value interface {
+		UnmarshalBinary(data []byte) error
+	}
+	switch name {
+	case moduleBloom:
+		value = &bloom.Bloom{}
+	case moduleCuckoo:
+		value = &bloom.Cuckoo{}
+	case moduleCMS:
+		value = &cms.CountMinSketch{}
+	case moduleTopK:
+		value = &topk.TopK{}
+	case moduleTimeSeries:
+		value = &timeseries.Series{}
+	case moduleJSON:
+		root, err := jsondoc.Parse(data)
+		if err != nil {
+			return nil, rdb.ErrBadFormat
+		}
+		return &jsondoc.Document{Root: root}, nil
+	default:
+		return nil, rdb.ErrBadFormat
+	}
+	if err := value.UnmarshalBinary(data); err != nil {
+		return nil, rdb.ErrBadFormat
+	}
+	return value, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// dumpAndRestore 将 src DUMP 后 RESTORE 到 dest
+func dumpAndRestore(t *testing.T, s *SingleServer, src string, dest string) {
+	t.Helper()
+	conn := &fakeConn{}
+	reply, ok := execArgs(s, conn, "dump", src).(*protocol.BulkReply)
+	if !ok {
+		t.Fatalf("dump %s err: %q", src, execArgs(s, conn, "dump", src).ToBytes())
+	}
+	if reply := execArgs(s, conn, "restore", dest, "0", string(reply.Arg)); string(reply.ToBytes()) != "+OK\r\n" {
+		t.Fatalf("restore %s err: %q", dest, reply.ToBytes())
+	}
+}
+
+func Test_DumpModules(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	setup := []string{
+		"bf.reserve bf 0.01 100",
+		"bf.add bf a",
+		"cf.add cf a",
+		"cms.initbydim cms 10 2",
+		"cms.incrby cms a 3",
+		"topk.reserve topk 2",
+		"topk.add topk a b a",
+		"json.set json $ {\"a\":[1,\"x\"]}",
+		"ts.create ts labels area east",
+		"ts.create ts_avg",
+		"ts.createrule ts ts_avg aggregation avg 10",
+		"ts.add ts 1 1.5",
+	}
+	for _, line := range setup {
+		if reply := exec(s, conn, line); reply[0] == '-' {
+			t.Fatalf("%s err: %q", line, reply)
+		}
+	}
+	for _, key := range []string{"bf", "cf", "cms", "topk", "json", "ts"} {
+		dumpAndRestore(t, s, key, key+"2")
+	}
+	testCases := map[string]string{
+		"type bf2":         "+MBbloom--\r\n",
+		"bf.exists bf2 a":  ":1\r\n",
+		"bf.exists bf2 b":  ":0\r\n",
+		"type cf2":         "+MBbloomCF\r\n",
+		"cf.exists cf2 a":  ":1\r\n",
+		"cf.exists cf2 b":  ":0\r\n",
+		"cms.query cms2 a": "*1\r\n:3\r\n",
+		"topk.list topk2":  "*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		"json.get json2 $": "$15\r\n[{\"a\":[1,\"x\"]}]\r\n",
+		"ts.range ts2 - +": "*1\r\n*2\r\n:1\r\n$3\r\n1.5\r\n",
+	}
+	for line, want := range testCases {
+		if reply := exec(s, conn, line); reply != want {
+			t.Errorf("%s err: %q, want: %q", line, reply, want)
+		}
+	}
+	// 压缩规则也被还原，时间桶关闭后写入目标序列
+	exec(s, conn, "ts.add ts2 20 2")
+	if reply := exec(s, conn, "ts.range ts_avg - +"); reply != "*1\r\n*2\r\n:0\r\n$3\r\n1.5\r\n" {
+		t.Errorf("restore rules err: %q", reply)
+	}
+	// 其他模块的类型不能读取
+	if reply := execArgs(s, conn, "restore", "x", "0", "\x07\x81\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0b\x00"); !protocol.IsErrorReply(reply) {
+		t.Errorf("restore should reject bad payload")
+	}
+}
+
+func Test_DumpStream(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	// 超过一个节点的消息数，字段不同的消息，以及 seq 比主ID小的消息
+	for i := 1; i <= 150; i++ {
+		exec(s, conn, "xadd st "+strconv.Itoa(i)+"-"+strconv.Itoa(200-i)+" f "+strconv.Itoa(i))
+	}
+	setup := []string{
+		"xadd st 151-0 a 1 b x",
+		"xdel st 3-197",
+		"xgroup create st g1 0",
+		"xgroup create st g2 $",
+		"xreadgroup group g1 alice count 2 streams st >",
+		"xreadgroup group g1 bob count 1 streams st >",
+		"xack st g1 1-199",
+	}
+	for _, line := range setup {
+		if reply := exec(s, conn, line); reply[0] == '-' {
+			t.Fatalf("%s err: %q", line, reply)
+		}
+	}
+	dumpAndRestore(t, s, "st", "st2")
+	for _, cmd := range []string{"xlen %s", "xrange %s - +", "xpending %s g1", "xpending %s g1 - + 10", "xpending %s g2"} {
+		want := exec(s, conn, strings.ReplaceAll(cmd, "%s", "st"))
+		if reply := exec(s, conn, strings.ReplaceAll(cmd, "%s", "st2")); reply != want {
+			t.Errorf("%s err: %q, want: %q", cmd, reply, want)
+		}
+	}
+	// 最后的ID也被还原
+	if reply := exec(s, conn, "xadd st2 151-0 f v"); reply[0] != '-' {
+		t.Errorf("restore last id err: %q", reply)
+	}
+	exec(s, conn, "xtrim st maxlen 0")
+	dumpAndRestore(t, s, "st", "st3")
+	if reply := exec(s, conn, "xlen st3"); reply != ":0\r\n" {
+		t.Errorf("restore empty stream err: %q", reply)
+	}
+}
@@ -0,0 +1,473 @@
+package database
+
+import (
+	"fmt"
+	"github.com/jiangh156/godis/datastruct/sortedset"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/lib/geohash"
+	"github.com/jiangh156/godis/redis/protocol"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseUnit 返回距离单位对应的米数
+func parseUnit(arg []byte) (float64, redis.Reply) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, protocol.MakeErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func parseLngLat(lngArg []byte, latArg []byte) (float64, float64, redis.Reply) {
+	lng, err := strconv.ParseFloat(string(lngArg), 64)
+	if err != nil {
+		return 0, 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	lat, err := strconv.ParseFloat(string(latArg), 64)
+	if err != nil {
+		return 0, 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	if !geohash.Validate(lng, lat) {
+		return 0, 0, protocol.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lng, lat))
+	}
+	return lng, lat, nil
+}
+
+// formatCoord 坐标保留 17 位小数并去掉末尾的 0
+func formatCoord(value float64) []byte {
+	s := strconv.FormatFloat(value, 'f', 17, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	return []byte(s)
+}
+
+func formatDist(dist float64) []byte {
+	return []byte(strconv.FormatFloat(dist, 'f', 4, 64))
+}
+
+func coordToReply(lng float64, lat float64) redis.Reply {
+	return protocol.MakeMultiBulkReply([][]byte{formatCoord(lng), formatCoord(lat)})
+}
+
+// GEOADD key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]
+func execGeoAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	var nx, xx, ch bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		}
+		break
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return protocol.MakeErrReply("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+	}
+	if nx && xx {
+		return protocol.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	// 先解析全部坐标，保证命令的原子性
+	elements := make([]*sortedset.Element, len(triples)/3)
+	for j := range elements {
+		lng, lat, errReply := parseLngLat(triples[3*j], triples[3*j+1])
+		if errReply != nil {
+			return errReply
+		}
+		elements[j] = &sortedset.Element{
+			Member: string(triples[3*j+2]),
+			Score:  float64(geohash.Encode(lng, lat)),
+		}
+	}
+	zSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zSet == nil && xx {
+		return protocol.MakeIntReply(0)
+	}
+	if zSet == nil {
+		zSet, _, _ = db.getOrInitSortedSet(key)
+	}
+	cnt := 0
+	for _, element := range elements {
+		_, exists := zSet.Get(element.Member)
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		added, changed := zSet.Add(element.Member, element.Score)
+		if added || (ch && changed) {
+			cnt++
+		}
+	}
+	db.signalKey(key)
+	aofReply := db.makeAofCmd("geoadd", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(int64(cnt))
+}
+
+// GEODIST key member1 member2 [M | KM | FT | MI]
+func execGeoDist(db *DB, args [][]byte) redis.Reply {
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply redis.Reply
+		unit, errReply = parseUnit(args[3])
+		if errReply != nil {
+			return errReply
+		}
+	} else if len(args) != 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zSet == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	e1, ok1 := zSet.Get(string(args[1]))
+	e2, ok2 := zSet.Get(string(args[2]))
+	if !ok1 || !ok2 {
+		return protocol.MakeNullBulkReply()
+	}
+	lng1, lat1 := geohash.Decode(uint64(e1.Score))
+	lng2, lat2 := geohash.Decode(uint64(e2.Score))
+	return protocol.MakeBulkReply(formatDist(geohash.Distance(lng1, lat1, lng2, lat2) / unit))
+}
+
+// GEOPOS key [member [member ...]]
+func execGeoPos(db *DB, args [][]byte) redis.Reply {
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		var element *sortedset.Element
+		ok := false
+		if zSet != nil {
+			element, ok = zSet.Get(string(member))
+		}
+		if !ok {
+			result[i] = protocol.MakeNullMultiBulkReply()
+			continue
+		}
+		result[i] = coordToReply(geohash.Decode(uint64(element.Score)))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// GEOHASH key [member [member ...]]
+func execGeoHash(db *DB, args [][]byte) redis.Reply {
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	for i, member := range args[1:] {
+		if zSet == nil {
+			continue
+		}
+		if element, ok := zSet.Get(string(member)); ok {
+			result[i] = []byte(geohash.ToString(uint64(element.Score)))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+type geoSearchOption struct {
+	fromMember *string
+	fromLngLat bool
+	lng        float64
+	lat        float64
+	byRadius   bool
+	byBox      bool
+	radius     float64 // 单位米
+	width      float64
+	height     float64
+	unit       float64
+	desc       bool
+	sorted     bool
+	count      int64
+	any        bool
+	withDist   bool
+	withCoord  bool
+	withHash   bool
+	storeDist  bool
+}
+
+type geoPoint struct {
+	member string
+	hash   uint64
+	lng    float64
+	lat    float64
+	dist   float64 // 单位米
+}
+
+func parseDistance(arg []byte, msg string) (float64, redis.Reply) {
+	value, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, protocol.MakeErrReply(msg)
+	}
+	return value, nil
+}
+
+/*
+ * 解析 FROMMEMBER member | FROMLONLAT longitude latitude
+ * BYRADIUS radius unit | BYBOX width height unit
+ * [ASC | DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+ * store 为 true 时不允许 WITH 选项，允许 STOREDIST
+ */
+func parseGeoSearchOption(args [][]byte, store bool) (*geoSearchOption, redis.Reply) {
+	option := &geoSearchOption{}
+	var errReply redis.Reply
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch arg := strings.ToUpper(string(args[i])); {
+		case arg == "FROMMEMBER" && remaining >= 1:
+			member := string(args[i+1])
+			option.fromMember = &member
+			i++
+		case arg == "FROMLONLAT" && remaining >= 2:
+			option.lng, option.lat, errReply = parseLngLat(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			option.fromLngLat = true
+			i += 2
+		case arg == "BYRADIUS" && remaining >= 2:
+			option.radius, errReply = parseDistance(args[i+1], "ERR need numeric radius")
+			if errReply != nil {
+				return nil, errReply
+			}
+			if option.radius < 0 {
+				return nil, protocol.MakeErrReply("ERR radius cannot be negative")
+			}
+			option.unit, errReply = parseUnit(args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			option.radius *= option.unit
+			option.byRadius = true
+			i += 2
+		case arg == "BYBOX" && remaining >= 3:
+			option.width, errReply = parseDistance(args[i+1], "ERR value is not a valid float")
+			if errReply != nil {
+				return nil, errReply
+			}
+			option.height, errReply = parseDistance(args[i+2], "ERR value is not a valid float")
+			if errReply != nil {
+				return nil, errReply
+			}
+			if option.width < 0 || option.height < 0 {
+				return nil, protocol.MakeErrReply("ERR height or width cannot be negative")
+			}
+			option.unit, errReply = parseUnit(args[i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			option.width *= option.unit
+			option.height *= option.unit
+			option.byBox = true
+			i += 3
+		case arg == "ASC":
+			option.sorted, option.desc = true, false
+		case arg == "DESC":
+			option.sorted, option.desc = true, true
+		case arg == "COUNT" && remaining >= 1:
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, protocol.MakeErrReply("ERR COUNT must be > 0")
+			}
+			option.count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(string(args[i+1])) == "ANY" {
+				option.any = true
+				i++
+			}
+		case arg == "WITHDIST" && !store:
+			option.withDist = true
+		case arg == "WITHCOORD" && !store:
+			option.withCoord = true
+		case arg == "WITHHASH" && !store:
+			option.withHash = true
+		case arg == "STOREDIST" && store:
+			option.storeDist = true
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if (option.fromMember != nil) == option.fromLngLat {
+		return nil, protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if option.byRadius == option.byBox {
+		return nil, protocol.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	// 指定 COUNT 时默认返回最近的成员
+	if option.count > 0 && !option.any && !option.sorted {
+		option.sorted = true
+	}
+	return option, nil
+}
+
+/*
+ * geoSearch 在中心点及相邻的 geohash 格子中查找范围内的成员
+ * 指定 ANY 时找到 count 个成员后立即返回
+ */
+func geoSearch(zSet *sortedset.SortedSet, option *geoSearchOption) ([]*geoPoint, redis.Reply) {
+	if option.fromMember != nil {
+		element, ok := zSet.Get(*option.fromMember)
+		if !ok {
+			return nil, protocol.MakeErrReply("ERR could not decode requested zset member")
+		}
+		option.lng, option.lat = geohash.Decode(uint64(element.Score))
+	}
+	width, height := option.width, option.height
+	if option.byRadius {
+		width, height = option.radius*2, option.radius*2
+	}
+	points := make([]*geoPoint, 0)
+	for _, r := range geohash.Ranges(option.lng, option.lat, width, height) {
+		min := &sortedset.ScoreBorder{Value: float64(r.Min)}
+		max := &sortedset.ScoreBorder{Value: float64(r.Max), Exclude: true}
+		zSet.ForEachByScore(min, max, 0, -1, false, func(element *sortedset.Element) bool {
+			hash := uint64(element.Score)
+			lng, lat := geohash.Decode(hash)
+			dist := geohash.Distance(option.lng, option.lat, lng, lat)
+			if option.byRadius && dist > option.radius {
+				return true
+			}
+			if option.byBox && !geohash.InBox(option.lng, option.lat, width, height, lng, lat) {
+				return true
+			}
+			points = append(points, &geoPoint{
+				member: element.Member,
+				hash:   hash,
+				lng:    lng,
+				lat:    lat,
+				dist:   dist,
+			})
+			return !option.any || int64(len(points)) < option.count
+		})
+		if option.any && int64(len(points)) >= option.count {
+			break
+		}
+	}
+	if option.sorted {
+		sort.SliceStable(points, func(i, j int) bool {
+			if option.desc {
+				return points[i].dist > points[j].dist
+			}
+			return points[i].dist < points[j].dist
+		})
+	}
+	if option.count > 0 && int64(len(points)) > option.count {
+		points = points[:option.count]
+	}
+	return points, nil
+}
+
+func geoPointsToReply(points []*geoPoint, option *geoSearchOption) redis.Reply {
+	if !option.withDist && !option.withHash && !option.withCoord {
+		result := make([][]byte, len(points))
+		for i, point := range points {
+			result[i] = []byte(point.member)
+		}
+		return protocol.MakeMultiBulkReply(result)
+	}
+	result := make([]redis.Reply, len(points))
+	for i, point := range points {
+		item := []redis.Reply{protocol.MakeBulkReply([]byte(point.member))}
+		if option.withDist {
+			item = append(item, protocol.MakeBulkReply(formatDist(point.dist/option.unit)))
+		}
+		if option.withHash {
+			item = append(item, protocol.MakeIntReply(int64(point.hash)))
+		}
+		if option.withCoord {
+			item = append(item, coordToReply(point.lng, point.lat))
+		}
+		result[i] = protocol.MakeMultiRawReply(item)
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// GEOSEARCH key FROMMEMBER member | FROMLONLAT longitude latitude BYRADIUS radius unit | BYBOX width height unit [options]
+func execGeoSearch(db *DB, args [][]byte) redis.Reply {
+	option, errReply := parseGeoSearchOption(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zSet == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	points, errReply := geoSearch(zSet, option)
+	if errReply != nil {
+		return errReply
+	}
+	return geoPointsToReply(points, option)
+}
+
+// GEOSEARCHSTORE destination source FROMMEMBER member | FROMLONLAT longitude latitude BYRADIUS radius unit | BYBOX width height unit [options] [STOREDIST]
+func execGeoSearchStore(db *DB, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	option, errReply := parseGeoSearchOption(args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	zSet, errReply := db.getAsSortedSet(string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	var points []*geoPoint
+	if zSet != nil {
+		points, errReply = geoSearch(zSet, option)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	result := sortedset.Make()
+	for _, point := range points {
+		score := float64(point.hash)
+		if option.storeDist {
+			score = point.dist / option.unit
+		}
+		result.Add(point.member, score)
+	}
+	size := db.storeSortedSet(dest, result)
+	aofReply := db.makeAofCmd("geosearchstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(size)
+}
+
+func init() {
+	RegisterCommand("GeoAdd", execGeoAdd, -5)
+	RegisterCommand("GeoDist", execGeoDist, -4)
+	RegisterCommand("GeoPos", execGeoPos, -2)
+	RegisterCommand("GeoHash", execGeoHash, -2)
+	RegisterCommand("GeoSearch", execGeoSearch, -7)
+	RegisterCommand("GeoSearchStore", execGeoSearchStore, -8)
+}
@@ -1,29 +1,42 @@
 package database
 
 import (
-	"github.com/jiangh156/godis/datastruct/dict"
+	Hash "github.com/jiangh156/godis/datastruct/hash"
 	"github.com/jiangh156/godis/interface/redis"
 	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func (db *DB) getAsHash(key string) (dict.Dict, redis.ErrReply) {
+const (
+	// 主动清理过期字段的间隔
+	hashFieldExpireInterval = 100 * time.Millisecond
+)
+
+func (db *DB) getAsHash(key string) (*Hash.Hash, redis.ErrReply) {
 	entity, exists := db.Get(key)
 	if !exists {
 		return nil, nil
 	}
-	hash, ok := entity.Data.(dict.Dict)
+	hash, ok := entity.Data.(*Hash.Hash)
 	if !ok {
 		return nil, protocol.MakeWrongTypeErrReply()
 	}
+	// 所有字段均已过期
+	if hash.HasExpires() && hash.Len() == 0 {
+		db.Remove(key)
+		return nil, nil
+	}
 	return hash, nil
 }
-func (db *DB) getOrInitHash(key string) (dict.Dict, redis.ErrReply) {
+func (db *DB) getOrInitHash(key string) (*Hash.Hash, redis.ErrReply) {
 	hash, errReply := db.getAsHash(key)
 	if errReply != nil {
 		return nil, errReply
 	}
 	if hash == nil {
-		hash = dict.MakeSyncDict()
+		hash = Hash.Make()
 		db.Put(key, &DataEntity{Data: hash})
 	}
 	return hash, nil
@@ -65,7 +78,7 @@ func execHGet(db *DB, args [][]byte) redis.Reply {
 	if !exists {
 		return protocol.MakeNullBulkReply()
 	}
-	return protocol.MakeBulkReply(val.([]byte))
+	return protocol.MakeBulkReply(val)
 }
 
 // HDEL key field [field ...]
@@ -79,6 +92,9 @@ func execHDel(db *DB, args [][]byte) redis.Reply {
 	if err != nil {
 		return err
 	}
+	if hash == nil {
+		return protocol.MakeIntReply(0)
+	}
 	var removed int
 	for _, field := range fields {
 		result := hash.Remove(string(field))
@@ -86,6 +102,9 @@ func execHDel(db *DB, args [][]byte) redis.Reply {
 			removed++
 		}
 	}
+	if hash.Len() == 0 {
+		db.Remove(key)
+	}
 	aofReply := db.makeAofCmd("hdel", args)
 	db.addAof(aofReply)
 	return protocol.MakeIntReply(int64(removed))
@@ -101,17 +120,318 @@ func execHKeys(db *DB, args [][]byte) redis.Reply {
 	if err != nil {
 		return err
 	}
-	keyStrs := hash.Keys()
-	keys := make([][]byte, len(keyStrs))
-	for i, str := range keyStrs {
+	if hash == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	fields := hash.Fields()
+	keys := make([][]byte, len(fields))
+	for i, str := range fields {
 		keys[i] = []byte(str)
 	}
 	return protocol.MakeMultiBulkReply(keys)
 }
 
+// parseHashFields 解析 FIELDS numfields field [field ...]
+func parseHashFields(args [][]byte) ([]string, redis.ErrReply) {
+	if len(args) < 2 || strings.ToUpper(string(args[0])) != "FIELDS" {
+		return nil, protocol.MakeErrReply("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || numFields <= 0 {
+		return nil, protocol.MakeErrReply("ERR Parameter `numFields` should be greater than 0")
+	}
+	if int(numFields) != len(args)-2 {
+		return nil, protocol.MakeErrReply("ERR The `numfields` parameter must match the number of arguments")
+	}
+	fields := make([]string, numFields)
+	for i, arg := range args[2:] {
+		fields[i] = string(arg)
+	}
+	return fields, nil
+}
+
+// makeFieldCodeReply 所有字段返回相同的状态码
+func makeFieldCodeReply(count int, code int64) redis.Reply {
+	replies := make([]redis.Reply, count)
+	for i := range replies {
+		replies[i] = protocol.MakeIntReply(code)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// trackHashFieldTTL 记录含有过期字段的key，供主动清理使用
+func (db *DB) trackHashFieldTTL(key string) {
+	db.hashTTLKeys.Put(key, struct{}{})
+}
+
+/*
+ * HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+ * HPEXPIRE, HEXPIREAT, HPEXPIREAT 同理
+ * unit: 时间参数的单位, absolute: 时间参数是否为unix时间戳
+ * reply: -2 字段不存在, 0 条件不满足, 1 设置成功, 2 过期时间已过, 字段被删除
+ */
+func execHExpireGeneric(db *DB, cmdName string, args [][]byte, unit time.Duration, absolute bool) redis.Reply {
+	if len(args) < 4 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for '" + cmdName + "' command")
+	}
+	key := string(args[0])
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if raw < 0 || raw > int64(time.Duration(1<<62)/unit) {
+		return protocol.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	var expireTime time.Time
+	if absolute {
+		expireTime = time.UnixMilli(0).Add(time.Duration(raw) * unit)
+	} else {
+		expireTime = time.Now().Add(time.Duration(raw) * unit)
+	}
+	rest := args[2:]
+	var nx, xx, gt, lt bool
+	switch strings.ToUpper(string(rest[0])) {
+	case "NX":
+		nx = true
+	case "XX":
+		xx = true
+	case "GT":
+		gt = true
+	case "LT":
+		lt = true
+	}
+	if nx || xx || gt || lt {
+		rest = rest[1:]
+	}
+	fields, errReply := parseHashFields(rest)
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return makeFieldCodeReply(len(fields), -2)
+	}
+	now := time.Now()
+	replies := make([]redis.Reply, len(fields))
+	changed := make([][]byte, 0, len(fields))
+	for i, field := range fields {
+		if !hash.Has(field) {
+			replies[i] = protocol.MakeIntReply(-2)
+			continue
+		}
+		current, hasTTL := hash.ExpireTime(field)
+		// 没有过期时间的字段视为永不过期
+		if (nx && hasTTL) || (xx && !hasTTL) ||
+			(gt && (!hasTTL || !expireTime.After(current))) ||
+			(lt && hasTTL && !expireTime.Before(current)) {
+			replies[i] = protocol.MakeIntReply(0)
+			continue
+		}
+		changed = append(changed, []byte(field))
+		if !expireTime.After(now) {
+			hash.Remove(field)
+			replies[i] = protocol.MakeIntReply(2)
+			continue
+		}
+		hash.Expire(field, expireTime)
+		replies[i] = protocol.MakeIntReply(1)
+	}
+	if hash.Len() == 0 {
+		db.Remove(key)
+	} else if len(changed) > 0 {
+		db.trackHashFieldTTL(key)
+	}
+	if len(changed) > 0 {
+		// 统一使用绝对时间记录，保证重放结果一致
+		aofArgs := [][]byte{
+			[]byte(key),
+			[]byte(strconv.FormatInt(expireTime.UnixMilli(), 10)),
+			[]byte("FIELDS"),
+			[]byte(strconv.Itoa(len(changed))),
+		}
+		aofArgs = append(aofArgs, changed...)
+		db.addAof(db.makeAofCmd("hpexpireat", aofArgs))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func execHExpire(db *DB, args [][]byte) redis.Reply {
+	return execHExpireGeneric(db, "hexpire", args, time.Second, false)
+}
+
+// HPEXPIRE key milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func execHPExpire(db *DB, args [][]byte) redis.Reply {
+	return execHExpireGeneric(db, "hpexpire", args, time.Millisecond, false)
+}
+
+// HEXPIREAT key unix-time-seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func execHExpireAt(db *DB, args [][]byte) redis.Reply {
+	return execHExpireGeneric(db, "hexpireat", args, time.Second, true)
+}
+
+// HPEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func execHPExpireAt(db *DB, args [][]byte) redis.Reply {
+	return execHExpireGeneric(db, "hpexpireat", args, time.Millisecond, true)
+}
+
+/*
+ * HTTL key FIELDS numfields field [field ...]
+ * reply: -2 字段不存在, -1 字段没有过期时间, 否则为剩余时间
+ * absolute: 返回过期的unix时间戳而不是剩余时间
+ */
+func execHTTLGeneric(db *DB, cmdName string, args [][]byte, unit time.Duration, absolute bool) redis.Reply {
+	if len(args) < 3 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for '" + cmdName + "' command")
+	}
+	key := string(args[0])
+	fields, errReply := parseHashFields(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return makeFieldCodeReply(len(fields), -2)
+	}
+	replies := make([]redis.Reply, len(fields))
+	for i, field := range fields {
+		if !hash.Has(field) {
+			replies[i] = protocol.MakeIntReply(-2)
+			continue
+		}
+		expireTime, ok := hash.ExpireTime(field)
+		if !ok {
+			replies[i] = protocol.MakeIntReply(-1)
+			continue
+		}
+		if absolute {
+			replies[i] = protocol.MakeIntReply(expireTime.UnixMilli() / int64(unit/time.Millisecond))
+			continue
+		}
+		ttl := time.Until(expireTime)
+		// 四舍五入
+		replies[i] = protocol.MakeIntReply(int64((ttl + unit/2) / unit))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// HTTL key FIELDS numfields field [field ...]
+func execHTTL(db *DB, args [][]byte) redis.Reply {
+	return execHTTLGeneric(db, "httl", args, time.Second, false)
+}
+
+// HPTTL key FIELDS numfields field [field ...]
+func execHPTTL(db *DB, args [][]byte) redis.Reply {
+	return execHTTLGeneric(db, "hpttl", args, time.Millisecond, false)
+}
+
+// HEXPIRETIME key FIELDS numfields field [field ...]
+func execHExpireTime(db *DB, args [][]byte) redis.Reply {
+	return execHTTLGeneric(db, "hexpiretime", args, time.Second, true)
+}
+
+// HPEXPIRETIME key FIELDS numfields field [field ...]
+func execHPExpireTime(db *DB, args [][]byte) redis.Reply {
+	return execHTTLGeneric(db, "hpexpiretime", args, time.Millisecond, true)
+}
+
+/*
+ * HPERSIST key FIELDS numfields field [field ...]
+ * reply: -2 字段不存在, -1 字段没有过期时间, 1 成功移除过期时间
+ */
+func execHPersist(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 3 {
+		return protocol.MakeArgNumErrReply("hpersist")
+	}
+	key := string(args[0])
+	fields, errReply := parseHashFields(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return makeFieldCodeReply(len(fields), -2)
+	}
+	replies := make([]redis.Reply, len(fields))
+	persisted := 0
+	for i, field := range fields {
+		if !hash.Has(field) {
+			replies[i] = protocol.MakeIntReply(-2)
+			continue
+		}
+		if !hash.Persist(field) {
+			replies[i] = protocol.MakeIntReply(-1)
+			continue
+		}
+		persisted++
+		replies[i] = protocol.MakeIntReply(1)
+	}
+	if persisted > 0 {
+		aofReply := db.makeAofCmd("hpersist", args)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// activeExpireHashFields 定期删除哈希中已过期的字段，与命令持有同一把锁，数据库关闭后退出
+func (db *DB) activeExpireHashFields() {
+	ticker := time.NewTicker(hashFieldExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.closed:
+			return
+		case <-ticker.C:
+		}
+		db.mu.Lock()
+		db.expireHashFields()
+		db.mu.Unlock()
+	}
+}
+
+// expireHashFields 删除已过期的字段，字段全部过期时删除key
+func (db *DB) expireHashFields() {
+	db.hashTTLKeys.ForEach(func(key string, _ any) bool {
+		entity, exists := db.peek(key)
+		if !exists {
+			db.hashTTLKeys.Remove(key)
+			return true
+		}
+		hash, ok := entity.Data.(*Hash.Hash)
+		if !ok || !hash.HasExpires() {
+			db.hashTTLKeys.Remove(key)
+			return true
+		}
+		hash.RemoveExpired()
+		if hash.Len() == 0 {
+			db.Remove(key)
+			db.hashTTLKeys.Remove(key)
+		}
+		return true
+	})
+}
+
 func init() {
 	RegisterCommand("HSet", execHSet, 4)
 	RegisterCommand("HGet", execHGet, 3)
 	RegisterCommand("HDel", execHDel, -3)
 	RegisterCommand("HKeys", execHKeys, 2)
+	RegisterCommand("HExpire", execHExpire, -6)
+	RegisterCommand("HPExpire", execHPExpire, -6)
+	RegisterCommand("HExpireAt", execHExpireAt, -6)
+	RegisterCommand("HPExpireAt", execHPExpireAt, -6)
+	RegisterCommand("HTTL", execHTTL, -5)
+	RegisterCommand("HPTTL", execHPTTL, -5)
+	RegisterCommand("HExpireTime", execHExpireTime, -5)
+	RegisterCommand("HPExpireTime", execHPExpireTime, -5)
+	RegisterCommand("HPersist", execHPersist, -5)
 }
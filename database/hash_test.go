@@ -0,0 +1,78 @@
+package database
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_HashFieldExpire(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "hset h a 1")
+	exec(s, conn, "hset h b 2")
+	if reply := exec(s, conn, "hpexpire h 50 FIELDS 2 a nosuch"); reply != "*2\r\n:1\r\n:-2\r\n" {
+		t.Errorf("hpexpire err: %q", reply)
+	}
+	if reply := exec(s, conn, "hpersist h"); reply != "-ERR wrong number of argument for hpersist command\r\n" {
+		t.Errorf("hpersist err: %q", reply)
+	}
+	// 主动清理与其他客户端的写命令并发执行
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := &fakeConn{}
+			for j := 0; j < 50; j++ {
+				field := strconv.Itoa(i*100 + j)
+				exec(s, c, "hset h "+field+" v")
+				exec(s, c, "hpexpire h 1 FIELDS 1 "+field)
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+	time.Sleep(3 * hashFieldExpireInterval)
+	if reply := exec(s, conn, "hkeys h"); reply != "*1\r\n$1\r\nb\r\n" {
+		t.Errorf("hash field expire err: %q", reply)
+	}
+	exec(s, conn, "hpexpire h 1 FIELDS 1 b")
+	time.Sleep(3 * hashFieldExpireInterval)
+	if reply := exec(s, conn, "exists h"); reply != ":0\r\n" {
+		t.Errorf("hash should be removed when all fields expired: %q", reply)
+	}
+}
+
+func Test_HashFieldTTL(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "hset h a 1")
+	exec(s, conn, "hset h b 2")
+	exec(s, conn, "hset h c 3")
+	// 条件不满足时返回 0，字段不存在时返回 -2
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"hexpire h 100 FIELDS 2 a nosuch", "*2\r\n:1\r\n:-2\r\n"},
+		{"hexpire h 200 NX FIELDS 2 a b", "*2\r\n:0\r\n:1\r\n"},
+		{"hexpire h 50 GT FIELDS 1 a", "*1\r\n:0\r\n"},
+		{"hexpire h 300 XX FIELDS 2 a c", "*2\r\n:1\r\n:0\r\n"},
+		{"hexpire h 150 LT FIELDS 1 a", "*1\r\n:1\r\n"},
+		{"httl h FIELDS 3 a b c", "*3\r\n:150\r\n:200\r\n:-1\r\n"},
+		{"hpersist h FIELDS 3 a c nosuch", "*3\r\n:1\r\n:-1\r\n:-2\r\n"},
+		{"httl h FIELDS 2 a b", "*2\r\n:-1\r\n:200\r\n"},
+		{"hexpire h 100 FIELDS 3 a", "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+		// 过期时间为 0 时立即删除字段
+		{"hexpire h 0 FIELDS 1 b", "*1\r\n:2\r\n"},
+		{"hkeys h", "*2\r\n$1\r\na\r\n$1\r\nc\r\n"},
+		{"httl nosuch FIELDS 1 a", "*1\r\n:-2\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
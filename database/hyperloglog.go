@@ -0,0 +1,116 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/datastruct/hll"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+)
+
+// getAsHLL HyperLogLog 以字符串存储，不是合法的 HyperLogLog 时返回错误
+func (db *DB) getAsHLL(key string) ([]byte, redis.Reply) {
+	data, errReply := db.getAsString(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if data == nil {
+		return nil, nil
+	}
+	if !hll.IsValid(data) {
+		return nil, protocol.MakeErrReply(hll.ErrInvalid.Error())
+	}
+	return data, nil
+}
+
+// PFADD key [element [element ...]]
+func execPFAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	data, errReply := db.getAsHLL(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := data == nil
+	if created {
+		data = hll.New()
+	}
+	data, updated, err := hll.Add(data, args[1:], config.Properties.HllSparseMaxBytes)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	if !created && !updated {
+		return protocol.MakeIntReply(0)
+	}
+	db.Put(key, &DataEntity{
+		Data: data,
+	})
+	aofReply := db.makeAofCmd("pfadd", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(1)
+}
+
+// PFCOUNT key [key ...]
+func execPFCount(db *DB, args [][]byte) redis.Reply {
+	if len(args) == 1 {
+		data, errReply := db.getAsHLL(string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if data == nil {
+			return protocol.MakeIntReply(0)
+		}
+		// 基数缓存直接写入 data 的头部
+		count, _, err := hll.Count(data)
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		return protocol.MakeIntReply(int64(count))
+	}
+	datas := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		data, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if data != nil {
+			datas = append(datas, data)
+		}
+	}
+	count, err := hll.CountUnion(datas)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	return protocol.MakeIntReply(int64(count))
+}
+
+// PFMERGE destkey [sourcekey [sourcekey ...]]
+func execPFMerge(db *DB, args [][]byte) redis.Reply {
+	datas := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		data, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if data != nil {
+			datas = append(datas, data)
+		}
+	}
+	if len(datas) == 0 {
+		datas = append(datas, hll.New())
+	}
+	merged, err := hll.Merge(datas, config.Properties.HllSparseMaxBytes)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	db.Put(string(args[0]), &DataEntity{
+		Data: merged,
+	})
+	aofReply := db.makeAofCmd("pfmerge", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("PFAdd", execPFAdd, -2)
+	RegisterCommand("PFCount", execPFCount, -2)
+	RegisterCommand("PFMerge", execPFMerge, -2)
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"fmt"
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clientCounter 返回当前的连接数，由网络层注册
+var clientCounter func() int
+
+// SetClientCounter 注册连接数的统计函数
+func SetClientCounter(counter func() int) {
+	clientCounter = counter
+}
+
+type commandStats struct {
+	calls int64
+	usec  int64
+}
+
+// serverStats 命令执行的统计信息
+type serverStats struct {
+	startTime     time.Time
+	totalCommands int64
+	opsPerSec     int64
+
+	mu       sync.Mutex
+	commands map[string]*commandStats
+}
+
+func makeServerStats() *serverStats {
+	stats := &serverStats{
+		startTime: time.Now(),
+		commands:  make(map[string]*commandStats),
+	}
+	go stats.sampleOps()
+	return stats
+}
+
+// sampleOps 每秒采样一次执行的命令数
+func (stats *serverStats) sampleOps() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := atomic.LoadInt64(&stats.totalCommands)
+	for range ticker.C {
+		total := atomic.LoadInt64(&stats.totalCommands)
+		ops := total - last
+		// RESETSTAT 后计数器变小
+		if ops < 0 {
+			ops = total
+		}
+		atomic.StoreInt64(&stats.opsPerSec, ops)
+		last = total
+	}
+}
+
+// record 记录一次命令执行，忽略不存在的命令
+func (stats *serverStats) record(cmdName string, duration time.Duration) {
+	if _, ok := cmdTable[cmdName]; !ok {
+		if _, ok := serverCmdTable[cmdName]; !ok {
+			return
+		}
+	}
+	atomic.AddInt64(&stats.totalCommands, 1)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	cmd, ok := stats.commands[cmdName]
+	if !ok {
+		cmd = &commandStats{}
+		stats.commands[cmdName] = cmd
+	}
+	cmd.calls++
+	cmd.usec += duration.Microseconds()
+}
+
+// reset 清空命令统计，运行时间不受影响
+func (stats *serverStats) reset() {
+	atomic.StoreInt64(&stats.totalCommands, 0)
+	atomic.StoreInt64(&stats.opsPerSec, 0)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.commands = make(map[string]*commandStats)
+}
+
+// infoSections 按输出顺序排列的信息分组，commandstats 默认不输出
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "commandstats", "keyspace"}
+
+// usedMemoryMetric 堆上对象占用的内存，与 MemStats.HeapAlloc 相同，读取时不需要暂停所有协程
+const usedMemoryMetric = "/memory/classes/heap/objects:bytes"
+
+func usedMemory() uint64 {
+	sample := []metrics.Sample{{Name: usedMemoryMetric}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+func formatBytes(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.2f%s", f, units[i])
+}
+
+func (s *SingleServer) infoSection(section string) []string {
+	switch section {
+	case "server":
+		uptime := time.Since(s.stats.startTime)
+		mode := "standalone"
+		if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+			mode = "cluster"
+		}
+		executable, _ := os.Executable()
+		return []string{
+			"godis_mode:" + mode,
+			"os:" + runtime.GOOS + " " + runtime.GOARCH,
+			fmt.Sprintf("arch_bits:%d", 32<<(^uint(0)>>63)),
+			"go_version:" + runtime.Version(),
+			fmt.Sprintf("process_id:%d", os.Getpid()),
+			fmt.Sprintf("tcp_port:%d", config.Properties.Port),
+			fmt.Sprintf("uptime_in_seconds:%d", int64(uptime.Seconds())),
+			fmt.Sprintf("uptime_in_days:%d", int64(uptime.Hours()/24)),
+			"executable:" + executable,
+		}
+	case "clients":
+		clients := 0
+		if clientCounter != nil {
+			clients = clientCounter()
+		}
+		blocked := 0
+		for _, db := range s.DBSet {
+			blocked += db.blockedCount()
+		}
+		return []string{
+			fmt.Sprintf("connected_clients:%d", clients),
+			fmt.Sprintf("maxclients:%d", config.Properties.MaxClients),
+			fmt.Sprintf("blocked_clients:%d", blocked),
+		}
+	case "memory":
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		used := usedMemory()
+		maxMemory := config.MaxMemory()
+		return []string{
+			fmt.Sprintf("used_memory:%d", used),
+			"used_memory_human:" + formatBytes(used),
+			fmt.Sprintf("used_memory_sys:%d", m.Sys),
+			"used_memory_sys_human:" + formatBytes(m.Sys),
+			fmt.Sprintf("maxmemory:%d", maxMemory),
+			"maxmemory_human:" + formatBytes(uint64(maxMemory)),
+			fmt.Sprintf("num_gc:%d", m.NumGC),
+			"mem_allocator:go",
+		}
+	case "persistence":
+		appendOnly := config.AppendOnly()
+		lines := []string{
+			fmt.Sprintf("loading:%d", boolToInt(s.aofLoading.Get())),
+			fmt.Sprintf("aof_enabled:%d", boolToInt(appendOnly)),
+		}
+		if appendOnly {
+			status := "ok"
+			if s.aofWriteErr.Get() {
+				status = "err"
+			}
+			var size int64
+			if info, err := os.Stat(config.Properties.AppendFilename); err == nil {
+				size = info.Size()
+			}
+			lines = append(lines, "aof_last_write_status:"+status, fmt.Sprintf("aof_current_size:%d", size))
+		}
+		return lines
+	case "stats":
+		return []string{
+			fmt.Sprintf("total_commands_processed:%d", atomic.LoadInt64(&s.stats.totalCommands)),
+			fmt.Sprintf("instantaneous_ops_per_sec:%d", atomic.LoadInt64(&s.stats.opsPerSec)),
+		}
+	case "replication":
+		return []string{"role:master", "connected_slaves:0"}
+	case "commandstats":
+		s.stats.mu.Lock()
+		defer s.stats.mu.Unlock()
+		names := make([]string, 0, len(s.stats.commands))
+		for name := range s.stats.commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			cmd := s.stats.commands[name]
+			lines = append(lines, fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f",
+				name, cmd.calls, cmd.usec, float64(cmd.usec)/float64(cmd.calls)))
+		}
+		return lines
+	case "keyspace":
+		lines := make([]string, 0)
+		for i, db := range s.DBSet {
+			unlock := s.lockDBs(i)
+			keys, expires := db.Data.Len(), db.TTLMap.Len()
+			unlock()
+			if keys == 0 {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("db%d:keys=%d,expires=%d", i, keys, expires))
+		}
+		return lines
+	}
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// INFO [section [section ...]]
+func (s *SingleServer) execInfo(conn redis.Connection, args [][]byte) redis.Reply {
+	selected := make(map[string]bool)
+	for _, arg := range args[1:] {
+		section := strings.ToLower(string(arg))
+		switch section {
+		case "all", "everything":
+			for _, name := range infoSections {
+				selected[name] = true
+			}
+		case "default":
+			for _, name := range infoSections {
+				selected[name] = name != "commandstats" || selected[name]
+			}
+		default:
+			selected[section] = true
+		}
+	}
+	if len(args) == 1 {
+		for _, name := range infoSections {
+			selected[name] = name != "commandstats"
+		}
+	}
+	var builder strings.Builder
+	for _, name := range infoSections {
+		if !selected[name] {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + strings.ToUpper(name[:1]) + name[1:] + "\r\n")
+		for _, line := range s.infoSection(name) {
+			builder.WriteString(line + "\r\n")
+		}
+	}
+	return protocol.MakeBulkReply([]byte(builder.String()))
+}
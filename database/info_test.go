@@ -0,0 +1,43 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Info(t *testing.T) {
+	s := makeTestServer(t)
+	conn, conn1 := &fakeConn{}, &fakeConn{dbIndex: 1}
+	exec(s, conn, "set a 1")
+	exec(s, conn, "set b 2")
+	exec(s, conn, "expire b 100")
+	exec(s, conn1, "sadd s x")
+
+	reply := exec(s, conn, "info")
+	for _, want := range []string{"# Server\r\n", "# Clients\r\n", "# Memory\r\n", "# Persistence\r\n", "# Stats\r\n", "# Keyspace\r\n",
+		"db0:keys=2,expires=1\r\n", "db1:keys=1,expires=0\r\n", "aof_enabled:0\r\n"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("info err: missing %q", want)
+		}
+	}
+	// 默认不输出 commandstats
+	if strings.Contains(reply, "# Commandstats") {
+		t.Errorf("info err: commandstats should not be in default sections")
+	}
+
+	reply = exec(s, conn, "info commandstats keyspace")
+	for _, want := range []string{"# Commandstats\r\n", "cmdstat_set:calls=2,", "cmdstat_expire:calls=1,", "# Keyspace\r\n"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("info commandstats err: missing %q in %q", want, reply)
+		}
+	}
+	if strings.Contains(reply, "# Server") {
+		t.Errorf("info commandstats err: unexpected section in %q", reply)
+	}
+	if reply := exec(s, conn, "info ALL"); !strings.Contains(reply, "# Server\r\n") || !strings.Contains(reply, "# Commandstats\r\n") {
+		t.Errorf("info all err: %q", reply)
+	}
+	if reply := exec(s, conn, "info nosuch"); strings.Contains(reply, "#") {
+		t.Errorf("info nosuch err: %q", reply)
+	}
+}
@@ -0,0 +1,524 @@
+package database
+
+import (
+	"fmt"
+	"github.com/jiangh156/godis/datastruct/jsondoc"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// jsonRootPath 省略路径时使用旧版的根路径
+const jsonRootPath = "."
+
+func (db *DB) getAsJSON(key string) (*jsondoc.Document, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	doc, ok := entity.Data.(*jsondoc.Document)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return doc, nil
+}
+
+func parseJSONPath(raw string) (*jsondoc.Path, redis.Reply) {
+	path, err := jsondoc.ParsePath(raw)
+	if err != nil {
+		return nil, protocol.MakeErrReply(err.Error())
+	}
+	return path, nil
+}
+
+func parseJSONValue(arg []byte) (any, redis.Reply) {
+	val, err := jsondoc.Parse(arg)
+	if err != nil {
+		return nil, protocol.MakeErrReply(err.Error())
+	}
+	return val, nil
+}
+
+func jsonPathNotExist(path *jsondoc.Path) redis.Reply {
+	return protocol.MakeErrReply(fmt.Sprintf("ERR Path '%s' does not exist", path))
+}
+
+func jsonWrongType(expected string, val any) redis.Reply {
+	return protocol.MakeErrReply(fmt.Sprintf("ERR WRONGTYPE wrong type of path value - expected %s but found %s",
+		expected, jsondoc.TypeName(val)))
+}
+
+// JSON.SET key path value [NX | XX]
+func execJSONSet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	var nx, xx bool
+	if len(args) == 4 {
+		switch strings.ToUpper(string(args[3])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	} else if len(args) != 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	path, errReply := parseJSONPath(string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	val, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		if !path.IsRoot() {
+			return protocol.MakeErrReply("ERR new objects must be created at the root")
+		}
+		if xx {
+			return protocol.MakeNullBulkReply()
+		}
+		db.Put(key, &DataEntity{
+			Data: &jsondoc.Document{Root: val},
+		})
+	} else if path.IsRoot() {
+		if nx {
+			return protocol.MakeNullBulkReply()
+		}
+		doc.Root = val
+	} else if path.Set(doc.Root, val, nx, xx) == 0 {
+		return protocol.MakeNullBulkReply()
+	}
+	aofReply := db.makeAofCmd("json.set", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+/*
+ * jsonPathResult 旧版路径返回第一个匹配的值，JSONPath 返回所有匹配的值组成的数组
+ * asArray 为 true 时旧版路径也返回数组
+ */
+func jsonPathResult(doc *jsondoc.Document, path *jsondoc.Path, asArray bool) (any, redis.Reply) {
+	nodes := path.Evaluate(doc.Root)
+	if path.IsLegacy() && !asArray {
+		if len(nodes) == 0 {
+			return nil, jsonPathNotExist(path)
+		}
+		return nodes[0].Value, nil
+	}
+	result := &jsondoc.Array{Items: make([]any, len(nodes))}
+	for i, node := range nodes {
+		result.Items[i] = node.Value
+	}
+	return result, nil
+}
+
+// JSON.GET key [INDENT indent] [NEWLINE newline] [SPACE space] [path [path ...]]
+func execJSONGet(db *DB, args [][]byte) redis.Reply {
+	format := &jsondoc.Format{}
+	paths := make([]*jsondoc.Path, 0)
+	hasJSONPath := false
+	for i := 1; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if (arg == "INDENT" || arg == "NEWLINE" || arg == "SPACE") && i+1 < len(args) {
+			switch arg {
+			case "INDENT":
+				format.Indent = string(args[i+1])
+			case "NEWLINE":
+				format.Newline = string(args[i+1])
+			case "SPACE":
+				format.Space = string(args[i+1])
+			}
+			i++
+			continue
+		}
+		path, errReply := parseJSONPath(string(args[i]))
+		if errReply != nil {
+			return errReply
+		}
+		hasJSONPath = hasJSONPath || !path.IsLegacy()
+		paths = append(paths, path)
+	}
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	if len(paths) == 0 {
+		return protocol.MakeBulkReply(jsondoc.MarshalFormat(doc.Root, format))
+	}
+	if len(paths) == 1 {
+		result, errReply := jsonPathResult(doc, paths[0], false)
+		if errReply != nil {
+			return errReply
+		}
+		return protocol.MakeBulkReply(jsondoc.MarshalFormat(result, format))
+	}
+	// 多个路径时返回以路径为键的对象，任意一个为 JSONPath 时所有结果都是数组
+	result := jsondoc.MakeObject()
+	for _, path := range paths {
+		val, errReply := jsonPathResult(doc, path, hasJSONPath)
+		if errReply != nil {
+			return errReply
+		}
+		result.Set(path.String(), val)
+	}
+	return protocol.MakeBulkReply(jsondoc.MarshalFormat(result, format))
+}
+
+// JSON.DEL key [path]
+func execJSONDel(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return protocol.MakeArgNumErrReply("json.del")
+	}
+	key := string(args[0])
+	rawPath := jsonRootPath
+	if len(args) == 2 {
+		rawPath = string(args[1])
+	}
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeIntReply(0)
+	}
+	deleted := 1
+	if path.IsRoot() {
+		db.Remove(key)
+	} else {
+		deleted = jsondoc.Delete(path.Evaluate(doc.Root))
+	}
+	if deleted > 0 {
+		aofReply := db.makeAofCmd("json.del", args)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+/*
+ * updateJSON 对路径匹配到的每个节点执行 update
+ * update 返回 nil 表示节点类型不匹配，此时 JSONPath 的结果为 null，旧版路径返回错误
+ * 有节点被修改时记录 AOF
+ */
+func (db *DB) updateJSON(cmdName string, args [][]byte, rawPath string, expected string,
+	update func(doc *jsondoc.Document, node *jsondoc.Node) redis.Reply) (*jsondoc.Path, []redis.Reply, redis.Reply) {
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if doc == nil {
+		return nil, nil, protocol.MakeErrReply("ERR could not perform this operation on a key that doesn't exist")
+	}
+	nodes := path.Evaluate(doc.Root)
+	if path.IsLegacy() {
+		if len(nodes) == 0 {
+			return nil, nil, jsonPathNotExist(path)
+		}
+		for _, node := range nodes {
+			if jsondoc.TypeName(node.Value) != expected &&
+				!(expected == "number" && jsondoc.TypeName(node.Value) == "integer") {
+				return nil, nil, jsonWrongType(expected, node.Value)
+			}
+		}
+	}
+	results := make([]redis.Reply, len(nodes))
+	updated := false
+	for i, node := range nodes {
+		results[i] = update(doc, node)
+		if results[i] == nil {
+			results[i] = protocol.MakeNullBulkReply()
+		} else {
+			updated = true
+		}
+	}
+	if updated {
+		aofReply := db.makeAofCmd(cmdName, args)
+		db.addAof(aofReply)
+	}
+	return path, results, nil
+}
+
+// addJSONNumber 返回 v+delta，整数溢出时转为浮点数，v 不是数字时返回 false
+func addJSONNumber(v any, delta any) (any, bool) {
+	switch v := v.(type) {
+	case int64:
+		if d, ok := delta.(int64); ok {
+			if sum := v + d; (sum > v) == (d > 0) {
+				return sum, true
+			}
+			// 与 RedisJSON 相同，溢出后使用浮点数
+			return float64(v) + float64(d), true
+		}
+		return float64(v) + delta.(float64), true
+	case float64:
+		if d, ok := delta.(int64); ok {
+			return v + float64(d), true
+		}
+		return v + delta.(float64), true
+	}
+	return nil, false
+}
+
+// JSON.NUMINCRBY key path value
+func execJSONNumIncrBy(db *DB, args [][]byte) redis.Reply {
+	delta, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	if jsondoc.TypeName(delta) != "integer" && jsondoc.TypeName(delta) != "number" {
+		return protocol.MakeErrReply("ERR value is not a number")
+	}
+	// 修改前检查所有结果，JSON 中不能表示无穷大
+	if path, err := jsondoc.ParsePath(string(args[1])); err == nil {
+		if doc, _ := db.getAsJSON(string(args[0])); doc != nil {
+			for _, node := range path.Evaluate(doc.Root) {
+				if result, ok := addJSONNumber(node.Value, delta); ok {
+					if f, isFloat := result.(float64); isFloat && (math.IsInf(f, 0) || math.IsNaN(f)) {
+						return protocol.MakeErrReply("ERR result is not a finite number")
+					}
+				}
+			}
+		}
+	}
+	values := make([]any, 0)
+	path, _, errReply := db.updateJSON("json.numincrby", args, string(args[1]), "number",
+		func(doc *jsondoc.Document, node *jsondoc.Node) redis.Reply {
+			result, ok := addJSONNumber(node.Value, delta)
+			if !ok {
+				values = append(values, nil)
+				return nil
+			}
+			doc.SetNode(node, result)
+			values = append(values, result)
+			return protocol.MakeOkReply()
+		})
+	if errReply != nil {
+		return errReply
+	}
+	if path.IsLegacy() {
+		return protocol.MakeBulkReply(jsondoc.Marshal(values[len(values)-1]))
+	}
+	return protocol.MakeBulkReply(jsondoc.Marshal(&jsondoc.Array{Items: values}))
+}
+
+// JSON.STRAPPEND key [path] value
+func execJSONStrAppend(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 3 {
+		return protocol.MakeArgNumErrReply("json.strappend")
+	}
+	rawPath := jsonRootPath
+	if len(args) == 3 {
+		rawPath = string(args[1])
+	}
+	val, errReply := parseJSONValue(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	suffix, ok := val.(string)
+	if !ok {
+		return jsonWrongType("string", val)
+	}
+	path, results, errReply := db.updateJSON("json.strappend", args, rawPath, "string",
+		func(doc *jsondoc.Document, node *jsondoc.Node) redis.Reply {
+			s, ok := node.Value.(string)
+			if !ok {
+				return nil
+			}
+			doc.SetNode(node, s+suffix)
+			return protocol.MakeIntReply(int64(len(s) + len(suffix)))
+		})
+	if errReply != nil {
+		return errReply
+	}
+	if path.IsLegacy() {
+		return results[len(results)-1]
+	}
+	return protocol.MakeMultiRawReply(results)
+}
+
+// JSON.ARRAPPEND key path value [value ...]
+func execJSONArrAppend(db *DB, args [][]byte) redis.Reply {
+	values := make([]any, len(args)-2)
+	for i, arg := range args[2:] {
+		val, errReply := parseJSONValue(arg)
+		if errReply != nil {
+			return errReply
+		}
+		values[i] = val
+	}
+	path, results, errReply := db.updateJSON("json.arrappend", args, string(args[1]), "array",
+		func(doc *jsondoc.Document, node *jsondoc.Node) redis.Reply {
+			arr, ok := node.Value.(*jsondoc.Array)
+			if !ok {
+				return nil
+			}
+			for _, val := range values {
+				arr.Items = append(arr.Items, jsondoc.Clone(val))
+			}
+			return protocol.MakeIntReply(int64(len(arr.Items)))
+		})
+	if errReply != nil {
+		return errReply
+	}
+	if path.IsLegacy() {
+		return results[len(results)-1]
+	}
+	return protocol.MakeMultiRawReply(results)
+}
+
+// JSON.ARRPOP key [path [index]]
+func execJSONArrPop(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 3 {
+		return protocol.MakeArgNumErrReply("json.arrpop")
+	}
+	rawPath := jsonRootPath
+	if len(args) >= 2 {
+		rawPath = string(args[1])
+	}
+	index := -1
+	if len(args) == 3 {
+		var err error
+		index, err = strconv.Atoi(string(args[2]))
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	path, results, errReply := db.updateJSON("json.arrpop", args, rawPath, "array",
+		func(doc *jsondoc.Document, node *jsondoc.Node) redis.Reply {
+			arr, ok := node.Value.(*jsondoc.Array)
+			if !ok || len(arr.Items) == 0 {
+				return nil
+			}
+			// 下标超出范围时弹出首尾元素
+			i := index
+			if i < 0 {
+				i += len(arr.Items)
+			}
+			if i < 0 {
+				i = 0
+			}
+			if i >= len(arr.Items) {
+				i = len(arr.Items) - 1
+			}
+			val := arr.Items[i]
+			arr.Items = append(arr.Items[:i], arr.Items[i+1:]...)
+			return protocol.MakeBulkReply(jsondoc.Marshal(val))
+		})
+	if errReply != nil {
+		return errReply
+	}
+	if path.IsLegacy() {
+		return results[len(results)-1]
+	}
+	return protocol.MakeMultiRawReply(results)
+}
+
+// JSON.OBJKEYS key [path]
+func execJSONObjKeys(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return protocol.MakeArgNumErrReply("json.objkeys")
+	}
+	rawPath := jsonRootPath
+	if len(args) == 2 {
+		rawPath = string(args[1])
+	}
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	nodes := path.Evaluate(doc.Root)
+	results := make([]redis.Reply, len(nodes))
+	for i, node := range nodes {
+		obj, ok := node.Value.(*jsondoc.Object)
+		if !ok {
+			if path.IsLegacy() {
+				return jsonWrongType("object", node.Value)
+			}
+			results[i] = protocol.MakeNullMultiBulkReply()
+			continue
+		}
+		keys := make([][]byte, obj.Len())
+		for j, key := range obj.Keys() {
+			keys[j] = []byte(key)
+		}
+		results[i] = protocol.MakeMultiBulkReply(keys)
+	}
+	if path.IsLegacy() {
+		if len(results) == 0 {
+			return jsonPathNotExist(path)
+		}
+		return results[0]
+	}
+	return protocol.MakeMultiRawReply(results)
+}
+
+// JSON.TYPE key [path]
+func execJSONType(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return protocol.MakeArgNumErrReply("json.type")
+	}
+	rawPath := jsonRootPath
+	if len(args) == 2 {
+		rawPath = string(args[1])
+	}
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	nodes := path.Evaluate(doc.Root)
+	if path.IsLegacy() {
+		if len(nodes) == 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeStatusReply(jsondoc.TypeName(nodes[0].Value))
+	}
+	types := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		types[i] = []byte(jsondoc.TypeName(node.Value))
+	}
+	return protocol.MakeMultiBulkReply(types)
+}
+
+func init() {
+	RegisterCommand("JSON.Set", execJSONSet, -4)
+	RegisterCommand("JSON.Get", execJSONGet, -2)
+	RegisterCommand("JSON.Del", execJSONDel, -2)
+	RegisterCommand("JSON.NumIncrBy", execJSONNumIncrBy, 4)
+	RegisterCommand("JSON.StrAppend", execJSONStrAppend, -3)
+	RegisterCommand("JSON.ArrAppend", execJSONArrAppend, -4)
+	RegisterCommand("JSON.ArrPop", execJSONArrPop, -2)
+	RegisterCommand("JSON.ObjKeys", execJSONObjKeys, -2)
+	RegisterCommand("JSON.Type", execJSONType, -2)
+}
@@ -0,0 +1,25 @@
+package database
+
+import "testing"
+
+func Test_JSONNumIncrBy(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, `json.set j $ {"i":9223372036854775807,"f":1.5e308,"n":1,"s":"x"}`)
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"json.numincrby j $.n 2", "$3\r\n[3]\r\n"},
+		{"json.numincrby j $.* 1", "$39\r\n[9.223372036854776e+18,1.5e+308,4,null]\r\n"},
+		// 结果为无穷大时返回错误，不修改任何值
+		{"json.numincrby j $.* 1.5e308", "-ERR result is not a finite number\r\n"},
+		{"json.get j $.n", "$3\r\n[4]\r\n"},
+		{"json.numincrby j .i -9.3e18", "$21\r\n-7.66279631452242e+16\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
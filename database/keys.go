@@ -1,10 +1,21 @@
 package database
 
 import (
+	"github.com/jiangh156/godis/datastruct/bloom"
+	"github.com/jiangh156/godis/datastruct/cms"
+	Hash "github.com/jiangh156/godis/datastruct/hash"
+	"github.com/jiangh156/godis/datastruct/jsondoc"
+	List "github.com/jiangh156/godis/datastruct/list"
+	Set "github.com/jiangh156/godis/datastruct/set"
+	"github.com/jiangh156/godis/datastruct/sortedset"
+	"github.com/jiangh156/godis/datastruct/stream"
+	"github.com/jiangh156/godis/datastruct/timeseries"
+	"github.com/jiangh156/godis/datastruct/topk"
 	"github.com/jiangh156/godis/interface/redis"
 	"github.com/jiangh156/godis/lib/wildcard"
 	"github.com/jiangh156/godis/redis/protocol"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,6 +35,19 @@ func execDel(db *DB, args [][]byte) redis.Reply {
 	return protocol.MakeIntReply(int64(result))
 }
 
+// UNLINK k1 k2 k3, 与DEL相同但value在后台释放
+func execUnlink(db *DB, args [][]byte) redis.Reply {
+	result := 0
+	for _, arg := range args {
+		if db.unlink(string(arg)) {
+			result++
+		}
+	}
+	aofReply := db.makeAofCmd("unlink", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(int64(result))
+}
+
 // EXISTS k1 k2 k3
 func execExists(db *DB, args [][]byte) redis.Reply {
 	if len(args) < 1 {
@@ -75,7 +99,7 @@ func execType(db *DB, args [][]byte) redis.Reply {
 		return protocol.MakeErrReply("ERR wrong number of arguments for 'type' command")
 	}
 	key := string(args[0])
-	entity, exists := db.Get(key)
+	entity, exists := db.peek(key)
 	if !exists {
 		return protocol.MakeStatusReply("none")
 	}
@@ -83,10 +107,31 @@ func execType(db *DB, args [][]byte) redis.Reply {
 		db.Persist(key)
 		return protocol.MakeStatusReply("none")
 	}
-	// TODO 目前只有string，后续完善
 	switch entity.Data.(type) {
 	case []byte:
 		return protocol.MakeStatusReply("string")
+	case List.List:
+		return protocol.MakeStatusReply("list")
+	case *Hash.Hash:
+		return protocol.MakeStatusReply("hash")
+	case *Set.Set:
+		return protocol.MakeStatusReply("set")
+	case *sortedset.SortedSet:
+		return protocol.MakeStatusReply("zset")
+	case *stream.Stream:
+		return protocol.MakeStatusReply("stream")
+	case *bloom.Bloom:
+		return protocol.MakeStatusReply(moduleBloom)
+	case *bloom.Cuckoo:
+		return protocol.MakeStatusReply(moduleCuckoo)
+	case *cms.CountMinSketch:
+		return protocol.MakeStatusReply(moduleCMS)
+	case *topk.TopK:
+		return protocol.MakeStatusReply(moduleTopK)
+	case *jsondoc.Document:
+		return protocol.MakeStatusReply(moduleJSON)
+	case *timeseries.Series:
+		return protocol.MakeStatusReply(moduleTimeSeries)
 	}
 	return protocol.MakeUnknownErrReply()
 }
@@ -158,8 +203,132 @@ func execExpire(db *DB, args [][]byte) redis.Reply {
 	db.Expire(key, expireTime)
 	return protocol.MakeIntReply(1)
 }
+
+// 长度不超过该值的字符串使用embstr编码
+const embstrSizeLimit = 44
+
+// getEncoding 返回value的底层编码
+func getEncoding(entity *DataEntity) string {
+	switch data := entity.Data.(type) {
+	case []byte:
+		if val, err := strconv.ParseInt(string(data), 10, 64); err == nil && strconv.FormatInt(val, 10) == string(data) {
+			return "int"
+		}
+		if len(data) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case List.List:
+		return "linkedlist"
+	case *Hash.Hash:
+		return data.Encoding()
+	case *Set.Set:
+		return data.Encoding()
+	case *sortedset.SortedSet:
+		return data.Encoding()
+	case *stream.Stream:
+		return "stream"
+	case *bloom.Bloom, *bloom.Cuckoo, *cms.CountMinSketch, *topk.TopK, *jsondoc.Document, *timeseries.Series:
+		return "raw"
+	}
+	return "unknown"
+}
+
+// OBJECT ENCODING | IDLETIME | FREQ | REFCOUNT key
+func execObject(db *DB, args [][]byte) redis.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	if subCommand == "help" && len(args) == 1 {
+		return protocol.MakeMultiBulkReply([][]byte{
+			[]byte("OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"),
+			[]byte("ENCODING <key>"),
+			[]byte("    Return the kind of internal representation used in order to store the value associated with a <key>."),
+			[]byte("FREQ <key>"),
+			[]byte("    Return the access frequency index of the <key>. The returned integer is proportional to the logarithm of the recent access frequency of the key."),
+			[]byte("IDLETIME <key>"),
+			[]byte("    Return the idle time of the <key>, that is the approximated number of seconds elapsed since the last access to the key."),
+			[]byte("REFCOUNT <key>"),
+			[]byte("    Return the number of references of the value associated with the specified <key>."),
+		})
+	}
+	if len(args) != 2 {
+		return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" + string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	key := string(args[1])
+	// 内省命令不更新访问元数据
+	entity, exists := db.peek(key)
+	if exists && db.IsExpire(key) {
+		db.Persist(key)
+		exists = false
+	}
+	switch subCommand {
+	case "encoding":
+		if !exists {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeBulkReply([]byte(getEncoding(entity)))
+	case "idletime":
+		if !exists {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeIntReply(entity.IdleTime())
+	case "freq":
+		if !exists {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeIntReply(int64(entity.Freq()))
+	case "refcount":
+		if !exists {
+			return protocol.MakeNullBulkReply()
+		}
+		// value不在key之间共享
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" + string(args[0]) + "'. Try OBJECT HELP.")
+}
+
+// TOUCH key [key ...]
+func execTouch(db *DB, args [][]byte) redis.Reply {
+	count := 0
+	for _, arg := range args {
+		key := string(arg)
+		if _, exists := db.Get(key); exists && !db.IsExpire(key) {
+			count++
+		}
+	}
+	return protocol.MakeIntReply(int64(count))
+}
+
+// randomKeyAttempts RANDOMKEY 跳过过期key的最大尝试次数
+const randomKeyAttempts = 100
+
+// RANDOMKEY
+func execRandomKey(db *DB, args [][]byte) redis.Reply {
+	for i := 0; i < randomKeyAttempts && db.Data.Len() > 0; i++ {
+		keys := db.Data.RandomKeys(1)
+		if len(keys) == 0 {
+			break
+		}
+		key := keys[0]
+		if _, exists := db.peek(key); !exists {
+			continue
+		}
+		if db.IsExpire(key) {
+			db.Remove(key)
+			continue
+		}
+		return protocol.MakeBulkReply([]byte(key))
+	}
+	return protocol.MakeNullBulkReply()
+}
+
+// DBSIZE
+func execDBSize(db *DB, args [][]byte) redis.Reply {
+	return protocol.MakeIntReply(int64(db.Data.Len()))
+}
+
 func init() {
 	RegisterCommand("Del", execDel, -2)
+	RegisterCommand("Unlink", execUnlink, -2)
 	RegisterCommand("Exists", execExists, -2)
 	RegisterCommand("Keys", execKeys, 2)
 	RegisterCommand("FlushDB", execFlushDB, 1)
@@ -167,6 +336,10 @@ func init() {
 	RegisterCommand("Rename", execRename, 3)
 	RegisterCommand("RenameNX", execRenameNX, 3)
 	RegisterCommand("Expire", execExpire, 3)
+	RegisterCommand("Object", execObject, -2)
+	RegisterCommand("Touch", execTouch, -2)
+	RegisterCommand("RandomKey", execRandomKey, 1)
+	RegisterCommand("DBSize", execDBSize, 1)
 
 	RegisterSingleCommand("FLUSHDB")
 }
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_ObjectEncoding(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	long := strings.Repeat("x", 65)
+	steps := []struct {
+		line string
+		key  string
+		want string
+	}{
+		{"hset h a 1", "h", "listpack"},
+		{"hset h long " + long, "h", "hashtable"},
+		// 删除长字段后不会转换回 listpack
+		{"hdel h long", "h", "hashtable"},
+		{"sadd s 1 2 3", "s", "intset"},
+		{"sadd s x", "s", "hashtable"},
+		{"zadd z 1 a", "z", "listpack"},
+		{"zadd z 2 " + long, "z", "skiplist"},
+		{"set str v", "str", "embstr"},
+	}
+	for _, step := range steps {
+		exec(s, conn, step.line)
+		want := "$" + strconv.Itoa(len(step.want)) + "\r\n" + step.want + "\r\n"
+		if reply := exec(s, conn, "object encoding "+step.key); reply != want {
+			t.Errorf("%s err: %q, want: %s", step.line, reply, step.want)
+		}
+	}
+	// 超过数量阈值后转换
+	for i := 0; i <= 128; i++ {
+		exec(s, conn, "hset h2 f"+strconv.Itoa(i)+" v")
+		exec(s, conn, "zadd z2 "+strconv.Itoa(i)+" m"+strconv.Itoa(i))
+	}
+	for i := 0; i <= 512; i++ {
+		exec(s, conn, "sadd s2 "+strconv.Itoa(i))
+	}
+	for key, want := range map[string]string{"h2": "hashtable", "z2": "skiplist", "s2": "hashtable"} {
+		if reply := exec(s, conn, "object encoding "+key); !strings.Contains(reply, want) {
+			t.Errorf("object encoding %s err: %q, want: %s", key, reply, want)
+		}
+	}
+	// 转换后数据保持不变
+	if reply := exec(s, conn, "hget h2 f128") + exec(s, conn, "zscore z2 m0") + exec(s, conn, "sismember s2 512"); reply != "$1\r\nv\r\n$1\r\n0\r\n:1\r\n" {
+		t.Errorf("convert err: %q", reply)
+	}
+}
+
+func Test_KeyIntrospection(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	for _, line := range []string{"set str v", "rpush l a", "hset h f v", "sadd s a", "zadd z 1 a", "xadd x * f v",
+		"bf.add bf a", "cms.initbydim c 10 2", "topk.reserve k 2", "json.set j $ 1", "ts.create ts"} {
+		if reply := exec(s, conn, line); reply[0] == '-' {
+			t.Fatalf("%s err: %q", line, reply)
+		}
+	}
+	types := map[string]string{
+		"str": "string", "l": "list", "h": "hash", "s": "set", "z": "zset", "x": "stream", "nosuch": "none",
+		"bf": "MBbloom--", "c": "CMSk-TYPE", "k": "TopK-TYPE", "j": "ReJSON-RL", "ts": "TSDB-TYPE",
+	}
+	for key, want := range types {
+		if reply := exec(s, conn, "type "+key); reply != "+"+want+"\r\n" {
+			t.Errorf("type %s err: %q, want: %s", key, reply, want)
+		}
+	}
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"dbsize", ":11\r\n"},
+		{"touch str l nosuch", ":2\r\n"},
+		{"object refcount str", ":1\r\n"},
+		{"object idletime str", ":0\r\n"},
+		{"object encoding nosuch", "$-1\r\n"},
+		{"object nosuch str", "-ERR unknown subcommand or wrong number of arguments for 'nosuch'. Try OBJECT HELP.\r\n"},
+		{"flushdb", "+OK\r\n"},
+		{"randomkey", "$-1\r\n"},
+		{"set only v", "+OK\r\n"},
+		{"randomkey", "$4\r\nonly\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
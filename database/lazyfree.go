@@ -0,0 +1,87 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/dict"
+	Hash "github.com/jiangh156/godis/datastruct/hash"
+	List "github.com/jiangh156/godis/datastruct/list"
+	Set "github.com/jiangh156/godis/datastruct/set"
+	"github.com/jiangh156/godis/datastruct/sortedset"
+	"github.com/jiangh156/godis/datastruct/stream"
+)
+
+/*
+ * 惰性释放: UNLINK 和 FLUSHALL ASYNC 在命令中只断开 key 与 value 的关联,
+ * 被替换下来的字典在后台 goroutine 中清空，大 value 的最后一个引用也由后台 goroutine 持有并丢弃,
+ * 内存最终由 GC 回收
+ */
+
+// 元素个数超过该值的value交给后台释放
+const lazyfreeThreshold = 64
+
+var lazyfreeChan = make(chan any, 1<<10)
+
+func init() {
+	go handleLazyfree()
+}
+
+func handleLazyfree() {
+	for data := range lazyfreeChan {
+		if d, ok := data.(dict.Dict); ok {
+			d.Clear()
+		}
+	}
+}
+
+// valueLen 返回value的元素个数，字符串等单个对象返回1
+func valueLen(data any) int {
+	switch val := data.(type) {
+	case List.List:
+		return val.Len()
+	case *Hash.Hash:
+		return val.Len()
+	case *Set.Set:
+		return val.Len()
+	case *sortedset.SortedSet:
+		return int(val.Len())
+	case *stream.Stream:
+		return int(val.Len())
+	}
+	return 1
+}
+
+// lazyfree 大value在后台释放，小value直接丢弃
+func lazyfree(data any) {
+	if valueLen(data) <= lazyfreeThreshold {
+		return
+	}
+	select {
+	case lazyfreeChan <- data:
+	default:
+		// 队列已满时由GC直接回收
+	}
+}
+
+// unlink 删除key并在后台释放value
+func (db *DB) unlink(key string) bool {
+	entity, exists := db.peek(key)
+	if !exists {
+		return false
+	}
+	db.Remove(key)
+	db.Persist(key)
+	if entity != nil {
+		lazyfree(entity.Data)
+	}
+	return true
+}
+
+// flushAsync 替换为新的字典，旧字典在后台清空
+func (db *DB) flushAsync() {
+	data, ttlMap, hashTTLKeys := db.Data, db.TTLMap, db.hashTTLKeys
+	db.Data = dict.MakeSyncDict()
+	db.TTLMap = dict.MakeSyncDict()
+	db.hashTTLKeys = dict.MakeSyncDict()
+	lazyfreeChan <- data
+	lazyfreeChan <- ttlMap
+	lazyfreeChan <- hashTTLKeys
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/lib/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeConn struct {
+	dbIndex int
+}
+
+func (c *fakeConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *fakeConn) GetDBIndex() int {
+	return c.dbIndex
+}
+
+func (c *fakeConn) SelectDB(dbNum int) {
+	c.dbIndex = dbNum
+}
+
+func makeTestServer(t *testing.T) *SingleServer {
+	s := NewSingleServer()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// exec 执行以空格分隔的命令，返回 RESP 格式的结果
+func exec(s *SingleServer, conn redis.Connection, line string) string {
+	return string(s.Exec(conn, utils.ToCmdLine(strings.Fields(line)...)).ToBytes())
+}
+
+// execArgs 执行参数中含有空格或二进制数据的命令
+func execArgs(s *SingleServer, conn redis.Connection, args ...string) redis.Reply {
+	return s.Exec(conn, utils.ToCmdLine(args...))
+}
+
+func Test_ConcurrentWrites(t *testing.T) {
+	s := makeTestServer(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn := &fakeConn{}
+			for j := 0; j < 100; j++ {
+				member := strconv.Itoa(i*1000 + j)
+				exec(s, conn, "hset h "+member+" v")
+				exec(s, conn, "sadd s "+member)
+				exec(s, conn, "zadd z 1 "+member)
+				if j%2 == 0 {
+					exec(s, conn, "hdel h "+member)
+					exec(s, conn, "srem s "+member)
+					exec(s, conn, "zrem z "+member)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	conn := &fakeConn{}
+	for _, line := range []string{"hkeys h", "smembers s", "zrange z 0 -1"} {
+		if reply := exec(s, conn, line); !strings.HasPrefix(reply, "*400\r\n") {
+			t.Errorf("%s err: %q", line, reply[:8])
+		}
+	}
+}
+
+func Test_BlockingPop(t *testing.T) {
+	s := makeTestServer(t)
+	done := make(chan string)
+	go func() {
+		done <- exec(s, &fakeConn{}, "bzpopmin z 1")
+	}()
+	// 阻塞的客户端不能占用数据库的锁
+	time.Sleep(50 * time.Millisecond)
+	if reply := exec(s, &fakeConn{}, "zadd z 1 a"); reply != ":1\r\n" {
+		t.Fatalf("zadd err: %q", reply)
+	}
+	if reply := <-done; reply != "*3\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\n1\r\n" {
+		t.Errorf("bzpopmin err: %q", reply)
+	}
+}
+
+func Test_CrossDBMove(t *testing.T) {
+	s := makeTestServer(t)
+	conn0, conn1 := &fakeConn{}, &fakeConn{dbIndex: 1}
+	exec(s, conn0, "set a 0")
+	exec(s, conn1, "set b 1")
+	// 相反方向的 MOVE 不会互相死锁
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			exec(s, &fakeConn{}, "move a 1")
+		}()
+		go func() {
+			defer wg.Done()
+			exec(s, &fakeConn{dbIndex: 1}, "move a 0")
+		}()
+	}
+	wg.Wait()
+	if exec(s, conn0, "exists a")+exec(s, conn1, "exists a") != ":1\r\n:0\r\n" &&
+		exec(s, conn0, "exists a")+exec(s, conn1, "exists a") != ":0\r\n:1\r\n" {
+		t.Errorf("move err")
+	}
+}
+
+func Test_SwapDBConcurrent(t *testing.T) {
+	s := makeTestServer(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			conn := &fakeConn{dbIndex: i % 2}
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa(i*1000 + j)
+				exec(s, conn, "set "+key+" v")
+				exec(s, conn, "get "+key)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				exec(s, &fakeConn{}, "swapdb 0 1")
+				exec(s, &fakeConn{}, "info keyspace")
+			}
+		}()
+	}
+	wg.Wait()
+	// 写入的key在两个数据库之间交换，总数不变
+	conn0, conn1 := &fakeConn{}, &fakeConn{dbIndex: 1}
+	size0, _ := strconv.Atoi(strings.Trim(exec(s, conn0, "dbsize"), ":\r\n"))
+	size1, _ := strconv.Atoi(strings.Trim(exec(s, conn1, "dbsize"), ":\r\n"))
+	if size0+size1 != 400 {
+		t.Errorf("swapdb err: %d + %d", size0, size1)
+	}
+	exec(s, conn0, "flushall async")
+	if reply := exec(s, conn0, "dbsize") + exec(s, conn1, "dbsize"); reply != ":0\r\n:0\r\n" {
+		t.Errorf("flushall err: %q", reply)
+	}
+}
+
+func Test_MaxMemory(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "rpush list a b c")
+	exec(s, conn, "config set maxmemory 1")
+	t.Cleanup(func() { exec(s, conn, "config set maxmemory 0") })
+	// 超过 maxmemory 时拒绝会占用内存的写命令，读命令和删除数据的命令不受影响
+	if reply := exec(s, conn, "set a 1"); !strings.HasPrefix(reply, "-OOM ") {
+		t.Errorf("set err: %q", reply)
+	}
+	if reply := exec(s, conn, "lrange list 0 -1"); !strings.HasPrefix(reply, "*3\r\n") {
+		t.Errorf("lrange err: %q", reply)
+	}
+	if reply := exec(s, conn, "lpop list") + exec(s, conn, "del list"); reply != "$1\r\na\r\n:1\r\n" {
+		t.Errorf("lpop/del err: %q", reply)
+	}
+	exec(s, conn, "config set maxmemory 0")
+	if reply := exec(s, conn, "set a 1"); reply != "+OK\r\n" {
+		t.Errorf("set err: %q", reply)
+	}
+}
+
+func Test_ConfiguredDatabases(t *testing.T) {
+	old := config.Properties.Databases
+	config.Properties.Databases = 4
+	t.Cleanup(func() { config.Properties.Databases = old })
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "set a 1")
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"select 3", "+OK\r\n"},
+		{"select 4", "-ERR DB index is out of range\r\n"},
+		{"select -1", "-ERR DB index is out of range\r\n"},
+		{"select 0", "+OK\r\n"},
+		{"swapdb 0 4", "-ERR DB index is out of range\r\n"},
+		{"move a 4", "-ERR DB index is out of range\r\n"},
+		{"copy a b DB 4", "-ERR DB index is out of range\r\n"},
+		{"swapdb 0 3", "+OK\r\n"},
+		{"exists a", ":0\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+	if reply := exec(s, &fakeConn{dbIndex: 3}, "get a"); reply != "$1\r\n1\r\n" {
+		t.Errorf("swapdb err: %q", reply)
+	}
+}
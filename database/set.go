@@ -4,7 +4,9 @@ import (
 	Set "github.com/jiangh156/godis/datastruct/set"
 	"github.com/jiangh156/godis/interface/redis"
 	"github.com/jiangh156/godis/redis/protocol"
+	"math"
 	"strconv"
+	"strings"
 )
 
 func (db *DB) getAsSet(key string) (*Set.Set, redis.ErrReply) {
@@ -32,6 +34,32 @@ func (db *DB) getOrInitSet(key string) (*Set.Set, redis.ErrReply) {
 	return set, nil
 }
 
+// setToReply 将集合转换为 multi bulk reply
+func setToReply(set *Set.Set) redis.Reply {
+	if set == nil || set.Len() == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	arr := make([][]byte, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		arr = append(arr, []byte(member))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(arr)
+}
+
+// storeSet 将结果集合写入 destination，覆盖原有的值，结果为空时删除 destination
+func (db *DB) storeSet(dest string, set *Set.Set) int {
+	db.Persist(dest)
+	if set == nil || set.Len() == 0 {
+		db.Remove(dest)
+		return 0
+	}
+	db.Put(dest, &DataEntity{
+		Data: set,
+	})
+	return set.Len()
+}
+
 // SADD key member [member ...]
 func execSAdd(db *DB, args [][]byte) redis.Reply {
 	if len(args) < 2 {
@@ -43,12 +71,13 @@ func execSAdd(db *DB, args [][]byte) redis.Reply {
 	if err != nil {
 		return err
 	}
+	added := 0
 	for _, member := range members {
-		set.Add(string(member))
+		added += set.Add(string(member))
 	}
 	aofReply := db.makeAofCmd("sadd", args)
 	db.addAof(aofReply)
-	return protocol.MakeIntReply(int64(len(members)))
+	return protocol.MakeIntReply(int64(added))
 }
 
 // SMEMBERS key
@@ -57,19 +86,11 @@ func execSMembers(db *DB, args [][]byte) redis.Reply {
 		return protocol.MakeErrReply("ERR wrong number of arguments for 'SMembers' command")
 	}
 	key := string(args[0])
-	set, err := db.getOrInitSet(key)
+	set, err := db.getAsSet(key)
 	if err != nil {
 		return err
 	}
-	if set == nil {
-		return protocol.MakeEmptyMultiBulkReply()
-	}
-	slice := set.ToSlice()
-	result := make([][]byte, len(slice))
-	for i, s := range slice {
-		result[i] = []byte(s)
-	}
-	return protocol.MakeMultiBulkReply(result)
+	return setToReply(set)
 }
 
 // SREM key member [member ...]
@@ -79,7 +100,7 @@ func execSRem(db *DB, args [][]byte) redis.Reply {
 	}
 	key := string(args[0])
 	members := args[1:]
-	set, err := db.getOrInitSet(key)
+	set, err := db.getAsSet(key)
 	if err != nil {
 		return err
 	}
@@ -93,6 +114,9 @@ func execSRem(db *DB, args [][]byte) redis.Reply {
 			removed++
 		}
 	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
 	aofReply := db.makeAofCmd("srem", args)
 	db.addAof(aofReply)
 	return protocol.MakeIntReply(int64(removed))
@@ -105,7 +129,7 @@ func execSIsMember(db *DB, args [][]byte) redis.Reply {
 	}
 	key := string(args[0])
 	member := string(args[1])
-	set, err := db.getOrInitSet(key)
+	set, err := db.getAsSet(key)
 	if err != nil {
 		return err
 	}
@@ -120,13 +144,35 @@ func execSIsMember(db *DB, args [][]byte) redis.Reply {
 	return protocol.MakeIntReply(int64(result))
 }
 
+// SMISMEMBER key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SMIsMember' command")
+	}
+	key := string(args[0])
+	members := args[1:]
+	set, err := db.getAsSet(key)
+	if err != nil {
+		return err
+	}
+	replies := make([]redis.Reply, len(members))
+	for i, member := range members {
+		if set != nil && set.Has(string(member)) {
+			replies[i] = protocol.MakeIntReply(1)
+		} else {
+			replies[i] = protocol.MakeIntReply(0)
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
 // SCARD key
 func execSCard(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 1 {
 		return protocol.MakeErrReply("ERR wrong number of arguments for 'SCard' command")
 	}
 	key := string(args[0])
-	set, err := db.getOrInitSet(key)
+	set, err := db.getAsSet(key)
 	if err != nil {
 		return err
 	}
@@ -142,14 +188,14 @@ func execSRandMember(db *DB, args [][]byte) redis.Reply {
 		return protocol.MakeErrReply("ERR wrong number of arguments for 'SRandMember' command")
 	}
 	key := string(args[0])
-	set, err := db.getOrInitSet(key)
+	set, err := db.getAsSet(key)
 	if err != nil {
 		return err
 	}
-	if set == nil {
-		return protocol.MakeIntReply(0)
-	}
 	if len(args) == 1 {
+		if set == nil || set.Len() == 0 {
+			return protocol.MakeNullBulkReply()
+		}
 		member := set.RandomMembers(1)
 		return protocol.MakeBulkReply([]byte(member[0]))
 	} else {
@@ -157,19 +203,28 @@ func execSRandMember(db *DB, args [][]byte) redis.Reply {
 		if err != nil {
 			return protocol.MakeErrReply("ERR value is not an integer or out of range")
 		}
-		count := int(count64)
-		if count > 0 {
-			members := set.RandomMembers(count)
+		if count64 < -math.MaxInt64/2 || count64 > math.MaxInt64/2 {
+			return protocol.MakeErrReply("ERR value is out of range")
+		}
+		if set == nil || set.Len() == 0 {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+		// count 为正数时返回不重复的成员，为负数时允许重复
+		if count64 > 0 {
+			if count64 > int64(set.Len()) {
+				count64 = int64(set.Len())
+			}
+			members := set.RandomDistinctMembers(int(count64))
 			result := make([][]byte, len(members))
 			for i, v := range members {
 				result[i] = []byte(v)
 			}
 			return protocol.MakeMultiBulkReply(result)
-		} else if count < 0 {
-			members := set.RandomDistinctMembers(-count)
-			result := make([][]byte, len(members))
-			for i, v := range members {
-				result[i] = []byte(v)
+		} else if count64 < 0 {
+			// 逐个取成员，不按 count 预先分配
+			result := make([][]byte, 0)
+			for i := int64(0); i < -count64; i++ {
+				result = append(result, []byte(set.RandomMembers(1)[0]))
 			}
 			return protocol.MakeMultiBulkReply(result)
 		} else {
@@ -179,99 +234,262 @@ func execSRandMember(db *DB, args [][]byte) redis.Reply {
 
 }
 
-// SDIFF key [key ...]
-func execSDiff(db *DB, args [][]byte) redis.Reply {
-	if len(args) < 1 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'sdiff' command")
+// SPOP key [count]
+func execSPop(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SPop' command")
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count64 < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	}
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
 	}
-	keys := make([]string, len(args))
-	for i, arg := range args {
-		keys[i] = string(arg)
+	if set == nil {
+		if len(args) == 1 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	members := set.RandomDistinctMembers(count)
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		set.Remove(member)
+		result[i] = []byte(member)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(members) > 0 {
+		// 记录实际被删除的成员，避免重放时重新随机
+		aofReply := db.makeAofCmd("srem", append([][]byte{args[0]}, result...))
+		db.addAof(aofReply)
+	}
+	if len(args) == 1 {
+		if len(result) == 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeBulkReply(result[0])
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// SMOVE source destination member
+func execSMove(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 3 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SMove' command")
+	}
+	src := string(args[0])
+	dest := string(args[1])
+	member := string(args[2])
+	srcSet, errReply := db.getAsSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	destSet, errReply := db.getAsSet(dest)
+	if errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return protocol.MakeIntReply(0)
+	}
+	if src == dest {
+		return protocol.MakeIntReply(1)
 	}
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.Remove(src)
+	}
+	if destSet == nil {
+		destSet, _ = db.getOrInitSet(dest)
+	}
+	destSet.Add(member)
+	aofReply := db.makeAofCmd("smove", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(1)
+}
 
+// sInter 计算多个集合的交集，任意一个key不存在时结果为空
+func (db *DB) sInter(keys [][]byte) (*Set.Set, redis.ErrReply) {
 	var result *Set.Set
-	for i, key := range keys {
-		set, errReply := db.getAsSet(key)
+	for _, key := range keys {
+		set, errReply := db.getAsSet(string(key))
 		if errReply != nil {
-			return errReply
+			return nil, errReply
 		}
 		if set == nil {
-			if i == 0 {
-				// early termination
-				return protocol.MakeEmptyMultiBulkReply()
-			} else {
-				continue
-			}
+			return Set.Make(), nil
 		}
 		if result == nil {
-			// init
 			result = Set.MakeFromVals(set.ToSlice()...)
 		} else {
-			result = result.Diff(set)
-			if result.Len() == 0 {
-				// early termination
-				return protocol.MakeEmptyMultiBulkReply()
-			}
+			result = result.Intersect(set)
 		}
 	}
-
-	if result == nil {
-		// all keys are nil
-		return protocol.MakeEmptyMultiBulkReply()
-	}
-	arr := make([][]byte, result.Len())
-	i := 0
-	result.ForEach(func(member string) bool {
-		arr[i] = []byte(member)
-		i++
-		return true
-	})
-	return protocol.MakeMultiBulkReply(arr)
+	return result, nil
 }
 
-// SUNION key [key ...]
-func execSUnion(db *DB, args [][]byte) redis.Reply {
-	if len(args) < 1 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'SUnion' command")
-	}
-	keys := make([]string, len(args))
-	for i, arg := range args {
-		keys[i] = string(arg)
+// sUnion 计算多个集合的并集，不存在的key视为空集合
+func (db *DB) sUnion(keys [][]byte) (*Set.Set, redis.ErrReply) {
+	result := Set.Make()
+	for _, key := range keys {
+		set, errReply := db.getAsSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if set == nil {
+			continue
+		}
+		result = result.Union(set)
 	}
+	return result, nil
+}
 
+// sDiff 计算第一个集合与其余集合的差集
+func (db *DB) sDiff(keys [][]byte) (*Set.Set, redis.ErrReply) {
 	var result *Set.Set
 	for i, key := range keys {
-		set, errReply := db.getAsSet(key)
+		set, errReply := db.getAsSet(string(key))
 		if errReply != nil {
-			return errReply
+			return nil, errReply
 		}
-		if set == nil {
-			if i == 0 {
-				// early termination
-				return protocol.MakeEmptyMultiBulkReply()
+		if i == 0 {
+			if set == nil {
+				result = Set.Make()
 			} else {
-				continue
+				result = Set.MakeFromVals(set.ToSlice()...)
 			}
+			continue
 		}
-		if result == nil {
-			// init
-			result = Set.MakeFromVals(set.ToSlice()...)
-		} else {
-			result = result.Union(set)
-			if result.Len() == 0 {
-				// early termination
-				return protocol.MakeEmptyMultiBulkReply()
-			}
+		if set != nil && result.Len() > 0 {
+			result = result.Diff(set)
 		}
 	}
-	arr := make([][]byte, result.Len())
-	i := 0
-	result.ForEach(func(member string) bool {
-		arr[i] = []byte(member)
-		i++
-		return true
-	})
-	return protocol.MakeMultiBulkReply(arr)
+	return result, nil
+}
+
+// SINTER key [key ...]
+func execSInter(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 1 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SInter' command")
+	}
+	result, errReply := db.sInter(args)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(result)
+}
+
+// SINTERSTORE destination key [key ...]
+func execSInterStore(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SInterStore' command")
+	}
+	result, errReply := db.sInter(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	size := db.storeSet(string(args[0]), result)
+	aofReply := db.makeAofCmd("sinterstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(int64(size))
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func execSInterCard(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SInterCard' command")
+	}
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return protocol.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if int(numKeys) > len(args)-1 {
+		return protocol.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys := args[1 : 1+numKeys]
+	rest := args[1+numKeys:]
+	limit := int64(0)
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(string(rest[0])) != "LIMIT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		limit, err = strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil || limit < 0 {
+			return protocol.MakeErrReply("ERR LIMIT can't be negative")
+		}
+	}
+	result, errReply := db.sInter(keys)
+	if errReply != nil {
+		return errReply
+	}
+	size := int64(result.Len())
+	// limit 为 0 表示不限制
+	if limit > 0 && size > limit {
+		size = limit
+	}
+	return protocol.MakeIntReply(size)
+}
+
+// SDIFF key [key ...]
+func execSDiff(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 1 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'sdiff' command")
+	}
+	result, errReply := db.sDiff(args)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(result)
+}
+
+// SDIFFSTORE destination key [key ...]
+func execSDiffStore(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SDiffStore' command")
+	}
+	result, errReply := db.sDiff(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	size := db.storeSet(string(args[0]), result)
+	aofReply := db.makeAofCmd("sdiffstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(int64(size))
+}
+
+// SUNION key [key ...]
+func execSUnion(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 1 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SUnion' command")
+	}
+	result, errReply := db.sUnion(args)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(result)
+}
+
+// SUNIONSTORE destination key [key ...]
+func execSUnionStore(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'SUnionStore' command")
+	}
+	result, errReply := db.sUnion(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	size := db.storeSet(string(args[0]), result)
+	aofReply := db.makeAofCmd("sunionstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(int64(size))
 }
 
 func init() {
@@ -279,9 +497,16 @@ func init() {
 	RegisterCommand("SMembers", execSMembers, 2)
 	RegisterCommand("SRem", execSRem, -3)
 	RegisterCommand("SIsMember", execSIsMember, 3)
-	RegisterCommand("SRandMember", execSIsMember, -2)
+	RegisterCommand("SMIsMember", execSMIsMember, -3)
 	RegisterCommand("SCard", execSCard, 2)
 	RegisterCommand("SRandMember", execSRandMember, -2)
+	RegisterCommand("SPop", execSPop, -2)
+	RegisterCommand("SMove", execSMove, 4)
+	RegisterCommand("SInter", execSInter, -2)
+	RegisterCommand("SInterStore", execSInterStore, -3)
+	RegisterCommand("SInterCard", execSInterCard, -3)
 	RegisterCommand("SDiff", execSDiff, -2)
+	RegisterCommand("SDiffStore", execSDiffStore, -3)
 	RegisterCommand("SUnion", execSUnion, -2)
+	RegisterCommand("SUnionStore", execSUnionStore, -3)
 }
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_SetCommands(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "sadd s1 a b c 1")
+	exec(s, conn, "sadd s2 b c d 1")
+	exec(s, conn, "sadd s3 c")
+	exec(s, conn, "set str v")
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"sintercard 2 s1 s2", ":3\r\n"},
+		{"sintercard 3 s1 s2 s3 LIMIT 1", ":1\r\n"},
+		{"sintercard 2 s1 nosuch", ":0\r\n"},
+		{"sintercard 3 s1 s2", "-ERR Number of keys can't be greater than number of args\r\n"},
+		{"sintercard 0 s1", "-ERR numkeys should be greater than 0\r\n"},
+		{"sintercard 2 s1 s2 LIMIT -1", "-ERR LIMIT can't be negative\r\n"},
+		{"sinter s1 s2 s3", "*1\r\n$1\r\nc\r\n"},
+		{"sinter s1 nosuch", "*0\r\n"},
+		{"sinter s1 str", "-WRONGTYPE Operation against a key holding the wrong king of value\r\n"},
+		{"sinterstore dest s1 s2", ":3\r\n"},
+		{"smismember dest b c d a", "*4\r\n:1\r\n:1\r\n:0\r\n:0\r\n"},
+		// 交集为空时删除目标 key
+		{"sinterstore dest s1 nosuch", ":0\r\n"},
+		{"exists dest", ":0\r\n"},
+		{"smove s1 s3 a", ":1\r\n"},
+		{"smove s1 s3 a", ":0\r\n"},
+		{"smismember s1 a", "*1\r\n:0\r\n"},
+		{"smismember s3 a c 1", "*3\r\n:1\r\n:1\r\n:0\r\n"},
+		{"smove s1 str b", "-WRONGTYPE Operation against a key holding the wrong king of value\r\n"},
+		{"smove nosuch s1 a", ":0\r\n"},
+		{"spop nosuch", "$-1\r\n"},
+		{"spop s1 -1", "-ERR value is out of range, must be positive\r\n"},
+		{"spop s1 0", "*0\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+	// 数量超过集合大小时弹出全部成员并删除 key
+	if reply := exec(s, conn, "spop s2 10"); !strings.HasPrefix(reply, "*4\r\n") || exec(s, conn, "exists s2") != ":0\r\n" {
+		t.Errorf("spop s2 10 err: %q", reply)
+	}
+	// 弹出的成员从集合中删除
+	reply := exec(s, conn, "spop s3")
+	member := reply[len("$1\r\n") : len(reply)-2]
+	if exec(s, conn, "sismember s3 "+member) != ":0\r\n" || exec(s, conn, "scard s3") != ":1\r\n" {
+		t.Errorf("spop err: %q", reply)
+	}
+}
+
+func Test_SRandMember(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	// intset 和 hashtable 两种编码
+	exec(s, conn, "sadd ints 1 2 3")
+	exec(s, conn, "sadd strs a b c")
+	for _, key := range []string{"ints", "strs"} {
+		testCases := []struct {
+			line   string
+			prefix string
+		}{
+			{"srandmember " + key + " -9223372036854775808", "-ERR value is out of range\r\n"},
+			{"srandmember " + key + " 9223372036854775807", "-ERR value is out of range\r\n"},
+			{"srandmember " + key + " 4611686018427387903", "*3\r\n"},
+			{"srandmember " + key + " -5", "*5\r\n"},
+			{"srandmember " + key + " 2", "*2\r\n"},
+			{"srandmember " + key + " 0", "*0\r\n"},
+			{"srandmember " + key, "$1\r\n"},
+		}
+		for _, tt := range testCases {
+			if reply := exec(s, conn, tt.line); !strings.HasPrefix(reply, tt.prefix) {
+				t.Errorf("%s err: %q, want prefix: %q", tt.line, reply, tt.prefix)
+			}
+		}
+	}
+	if reply := exec(s, conn, "srandmember nosuch -3"); reply != "*0\r\n" {
+		t.Errorf("srandmember nosuch err: %q", reply)
+	}
+}
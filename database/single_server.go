@@ -4,68 +4,251 @@ import (
 	"github.com/jiangh156/godis/config"
 	"github.com/jiangh156/godis/interface/db"
 	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/lib/logger"
 	"github.com/jiangh156/godis/lib/sync/atomic"
 	"github.com/jiangh156/godis/redis/protocol"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type SingleServer struct {
 	DBSet      []*DB
 	aofLoading atomic.AtomicBool
+	// 最近一次写AOF文件是否失败
+	aofWriteErr atomic.AtomicBool
+	aofChan     chan *aofPayload
+	aofFile     *os.File
+	// 写入协程退出时关闭
+	aofDone chan struct{}
+	stats   *serverStats
 }
 
+// serverExecFunc 涉及多个数据库或服务器状态的命令，不经过单个数据库执行
+type serverExecFunc func(s *SingleServer, conn redis.Connection, args [][]byte) redis.Reply
+
+var serverCmdTable map[string]serverExecFunc
+
 var RedisServerInstance *SingleServer
 
 var _ db.DataBase = (*SingleServer)(nil)
 
+func init() {
+	serverCmdTable = map[string]serverExecFunc{
+		"select":   (*SingleServer).execSelect,
+		"swapdb":   (*SingleServer).execSwapDB,
+		"flushall": (*SingleServer).execFlushAll,
+		"info":     (*SingleServer).execInfo,
+		"config":   (*SingleServer).execConfig,
+	}
+	RegisterSingleCommand("FLUSHALL")
+	RegisterSingleCommand("INFO")
+}
+
 // redis节点Datebase
 func NewSingleServer() *SingleServer {
-	if config.Properties.Databases == 0 {
+	if config.Properties.Databases <= 0 {
 		config.Properties.Databases = 16
 	}
-	server := &SingleServer{DBSet: make([]*DB, 16)}
+	server := &SingleServer{
+		DBSet: make([]*DB, config.Properties.Databases),
+		stats: makeServerStats(),
+	}
 	for i := range server.DBSet {
 		db := MakeDB()
 		db.index = i
 		server.DBSet[i] = db
 	}
 	RedisServerInstance = server
-	//TODO AOF
 	if config.Properties.AppendOnly {
+		// 文件末尾所在的数据库未知，第一条命令前总是写入 SELECT
+		if err := server.openAof(-1); err != nil {
+			logger.Fatal("open aof failed: " + err.Error())
+		}
 		server.aofLoading.Set(true)
-		LoadAof()
+		if err := LoadAof(); err != nil {
+			logger.Fatal("load aof failed: " + err.Error())
+		}
 	}
 	return server
 }
 
 func (s *SingleServer) Exec(conn redis.Connection, args [][]byte) redis.Reply {
-	// 处理select命令
-	cmdName := args[0]
-	if strings.ToLower(string(cmdName)) == "select" {
-		return execSelect(conn, args)
+	cmdName := strings.ToLower(string(args[0]))
+	start := time.Now()
+	reply := s.execCommand(conn, cmdName, args)
+	// 加载AOF时执行的命令不计入统计
+	if !s.aofLoading.Get() {
+		s.stats.record(cmdName, time.Since(start))
+	}
+	return reply
+}
+
+var oomErrReply = protocol.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'.")
+
+func (s *SingleServer) execCommand(conn redis.Connection, cmdName string, args [][]byte) redis.Reply {
+	// 没有淘汰策略，超过 maxmemory 时拒绝会占用内存的写命令，加载AOF时不检查
+	if maxMemory := config.MaxMemory(); maxMemory > 0 && !s.aofLoading.Get() && commandDenyOOM(cmdName) &&
+		usedMemory() > uint64(maxMemory) {
+		return oomErrReply
+	}
+	if exec, ok := serverCmdTable[cmdName]; ok {
+		return exec(s, conn, args)
+	}
+	return s.execOnDB(conn.GetDBIndex(), conn, args)
+}
+
+// dbIndexArgs 返回命令中引用的数据库编号
+func dbIndexArgs(cmdName string, args [][]byte) [][]byte {
+	switch cmdName {
+	case "select":
+		if len(args) > 1 {
+			return args[1:2]
+		}
+	case "swapdb":
+		if len(args) > 2 {
+			return args[1:3]
+		}
+	case "move":
+		if len(args) > 2 {
+			return args[2:3]
+		}
+	case "copy":
+		for i := 3; i+1 < len(args); i++ {
+			if strings.ToLower(string(args[i])) == "db" {
+				return args[i+1 : i+2]
+			}
+		}
+	}
+	return nil
+}
+
+// lockDBs 按编号从小到大锁住数据库，跨数据库的命令之间不会死锁，返回解锁的函数
+func (s *SingleServer) lockDBs(indexes ...int) func() {
+	sorted := append([]int(nil), indexes...)
+	sort.Ints(sorted)
+	locked := make([]*DB, 0, len(sorted))
+	for i, index := range sorted {
+		if i > 0 && index == sorted[i-1] {
+			continue
+		}
+		db := s.DBSet[index]
+		db.mu.Lock()
+		locked = append(locked, db)
+	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].mu.Unlock()
+		}
+	}
+}
+
+// lockAllDBs 锁住所有的数据库，用于SWAPDB、FLUSHALL等修改多个数据库的命令
+func (s *SingleServer) lockAllDBs() func() {
+	indexes := make([]int, len(s.DBSet))
+	for i := range indexes {
+		indexes[i] = i
 	}
-	index := conn.GetDBIndex()
+	return s.lockDBs(indexes...)
+}
+
+// execOnDB 锁住命令涉及的数据库后执行，MOVE 和 COPY 还需要锁住目标数据库
+func (s *SingleServer) execOnDB(index int, conn redis.Connection, args [][]byte) redis.Reply {
+	indexes := []int{index}
+	for _, arg := range dbIndexArgs(strings.ToLower(string(args[0])), args) {
+		if i, err := strconv.Atoi(string(arg)); err == nil && i >= 0 && i < len(s.DBSet) {
+			indexes = append(indexes, i)
+		}
+	}
+	unlock := s.lockDBs(indexes...)
+	defer unlock()
 	return s.DBSet[index].Exec(conn, args)
 }
 
-func execSelect(conn redis.Connection, args [][]byte) redis.Reply {
+func (s *SingleServer) execSelect(conn redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("select")
+	}
 	dbNum, err := strconv.ParseInt(string(args[1]), 10, 64)
 	if err != nil {
 		return protocol.MakeErrReply("ERR illegal number: " + string(args[1]))
 	}
-	if dbNum < 0 || dbNum > 15 {
-		return protocol.MakeErrReply("ERR invalid DB index: " + strconv.Itoa(int(dbNum)))
+	if dbNum < 0 || dbNum >= int64(len(s.DBSet)) {
+		return protocol.MakeErrReply("ERR DB index is out of range")
 	}
+	// AOF 在写入命令时记录所在的数据库，不需要记录 SELECT
 	conn.SelectDB(int(dbNum))
-	if config.Properties.AppendOnly {
-		aofReply := RedisServerInstance.DBSet[0].makeAofCmd("select", args[1:])
-		RedisServerInstance.DBSet[0].addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+// SWAPDB index1 index2, 交换两个数据库的数据，所有连接立即看到交换后的数据
+func (s *SingleServer) execSwapDB(conn redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 3 {
+		return protocol.MakeArgNumErrReply("swapdb")
+	}
+	index1, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return protocol.MakeErrReply("ERR invalid first DB index")
+	}
+	index2, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return protocol.MakeErrReply("ERR invalid second DB index")
+	}
+	if index1 < 0 || index1 >= len(s.DBSet) || index2 < 0 || index2 >= len(s.DBSet) {
+		return protocol.MakeErrReply("ERR DB index is out of range")
+	}
+	// 其他连接读写这两个数据库时持有各自的锁，AOF写入0号数据库
+	unlock := s.lockDBs(0, index1, index2)
+	defer unlock()
+	db1, db2 := s.DBSet[index1], s.DBSet[index2]
+	if db1 != db2 {
+		db1.Data, db2.Data = db2.Data, db1.Data
+		db1.TTLMap, db2.TTLMap = db2.TTLMap, db1.TTLMap
+		db1.hashTTLKeys, db2.hashTTLKeys = db2.hashTTLKeys, db1.hashTTLKeys
+		// 唤醒阻塞的客户端在交换后的数据上重试
+		db1.signalAll()
+		db2.signalAll()
+	}
+	aofReply := s.DBSet[0].makeAofCmd("swapdb", args[1:])
+	s.DBSet[0].addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+// FLUSHALL [ASYNC | SYNC]
+func (s *SingleServer) execFlushAll(conn redis.Connection, args [][]byte) redis.Reply {
+	async := false
+	if len(args) > 2 {
+		return protocol.MakeArgNumErrReply("flushall")
+	}
+	if len(args) == 2 {
+		switch strings.ToUpper(string(args[1])) {
+		case "ASYNC":
+			async = true
+		case "SYNC":
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	unlock := s.lockAllDBs()
+	defer unlock()
+	for _, db := range s.DBSet {
+		if async {
+			db.flushAsync()
+		} else {
+			db.Flush()
+		}
 	}
+	aofReply := s.DBSet[0].makeAofCmd("flushall", args[1:])
+	s.DBSet[0].addAof(aofReply)
 	return protocol.MakeOkReply()
 }
 
 func (s *SingleServer) Close() {
+	unlock := s.lockAllDBs()
+	s.closeAof()
+	unlock()
 	for _, db := range s.DBSet {
 		db.Close()
 	}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"bytes"
+	List "github.com/jiangh156/godis/datastruct/list"
+	Set "github.com/jiangh156/godis/datastruct/set"
+	"github.com/jiangh156/godis/datastruct/sortedset"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type sortOptions struct {
+	by       string
+	dontSort bool // BY 的模式中没有 *，不排序
+	offset   int
+	count    int // 小于 0 时不限制
+	gets     []string
+	desc     bool
+	alpha    bool
+	store    string
+}
+
+type sortItem struct {
+	value  []byte
+	weight []byte // ALPHA 排序使用的比较值
+	score  float64
+}
+
+// parseSortOptions 解析 SORT 的参数，readOnly 为 true 时不允许 STORE
+func parseSortOptions(args [][]byte, readOnly bool) (*sortOptions, redis.Reply) {
+	opts := &sortOptions{count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "ASC":
+			opts.desc = false
+		case "DESC":
+			opts.desc = true
+		case "ALPHA":
+			opts.alpha = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			offset, err1 := strconv.Atoi(string(args[i+1]))
+			count, err2 := strconv.Atoi(string(args[i+2]))
+			if err1 != nil || err2 != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			opts.offset, opts.count = offset, count
+			i += 2
+		case "BY":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.by = string(args[i+1])
+			opts.dontSort = !strings.Contains(opts.by, "*")
+			i++
+		case "GET":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.gets = append(opts.gets, string(args[i+1]))
+			i++
+		case "STORE":
+			if readOnly || i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.store = string(args[i+1])
+			i++
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+/*
+ * lookupByPattern 将模式中的第一个 * 替换为元素后读取对应的值
+ * "#" 返回元素本身，"key*->field" 读取哈希字段，其他情况读取字符串
+ * 模式中没有 * 或者值不存在时返回 nil
+ */
+func (db *DB) lookupByPattern(pattern string, element []byte) []byte {
+	if pattern == "#" {
+		return element
+	}
+	star := strings.Index(pattern, "*")
+	if star < 0 {
+		return nil
+	}
+	field := ""
+	if arrow := strings.Index(pattern[star+1:], "->"); arrow >= 0 && star+1+arrow+2 < len(pattern) {
+		field = pattern[star+1+arrow+2:]
+		pattern = pattern[:star+1+arrow]
+	}
+	key := pattern[:star] + string(element) + pattern[star+1:]
+	if field == "" {
+		val, _ := db.getAsString(key)
+		return val
+	}
+	hash, _ := db.getAsHash(key)
+	if hash == nil {
+		return nil
+	}
+	val, _ := hash.Get(field)
+	return val
+}
+
+// sortSource 读取需要排序的元素，有序集合按分数顺序返回
+func (db *DB) sortSource(key string) ([][]byte, bool, redis.Reply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, false, nil
+	}
+	elements := make([][]byte, 0)
+	switch data := entity.Data.(type) {
+	case List.List:
+		data.ForEach(func(i int, val any) bool {
+			elements = append(elements, val.([]byte))
+			return true
+		})
+	case *Set.Set:
+		for _, member := range data.ToSlice() {
+			elements = append(elements, []byte(member))
+		}
+		return elements, true, nil
+	case *sortedset.SortedSet:
+		data.ForEach(0, data.Len(), false, func(element *sortedset.Element) bool {
+			elements = append(elements, []byte(element.Member))
+			return true
+		})
+	default:
+		return nil, false, &protocol.WrongTypeErrReply{}
+	}
+	return elements, false, nil
+}
+
+func execSortGeneric(db *DB, args [][]byte, readOnly bool) redis.Reply {
+	opts, errReply := parseSortOptions(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	elements, isSet, errReply := db.sortSource(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	items := make([]*sortItem, len(elements))
+	for i, element := range elements {
+		items[i] = &sortItem{value: element}
+	}
+	// 集合的遍历顺序不确定，不排序时也按字典序排列以保证结果稳定
+	dontSort := opts.dontSort
+	alpha := opts.alpha
+	if dontSort && isSet {
+		dontSort, alpha = false, true
+		opts.by = ""
+	}
+	if !dontSort {
+		for _, item := range items {
+			item.weight = item.value
+			if opts.by != "" {
+				item.weight = db.lookupByPattern(opts.by, item.value)
+			}
+			if alpha {
+				continue
+			}
+			// 缺少权重时按 0 处理
+			if item.weight == nil {
+				continue
+			}
+			score, err := strconv.ParseFloat(string(item.weight), 64)
+			if err != nil || score != score {
+				return protocol.MakeErrReply("ERR One or more scores can't be converted into double")
+			}
+			item.score = score
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			a, b := items[i], items[j]
+			cmp := 0
+			if alpha {
+				cmp = bytes.Compare(a.weight, b.weight)
+			} else if a.score < b.score {
+				cmp = -1
+			} else if a.score > b.score {
+				cmp = 1
+			}
+			// 权重相同时比较元素本身，保证结果稳定
+			if cmp == 0 {
+				cmp = bytes.Compare(a.value, b.value)
+			}
+			if opts.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	} else if opts.desc {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	start, end := opts.offset, len(items)
+	if start < 0 {
+		start = 0
+	}
+	if start > len(items) {
+		start = len(items)
+	}
+	// start+count 可能溢出
+	if opts.count >= 0 && opts.count < end-start {
+		end = start + opts.count
+	}
+	items = items[start:end]
+	result := make([][]byte, 0, len(items))
+	for _, item := range items {
+		if len(opts.gets) == 0 {
+			result = append(result, item.value)
+			continue
+		}
+		for _, pattern := range opts.gets {
+			result = append(result, db.lookupByPattern(pattern, item.value))
+		}
+	}
+	if opts.store == "" {
+		return protocol.MakeMultiBulkReply(result)
+	}
+	list := List.Make()
+	for _, val := range result {
+		// 不存在的值存储为空字符串
+		if val == nil {
+			val = []byte{}
+		}
+		list.Add(val)
+	}
+	db.Persist(opts.store)
+	if list.Len() == 0 {
+		db.Remove(opts.store)
+	} else {
+		db.Put(opts.store, &DataEntity{
+			Data: list,
+		})
+		db.signalKey(opts.store)
+	}
+	aofReply := db.makeAofCmd("sort", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(int64(list.Len()))
+}
+
+// SORT key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC | DESC] [ALPHA] [STORE destination]
+func execSort(db *DB, args [][]byte) redis.Reply {
+	return execSortGeneric(db, args, false)
+}
+
+// SORT_RO key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC | DESC] [ALPHA]
+func execSortRO(db *DB, args [][]byte) redis.Reply {
+	return execSortGeneric(db, args, true)
+}
+
+func init() {
+	RegisterCommand("Sort", execSort, -2)
+	RegisterCommand("Sort_RO", execSortRO, -2)
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/redis/protocol"
+	"testing"
+)
+
+func Test_Sort(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	setup := []string{
+		"rpush nums 3 1 2",
+		"rpush strs b a c",
+		"sadd set 10 9",
+		"zadd zset 1 z 2 y",
+		"set w_1 30", "set w_2 10", "set w_3 20",
+		"set o_1 one", "set o_2 two", "set o_3 three",
+		"hset obj_1 name n1",
+	}
+	for _, line := range setup {
+		exec(s, conn, line)
+	}
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"sort nums", "*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+		{"sort nums DESC LIMIT 0 2", "*2\r\n$1\r\n3\r\n$1\r\n2\r\n"},
+		// 与 Redis 相同，负数的偏移量当作 0
+		{"sort nums LIMIT -1 2", "*2\r\n$1\r\n1\r\n$1\r\n2\r\n"},
+		{"sort nums LIMIT 1 9223372036854775807", "*2\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+		{"sort set", "*2\r\n$1\r\n9\r\n$2\r\n10\r\n"},
+		{"sort zset BY nosort", "*2\r\n$1\r\nz\r\n$1\r\ny\r\n"},
+		{"sort strs", "-ERR One or more scores can't be converted into double\r\n"},
+		{"sort strs ALPHA DESC", "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n"},
+		{"sort nums BY w_*", "*3\r\n$1\r\n2\r\n$1\r\n3\r\n$1\r\n1\r\n"},
+		{"sort nums BY w_* GET o_* GET #", "*6\r\n$3\r\ntwo\r\n$1\r\n2\r\n$5\r\nthree\r\n$1\r\n3\r\n$3\r\none\r\n$1\r\n1\r\n"},
+		{"sort nums GET obj_*->name", "*3\r\n$2\r\nn1\r\n$-1\r\n$-1\r\n"},
+		{"sort nums BY nosort", "*3\r\n$1\r\n3\r\n$1\r\n1\r\n$1\r\n2\r\n"},
+		{"sort nums STORE dst", ":3\r\n"},
+		{"lrange dst 0 -1", "*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+		// 结果为空时删除目标 key
+		{"sort nosuch STORE dst", ":0\r\n"},
+		{"exists dst", ":0\r\n"},
+		{"sort_ro nums STORE dst", "-ERR syntax error\r\n"},
+		{"sort w_1", string(protocol.MakeWrongTypeErrReply().ToBytes())},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
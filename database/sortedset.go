@@ -1,10 +1,14 @@
 package database
 
 import (
+	Set "github.com/jiangh156/godis/datastruct/set"
 	"github.com/jiangh156/godis/datastruct/sortedset"
 	"github.com/jiangh156/godis/interface/redis"
 	"github.com/jiangh156/godis/redis/protocol"
+	"math"
+	"math/rand"
 	"strconv"
+	"strings"
 )
 
 func (db *DB) getAsSortedSet(key string) (*sortedset.SortedSet, redis.ErrReply) {
@@ -35,34 +39,153 @@ func (db *DB) getOrInitSortedSet(key string) (sortedSet *sortedset.SortedSet, in
 	return sortedSet, inited, nil
 }
 
-// ZADD key score member [score member ...]
+// formatScore 分数转换为字符串
+func formatScore(score float64) []byte {
+	return []byte(strconv.FormatFloat(score, 'f', -1, 64))
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
 func execZAdd(db *DB, args [][]byte) redis.Reply {
-	if len(args) < 3 || (len(args)-1)%2 != 0 {
+	if len(args) < 3 {
 		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZAdd' command")
 	}
 	key := string(args[0])
-	zSet, _, err := db.getOrInitSortedSet(key)
-	if err != nil {
-		return err
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+	// 解析选项
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "GT":
+			gt = true
+			continue
+		case "LT":
+			lt = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		case "INCR":
+			incr = true
+			continue
+		}
+		break
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	if nx && xx {
+		return protocol.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || (gt && nx) || (lt && nx) {
+		return protocol.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) != 2 {
+		return protocol.MakeErrReply("ERR INCR option supports a single increment-element pair")
+	}
+	// 先解析全部分数，保证命令的原子性
+	elements := make([]*sortedset.Element, len(pairs)/2)
+	for j := range elements {
+		score, err := strconv.ParseFloat(string(pairs[2*j]), 64)
+		if err != nil || math.IsNaN(score) {
+			return protocol.MakeErrReply("ERR value is not a valid float")
+		}
+		elements[j] = &sortedset.Element{
+			Member: string(pairs[2*j+1]),
+			Score:  score,
+		}
+	}
+	zSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zSet == nil && xx {
+		if incr {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeIntReply(0)
+	}
+	if zSet == nil {
+		zSet, _, _ = db.getOrInitSortedSet(key)
 	}
-	kvLen := len(args)
-
 	cnt := 0
-	// 下标从1开始，args[0] 为key
-	for i := 1; i < kvLen; i += 2 {
-		member := string(args[i])
-		score, err := strconv.ParseFloat(string(args[i+1]), 64)
-		if err != nil {
-			return protocol.MakeErrReply("ERR value is not a valid float64")
+	var incrScore *float64
+	for _, element := range elements {
+		score := element.Score
+		current, exists := zSet.Get(element.Member)
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if incr && exists {
+			score += current.Score
+			if math.IsNaN(score) {
+				return protocol.MakeErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		// 新成员不受 GT/LT 限制
+		if exists && ((gt && score <= current.Score) || (lt && score >= current.Score)) {
+			continue
 		}
-		add := zSet.Add(member, score)
-		if add {
+		added, changed := zSet.Add(element.Member, score)
+		if added || (ch && changed) {
 			cnt++
 		}
+		incrScore = &score
+	}
+	if zSet.Len() == 0 {
+		db.Remove(key)
+	} else {
+		db.signalKey(key)
+	}
+	aofReply := db.makeAofCmd("zadd", args)
+	db.addAof(aofReply)
+	if incr {
+		if incrScore == nil {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeBulkReply(formatScore(*incrScore))
 	}
 	return protocol.MakeIntReply(int64(cnt))
 }
 
+// ZINCRBY key increment member
+func execZIncrBy(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 3 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZIncrBy' command")
+	}
+	key := string(args[0])
+	increment, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(increment) {
+		return protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	member := string(args[2])
+	zSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	score := increment
+	if element, exists := zSet.Get(member); exists {
+		score += element.Score
+	}
+	if math.IsNaN(score) {
+		if zSet.Len() == 0 {
+			db.Remove(key)
+		}
+		return protocol.MakeErrReply("ERR resulting score is not a number (NaN)")
+	}
+	zSet.Add(member, score)
+	db.signalKey(key)
+	aofReply := db.makeAofCmd("zincrby", args)
+	db.addAof(aofReply)
+	return protocol.MakeBulkReply(formatScore(score))
+}
+
 // ZSCORE key member
 func execZScore(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 2 {
@@ -78,7 +201,94 @@ func execZScore(db *DB, args [][]byte) redis.Reply {
 	if !ok {
 		return protocol.MakeNullBulkReply()
 	}
-	return protocol.MakeBulkReply([]byte(strconv.FormatFloat(element.Score, 'f', -1, 64)))
+	return protocol.MakeBulkReply(formatScore(element.Score))
+}
+
+// ZMSCORE key member [member ...]
+func execZMScore(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZMScore' command")
+	}
+	key := string(args[0])
+	zSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	scores := make([][]byte, len(args)-1)
+	for i, member := range args[1:] {
+		if zSet == nil {
+			continue
+		}
+		if element, ok := zSet.Get(string(member)); ok {
+			scores[i] = formatScore(element.Score)
+		}
+	}
+	return protocol.MakeMultiBulkReply(scores)
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]
+func execZRandMember(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 1 || len(args) > 3 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRandMember' command")
+	}
+	key := string(args[0])
+	count := int64(1)
+	withScores := false
+	if len(args) >= 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		// WITHSCORES 时返回的元素个数翻倍
+		if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+			return protocol.MakeErrReply("ERR value is out of range")
+		}
+	}
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORES" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		withScores = true
+	}
+	zSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zSet == nil || zSet.Len() == 0 {
+		if len(args) == 1 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	size := zSet.Len()
+	if len(args) == 1 {
+		rank := rand.Int63n(size)
+		return protocol.MakeBulkReply([]byte(zSet.Range(rank, rank+1, false)[0].Member))
+	}
+	result := make([][]byte, 0)
+	appendRank := func(rank int64) {
+		element := zSet.Range(rank, rank+1, false)[0]
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, formatScore(element.Score))
+		}
+	}
+	if count >= 0 {
+		// 正数返回不重复的成员
+		if count > size {
+			count = size
+		}
+		for _, rank := range rand.Perm(int(size))[:count] {
+			appendRank(int64(rank))
+		}
+	} else {
+		// 负数允许重复，逐个生成结果，不按 count 预先分配
+		for i := int64(0); i < -count; i++ {
+			appendRank(rand.Int63n(size))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
 }
 
 // ZRANK key member
@@ -133,197 +343,385 @@ func execZCard(db *DB, args [][]byte) redis.Reply {
 	return protocol.MakeIntReply(zSet.Len())
 }
 
-// ZRANGE key start stop
-func execZRange(db *DB, args [][]byte) redis.Reply {
-	if len(args) != 2 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRange' command")
+// ZRANGE 系列命令的区间类型
+const (
+	zRangeByRank = iota
+	zRangeByScore
+	zRangeByLex
+)
+
+type zRangeOption struct {
+	by         int
+	rev        bool
+	hasLimit   bool
+	offset     int64
+	limit      int64 // limit < 0 means no limit
+	withScores bool
+}
+
+/*
+ * 解析 [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+ * unified: 是否允许 BYSCORE, BYLEX 和 REV, 旧命令的区间类型和方向由命令本身决定
+ */
+func parseZRangeOption(args [][]byte, option *zRangeOption, unified bool) redis.Reply {
+	option.limit = -1
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch {
+		case arg == "WITHSCORES":
+			option.withScores = true
+		case arg == "LIMIT" && i+2 < len(args):
+			offset, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			limit, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			option.hasLimit = true
+			option.offset = offset
+			option.limit = limit
+			i += 2
+		case unified && arg == "BYSCORE":
+			option.by = zRangeByScore
+		case unified && arg == "BYLEX":
+			option.by = zRangeByLex
+		case unified && arg == "REV":
+			option.rev = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
 	}
-	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if option.hasLimit && option.by == zRangeByRank {
+		return protocol.MakeErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if option.withScores && option.by == zRangeByLex {
+		return protocol.MakeErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return nil
+}
+
+/*
+ * rangeSortedSet 按 option 取出区间内的元素, zSet 为 nil 时视为空集合
+ * 按分数或字典序倒序时 start 为上界, stop 为下界
+ */
+func rangeSortedSet(zSet *sortedset.SortedSet, start []byte, stop []byte, option *zRangeOption) ([]*sortedset.Element, redis.Reply) {
+	switch option.by {
+	case zRangeByScore:
+		minArg, maxArg := start, stop
+		if option.rev {
+			minArg, maxArg = stop, start
+		}
+		min, err := sortedset.ParseScoreBorder(string(minArg))
+		if err != nil {
+			return nil, protocol.MakeErrReply("ERR min or max is not a float")
+		}
+		max, err := sortedset.ParseScoreBorder(string(maxArg))
+		if err != nil {
+			return nil, protocol.MakeErrReply("ERR min or max is not a float")
+		}
+		if zSet == nil {
+			return nil, nil
+		}
+		return zSet.RangeByScore(min, max, option.offset, option.limit, option.rev), nil
+	case zRangeByLex:
+		minArg, maxArg := start, stop
+		if option.rev {
+			minArg, maxArg = stop, start
+		}
+		min, max, errReply := parseLexRange(minArg, maxArg)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if zSet == nil {
+			return nil, nil
+		}
+		return zSet.RangeByLex(min, max, option.offset, option.limit, option.rev), nil
+	}
+	startIndex, err := strconv.ParseInt(string(start), 10, 64)
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	stopIndex, err := strconv.ParseInt(string(stop), 10, 64)
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	if zSet == nil {
+		return nil, nil
+	}
+	// 负数下标从尾部开始计算，stop 为闭区间
+	size := zSet.Len()
+	if startIndex < 0 {
+		startIndex = size + startIndex
+	}
+	if startIndex < 0 {
+		startIndex = 0
+	}
+	if stopIndex < 0 {
+		stopIndex = size + stopIndex
+	}
+	if stopIndex >= size {
+		stopIndex = size - 1
+	}
+	if startIndex > stopIndex {
+		return nil, nil
+	}
+	return zSet.Range(startIndex, stopIndex+1, option.rev), nil
+}
+
+func elementsToReply(elements []*sortedset.Element, withScores bool) redis.Reply {
+	if len(elements) == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, len(elements))
+	for _, e := range elements {
+		result = append(result, []byte(e.Member))
+		if withScores {
+			result = append(result, formatScore(e.Score))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execZRangeGeneric args: key start stop [options ...]
+func execZRangeGeneric(db *DB, args [][]byte, option *zRangeOption, unified bool) redis.Reply {
+	if len(args) < 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	errReply := parseZRangeOption(args[3:], option, unified)
 	if errReply != nil {
 		return errReply
 	}
-	if zSet == nil {
-		return protocol.MakeEmptyMultiBulkReply()
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
 	}
-	elements := zSet.Range(start, stop, false)
-	members := make([][]byte, len(elements))
-	for i, e := range elements {
-		members[i] = []byte(e.Member)
+	elements, errReply := rangeSortedSet(zSet, args[1], args[2], option)
+	if errReply != nil {
+		return errReply
 	}
-	return protocol.MakeMultiBulkReply(members)
+	return elementsToReply(elements, option.withScores)
+}
+
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zRangeOption{}, true)
 }
 
-// ZREVRANGE key start stop
+// ZREVRANGE key start stop [WITHSCORES]
 func execZRevRange(db *DB, args [][]byte) redis.Reply {
-	if len(args) != 2 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRevRange' command")
+	return execZRangeGeneric(db, args, &zRangeOption{rev: true}, false)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zRangeOption{by: zRangeByScore}, false)
+}
+
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zRangeOption{by: zRangeByScore, rev: true}, false)
+}
+
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zRangeOption{by: zRangeByLex}, false)
+}
+
+// ZREVRANGEBYLEX key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zRangeOption{by: zRangeByLex, rev: true}, false)
+}
+
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) redis.Reply {
+	if len(args) < 4 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRangeStore' command")
 	}
-	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	dest := string(args[0])
+	option := &zRangeOption{}
+	errReply := parseZRangeOption(args[4:], option, true)
+	if errReply != nil {
+		return errReply
 	}
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	if option.withScores {
+		return protocol.MakeSyntaxErrReply()
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	zSet, errReply := db.getAsSortedSet(string(args[1]))
 	if errReply != nil {
 		return errReply
 	}
-	if zSet == nil {
-		return protocol.MakeEmptyMultiBulkReply()
+	elements, errReply := rangeSortedSet(zSet, args[2], args[3], option)
+	if errReply != nil {
+		return errReply
 	}
-	elements := zSet.Range(start, stop, true)
-	members := make([][]byte, len(elements))
-	for i, e := range elements {
-		members[i] = []byte(e.Member)
+	result := sortedset.Make()
+	for _, e := range elements {
+		result.Add(e.Member, e.Score)
 	}
-	return protocol.MakeMultiBulkReply(members)
+	size := db.storeSortedSet(dest, result)
+	aofReply := db.makeAofCmd("zrangestore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(size)
 }
 
-/*
- * param limit: limit < 0 means no limit
- */
 // ZCOUNT key min max
 func execZCount(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 3 {
 		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZCount' command")
 	}
-	key := string(args[0])
-	min, err := strconv.ParseFloat(string(args[1]), 64)
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return protocol.MakeErrReply("ERR min or max is not a float")
 	}
-	max, err := strconv.ParseFloat(string(args[2]), 64)
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return protocol.MakeErrReply("ERR min or max is not a float")
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
 	if errReply != nil {
 		return errReply
 	}
 	if zSet == nil {
 		return protocol.MakeIntReply(0)
 	}
-	elements := zSet.RangeByScore(&sortedset.ScoreBorder{Value: min}, &sortedset.ScoreBorder{Value: max}, 0, -1, false)
-	members := make([][]byte, len(elements))
-	return protocol.MakeIntReply(int64(len(members)))
+	return protocol.MakeIntReply(zSet.Count(min, max))
 }
 
-// ZRANGEBYSCORE key min max
-func execZRangeByScore(db *DB, args [][]byte) redis.Reply {
+// ZREMRANGEBYSCORE key min max
+func execZRemRangeByScore(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 3 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRangeByScore' command")
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRemRangeByScore' command")
 	}
 	key := string(args[0])
-	min, err := strconv.ParseFloat(string(args[1]), 64)
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return protocol.MakeErrReply("ERR min or max is not a float")
 	}
-	max, err := strconv.ParseFloat(string(args[2]), 64)
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return protocol.MakeErrReply("ERR min or max is not a float")
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	zSet, errReply := db.getAsSortedSet(key)
 	if errReply != nil {
 		return errReply
 	}
 	if zSet == nil {
-		return protocol.MakeEmptyMultiBulkReply()
+		return protocol.MakeIntReply(0)
+	}
+	removed := zSet.RemoveByScore(min, max)
+	if zSet.Len() == 0 {
+		db.Remove(key)
 	}
-	elements := zSet.RangeByScore(&sortedset.ScoreBorder{Value: min}, &sortedset.ScoreBorder{Value: max}, 0, -1, false)
-	members := make([][]byte, len(elements))
-	for i, e := range elements {
-		members[i] = []byte(e.Member)
+	if removed > 0 {
+		aofReply := db.makeAofCmd("zremrangebyscore", args)
+		db.addAof(aofReply)
 	}
-	return protocol.MakeMultiBulkReply(members)
+	return protocol.MakeIntReply(removed)
 }
 
-func execZRevRangeByScore(db *DB, args [][]byte) redis.Reply {
+// ZREMRANGEBYRANK key start stop
+func execZRemRangeByRank(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 3 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRevRangeByScore' command")
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRemRangeByRank' command")
 	}
 	key := string(args[0])
-	min, err := strconv.ParseFloat(string(args[1]), 64)
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
 	if err != nil {
 		return protocol.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	max, err := strconv.ParseFloat(string(args[2]), 64)
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
 	if err != nil {
 		return protocol.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	zSet, errReply := db.getAsSortedSet(key)
 	if errReply != nil {
 		return errReply
 	}
 	if zSet == nil {
-		return protocol.MakeEmptyMultiBulkReply()
+		return protocol.MakeIntReply(0)
+	}
+	// 负数下标从尾部开始计算，stop 为闭区间
+	size := zSet.Len()
+	if start < 0 {
+		start = size + start
+	}
+	if stop < 0 {
+		stop = size + stop
 	}
-	elements := zSet.RangeByScore(&sortedset.ScoreBorder{Value: min}, &sortedset.ScoreBorder{Value: max}, 0, -1, true)
-	members := make([][]byte, len(elements))
-	for i, e := range elements {
-		members[i] = []byte(e.Member)
+	// 避免 stop+1 溢出
+	if stop >= size {
+		stop = size - 1
 	}
-	return protocol.MakeMultiBulkReply(members)
+	removed := zSet.RemoveByRank(start, stop+1)
+	if zSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		aofReply := db.makeAofCmd("zremrangebyrank", args)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeIntReply(removed)
 }
 
-// ZREMRANGEBYSCORE key min max
-func execZRemRangeByScore(db *DB, args [][]byte) redis.Reply {
-	if len(args) != 3 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRemRangeByScore' command")
-	}
-	key := string(args[0])
-	min, err := strconv.ParseFloat(string(args[1]), 64)
+// parseLexRange 解析字典序区间的上下边界
+func parseLexRange(minArg []byte, maxArg []byte) (*sortedset.LexBorder, *sortedset.LexBorder, redis.Reply) {
+	min, err := sortedset.ParseLexBorder(string(minArg))
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return nil, nil, protocol.MakeErrReply(err.Error())
 	}
-	max, err := strconv.ParseFloat(string(args[2]), 64)
+	max, err := sortedset.ParseLexBorder(string(maxArg))
 	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		return nil, nil, protocol.MakeErrReply(err.Error())
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	return min, max, nil
+}
+
+// ZLEXCOUNT key min max
+func execZLexCount(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 3 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZLexCount' command")
+	}
+	min, max, errReply := parseLexRange(args[1], args[2])
+	if errReply != nil {
+		return errReply
+	}
+	zSet, errReply := db.getAsSortedSet(string(args[0]))
 	if errReply != nil {
 		return errReply
 	}
 	if zSet == nil {
 		return protocol.MakeIntReply(0)
 	}
-	removed := zSet.RemoveByScore(&sortedset.ScoreBorder{Value: min}, &sortedset.ScoreBorder{Value: max})
-	return protocol.MakeIntReply(removed)
+	return protocol.MakeIntReply(zSet.LexCount(min, max))
 }
 
-// ZREMRANGEBYRANK key start stop
-func execZRemRangeByRank(db *DB, args [][]byte) redis.Reply {
+// ZREMRANGEBYLEX key min max
+func execZRemRangeByLex(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 3 {
-		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRemRangeByRank' command")
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'ZRemRangeByLex' command")
 	}
 	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
-	}
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	min, max, errReply := parseLexRange(args[1], args[2])
+	if errReply != nil {
+		return errReply
 	}
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	zSet, errReply := db.getAsSortedSet(key)
 	if errReply != nil {
 		return errReply
 	}
 	if zSet == nil {
 		return protocol.MakeIntReply(0)
 	}
-	removed := zSet.RemoveByRank(start, stop)
+	removed := zSet.RemoveByLex(min, max)
+	if zSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		aofReply := db.makeAofCmd("zremrangebylex", args)
+		db.addAof(aofReply)
+	}
 	return protocol.MakeIntReply(removed)
 }
 
@@ -334,7 +732,7 @@ func execZRem(db *DB, args [][]byte) redis.Reply {
 	}
 	key := string(args[0])
 	members := args[1:]
-	zSet, _, errReply := db.getOrInitSortedSet(key)
+	zSet, errReply := db.getAsSortedSet(key)
 	if errReply != nil {
 		return errReply
 	}
@@ -348,21 +746,395 @@ func execZRem(db *DB, args [][]byte) redis.Reply {
 			removed++
 		}
 	}
+	if zSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		aofReply := db.makeAofCmd("zrem", args)
+		db.addAof(aofReply)
+	}
 	return protocol.MakeIntReply(removed)
 }
 
+// popSortedSet 弹出 count 个元素, 集合为空时删除 key, AOF 记录实际删除的成员
+func (db *DB) popSortedSet(key string, zSet *sortedset.SortedSet, count int64, max bool) []*sortedset.Element {
+	var elements []*sortedset.Element
+	if max {
+		elements = zSet.PopMax(count)
+	} else {
+		elements = zSet.PopMin(count)
+	}
+	if zSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(elements) > 0 {
+		aofArgs := make([][]byte, 0, len(elements)+1)
+		aofArgs = append(aofArgs, []byte(key))
+		for _, e := range elements {
+			aofArgs = append(aofArgs, []byte(e.Member))
+		}
+		aofReply := db.makeAofCmd("zrem", aofArgs)
+		db.addAof(aofReply)
+	}
+	return elements
+}
+
+// ZPOPMIN key [count] / ZPOPMAX key [count]
+func execZPopGeneric(db *DB, args [][]byte, max bool) redis.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+	zSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zSet == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return elementsToReply(db.popSortedSet(key, zSet, count, max), true)
+}
+
+// ZPOPMIN key [count]
+func execZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execZPopGeneric(db, args, false)
+}
+
+// ZPOPMAX key [count]
+func execZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execZPopGeneric(db, args, true)
+}
+
+// ZMPOP numkeys key [key ...] MIN | MAX [COUNT count]
+func execZMPop(db *DB, args [][]byte) redis.Reply {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return protocol.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	// 先与参数个数比较，numKeys+2 可能溢出
+	if numKeys > int64(len(args)-2) {
+		return protocol.MakeSyntaxErrReply()
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	var max bool
+	switch strings.ToUpper(string(args[numKeys+1])) {
+	case "MIN":
+		max = false
+	case "MAX":
+		max = true
+	default:
+		return protocol.MakeSyntaxErrReply()
+	}
+	count := int64(1)
+	rest := args[numKeys+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(string(rest[0])) != "COUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		count, err = strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count <= 0 {
+			return protocol.MakeErrReply("ERR count should be greater than 0")
+		}
+	}
+	for _, key := range keys {
+		zSet, errReply := db.getAsSortedSet(key)
+		if errReply != nil {
+			return errReply
+		}
+		if zSet == nil || zSet.Len() == 0 {
+			continue
+		}
+		elements := db.popSortedSet(key, zSet, count, max)
+		replies := make([]redis.Reply, len(elements))
+		for i, e := range elements {
+			replies[i] = protocol.MakeMultiBulkReply([][]byte{[]byte(e.Member), formatScore(e.Score)})
+		}
+		return protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			protocol.MakeMultiRawReply(replies),
+		})
+	}
+	return protocol.MakeNullMultiBulkReply()
+}
+
+// BZPOPMIN key [key ...] timeout / BZPOPMAX key [key ...] timeout
+func execBZPopGeneric(db *DB, args [][]byte, max bool) redis.Reply {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = string(args[i])
+	}
+	reply := db.blockUntil(keys, timeout, func() redis.Reply {
+		for _, key := range keys {
+			zSet, errReply := db.getAsSortedSet(key)
+			if errReply != nil {
+				return errReply
+			}
+			if zSet == nil || zSet.Len() == 0 {
+				continue
+			}
+			e := db.popSortedSet(key, zSet, 1, max)[0]
+			return protocol.MakeMultiBulkReply([][]byte{[]byte(key), []byte(e.Member), formatScore(e.Score)})
+		}
+		return nil
+	})
+	if reply == nil {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return reply
+}
+
+// BZPOPMIN key [key ...] timeout
+func execBZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execBZPopGeneric(db, args, false)
+}
+
+// BZPOPMAX key [key ...] timeout
+func execBZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execBZPopGeneric(db, args, true)
+}
+
+// getAsSortedSetOrSet 获取有序集合，普通集合视为分数均为 1 的有序集合
+func (db *DB) getAsSortedSetOrSet(key string) (*sortedset.SortedSet, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	switch data := entity.Data.(type) {
+	case *sortedset.SortedSet:
+		return data, nil
+	case *Set.Set:
+		zSet := sortedset.Make()
+		data.ForEach(func(member string) bool {
+			zSet.Add(member, 1)
+			return true
+		})
+		return zSet, nil
+	}
+	return nil, protocol.MakeWrongTypeErrReply()
+}
+
+// zSetToReply 有序集合按分数从小到大转换为 multi bulk reply
+func zSetToReply(zSet *sortedset.SortedSet, withScores bool) redis.Reply {
+	if zSet == nil || zSet.Len() == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, zSet.Len())
+	zSet.ForEach(0, zSet.Len(), false, func(element *sortedset.Element) bool {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, formatScore(element.Score))
+		}
+		return true
+	})
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// storeSortedSet 将结果写入 destination，覆盖原有的值，结果为空时删除 destination
+func (db *DB) storeSortedSet(dest string, zSet *sortedset.SortedSet) int64 {
+	db.Persist(dest)
+	if zSet == nil || zSet.Len() == 0 {
+		db.Remove(dest)
+		return 0
+	}
+	db.Put(dest, &DataEntity{
+		Data: zSet,
+	})
+	db.signalKey(dest)
+	return zSet.Len()
+}
+
+type zAggregateOption struct {
+	sets       []*sortedset.SortedSet
+	weights    []float64
+	aggregate  string
+	withScores bool
+}
+
+/*
+ * 解析 numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+ * allowWeights: 是否允许 WEIGHTS 和 AGGREGATE, allowWithScores: 是否允许 WITHSCORES
+ */
+func (db *DB) parseZAggregateArgs(cmdName string, args [][]byte, allowWeights bool, allowWithScores bool) (*zAggregateOption, redis.Reply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, protocol.MakeErrReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if int(numKeys) > len(args)-1 {
+		return nil, protocol.MakeSyntaxErrReply()
+	}
+	keys := args[1 : 1+numKeys]
+	option := &zAggregateOption{
+		aggregate: sortedset.AggregateSum,
+	}
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToUpper(string(rest[i])) {
+		case "WEIGHTS":
+			if !allowWeights || i+int(numKeys) >= len(rest) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			option.weights = make([]float64, numKeys)
+			for j := range option.weights {
+				weight, err := strconv.ParseFloat(string(rest[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, protocol.MakeErrReply("ERR weight value is not a float")
+				}
+				option.weights[j] = weight
+			}
+			i += int(numKeys)
+		case "AGGREGATE":
+			if !allowWeights || i+1 >= len(rest) || !sortedset.IsAggregate(string(rest[i+1])) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			option.aggregate = strings.ToUpper(string(rest[i+1]))
+			i++
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			option.withScores = true
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	option.sets = make([]*sortedset.SortedSet, len(keys))
+	for i, key := range keys {
+		zSet, errReply := db.getAsSortedSetOrSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		option.sets[i] = zSet
+	}
+	return option, nil
+}
+
+// ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+func execZUnion(db *DB, args [][]byte) redis.Reply {
+	option, errReply := db.parseZAggregateArgs("zunion", args, true, true)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Union(option.sets, option.weights, option.aggregate)
+	return zSetToReply(result, option.withScores)
+}
+
+// ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+func execZInter(db *DB, args [][]byte) redis.Reply {
+	option, errReply := db.parseZAggregateArgs("zinter", args, true, true)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Intersect(option.sets, option.weights, option.aggregate)
+	return zSetToReply(result, option.withScores)
+}
+
+// ZDIFF numkeys key [key ...] [WITHSCORES]
+func execZDiff(db *DB, args [][]byte) redis.Reply {
+	option, errReply := db.parseZAggregateArgs("zdiff", args, false, true)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Diff(option.sets)
+	return zSetToReply(result, option.withScores)
+}
+
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+func execZUnionStore(db *DB, args [][]byte) redis.Reply {
+	option, errReply := db.parseZAggregateArgs("zunionstore", args[1:], true, false)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Union(option.sets, option.weights, option.aggregate)
+	size := db.storeSortedSet(string(args[0]), result)
+	aofReply := db.makeAofCmd("zunionstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(size)
+}
+
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+func execZInterStore(db *DB, args [][]byte) redis.Reply {
+	option, errReply := db.parseZAggregateArgs("zinterstore", args[1:], true, false)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Intersect(option.sets, option.weights, option.aggregate)
+	size := db.storeSortedSet(string(args[0]), result)
+	aofReply := db.makeAofCmd("zinterstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(size)
+}
+
+// ZDIFFSTORE destination numkeys key [key ...]
+func execZDiffStore(db *DB, args [][]byte) redis.Reply {
+	option, errReply := db.parseZAggregateArgs("zdiffstore", args[1:], false, false)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Diff(option.sets)
+	size := db.storeSortedSet(string(args[0]), result)
+	aofReply := db.makeAofCmd("zdiffstore", args)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(size)
+}
+
 func init() {
 	RegisterCommand("ZAdd", execZAdd, -4)
+	RegisterCommand("ZIncrBy", execZIncrBy, 4)
 	RegisterCommand("ZScore", execZScore, -3)
+	RegisterCommand("ZMScore", execZMScore, -3)
+	RegisterCommand("ZRandMember", execZRandMember, -2)
 	RegisterCommand("ZRank", execZRank, 3)
 	RegisterCommand("ZRevRank", execZRevRank, 3)
 	RegisterCommand("ZCard", execZCard, 2)
-	RegisterCommand("ZRange", execZRange, 4)
-	RegisterCommand("ZRevRange", execZRevRange, 4)
+	RegisterCommand("ZRange", execZRange, -4)
+	RegisterCommand("ZRangeStore", execZRangeStore, -5)
+	RegisterCommand("ZRevRange", execZRevRange, -4)
 	RegisterCommand("ZCount", execZCount, 4)
-	RegisterCommand("ZRangeByScore", execZRangeByScore, 4)
-	RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, 4)
+	RegisterCommand("ZRangeByScore", execZRangeByScore, -4)
+	RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, -4)
 	RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, 4)
 	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, 4)
+	RegisterCommand("ZRangeByLex", execZRangeByLex, -4)
+	RegisterCommand("ZRevRangeByLex", execZRevRangeByLex, -4)
+	RegisterCommand("ZLexCount", execZLexCount, 4)
+	RegisterCommand("ZRemRangeByLex", execZRemRangeByLex, 4)
 	RegisterCommand("ZRem", execZRem, -3)
+	RegisterCommand("ZPopMin", execZPopMin, -2)
+	RegisterCommand("ZPopMax", execZPopMax, -2)
+	RegisterCommand("ZMPop", execZMPop, -4)
+	RegisterCommand("BZPopMin", execBZPopMin, -3)
+	RegisterCommand("BZPopMax", execBZPopMax, -3)
+	RegisterCommand("ZUnion", execZUnion, -3)
+	RegisterCommand("ZInter", execZInter, -3)
+	RegisterCommand("ZDiff", execZDiff, -3)
+	RegisterCommand("ZUnionStore", execZUnionStore, -4)
+	RegisterCommand("ZInterStore", execZInterStore, -4)
+	RegisterCommand("ZDiffStore", execZDiffStore, -4)
 }
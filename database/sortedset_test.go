@@ -0,0 +1,180 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ZRangeLimit(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "zadd z 1 a")
+	exec(s, conn, "zadd z 2 b")
+	exec(s, conn, "zadd z 3 c")
+	testCases := map[string]string{
+		"zrange z -inf +inf BYSCORE LIMIT 1 1":         "*1\r\n$1\r\nb\r\n",
+		"zrange z +inf -inf BYSCORE REV LIMIT 0 2":     "*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		"zrangebyscore z -inf +inf LIMIT -1 2":         "*0\r\n",
+		"zrevrangebyscore z +inf -inf LIMIT -1 2":      "*0\r\n",
+		"zrangebylex z - + LIMIT -1 1":                 "*0\r\n",
+		"zrangestore d z -inf +inf BYSCORE LIMIT -1 5": ":0\r\n",
+		"zrange z 0 -1 LIMIT 0 1":                      "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+	}
+	for line, want := range testCases {
+		if reply := exec(s, conn, line); reply != want {
+			t.Errorf("%s err: %q, want: %q", line, reply, want)
+		}
+	}
+}
+
+func Test_ZRange(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "zadd z 1 a 2 b 3 c 4 d")
+	testCases := map[string]string{
+		"zrange z 0 1 REV WITHSCORES":       "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		"zrange z -2 -1":                    "*2\r\n$1\r\nc\r\n$1\r\nd\r\n",
+		"zrange z (1 3 BYSCORE WITHSCORES":  "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		"zrange z 3 (1 BYSCORE REV":         "*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		"zrange z [b (d BYLEX":              "*2\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		"zrange z + - BYLEX REV LIMIT 1 2":  "*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		"zrange z a b BYSCORE":              "-ERR min or max is not a float\r\n",
+		"zrange z a b BYLEX":                "-ERR min or max not valid string range item\r\n",
+		"zrange z 0 -1 BYLEX WITHSCORES":    "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n",
+		"zrange z 0 -1 NOSUCH":              "-ERR syntax error\r\n",
+		"zrangestore dst z 1 +inf BYSCORE":  ":4\r\n",
+		"zrangestore dst z [c + BYLEX":      ":2\r\n",
+		"zrangestore dst z 0 -1 WITHSCORES": "-ERR syntax error\r\n",
+	}
+	for line, want := range testCases {
+		if reply := exec(s, conn, line); reply != want {
+			t.Errorf("%s err: %q, want: %q", line, reply, want)
+		}
+	}
+}
+
+func Test_ZAddOptions(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "zadd z 1 a 2 b")
+	// 按顺序执行，每一步依赖前面的结果
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"zadd z NX 5 a 3 c", ":1\r\n"},
+		{"zadd z XX 4 c 1 d", ":0\r\n"},
+		{"zadd z XX CH 4 c 1 d", ":0\r\n"},
+		{"zadd z CH 5 c 2 b", ":1\r\n"},
+		{"zadd z GT CH 0 a 6 c", ":1\r\n"},
+		{"zadd z LT CH 3 b 0 a 9 e", ":2\r\n"},
+		{"zmscore z a b c d e", "*5\r\n$1\r\n0\r\n$1\r\n2\r\n$1\r\n6\r\n$-1\r\n$1\r\n9\r\n"},
+		{"zadd z INCR 2 a", "$1\r\n2\r\n"},
+		{"zadd z NX INCR 1 a", "$-1\r\n"},
+		{"zadd z GT INCR -1 a", "$-1\r\n"},
+		{"zadd z INCR 1 a 2 b", "-ERR INCR option supports a single increment-element pair\r\n"},
+		{"zadd z NX XX 1 a", "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{"zadd z GT LT 1 a", "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{"zadd z 1 a 2", "-ERR syntax error\r\n"},
+		{"zadd z x a", "-ERR value is not a valid float\r\n"},
+		{"zincrby z 1.5 a", "$3\r\n3.5\r\n"},
+		{"zincrby z 1 new", "$1\r\n1\r\n"},
+		{"zincrby z x a", "-ERR value is not a valid float\r\n"},
+		{"zscore z a", "$3\r\n3.5\r\n"},
+		{"zmscore nosuch a", "*1\r\n$-1\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
+
+func Test_ZRandMember(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "zadd z 1 a 2 b 3 c")
+	testCases := []struct {
+		line   string
+		prefix string
+	}{
+		{"zrandmember nosuch", "$-1\r\n"},
+		{"zrandmember nosuch 3", "*0\r\n"},
+		{"zrandmember z 0", "*0\r\n"},
+		{"zrandmember z 2", "*2\r\n"},
+		{"zrandmember z 10", "*3\r\n"},
+		{"zrandmember z -5", "*5\r\n"},
+		{"zrandmember z 2 WITHSCORES", "*4\r\n"},
+		{"zrandmember z x", "-ERR value is not an integer or out of range\r\n"},
+		{"zrandmember z -9223372036854775808", "-ERR value is out of range\r\n"},
+		{"zrandmember z 4611686018427387904 WITHSCORES", "-ERR value is out of range\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); !strings.HasPrefix(reply, tt.prefix) {
+			t.Errorf("%s err: %q, want prefix: %q", tt.line, reply, tt.prefix)
+		}
+	}
+	// 正数时返回不重复的成员
+	reply := exec(s, conn, "zrandmember z 3")
+	for _, member := range []string{"a", "b", "c"} {
+		if !strings.Contains(reply, "$1\r\n"+member+"\r\n") {
+			t.Errorf("zrandmember z 3 err: %q", reply)
+		}
+	}
+}
+
+func Test_ZMPop(t *testing.T) {
+	s := makeTestServer(t)
+	conn := &fakeConn{}
+	exec(s, conn, "zadd z2 1 a 2 b 3 c")
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"zmpop 9223372036854775807 z MIN", "-ERR syntax error\r\n"},
+		{"zmpop 2 z MIN", "-ERR syntax error\r\n"},
+		{"zmpop 0 z MIN", "-ERR numkeys should be greater than 0\r\n"},
+		{"zmpop 2 z z2 MAX COUNT 2", "*2\r\n$2\r\nz2\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{"zmpop 1 z MIN", "*-1\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+}
+
+func Test_ZRemRange(t *testing.T) {
+	setupAof(t)
+	s := reloadAof(t)
+	conn := &fakeConn{}
+	exec(s, conn, "zadd z 1 a 2 b 3 c 4 d 5 e 6 f")
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"zremrangebyscore z (1 2", ":1\r\n"},
+		{"zremrangebyrank z -1 9223372036854775807", ":1\r\n"},
+		{"zremrangebylex z [c [c", ":1\r\n"},
+		{"zrange z 0 -1", "*3\r\n$1\r\na\r\n$1\r\nd\r\n$1\r\ne\r\n"},
+		// key 不存在时不会创建空的有序集合
+		{"zremrangebyscore nosuch 0 1", ":0\r\n"},
+		{"zremrangebyrank nosuch 0 1", ":0\r\n"},
+		{"exists nosuch", ":0\r\n"},
+		{"zremrangebyrank z 0 -1", ":3\r\n"},
+		{"exists z", ":0\r\n"},
+		{"zadd z2 1 a 2 b", ":2\r\n"},
+		{"zremrangebyscore z2 -inf 1", ":1\r\n"},
+	}
+	for _, tt := range testCases {
+		if reply := exec(s, conn, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q, want: %q", tt.line, reply, tt.want)
+		}
+	}
+	s.Close()
+	// 删除操作写入AOF
+	s2 := reloadAof(t)
+	if reply := exec(s2, conn, "exists z") + exec(s2, conn, "zrange z2 0 -1"); reply != ":0\r\n*1\r\n$1\r\nb\r\n" {
+		t.Errorf("aof err: %q", reply)
+	}
+}
@@ -0,0 +1,1070 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/stream"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (db *DB) getAsStream(key string) (*stream.Stream, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	st, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return st, nil
+}
+
+// getStreamGroup 获取消费者组，key 或消费者组不存在时返回 NOGROUP 错误
+func (db *DB) getStreamGroup(key string, groupName string, cmdName string) (*stream.Stream, *stream.Group, redis.Reply) {
+	st, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if st != nil {
+		if group, ok := st.GetGroup(groupName); ok {
+			return st, group, nil
+		}
+	}
+	return nil, nil, protocol.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'" + cmdName)
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func parseStreamID(arg []byte) (stream.ID, redis.Reply) {
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return stream.ID{}, protocol.MakeErrReply(err.Error())
+	}
+	return id, nil
+}
+
+func entryToReply(id stream.ID, entry *stream.Entry) redis.Reply {
+	if entry == nil {
+		return protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(id.String())),
+			protocol.MakeNullMultiBulkReply(),
+		})
+	}
+	fields := make([][]byte, len(entry.Fields))
+	for i, field := range entry.Fields {
+		fields[i] = []byte(field)
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte(id.String())),
+		protocol.MakeMultiBulkReply(fields),
+	})
+}
+
+func entriesToReply(entries []*stream.Entry) redis.Reply {
+	replies := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryToReply(entry.ID, entry)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+type streamTrimOption struct {
+	byMinID bool
+	approx  bool
+	maxLen  int64
+	minID   stream.ID
+	limit   int64
+}
+
+// parseStreamTrim 解析 MAXLEN | MINID [= | ~] threshold [LIMIT count]，返回消耗的参数个数
+func parseStreamTrim(args [][]byte) (*streamTrimOption, int, redis.Reply) {
+	option := &streamTrimOption{}
+	option.byMinID = strings.ToUpper(string(args[0])) == "MINID"
+	i := 1
+	if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+		option.approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, protocol.MakeSyntaxErrReply()
+	}
+	if option.byMinID {
+		id, errReply := parseStreamID(args[i])
+		if errReply != nil {
+			return nil, 0, errReply
+		}
+		option.minID = id
+	} else {
+		maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil || maxLen < 0 {
+			return nil, 0, protocol.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		option.maxLen = maxLen
+	}
+	i++
+	if i < len(args) && strings.ToUpper(string(args[i])) == "LIMIT" {
+		if i+1 >= len(args) {
+			return nil, 0, protocol.MakeSyntaxErrReply()
+		}
+		limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || limit < 0 {
+			return nil, 0, protocol.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		if !option.approx {
+			return nil, 0, protocol.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		option.limit = limit
+		i += 2
+	}
+	return option, i, nil
+}
+
+func (option *streamTrimOption) trim(st *stream.Stream) int64 {
+	if option.byMinID {
+		return st.TrimByMinID(option.minID, option.approx, option.limit)
+	}
+	return st.TrimByLen(option.maxLen, option.approx, option.limit)
+}
+
+// XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]] * | id field value [field value ...]
+func execXAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trimOption *streamTrimOption
+	i := 1
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "NOMKSTREAM" {
+			noMkStream = true
+		} else if arg == "MAXLEN" || arg == "MINID" {
+			option, consumed, errReply := parseStreamTrim(args[i:])
+			if errReply != nil {
+				return errReply
+			}
+			trimOption = option
+			i += consumed - 1
+		} else {
+			break
+		}
+	}
+	idIndex := i
+	if idIndex >= len(args) || (len(args)-idIndex-1) == 0 || (len(args)-idIndex-1)%2 != 0 {
+		return protocol.MakeArgNumErrReply("xadd")
+	}
+	fields := args[idIndex+1:]
+	st, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if st == nil {
+		if noMkStream {
+			return protocol.MakeNullBulkReply()
+		}
+		st = stream.Make()
+	}
+	var id stream.ID
+	idArg := string(args[idIndex])
+	ok := true
+	if idArg == "*" {
+		id, ok = st.NextID(uint64(nowMs()))
+	} else if strings.HasSuffix(idArg, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR Invalid stream ID specified as stream command argument")
+		}
+		id, ok = st.NextSeqID(ms)
+	} else {
+		var parseErr redis.Reply
+		id, parseErr = parseStreamID(args[idIndex])
+		if parseErr != nil {
+			return parseErr
+		}
+	}
+	if !ok {
+		return protocol.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	values := make([]string, len(fields))
+	for j, field := range fields {
+		values[j] = string(field)
+	}
+	if err := st.Add(id, values); err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	if _, exists := db.Get(key); !exists {
+		db.Put(key, &DataEntity{
+			Data: st,
+		})
+	}
+	if trimOption != nil {
+		trimOption.trim(st)
+	}
+	db.signalKey(key)
+	// AOF 记录实际生成的ID
+	aofArgs := make([][]byte, len(args))
+	copy(aofArgs, args)
+	aofArgs[idIndex] = []byte(id.String())
+	aofReply := db.makeAofCmd("xadd", aofArgs)
+	db.addAof(aofReply)
+	return protocol.MakeBulkReply([]byte(id.String()))
+}
+
+// XLEN key
+func execXLen(db *DB, args [][]byte) redis.Reply {
+	st, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if st == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(st.Len())
+}
+
+// XRANGE key start end [COUNT count] / XREVRANGE key end start [COUNT count]
+func execXRangeGeneric(db *DB, args [][]byte, desc bool) redis.Reply {
+	startArg, endArg := args[1], args[2]
+	if desc {
+		startArg, endArg = args[2], args[1]
+	}
+	start, err := stream.ParseRangeID(string(startArg), true)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	end, err := stream.ParseRangeID(string(endArg), false)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	var count int64 = -1
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		count, err = strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count <= 0 {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+	}
+	st, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if st == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return entriesToReply(st.Range(start, end, count, desc))
+}
+
+// XRANGE key start end [COUNT count]
+func execXRange(db *DB, args [][]byte) redis.Reply {
+	return execXRangeGeneric(db, args, false)
+}
+
+// XREVRANGE key end start [COUNT count]
+func execXRevRange(db *DB, args [][]byte) redis.Reply {
+	return execXRangeGeneric(db, args, true)
+}
+
+// XDEL key id [id ...]
+func execXDel(db *DB, args [][]byte) redis.Reply {
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	st, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if st == nil {
+		return protocol.MakeIntReply(0)
+	}
+	var deleted int64 = 0
+	for _, id := range ids {
+		if st.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		aofReply := db.makeAofCmd("xdel", args)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeIntReply(deleted)
+}
+
+// XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count]
+func execXTrim(db *DB, args [][]byte) redis.Reply {
+	strategy := strings.ToUpper(string(args[1]))
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	option, consumed, errReply := parseStreamTrim(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if consumed != len(args)-1 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	st, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if st == nil {
+		return protocol.MakeIntReply(0)
+	}
+	removed := option.trim(st)
+	if removed > 0 {
+		aofReply := db.makeAofCmd("xtrim", args)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeIntReply(removed)
+}
+
+type streamReadOption struct {
+	count   int64 // count <= 0 means no limit
+	block   bool
+	timeout time.Duration
+	noAck   bool
+	keys    []string
+	ids     [][]byte
+}
+
+/*
+ * parseStreamRead 解析 [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+ * allowNoAck: 是否允许 NOACK, 仅 XREADGROUP 可用
+ */
+func parseStreamRead(cmdName string, args [][]byte, allowNoAck bool) (*streamReadOption, redis.Reply) {
+	option := &streamReadOption{}
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch {
+		case arg == "COUNT" && i+1 < len(args):
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			option.count = count
+			i++
+		case arg == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, protocol.MakeErrReply("ERR timeout is negative")
+			}
+			option.block = true
+			option.timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case arg == "NOACK" && allowNoAck:
+			option.noAck = true
+		case arg == "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, protocol.MakeErrReply("ERR Unbalanced '" + cmdName + "' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			n := len(rest) / 2
+			option.keys = make([]string, n)
+			for j := 0; j < n; j++ {
+				option.keys[j] = string(rest[j])
+			}
+			option.ids = rest[n:]
+			return option, nil
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return nil, protocol.MakeSyntaxErrReply()
+}
+
+// readAfter 读取ID大于 after 的消息
+func readAfter(st *stream.Stream, after stream.ID, count int64) []*stream.Entry {
+	start, ok := after.Next()
+	if !ok {
+		return nil
+	}
+	return st.Range(start, stream.MaxID, count, false)
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func execXRead(db *DB, args [][]byte) redis.Reply {
+	option, errReply := parseStreamRead("xread", args, false)
+	if errReply != nil {
+		return errReply
+	}
+	// $ 表示只读取调用之后新增的消息
+	afterIDs := make([]stream.ID, len(option.keys))
+	for i, key := range option.keys {
+		if string(option.ids[i]) == "$" {
+			st, errReply := db.getAsStream(key)
+			if errReply != nil {
+				return errReply
+			}
+			if st != nil {
+				afterIDs[i] = st.LastID()
+			}
+			continue
+		}
+		id, err := stream.ParseID(string(option.ids[i]), 0)
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		afterIDs[i] = id
+	}
+	read := func() redis.Reply {
+		result := make([]redis.Reply, 0)
+		for i, key := range option.keys {
+			st, errReply := db.getAsStream(key)
+			if errReply != nil {
+				return errReply
+			}
+			if st == nil {
+				continue
+			}
+			entries := readAfter(st, afterIDs[i], option.count)
+			if len(entries) == 0 {
+				continue
+			}
+			result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeBulkReply([]byte(key)),
+				entriesToReply(entries),
+			}))
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return protocol.MakeMultiRawReply(result)
+	}
+	var reply redis.Reply
+	if option.block {
+		reply = db.blockUntil(option.keys, option.timeout, read)
+	} else {
+		reply = read()
+	}
+	if reply == nil {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return reply
+}
+
+// resolveGroupID 解析消费者组的起始ID, $ 表示 stream 当前最后一个ID
+func resolveGroupID(st *stream.Stream, arg []byte) (stream.ID, redis.Reply) {
+	if string(arg) == "$" {
+		return st.LastID(), nil
+	}
+	return parseStreamID(arg)
+}
+
+// XGROUP CREATE | SETID | DESTROY | CREATECONSUMER | DELCONSUMER key group ...
+func execXGroup(db *DB, args [][]byte) redis.Reply {
+	subCommand := strings.ToUpper(string(args[0]))
+	if subCommand == "HELP" || len(args) < 3 {
+		return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	key := string(args[1])
+	groupName := string(args[2])
+	st, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	switch subCommand {
+	case "CREATE":
+		return execXGroupCreate(db, st, args)
+	}
+	if st == nil {
+		return protocol.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+	group, groupExists := st.GetGroup(groupName)
+	noGroupReply := protocol.MakeErrReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	switch subCommand {
+	case "SETID":
+		if len(args) != 4 && len(args) != 6 {
+			break
+		}
+		if !groupExists {
+			return noGroupReply
+		}
+		id, errReply := resolveGroupID(st, args[3])
+		if errReply != nil {
+			return errReply
+		}
+		group.LastID = id
+		aofReply := db.makeAofCmd("xgroup", [][]byte{[]byte("setid"), args[1], args[2], []byte(id.String())})
+		db.addAof(aofReply)
+		return protocol.MakeOkReply()
+	case "DESTROY":
+		if len(args) != 3 {
+			break
+		}
+		if !st.DestroyGroup(groupName) {
+			return protocol.MakeIntReply(0)
+		}
+		aofReply := db.makeAofCmd("xgroup", args)
+		db.addAof(aofReply)
+		return protocol.MakeIntReply(1)
+	case "CREATECONSUMER":
+		if len(args) != 4 {
+			break
+		}
+		if !groupExists {
+			return noGroupReply
+		}
+		_, created := group.CreateConsumer(string(args[3]), time.Now())
+		if !created {
+			return protocol.MakeIntReply(0)
+		}
+		aofReply := db.makeAofCmd("xgroup", args)
+		db.addAof(aofReply)
+		return protocol.MakeIntReply(1)
+	case "DELCONSUMER":
+		if len(args) != 4 {
+			break
+		}
+		if !groupExists {
+			return noGroupReply
+		}
+		pending := group.DeleteConsumer(string(args[3]))
+		aofReply := db.makeAofCmd("xgroup", args)
+		db.addAof(aofReply)
+		return protocol.MakeIntReply(pending)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" + string(args[0]) + "'. Try XGROUP HELP.")
+}
+
+// XGROUP CREATE key group id | $ [MKSTREAM] [ENTRIESREAD entries-read]
+func execXGroupCreate(db *DB, st *stream.Stream, args [][]byte) redis.Reply {
+	if len(args) < 4 {
+		return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for 'CREATE'. Try XGROUP HELP.")
+	}
+	key := string(args[1])
+	mkStream := false
+	for i := 4; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "MKSTREAM" {
+			mkStream = true
+		} else if arg == "ENTRIESREAD" && i+1 < len(args) {
+			if _, err := strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			i++
+		} else {
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if st == nil {
+		if !mkStream {
+			return protocol.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		st = stream.Make()
+		db.Put(key, &DataEntity{
+			Data: st,
+		})
+	}
+	id, errReply := resolveGroupID(st, args[3])
+	if errReply != nil {
+		return errReply
+	}
+	if _, created := st.CreateGroup(string(args[2]), id); !created {
+		return protocol.MakeErrReply("BUSYGROUP Consumer Group name already exists")
+	}
+	aofArgs := [][]byte{[]byte("create"), args[1], args[2], []byte(id.String())}
+	if mkStream {
+		aofArgs = append(aofArgs, []byte("mkstream"))
+	}
+	aofReply := db.makeAofCmd("xgroup", aofArgs)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+/*
+ * claimAof 以 XCLAIM ... FORCE JUSTID 的形式记录待确认消息的状态
+ * 重放时可以精确还原消息的归属、投递时间和投递次数
+ */
+func (db *DB) claimAof(key string, groupName string, pe *stream.PendingEntry) {
+	deliveryTime := pe.DeliveryTime.UnixNano() / int64(time.Millisecond)
+	aofReply := db.makeAofCmd("xclaim", [][]byte{
+		[]byte(key), []byte(groupName), []byte(pe.Consumer), []byte("0"), []byte(pe.ID.String()),
+		[]byte("time"), []byte(strconv.FormatInt(deliveryTime, 10)),
+		[]byte("retrycount"), []byte(strconv.FormatInt(pe.DeliveryCount, 10)),
+		[]byte("force"), []byte("justid"),
+	})
+	db.addAof(aofReply)
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func execXReadGroup(db *DB, args [][]byte) redis.Reply {
+	if strings.ToUpper(string(args[0])) != "GROUP" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	groupName := string(args[1])
+	consumerName := string(args[2])
+	option, errReply := parseStreamRead("xreadgroup", args[3:], true)
+	if errReply != nil {
+		return errReply
+	}
+	// > 表示读取从未投递给组内消费者的消息，其他ID表示读取该消费者的待确认消息
+	onlyNew := true
+	afterIDs := make([]stream.ID, len(option.keys))
+	for i, key := range option.keys {
+		_, group, errReply := db.getStreamGroup(key, groupName, " in XREADGROUP with GROUP option")
+		if errReply != nil {
+			return errReply
+		}
+		if _, created := group.CreateConsumer(consumerName, time.Now()); created {
+			aofReply := db.makeAofCmd("xgroup", [][]byte{[]byte("createconsumer"), []byte(key), args[1], args[2]})
+			db.addAof(aofReply)
+		}
+		if string(option.ids[i]) == ">" {
+			continue
+		}
+		onlyNew = false
+		id, errReply := parseStreamID(option.ids[i])
+		if errReply != nil {
+			return errReply
+		}
+		afterIDs[i] = id
+	}
+	read := func() redis.Reply {
+		result := make([]redis.Reply, 0)
+		now := time.Now()
+		for i, key := range option.keys {
+			st, group, errReply := db.getStreamGroup(key, groupName, " in XREADGROUP with GROUP option")
+			if errReply != nil {
+				return errReply
+			}
+			consumer, _ := group.CreateConsumer(consumerName, now)
+			consumer.SeenTime = now
+			var entries redis.Reply
+			if string(option.ids[i]) == ">" {
+				newEntries := readAfter(st, group.LastID, option.count)
+				if len(newEntries) == 0 {
+					continue
+				}
+				for _, entry := range newEntries {
+					group.LastID = entry.ID
+					if option.noAck {
+						continue
+					}
+					pe := &stream.PendingEntry{
+						ID:            entry.ID,
+						Consumer:      consumerName,
+						DeliveryTime:  now,
+						DeliveryCount: 1,
+					}
+					group.SetPending(pe)
+					db.claimAof(key, groupName, pe)
+				}
+				aofReply := db.makeAofCmd("xgroup", [][]byte{[]byte("setid"), []byte(key), args[1], []byte(group.LastID.String())})
+				db.addAof(aofReply)
+				entries = entriesToReply(newEntries)
+			} else {
+				// 读取历史消息不修改待确认消息的状态，已删除的消息以 nil 返回
+				history := make([]redis.Reply, 0)
+				start, ok := afterIDs[i].Next()
+				if ok {
+					group.ForEachPending(start, func(pe *stream.PendingEntry) bool {
+						if pe.Consumer != consumerName {
+							return true
+						}
+						entry, _ := st.Get(pe.ID)
+						history = append(history, entryToReply(pe.ID, entry))
+						return option.count <= 0 || int64(len(history)) < option.count
+					})
+				}
+				entries = protocol.MakeMultiRawReply(history)
+			}
+			result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeBulkReply([]byte(key)),
+				entries,
+			}))
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return protocol.MakeMultiRawReply(result)
+	}
+	var reply redis.Reply
+	if option.block && onlyNew {
+		reply = db.blockUntil(option.keys, option.timeout, read)
+	} else {
+		reply = read()
+	}
+	if reply == nil {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return reply
+}
+
+// XACK key group id [id ...]
+func execXAck(db *DB, args [][]byte) redis.Reply {
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	st, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if st == nil {
+		return protocol.MakeIntReply(0)
+	}
+	group, ok := st.GetGroup(string(args[1]))
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	var acked int64 = 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		aofReply := db.makeAofCmd("xack", args)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeIntReply(acked)
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	groupName := string(args[1])
+	if len(args) == 2 {
+		_, group, errReply := db.getStreamGroup(key, groupName, "")
+		if errReply != nil {
+			return errReply
+		}
+		return xPendingSummary(group)
+	}
+	rest := args[2:]
+	var minIdle int64 = 0
+	if strings.ToUpper(string(rest[0])) == "IDLE" {
+		if len(rest) < 2 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		idle, err := strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		minIdle = idle
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	start, err := stream.ParseRangeID(string(rest[0]), true)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	end, err := stream.ParseRangeID(string(rest[1]), false)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	count, err := strconv.ParseInt(string(rest[2]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	consumerName := ""
+	if len(rest) == 4 {
+		consumerName = string(rest[3])
+	}
+	_, group, errReply := db.getStreamGroup(key, groupName, "")
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, 0)
+	if count <= 0 {
+		return protocol.MakeMultiRawReply(result)
+	}
+	now := nowMs()
+	group.ForEachPending(start, func(pe *stream.PendingEntry) bool {
+		if end.Less(pe.ID) {
+			return false
+		}
+		if consumerName != "" && pe.Consumer != consumerName {
+			return true
+		}
+		idle := now - pe.DeliveryTime.UnixNano()/int64(time.Millisecond)
+		if idle < minIdle {
+			return true
+		}
+		result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(pe.ID.String())),
+			protocol.MakeBulkReply([]byte(pe.Consumer)),
+			protocol.MakeIntReply(idle),
+			protocol.MakeIntReply(pe.DeliveryCount),
+		}))
+		return int64(len(result)) < count
+	})
+	return protocol.MakeMultiRawReply(result)
+}
+
+// xPendingSummary 返回待确认消息数、最小和最大ID，以及每个消费者的待确认消息数
+func xPendingSummary(group *stream.Group) redis.Reply {
+	if group.PendingLen() == 0 {
+		return protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeIntReply(0),
+			protocol.MakeNullBulkReply(),
+			protocol.MakeNullBulkReply(),
+			protocol.MakeNullMultiBulkReply(),
+		})
+	}
+	var first, last stream.ID
+	counts := make(map[string]int64)
+	group.ForEachPending(stream.MinID, func(pe *stream.PendingEntry) bool {
+		if len(counts) == 0 {
+			first = pe.ID
+		}
+		last = pe.ID
+		counts[pe.Consumer]++
+		return true
+	})
+	consumers := make([]redis.Reply, 0, len(counts))
+	for _, name := range group.ConsumerNames() {
+		if counts[name] == 0 {
+			continue
+		}
+		consumers = append(consumers, protocol.MakeMultiBulkReply([][]byte{
+			[]byte(name),
+			[]byte(strconv.FormatInt(counts[name], 10)),
+		}))
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeIntReply(group.PendingLen()),
+		protocol.MakeBulkReply([]byte(first.String())),
+		protocol.MakeBulkReply([]byte(last.String())),
+		protocol.MakeMultiRawReply(consumers),
+	})
+}
+
+type streamClaimOption struct {
+	minIdle      int64
+	deliveryTime *time.Time
+	retryCount   int64 // retryCount < 0 means not set
+	force        bool
+	justID       bool
+	lastID       *stream.ID
+}
+
+/*
+ * claimPending 将待确认消息转移给 consumerName
+ * 消息已从 stream 中删除时将其从待确认列表中移除并返回 deleted 为 true
+ */
+func (db *DB) claimPending(key string, st *stream.Stream, group *stream.Group, consumerName string,
+	id stream.ID, option *streamClaimOption, now time.Time) (entry *stream.Entry, claimed bool, deleted bool) {
+	pe, ok := group.GetPending(id)
+	entry, exists := st.Get(id)
+	if !exists {
+		if ok {
+			group.Ack(id)
+			aofReply := db.makeAofCmd("xack", [][]byte{[]byte(key), []byte(group.Name), []byte(id.String())})
+			db.addAof(aofReply)
+		}
+		return nil, false, true
+	}
+	if !ok {
+		if !option.force {
+			return nil, false, false
+		}
+		pe = &stream.PendingEntry{
+			ID:           id,
+			DeliveryTime: now,
+		}
+		group.SetPending(pe)
+	} else if option.minIdle > 0 && now.Sub(pe.DeliveryTime) < time.Duration(option.minIdle)*time.Millisecond {
+		return nil, false, false
+	}
+	pe.Consumer = consumerName
+	pe.DeliveryTime = now
+	if option.deliveryTime != nil {
+		pe.DeliveryTime = *option.deliveryTime
+	}
+	if option.retryCount >= 0 {
+		pe.DeliveryCount = option.retryCount
+	} else if !option.justID {
+		pe.DeliveryCount++
+	}
+	db.claimAof(key, group.Name, pe)
+	return entry, true, false
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	consumerName := string(args[2])
+	option := &streamClaimOption{retryCount: -1}
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	option.minIdle = minIdle
+	ids := make([]stream.ID, 0)
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	now := time.Now()
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch {
+		case arg == "FORCE":
+			option.force = true
+		case arg == "JUSTID":
+			option.justID = true
+		case (arg == "IDLE" || arg == "TIME" || arg == "RETRYCOUNT") && i+1 < len(args):
+			value, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR Invalid " + arg + " option argument for XCLAIM")
+			}
+			switch arg {
+			case "IDLE":
+				deliveryTime := now.Add(-time.Duration(value) * time.Millisecond)
+				option.deliveryTime = &deliveryTime
+			case "TIME":
+				deliveryTime := time.Unix(0, value*int64(time.Millisecond))
+				option.deliveryTime = &deliveryTime
+			case "RETRYCOUNT":
+				option.retryCount = value
+			}
+			i++
+		case arg == "LASTID" && i+1 < len(args):
+			lastID, errReply := parseStreamID(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			option.lastID = &lastID
+			i++
+		default:
+			return protocol.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	st, group, errReply := db.getStreamGroup(key, string(args[1]), "")
+	if errReply != nil {
+		return errReply
+	}
+	if option.lastID != nil && group.LastID.Less(*option.lastID) {
+		group.LastID = *option.lastID
+		aofReply := db.makeAofCmd("xgroup", [][]byte{[]byte("setid"), args[0], args[1], []byte(option.lastID.String())})
+		db.addAof(aofReply)
+	}
+	consumer, _ := group.CreateConsumer(consumerName, now)
+	consumer.SeenTime = now
+	result := make([]redis.Reply, 0, len(ids))
+	for _, id := range ids {
+		entry, claimed, _ := db.claimPending(key, st, group, consumerName, id, option, now)
+		if !claimed {
+			continue
+		}
+		if option.justID {
+			result = append(result, protocol.MakeBulkReply([]byte(id.String())))
+		} else {
+			result = append(result, entryToReply(id, entry))
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func execXAutoClaim(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	consumerName := string(args[2])
+	option := &streamClaimOption{retryCount: -1}
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	option.minIdle = minIdle
+	start, err := stream.ParseRangeID(string(args[4]), true)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	var count int64 = 100
+	for i := 5; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch {
+		case arg == "JUSTID":
+			option.justID = true
+		case arg == "COUNT" && i+1 < len(args):
+			count, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || count <= 0 {
+				return protocol.MakeErrReply("ERR COUNT must be > 0")
+			}
+			i++
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	st, group, errReply := db.getStreamGroup(key, string(args[1]), "")
+	if errReply != nil {
+		return errReply
+	}
+	now := time.Now()
+	consumer, _ := group.CreateConsumer(consumerName, now)
+	consumer.SeenTime = now
+	// 先收集待扫描的ID，认领过程中会修改待确认列表
+	scanned := make([]stream.ID, 0)
+	next := stream.MinID
+	group.ForEachPending(start, func(pe *stream.PendingEntry) bool {
+		if int64(len(scanned)) >= count {
+			next = pe.ID
+			return false
+		}
+		scanned = append(scanned, pe.ID)
+		return true
+	})
+	claimed := make([]redis.Reply, 0)
+	deleted := make([][]byte, 0)
+	for _, id := range scanned {
+		entry, ok, isDeleted := db.claimPending(key, st, group, consumerName, id, option, now)
+		if isDeleted {
+			deleted = append(deleted, []byte(id.String()))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if option.justID {
+			claimed = append(claimed, protocol.MakeBulkReply([]byte(id.String())))
+		} else {
+			claimed = append(claimed, entryToReply(id, entry))
+		}
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte(next.String())),
+		protocol.MakeMultiRawReply(claimed),
+		protocol.MakeMultiBulkReply(deleted),
+	})
+}
+
+func init() {
+	RegisterCommand("XAdd", execXAdd, -5)
+	RegisterCommand("XLen", execXLen, 2)
+	RegisterCommand("XRange", execXRange, -4)
+	RegisterCommand("XRevRange", execXRevRange, -4)
+	RegisterCommand("XDel", execXDel, -3)
+	RegisterCommand("XTrim", execXTrim, -4)
+	RegisterCommand("XRead", execXRead, -4)
+	RegisterCommand("XGroup", execXGroup, -2)
+	RegisterCommand("XReadGroup", execXReadGroup, -7)
+	RegisterCommand("XAck", execXAck, -4)
+	RegisterCommand("XPending", execXPending, -3)
+	RegisterCommand("XClaim", execXClaim, -6)
+	RegisterCommand("XAutoClaim", execXAutoClaim, -6)
+}
@@ -0,0 +1,477 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/timeseries"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (db *DB) getAsSeries(key string) (*timeseries.Series, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, protocol.MakeErrReply("ERR TSDB: the key does not exist")
+	}
+	series, ok := entity.Data.(*timeseries.Series)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return series, nil
+}
+
+// parseSeriesOptions 解析 [RETENTION retentionPeriod] [LABELS label value ...]
+func parseSeriesOptions(args [][]byte) (int64, []timeseries.Label, redis.Reply) {
+	var retention int64
+	labels := make([]timeseries.Label, 0)
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "RETENTION":
+			if i+1 >= len(args) {
+				return 0, nil, protocol.MakeSyntaxErrReply()
+			}
+			var err error
+			retention, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || retention < 0 {
+				return 0, nil, protocol.MakeErrReply("ERR TSDB: Couldn't parse RETENTION")
+			}
+			i++
+		case "LABELS":
+			// LABELS 必须是最后一个参数
+			pairs := args[i+1:]
+			if len(pairs) == 0 || len(pairs)%2 != 0 {
+				return 0, nil, protocol.MakeErrReply("ERR TSDB: Couldn't parse LABELS")
+			}
+			for j := 0; j < len(pairs); j += 2 {
+				labels = append(labels, timeseries.Label{Name: string(pairs[j]), Value: string(pairs[j+1])})
+			}
+			i = len(args)
+		default:
+			return 0, nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return retention, labels, nil
+}
+
+// parseTimestamp 解析样本的时间戳，* 表示当前时间
+func parseTimestamp(arg []byte) (int64, redis.Reply) {
+	if string(arg) == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	ts, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || ts < 0 {
+		return 0, protocol.MakeErrReply("ERR TSDB: invalid timestamp")
+	}
+	return ts, nil
+}
+
+// addSample 写入样本，并将压缩规则产生的样本写入目标序列
+func (db *DB) addSample(series *timeseries.Series, ts int64, value float64) redis.Reply {
+	compacted, err := series.Add(ts, value)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	for _, c := range compacted {
+		// 目标序列被删除后忽略
+		dest, errReply := db.getAsSeries(c.DestKey)
+		if errReply != nil {
+			continue
+		}
+		_, _ = dest.Add(c.Sample.Timestamp, c.Sample.Value)
+	}
+	return nil
+}
+
+// TS.CREATE key [RETENTION retentionPeriod] [LABELS label value ...]
+func execTSCreate(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	retention, labels, errReply := parseSeriesOptions(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := db.Get(key); exists {
+		return protocol.MakeErrReply("ERR TSDB: key already exists")
+	}
+	db.Put(key, &DataEntity{
+		Data: timeseries.Make(retention, labels),
+	})
+	aofReply := db.makeAofCmd("ts.create", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+// TS.ADD key timestamp value [RETENTION retentionPeriod] [LABELS label value ...]
+func execTSAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	ts, errReply := parseTimestamp(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR TSDB: invalid value")
+	}
+	retention, labels, errReply := parseSeriesOptions(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	series, errReply := db.getAsSeries(key)
+	if _, ok := errReply.(*protocol.WrongTypeErrReply); ok {
+		return errReply
+	}
+	// key 不存在时使用参数中的配置创建
+	if series == nil {
+		series = timeseries.Make(retention, labels)
+		db.Put(key, &DataEntity{
+			Data: series,
+		})
+	}
+	if errReply := db.addSample(series, ts, value); errReply != nil {
+		return errReply
+	}
+	// 记录实际的时间戳，保证重放结果一致
+	aofArgs := make([][]byte, len(args))
+	copy(aofArgs, args)
+	aofArgs[1] = []byte(strconv.FormatInt(ts, 10))
+	aofReply := db.makeAofCmd("ts.add", aofArgs)
+	db.addAof(aofReply)
+	return protocol.MakeIntReply(ts)
+}
+
+// TS.MADD key timestamp value [key timestamp value ...]
+func execTSMAdd(db *DB, args [][]byte) redis.Reply {
+	if len(args)%3 != 0 {
+		return protocol.MakeArgNumErrReply("ts.madd")
+	}
+	result := make([]redis.Reply, 0, len(args)/3)
+	aofArgs := make([][]byte, 0, len(args))
+	for i := 0; i < len(args); i += 3 {
+		series, errReply := db.getAsSeries(string(args[i]))
+		if errReply != nil {
+			result = append(result, errReply)
+			continue
+		}
+		ts, reply := parseTimestamp(args[i+1])
+		if reply != nil {
+			result = append(result, reply)
+			continue
+		}
+		value, err := strconv.ParseFloat(string(args[i+2]), 64)
+		if err != nil {
+			result = append(result, protocol.MakeErrReply("ERR TSDB: invalid value"))
+			continue
+		}
+		if reply := db.addSample(series, ts, value); reply != nil {
+			result = append(result, reply)
+			continue
+		}
+		result = append(result, protocol.MakeIntReply(ts))
+		aofArgs = append(aofArgs, args[i], []byte(strconv.FormatInt(ts, 10)), args[i+2])
+	}
+	// 只记录写入成功的样本
+	if len(aofArgs) > 0 {
+		aofReply := db.makeAofCmd("ts.madd", aofArgs)
+		db.addAof(aofReply)
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+type rangeOptions struct {
+	from        int64
+	to          int64
+	count       int // 小于 0 时不限制
+	aggregation string
+	bucket      int64
+	withLabels  bool
+	filters     []*labelFilter
+}
+
+// parseRangeBorder 解析时间范围，- 和 + 分别表示最小和最大时间戳
+func parseRangeBorder(arg []byte) (int64, redis.Reply) {
+	switch string(arg) {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	ts, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, protocol.MakeErrReply("ERR TSDB: wrong fromTimestamp or toTimestamp")
+	}
+	return ts, nil
+}
+
+// parseRangeOptions 解析 fromTimestamp toTimestamp [WITHLABELS] [COUNT count] [AGGREGATION aggregator bucketDuration] [FILTER filter ...]
+// multi 为 true 时允许 WITHLABELS 和 FILTER
+func parseRangeOptions(args [][]byte, multi bool) (*rangeOptions, redis.Reply) {
+	opts := &rangeOptions{count: -1}
+	var errReply redis.Reply
+	if opts.from, errReply = parseRangeBorder(args[0]); errReply != nil {
+		return nil, errReply
+	}
+	if opts.to, errReply = parseRangeBorder(args[1]); errReply != nil {
+		return nil, errReply
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: Couldn't parse COUNT")
+			}
+			opts.count = count
+			i++
+		case "AGGREGATION":
+			if i+2 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			aggregation, bucket, errReply := parseAggregation(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.aggregation, opts.bucket = aggregation, bucket
+			i += 2
+		case "WITHLABELS":
+			if !multi {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.withLabels = true
+		case "FILTER":
+			// FILTER 必须是最后一个参数
+			if !multi || i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			filters, errReply := parseLabelFilters(args[i+1:])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.filters = filters
+			i = len(args)
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if multi && opts.filters == nil {
+		return nil, protocol.MakeErrReply("ERR TSDB: missing FILTER argument")
+	}
+	return opts, nil
+}
+
+func parseAggregation(aggArg []byte, bucketArg []byte) (string, int64, redis.Reply) {
+	aggregation := strings.ToLower(string(aggArg))
+	if !timeseries.IsAggregation(aggregation) {
+		return "", 0, protocol.MakeErrReply("ERR TSDB: Unknown aggregation type")
+	}
+	bucket, err := strconv.ParseInt(string(bucketArg), 10, 64)
+	if err != nil || bucket <= 0 {
+		return "", 0, protocol.MakeErrReply("ERR TSDB: bucketDuration must be greater than zero")
+	}
+	return aggregation, bucket, nil
+}
+
+// querySeries 查询范围内的样本，按需聚合和逆序，最后截取 count 个
+func querySeries(series *timeseries.Series, opts *rangeOptions, desc bool) []timeseries.Sample {
+	samples := series.Range(opts.from, opts.to)
+	if opts.aggregation != "" {
+		samples = timeseries.Aggregate(samples, opts.aggregation, opts.bucket)
+	}
+	if desc {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if opts.count >= 0 && opts.count < len(samples) {
+		samples = samples[:opts.count]
+	}
+	return samples
+}
+
+func makeSamplesReply(samples []timeseries.Sample) redis.Reply {
+	result := make([]redis.Reply, len(samples))
+	for i, sample := range samples {
+		result[i] = protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeIntReply(sample.Timestamp),
+			protocol.MakeBulkReply(formatScore(sample.Value)),
+		})
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+func execTSRangeGeneric(db *DB, args [][]byte, desc bool) redis.Reply {
+	series, errReply := db.getAsSeries(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	opts, reply := parseRangeOptions(args[1:], false)
+	if reply != nil {
+		return reply
+	}
+	return makeSamplesReply(querySeries(series, opts, desc))
+}
+
+// TS.RANGE key fromTimestamp toTimestamp [COUNT count] [AGGREGATION aggregator bucketDuration]
+func execTSRange(db *DB, args [][]byte) redis.Reply {
+	return execTSRangeGeneric(db, args, false)
+}
+
+// TS.REVRANGE key fromTimestamp toTimestamp [COUNT count] [AGGREGATION aggregator bucketDuration]
+func execTSRevRange(db *DB, args [][]byte) redis.Reply {
+	return execTSRangeGeneric(db, args, true)
+}
+
+/*
+ * labelFilter 标签过滤条件:
+ * label=value, label!=value, label=(v1,v2), label!=(v1,v2)
+ * label= 表示不含该标签，label!= 表示含有该标签
+ */
+type labelFilter struct {
+	name   string
+	values []string
+	negate bool
+}
+
+func parseLabelFilters(args [][]byte) ([]*labelFilter, redis.Reply) {
+	filters := make([]*labelFilter, 0, len(args))
+	positive := false
+	for _, arg := range args {
+		raw := string(arg)
+		pos := strings.Index(raw, "=")
+		if pos <= 0 {
+			return nil, protocol.MakeErrReply("ERR TSDB: failed parsing labels")
+		}
+		filter := &labelFilter{name: raw[:pos]}
+		if strings.HasSuffix(filter.name, "!") {
+			filter.name = filter.name[:len(filter.name)-1]
+			filter.negate = true
+		}
+		value := raw[pos+1:]
+		if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+			filter.values = strings.Split(value[1:len(value)-1], ",")
+		} else {
+			filter.values = []string{value}
+		}
+		if filter.name == "" {
+			return nil, protocol.MakeErrReply("ERR TSDB: failed parsing labels")
+		}
+		if !filter.negate && value != "" {
+			positive = true
+		}
+		filters = append(filters, filter)
+	}
+	if !positive {
+		return nil, protocol.MakeErrReply("ERR TSDB: please provide at least one matcher")
+	}
+	return filters, nil
+}
+
+func (f *labelFilter) match(series *timeseries.Series) bool {
+	// 不含该标签时视为空值
+	value, _ := series.Label(f.name)
+	matched := false
+	for _, v := range f.values {
+		if v == value {
+			matched = true
+			break
+		}
+	}
+	return matched != f.negate
+}
+
+// TS.MRANGE fromTimestamp toTimestamp [WITHLABELS] [COUNT count] [AGGREGATION aggregator bucketDuration] FILTER filter ...
+func execTSMRange(db *DB, args [][]byte) redis.Reply {
+	opts, errReply := parseRangeOptions(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, 0)
+	db.Data.ForEach(func(key string, value any) bool {
+		entity, ok := value.(*DataEntity)
+		if !ok || db.IsExpire(key) {
+			return true
+		}
+		series, ok := entity.Data.(*timeseries.Series)
+		if !ok {
+			return true
+		}
+		for _, filter := range opts.filters {
+			if !filter.match(series) {
+				return true
+			}
+		}
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	result := make([]redis.Reply, 0, len(keys))
+	for _, key := range keys {
+		series, errReply := db.getAsSeries(key)
+		if errReply != nil {
+			continue
+		}
+		labels := make([]redis.Reply, 0)
+		if opts.withLabels {
+			for _, label := range series.Labels() {
+				labels = append(labels, protocol.MakeMultiBulkReply([][]byte{
+					[]byte(label.Name), []byte(label.Value),
+				}))
+			}
+		}
+		result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			protocol.MakeMultiRawReply(labels),
+			makeSamplesReply(querySeries(series, opts, false)),
+		}))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// TS.CREATERULE sourceKey destKey AGGREGATION aggregator bucketDuration
+func execTSCreateRule(db *DB, args [][]byte) redis.Reply {
+	srcKey, destKey := string(args[0]), string(args[1])
+	if strings.ToUpper(string(args[2])) != "AGGREGATION" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	aggregation, bucket, errReply := parseAggregation(args[3], args[4])
+	if errReply != nil {
+		return errReply
+	}
+	if srcKey == destKey {
+		return protocol.MakeErrReply("ERR TSDB: the source key and destination key should be different")
+	}
+	src, errReply := db.getAsSeries(srcKey)
+	if errReply != nil {
+		return errReply
+	}
+	dest, errReply := db.getAsSeries(destKey)
+	if errReply != nil {
+		return errReply
+	}
+	// 不允许规则串联
+	if src.SrcKey() != "" {
+		return protocol.MakeErrReply("ERR TSDB: the source key is a compaction destination")
+	}
+	if dest.SrcKey() != "" || len(dest.Rules()) > 0 {
+		return protocol.MakeErrReply("ERR TSDB: the destination key already has a src rule")
+	}
+	src.AddRule(&timeseries.Rule{DestKey: destKey, Aggregation: aggregation, Bucket: bucket})
+	dest.SetSrcKey(srcKey)
+	aofReply := db.makeAofCmd("ts.createrule", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("TS.Create", execTSCreate, -2)
+	RegisterCommand("TS.Add", execTSAdd, -4)
+	RegisterCommand("TS.MAdd", execTSMAdd, -4)
+	RegisterCommand("TS.Range", execTSRange, -4)
+	RegisterCommand("TS.RevRange", execTSRevRange, -4)
+	RegisterCommand("TS.MRange", execTSMRange, -4)
+	RegisterCommand("TS.CreateRule", execTSCreateRule, 6)
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"github.com/jiangh156/godis/datastruct/topk"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+)
+
+// topKMaxIncrement 单次增加的上限，避免衰减循环过长
+const topKMaxIncrement = 100000
+
+func (db *DB) getAsTopK(key string) (*topk.TopK, redis.ErrReply) {
+	entity, exists := db.Get(key)
+	if !exists {
+		return nil, protocol.MakeErrReply("ERR TopK: key does not exist")
+	}
+	topK, ok := entity.Data.(*topk.TopK)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return topK, nil
+}
+
+// TOPK.RESERVE key topk [width depth decay]
+func execTopKReserve(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 2 && len(args) != 5 {
+		return protocol.MakeArgNumErrReply("topk.reserve")
+	}
+	key := string(args[0])
+	k, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil || k == 0 {
+		return protocol.MakeErrReply("ERR TopK: invalid k")
+	}
+	var width, depth uint64 = topk.DefaultWidth, topk.DefaultDepth
+	decay := topk.DefaultDecay
+	if len(args) == 5 {
+		width, err = strconv.ParseUint(string(args[2]), 10, 64)
+		if err != nil || width == 0 {
+			return protocol.MakeErrReply("ERR TopK: invalid width")
+		}
+		depth, err = strconv.ParseUint(string(args[3]), 10, 64)
+		if err != nil || depth == 0 {
+			return protocol.MakeErrReply("ERR TopK: invalid depth")
+		}
+		decay, err = strconv.ParseFloat(string(args[4]), 64)
+		if err != nil || decay <= 0 || decay > 1 {
+			return protocol.MakeErrReply("ERR TopK: invalid decay value. must be '<= 1' & '> 0'")
+		}
+	}
+	if k > topk.MaxK {
+		return protocol.MakeErrReply("ERR TopK: k is too large")
+	}
+	if !topk.ValidSize(k, width, depth) {
+		return protocol.MakeErrReply("ERR TopK: width/depth is too large")
+	}
+	if _, exists := db.Get(key); exists {
+		return protocol.MakeErrReply("ERR TopK: key already exists")
+	}
+	db.Put(key, &DataEntity{
+		Data: topk.Make(k, width, depth, decay),
+	})
+	aofReply := db.makeAofCmd("topk.reserve", args)
+	db.addAof(aofReply)
+	return protocol.MakeOkReply()
+}
+
+func expelledToReply(expelled string, ok bool) redis.Reply {
+	if !ok {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply([]byte(expelled))
+}
+
+// TOPK.ADD key item [item ...]
+func execTopKAdd(db *DB, args [][]byte) redis.Reply {
+	topK, errReply := db.getAsTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		result[i] = expelledToReply(topK.IncrBy(item, 1))
+	}
+	aofReply := db.makeAofCmd("topk.add", args)
+	db.addAof(aofReply)
+	return protocol.MakeMultiRawReply(result)
+}
+
+// TOPK.INCRBY key item increment [item increment ...]
+func execTopKIncrBy(db *DB, args [][]byte) redis.Reply {
+	pairs := args[1:]
+	if len(pairs)%2 != 0 {
+		return protocol.MakeArgNumErrReply("topk.incrby")
+	}
+	topK, errReply := db.getAsTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	// 先解析全部增量，保证命令的原子性
+	increments := make([]uint64, len(pairs)/2)
+	for i := range increments {
+		increment, err := strconv.ParseUint(string(pairs[2*i+1]), 10, 64)
+		if err != nil || increment == 0 || increment > topKMaxIncrement {
+			return protocol.MakeErrReply("ERR TopK: increment must be an integer between 1 and 100000")
+		}
+		increments[i] = increment
+	}
+	result := make([]redis.Reply, len(increments))
+	for i, increment := range increments {
+		result[i] = expelledToReply(topK.IncrBy(pairs[2*i], increment))
+	}
+	aofReply := db.makeAofCmd("topk.incrby", args)
+	db.addAof(aofReply)
+	return protocol.MakeMultiRawReply(result)
+}
+
+// TOPK.QUERY key item [item ...]
+func execTopKQuery(db *DB, args [][]byte) redis.Reply {
+	topK, errReply := db.getAsTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		if topK.Query(item) {
+			result[i] = protocol.MakeIntReply(1)
+		} else {
+			result[i] = protocol.MakeIntReply(0)
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// TOPK.LIST key [WITHCOUNT]
+func execTopKList(db *DB, args [][]byte) redis.Reply {
+	withCount := false
+	if len(args) == 2 {
+		if strings.ToUpper(string(args[1])) != "WITHCOUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		withCount = true
+	} else if len(args) != 1 {
+		return protocol.MakeArgNumErrReply("topk.list")
+	}
+	topK, errReply := db.getAsTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, 0)
+	for _, item := range topK.List() {
+		result = append(result, protocol.MakeBulkReply([]byte(item.Member)))
+		if withCount {
+			result = append(result, protocol.MakeIntReply(int64(item.Count)))
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+func init() {
+	RegisterCommand("TopK.Reserve", execTopKReserve, -3)
+	RegisterCommand("TopK.Add", execTopKAdd, -3)
+	RegisterCommand("TopK.IncrBy", execTopKIncrBy, -4)
+	RegisterCommand("TopK.Query", execTopKQuery, -3)
+	RegisterCommand("TopK.List", execTopKList, -2)
+}
@@ -0,0 +1,225 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	DefaultErrorRate = 0.01
+	DefaultCapacity  = 100
+	DefaultExpansion = 2
+
+	// MaxBits 单个子过滤器位数的上限(1GB)
+	MaxBits = 1 << 33
+
+	// 每扩容一次，新的子过滤器的误判率收紧为原来的一半
+	tighteningRatio = 0.5
+)
+
+var (
+	ErrFull     = errors.New("ERR non scaling filter is full")
+	ErrTooLarge = errors.New("ERR filter capacity is too large")
+	ErrCorrupt  = errors.New("ERR invalid bloom filter payload")
+)
+
+// hash 返回元素的两个哈希值，k 个哈希函数由 h1 + i*h2 生成
+func hash(item []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(item)
+	sum := h.Sum64()
+	// splitmix64 的混合函数，弥补 fnv 低位分布不均匀的问题
+	mixed := sum
+	mixed = (mixed ^ mixed>>30) * 0xbf58476d1ce4e5b9
+	mixed = (mixed ^ mixed>>27) * 0x94d049bb133111eb
+	mixed ^= mixed >> 31
+	return sum, mixed | 1
+}
+
+type filter struct {
+	bits     []uint64
+	nbits    uint64
+	hashes   uint64
+	capacity uint64
+	count    uint64
+}
+
+// bitsPerEntry 每个元素所需的位数
+func bitsPerEntry(errorRate float64) float64 {
+	return -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+}
+
+// ValidSize 容纳 capacity 个元素所需的位数不超过 MaxBits
+func ValidSize(errorRate float64, capacity uint64) bool {
+	return math.Ceil(float64(capacity)*bitsPerEntry(errorRate)) <= MaxBits
+}
+
+func makeFilter(capacity uint64, errorRate float64) *filter {
+	bpe := bitsPerEntry(errorRate)
+	nbits := uint64(math.Ceil(float64(capacity) * bpe))
+	if nbits < 64 {
+		nbits = 64
+	}
+	return &filter{
+		bits:     make([]uint64, (nbits+63)/64),
+		nbits:    nbits,
+		hashes:   uint64(math.Ceil(math.Ln2 * bpe)),
+		capacity: capacity,
+	}
+}
+
+func (f *filter) test(h1 uint64, h2 uint64) bool {
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.nbits
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filter) add(h1 uint64, h2 uint64) {
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.nbits
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// Bloom 可扩容的布隆过滤器，子过滤器写满后追加一个容量为 expansion 倍的新过滤器
+type Bloom struct {
+	filters   []*filter
+	errorRate float64
+	expansion uint64 // 0 表示不扩容
+}
+
+func Make(errorRate float64, capacity uint64, expansion uint64) *Bloom {
+	return &Bloom{
+		filters:   []*filter{makeFilter(capacity, errorRate)},
+		errorRate: errorRate,
+		expansion: expansion,
+	}
+}
+
+// Add 添加元素，元素可能已存在时返回 false
+func (b *Bloom) Add(item []byte) (bool, error) {
+	h1, h2 := hash(item)
+	for _, f := range b.filters {
+		if f.test(h1, h2) {
+			return false, nil
+		}
+	}
+	last := b.filters[len(b.filters)-1]
+	if last.count >= last.capacity {
+		if b.expansion == 0 {
+			return false, ErrFull
+		}
+		errorRate := b.errorRate * math.Pow(tighteningRatio, float64(len(b.filters)))
+		if b.expansion > math.MaxUint64/last.capacity || !ValidSize(errorRate, last.capacity*b.expansion) {
+			return false, ErrTooLarge
+		}
+		last = makeFilter(last.capacity*b.expansion, errorRate)
+		b.filters = append(b.filters, last)
+	}
+	last.add(h1, h2)
+	return true, nil
+}
+
+// Exists 返回元素是否可能存在
+func (b *Bloom) Exists(item []byte) bool {
+	h1, h2 := hash(item)
+	for _, f := range b.filters {
+		if f.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capacity 返回所有子过滤器的容量之和
+func (b *Bloom) Capacity() uint64 {
+	var capacity uint64
+	for _, f := range b.filters {
+		capacity += f.capacity
+	}
+	return capacity
+}
+
+// Size 返回位数组占用的字节数
+func (b *Bloom) Size() uint64 {
+	var size uint64
+	for _, f := range b.filters {
+		size += uint64(len(f.bits)) * 8
+	}
+	return size
+}
+
+func (b *Bloom) Filters() int {
+	return len(b.filters)
+}
+
+// Count 返回已添加的元素个数
+func (b *Bloom) Count() uint64 {
+	var count uint64
+	for _, f := range b.filters {
+		count += f.count
+	}
+	return count
+}
+
+func (b *Bloom) Expansion() uint64 {
+	return b.expansion
+}
+
+/*
+ * MarshalBinary 序列化为:
+ * errorRate | expansion | filter 个数 | 每个 filter 的 nbits, hashes, capacity, count, bits
+ * 整数均为小端序的 uint64
+ */
+func (b *Bloom) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, b.errorRate)
+	_ = binary.Write(buf, binary.LittleEndian, b.expansion)
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(b.filters)))
+	for _, f := range b.filters {
+		_ = binary.Write(buf, binary.LittleEndian, []uint64{f.nbits, f.hashes, f.capacity, f.count})
+		_ = binary.Write(buf, binary.LittleEndian, f.bits)
+	}
+	return buf.Bytes(), nil
+}
+
+func (b *Bloom) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	var n uint64
+	if binary.Read(reader, binary.LittleEndian, &b.errorRate) != nil ||
+		binary.Read(reader, binary.LittleEndian, &b.expansion) != nil ||
+		binary.Read(reader, binary.LittleEndian, &n) != nil || n == 0 {
+		return ErrCorrupt
+	}
+	b.filters = make([]*filter, 0, n)
+	for i := uint64(0); i < n; i++ {
+		header := make([]uint64, 4)
+		if binary.Read(reader, binary.LittleEndian, header) != nil || header[0] == 0 ||
+			header[0] > uint64(reader.Len())*8 {
+			return ErrCorrupt
+		}
+		f := &filter{
+			nbits:    header[0],
+			hashes:   header[1],
+			capacity: header[2],
+			count:    header[3],
+			bits:     make([]uint64, (header[0]+63)/64),
+		}
+		if binary.Read(reader, binary.LittleEndian, f.bits) != nil {
+			return ErrCorrupt
+		}
+		b.filters = append(b.filters, f)
+	}
+	if reader.Len() != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
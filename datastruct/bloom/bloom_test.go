@@ -0,0 +1,115 @@
+package bloom
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func Test_Bloom(t *testing.T) {
+	b := Make(0.01, 100, 2)
+	for i := 0; i < 1000; i++ {
+		if _, err := b.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Add() err: %v", err)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !b.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("Exists(%d) err: false negative", i)
+		}
+	}
+	falsePositive := 0
+	for i := 1000; i < 11000; i++ {
+		if b.Exists([]byte(strconv.Itoa(i))) {
+			falsePositive++
+		}
+	}
+	if falsePositive > 200 {
+		t.Errorf("false positive rate too high: %d/10000", falsePositive)
+	}
+	// 100 + 200 + 400 + 800
+	if b.Filters() != 4 || b.Capacity() != 1500 {
+		t.Errorf("expansion err: filters %d, capacity %d", b.Filters(), b.Capacity())
+	}
+	if added, _ := b.Add([]byte("1")); added {
+		t.Errorf("Add() should return false for existing item")
+	}
+}
+
+func Test_Bloom_nonScaling(t *testing.T) {
+	b := Make(0.01, 10, 0)
+	full := false
+	for i := 0; i < 30; i++ {
+		if _, err := b.Add([]byte(strconv.Itoa(i))); err == ErrFull {
+			full = true
+		}
+	}
+	if !full || b.Count() != 10 || b.Filters() != 1 {
+		t.Errorf("Add() err: full %v, count %d", full, b.Count())
+	}
+}
+
+func Test_Bloom_tooLarge(t *testing.T) {
+	if ValidSize(0.01, math.MaxInt64) || !ValidSize(0.01, 100) {
+		t.Errorf("ValidSize() err")
+	}
+	// 扩容后的容量溢出时不再添加新的子过滤器
+	b := Make(0.01, 2, math.MaxUint64/2)
+	for i := 0; i < 3; i++ {
+		_, _ = b.Add([]byte(strconv.Itoa(i)))
+	}
+	if _, err := b.Add([]byte("x")); err != ErrTooLarge || b.Filters() != 1 {
+		t.Errorf("Add() err: %v, filters %d", err, b.Filters())
+	}
+}
+
+func Test_Cuckoo(t *testing.T) {
+	c := MakeCuckoo(64)
+	for i := 0; i < 500; i++ {
+		c.Add([]byte(strconv.Itoa(i)))
+	}
+	if len(c.filters) < 2 {
+		t.Errorf("Add() should append filters, got %d", len(c.filters))
+	}
+	for i := 0; i < 500; i++ {
+		if !c.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("Exists(%d) err: false negative", i)
+		}
+	}
+	for i := 0; i < 500; i += 2 {
+		if !c.Delete([]byte(strconv.Itoa(i))) {
+			t.Fatalf("Delete(%d) err", i)
+		}
+	}
+	for i := 1; i < 500; i += 2 {
+		if !c.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("Exists(%d) err after delete", i)
+		}
+	}
+	if c.Count() != 250 {
+		t.Errorf("Count() err: %d", c.Count())
+	}
+}
+
+func Test_Marshal(t *testing.T) {
+	b := Make(0.001, 50, 2)
+	c := MakeCuckoo(32)
+	for i := 0; i < 200; i++ {
+		_, _ = b.Add([]byte(strconv.Itoa(i)))
+		c.Add([]byte(strconv.Itoa(i)))
+	}
+	data, _ := b.MarshalBinary()
+	b2 := &Bloom{}
+	if err := b2.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(b, b2) {
+		t.Errorf("Bloom round trip err: %v", err)
+	}
+	if err := b2.UnmarshalBinary(data[:len(data)-1]); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary() should reject truncated payload")
+	}
+	data, _ = c.MarshalBinary()
+	c2 := &Cuckoo{}
+	if err := c2.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(c, c2) {
+		t.Errorf("Cuckoo round trip err: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	DefaultCuckooCapacity = 1024
+	cuckooBucketSize      = 2
+	cuckooMaxIterations   = 20
+)
+
+/*
+ * Cuckoo 布隆过滤器，每个元素保存 1 字节的指纹，0 表示空槽
+ * 元素可以放在 i1 或 i2 = i1 ^ hash(fp) 两个桶中，两个桶都满时踢出已有的指纹
+ * 踢出若干次仍失败时追加一个同样大小的子过滤器，因此插入总是成功
+ * 踢出的位置由指纹决定，AOF 重放后得到相同的状态
+ */
+type Cuckoo struct {
+	numBuckets uint64 // 2 的幂
+	filters    [][]uint8
+	count      uint64
+	deleted    uint64
+}
+
+func MakeCuckoo(capacity uint64) *Cuckoo {
+	numBuckets := uint64(1)
+	for numBuckets*cuckooBucketSize < capacity {
+		numBuckets <<= 1
+	}
+	return &Cuckoo{
+		numBuckets: numBuckets,
+		filters:    [][]uint8{make([]uint8, numBuckets*cuckooBucketSize)},
+	}
+}
+
+func (c *Cuckoo) fingerprint(item []byte) (uint8, uint64) {
+	h1, h2 := hash(item)
+	fp := uint8(h2%255) + 1
+	return fp, h1 & (c.numBuckets - 1)
+}
+
+func (c *Cuckoo) altIndex(index uint64, fp uint8) uint64 {
+	return (index ^ uint64(fp)*0x5bd1e995) & (c.numBuckets - 1)
+}
+
+func (c *Cuckoo) bucket(filter []uint8, index uint64) []uint8 {
+	return filter[index*cuckooBucketSize : (index+1)*cuckooBucketSize]
+}
+
+func (c *Cuckoo) insertInto(filter []uint8, index uint64, fp uint8) bool {
+	bucket := c.bucket(filter, index)
+	for i := range bucket {
+		if bucket[i] == 0 {
+			bucket[i] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// Add 添加元素，允许重复添加
+func (c *Cuckoo) Add(item []byte) {
+	fp, i1 := c.fingerprint(item)
+	i2 := c.altIndex(i1, fp)
+	c.count++
+	for _, filter := range c.filters {
+		if c.insertInto(filter, i1, fp) || c.insertInto(filter, i2, fp) {
+			return
+		}
+	}
+	filter := c.filters[len(c.filters)-1]
+	index := i1
+	for n := 0; n < cuckooMaxIterations; n++ {
+		bucket := c.bucket(filter, index)
+		slot := int(fp) % cuckooBucketSize
+		fp, bucket[slot] = bucket[slot], fp
+		index = c.altIndex(index, fp)
+		if c.insertInto(filter, index, fp) {
+			return
+		}
+	}
+	// 所有子过滤器大小相同，被踢出的指纹在新过滤器中的位置不变
+	filter = make([]uint8, c.numBuckets*cuckooBucketSize)
+	c.insertInto(filter, index, fp)
+	c.filters = append(c.filters, filter)
+}
+
+func (c *Cuckoo) find(item []byte) ([]uint8, int) {
+	fp, i1 := c.fingerprint(item)
+	i2 := c.altIndex(i1, fp)
+	for j := len(c.filters) - 1; j >= 0; j-- {
+		for _, index := range []uint64{i1, i2} {
+			bucket := c.bucket(c.filters[j], index)
+			for i := range bucket {
+				if bucket[i] == fp {
+					return bucket, i
+				}
+			}
+		}
+	}
+	return nil, -1
+}
+
+// Exists 返回元素是否可能存在
+func (c *Cuckoo) Exists(item []byte) bool {
+	bucket, _ := c.find(item)
+	return bucket != nil
+}
+
+// Delete 删除元素的一个副本，元素不存在时返回 false
+func (c *Cuckoo) Delete(item []byte) bool {
+	bucket, i := c.find(item)
+	if bucket == nil {
+		return false
+	}
+	bucket[i] = 0
+	c.count--
+	c.deleted++
+	return true
+}
+
+func (c *Cuckoo) Count() uint64 {
+	return c.count
+}
+
+/*
+ * MarshalBinary 序列化为:
+ * numBuckets | count | deleted | filter 个数 | 每个 filter 的指纹
+ */
+func (c *Cuckoo) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, []uint64{c.numBuckets, c.count, c.deleted, uint64(len(c.filters))})
+	for _, filter := range c.filters {
+		buf.Write(filter)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Cuckoo) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	header := make([]uint64, 4)
+	if binary.Read(reader, binary.LittleEndian, header) != nil {
+		return ErrCorrupt
+	}
+	numBuckets, n := header[0], header[3]
+	if numBuckets == 0 || numBuckets&(numBuckets-1) != 0 || n == 0 ||
+		uint64(reader.Len()) != n*numBuckets*cuckooBucketSize {
+		return ErrCorrupt
+	}
+	c.numBuckets, c.count, c.deleted = numBuckets, header[1], header[2]
+	c.filters = make([][]uint8, n)
+	for i := range c.filters {
+		c.filters[i] = make([]uint8, numBuckets*cuckooBucketSize)
+		_, _ = reader.Read(c.filters[i])
+	}
+	return nil
+}
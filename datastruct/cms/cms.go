@@ -0,0 +1,150 @@
+package cms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+var ErrCorrupt = errors.New("ERR invalid count-min sketch payload")
+
+// MaxCounters 计数器总数的上限，每个计数器 8 字节
+const MaxCounters = 1 << 27
+
+// ValidSize width*depth 不溢出且不超过 MaxCounters
+func ValidSize(width uint64, depth uint64) bool {
+	return width > 0 && depth > 0 && width <= MaxCounters/depth
+}
+
+// CountMinSketch depth 行 width 列的计数器，元素的频率取各行计数器的最小值
+type CountMinSketch struct {
+	width    uint64
+	depth    uint64
+	counters []uint64
+	count    uint64
+}
+
+func Make(width uint64, depth uint64) *CountMinSketch {
+	return &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint64, width*depth),
+	}
+}
+
+// SizeByProb 根据误差和误差概率计算 width 和 depth，计数器总数超过上限时返回 false
+func SizeByProb(errorRate float64, probability float64) (uint64, uint64, bool) {
+	width := math.Ceil(2 / errorRate)
+	depth := math.Ceil(math.Log10(probability) / math.Log10(0.5))
+	// 在浮点数上比较，避免转换为整数时溢出
+	if !(width >= 1 && depth >= 1 && width*depth <= MaxCounters) {
+		return 0, 0, false
+	}
+	return uint64(width), uint64(depth), true
+}
+
+func (s *CountMinSketch) Width() uint64 {
+	return s.width
+}
+
+func (s *CountMinSketch) Depth() uint64 {
+	return s.depth
+}
+
+// Count 返回所有元素增加的次数之和
+func (s *CountMinSketch) Count() uint64 {
+	return s.count
+}
+
+func hash(item []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(item)
+	sum := h.Sum64()
+	mixed := (sum ^ sum>>30) * 0xbf58476d1ce4e5b9
+	mixed = (mixed ^ mixed>>27) * 0x94d049bb133111eb
+	return sum, mixed ^ mixed>>31 | 1
+}
+
+// index 返回元素在第 row 行的计数器下标
+func (s *CountMinSketch) index(h1 uint64, h2 uint64, row uint64) uint64 {
+	return row*s.width + (h1+row*h2)%s.width
+}
+
+// IncrBy 增加元素的频率，返回增加后的估计值
+func (s *CountMinSketch) IncrBy(item []byte, increment uint64) uint64 {
+	h1, h2 := hash(item)
+	min := uint64(math.MaxUint64)
+	for row := uint64(0); row < s.depth; row++ {
+		i := s.index(h1, h2, row)
+		s.counters[i] += increment
+		if s.counters[i] < min {
+			min = s.counters[i]
+		}
+	}
+	s.count += increment
+	return min
+}
+
+// Query 返回元素频率的估计值
+func (s *CountMinSketch) Query(item []byte) uint64 {
+	h1, h2 := hash(item)
+	min := uint64(math.MaxUint64)
+	for row := uint64(0); row < s.depth; row++ {
+		if c := s.counters[s.index(h1, h2, row)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Merge 将 sketches 按权重累加后覆盖 s，所有 sketch 的 width 和 depth 必须与 s 相同
+func (s *CountMinSketch) Merge(sketches []*CountMinSketch, weights []uint64) {
+	counters := make([]uint64, len(s.counters))
+	var count uint64
+	for k, sketch := range sketches {
+		for i, c := range sketch.counters {
+			counters[i] += c * weights[k]
+		}
+		count += sketch.count * weights[k]
+	}
+	s.counters = counters
+	s.count = count
+}
+
+// Clone 返回不共享计数器的副本
+func (s *CountMinSketch) Clone() *CountMinSketch {
+	c := *s
+	c.counters = append([]uint64(nil), s.counters...)
+	return &c
+}
+
+/*
+ * MarshalBinary 序列化为:
+ * width | depth | count | 计数器
+ * 整数均为小端序的 uint64
+ */
+func (s *CountMinSketch) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, []uint64{s.width, s.depth, s.count})
+	_ = binary.Write(buf, binary.LittleEndian, s.counters)
+	return buf.Bytes(), nil
+}
+
+func (s *CountMinSketch) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	header := make([]uint64, 3)
+	if binary.Read(reader, binary.LittleEndian, header) != nil {
+		return ErrCorrupt
+	}
+	width, depth := header[0], header[1]
+	size := uint64(reader.Len())
+	if !ValidSize(width, depth) || size != width*depth*8 {
+		return ErrCorrupt
+	}
+	s.width, s.depth, s.count = width, depth, header[2]
+	s.counters = make([]uint64, width*depth)
+	_ = binary.Read(reader, binary.LittleEndian, s.counters)
+	return nil
+}
@@ -0,0 +1,75 @@
+package cms
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func Test_CountMinSketch(t *testing.T) {
+	width, depth, ok := SizeByProb(0.001, 0.01)
+	if !ok || width != 2000 || depth != 7 {
+		t.Fatalf("SizeByProb() err: width %d, depth %d", width, depth)
+	}
+	s := Make(width, depth)
+	for i := 0; i < 1000; i++ {
+		s.IncrBy([]byte(strconv.Itoa(i)), uint64(i%10+1))
+	}
+	for i := 0; i < 1000; i++ {
+		count := s.Query([]byte(strconv.Itoa(i)))
+		// 估计值不会小于真实值
+		if count < uint64(i%10+1) || count > uint64(i%10+1)+10 {
+			t.Errorf("Query(%d) err: %d", i, count)
+		}
+	}
+	if s.Query([]byte("not exists")) > 10 {
+		t.Errorf("Query() err: %d", s.Query([]byte("not exists")))
+	}
+}
+
+func Test_Merge(t *testing.T) {
+	a := Make(100, 5)
+	b := Make(100, 5)
+	a.IncrBy([]byte("x"), 3)
+	b.IncrBy([]byte("x"), 4)
+	b.IncrBy([]byte("y"), 1)
+	dest := Make(100, 5)
+	dest.Merge([]*CountMinSketch{a, b}, []uint64{2, 1})
+	if dest.Query([]byte("x")) != 10 || dest.Count() != 11 {
+		t.Errorf("Merge() err: x %d, count %d", dest.Query([]byte("x")), dest.Count())
+	}
+}
+
+func Test_Marshal(t *testing.T) {
+	s := Make(100, 5)
+	s.IncrBy([]byte("x"), 3)
+	data, _ := s.MarshalBinary()
+	s2 := &CountMinSketch{}
+	if err := s2.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(s, s2) {
+		t.Errorf("round trip err: %v", err)
+	}
+	if err := s2.UnmarshalBinary(data[:len(data)-1]); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary() should reject truncated payload")
+	}
+	// width*depth*8 溢出后与剩余长度相等
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint64(header, 1<<61)
+	binary.LittleEndian.PutUint64(header[8:], 1<<3)
+	if err := s2.UnmarshalBinary(header); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary() should reject overflowing size")
+	}
+}
+
+func Test_Size(t *testing.T) {
+	if !ValidSize(1<<20, 1<<7) || ValidSize(1<<20, 1<<8) || ValidSize(math.MaxInt64, math.MaxInt64) || ValidSize(0, 1) {
+		t.Errorf("ValidSize() err")
+	}
+	if _, _, ok := SizeByProb(0.000000001, 0.0000000001); ok {
+		t.Errorf("SizeByProb() should reject too many counters")
+	}
+	if _, _, ok := SizeByProb(math.SmallestNonzeroFloat64, 0.5); ok {
+		t.Errorf("SizeByProb() should reject infinite width")
+	}
+}
@@ -84,16 +84,13 @@ func (dict *SyncDict) RandomKeys(limit int) []string {
 }
 
 func (dict *SyncDict) RandomDistinctKeys(limit int) []string {
-	keys := make([]string, limit)
-	i := 0
+	keys := make([]string, 0, limit)
+	if limit <= 0 {
+		return keys
+	}
 	dict.m.Range(func(k, value any) bool {
-		key := k.(string)
-		keys[i] = key
-		i++
-		if i == limit {
-			return false
-		}
-		return true
+		keys = append(keys, k.(string))
+		return len(keys) < limit
 	})
 	return keys
 }
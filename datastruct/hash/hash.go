@@ -0,0 +1,272 @@
+package hash
+
+import (
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/datastruct/dict"
+	"time"
+)
+
+const (
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+type entry struct {
+	field string
+	val   []byte
+}
+
+// Hash 哈希类型，支持字段级别的过期时间
+// 字段较少时使用紧凑的listpack编码，超过阈值后转换为哈希表
+type Hash struct {
+	listpack []*entry  // listpack编码，按插入顺序存储
+	dict     dict.Dict // hashtable编码，为nil时表示使用listpack编码
+	expires  dict.Dict // field -> time.Time，第一次设置过期时间时才创建
+}
+
+func Make() *Hash {
+	return &Hash{
+		listpack: make([]*entry, 0),
+	}
+}
+
+// Encoding 返回当前的底层编码
+func (hash *Hash) Encoding() string {
+	if hash.dict == nil {
+		return EncodingListpack
+	}
+	return EncodingHashtable
+}
+
+func (hash *Hash) indexOf(field string) int {
+	for i, e := range hash.listpack {
+		if e.field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// convertToHashtable listpack 转换为 hashtable，转换后不再转回
+func (hash *Hash) convertToHashtable() {
+	d := dict.MakeSyncDict()
+	for _, e := range hash.listpack {
+		d.Put(e.field, e.val)
+	}
+	hash.dict = d
+	hash.listpack = nil
+}
+
+func (hash *Hash) rawGet(field string) ([]byte, bool) {
+	if hash.dict != nil {
+		raw, exists := hash.dict.Get(field)
+		if !exists {
+			return nil, false
+		}
+		return raw.([]byte), true
+	}
+	i := hash.indexOf(field)
+	if i < 0 {
+		return nil, false
+	}
+	return hash.listpack[i].val, true
+}
+
+func (hash *Hash) rawPut(field string, val []byte) {
+	if hash.dict == nil {
+		maxValue := config.Properties.HashMaxListpackValue
+		if len(field) > maxValue || len(val) > maxValue {
+			hash.convertToHashtable()
+		}
+	}
+	if hash.dict != nil {
+		hash.dict.Put(field, val)
+		return
+	}
+	if i := hash.indexOf(field); i >= 0 {
+		hash.listpack[i].val = val
+		return
+	}
+	hash.listpack = append(hash.listpack, &entry{field: field, val: val})
+	if len(hash.listpack) > config.Properties.HashMaxListpackEntries {
+		hash.convertToHashtable()
+	}
+}
+
+func (hash *Hash) rawRemove(field string) {
+	if hash.dict != nil {
+		hash.dict.Remove(field)
+		return
+	}
+	if i := hash.indexOf(field); i >= 0 {
+		hash.listpack = append(hash.listpack[:i], hash.listpack[i+1:]...)
+	}
+}
+
+func (hash *Hash) rawLen() int {
+	if hash.dict != nil {
+		return hash.dict.Len()
+	}
+	return len(hash.listpack)
+}
+
+func (hash *Hash) rawForEach(consumer func(field string, val []byte) bool) {
+	if hash.dict != nil {
+		hash.dict.ForEach(func(field string, raw any) bool {
+			return consumer(field, raw.([]byte))
+		})
+		return
+	}
+	// 拷贝一份，consumer中可能删除字段
+	entries := make([]*entry, len(hash.listpack))
+	copy(entries, hash.listpack)
+	for _, e := range entries {
+		if !consumer(e.field, e.val) {
+			break
+		}
+	}
+}
+
+// isExpired 检查字段是否过期，过期则惰性删除
+func (hash *Hash) isExpired(field string) bool {
+	if hash.expires == nil {
+		return false
+	}
+	raw, ok := hash.expires.Get(field)
+	if !ok {
+		return false
+	}
+	if time.Now().Before(raw.(time.Time)) {
+		return false
+	}
+	hash.rawRemove(field)
+	hash.expires.Remove(field)
+	return true
+}
+
+func (hash *Hash) Get(field string) (val []byte, exists bool) {
+	if hash.isExpired(field) {
+		return nil, false
+	}
+	return hash.rawGet(field)
+}
+
+func (hash *Hash) Has(field string) bool {
+	_, exists := hash.Get(field)
+	return exists
+}
+
+/*
+ * return: 1 if field is new, 0 if updated
+ * overwriting a field clears its ttl
+ */
+func (hash *Hash) Put(field string, val []byte) int {
+	result := 1
+	if hash.Has(field) {
+		result = 0
+	}
+	hash.rawPut(field, val)
+	hash.removeExpire(field)
+	return result
+}
+
+func (hash *Hash) Remove(field string) int {
+	if !hash.Has(field) {
+		return 0
+	}
+	hash.rawRemove(field)
+	hash.removeExpire(field)
+	return 1
+}
+
+func (hash *Hash) removeExpire(field string) {
+	if hash.expires != nil {
+		hash.expires.Remove(field)
+	}
+}
+
+func (hash *Hash) Len() int {
+	if hash.expires != nil {
+		hash.RemoveExpired()
+	}
+	return hash.rawLen()
+}
+
+func (hash *Hash) ForEach(consumer func(field string, val []byte) bool) {
+	hash.rawForEach(func(field string, val []byte) bool {
+		if hash.isExpired(field) {
+			return true
+		}
+		return consumer(field, val)
+	})
+}
+
+func (hash *Hash) Fields() []string {
+	fields := make([]string, 0, hash.rawLen())
+	hash.ForEach(func(field string, val []byte) bool {
+		fields = append(fields, field)
+		return true
+	})
+	return fields
+}
+
+// Expire 设置字段的过期时间，字段不存在时返回false
+func (hash *Hash) Expire(field string, expireTime time.Time) bool {
+	if !hash.Has(field) {
+		return false
+	}
+	if hash.expires == nil {
+		hash.expires = dict.MakeSyncDict()
+	}
+	hash.expires.Put(field, expireTime)
+	return true
+}
+
+// Persist 移除字段的过期时间，字段没有过期时间时返回false
+func (hash *Hash) Persist(field string) bool {
+	if hash.expires == nil {
+		return false
+	}
+	if _, ok := hash.expires.Get(field); !ok {
+		return false
+	}
+	hash.expires.Remove(field)
+	return true
+}
+
+// ExpireTime 返回字段的过期时间，ok为false表示字段未设置过期时间
+func (hash *Hash) ExpireTime(field string) (expireTime time.Time, ok bool) {
+	if hash.expires == nil {
+		return time.Time{}, false
+	}
+	raw, ok := hash.expires.Get(field)
+	if !ok {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// HasExpires 是否存在设置了过期时间的字段
+func (hash *Hash) HasExpires() bool {
+	return hash.expires != nil && hash.expires.Len() > 0
+}
+
+// RemoveExpired 主动删除所有过期字段，返回被删除的字段
+func (hash *Hash) RemoveExpired() []string {
+	removed := make([]string, 0)
+	if hash.expires == nil {
+		return removed
+	}
+	now := time.Now()
+	hash.expires.ForEach(func(field string, raw any) bool {
+		if !now.Before(raw.(time.Time)) {
+			removed = append(removed, field)
+		}
+		return true
+	})
+	for _, field := range removed {
+		hash.rawRemove(field)
+		hash.expires.Remove(field)
+	}
+	return removed
+}
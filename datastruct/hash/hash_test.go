@@ -0,0 +1,30 @@
+package hash
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_LazyExpires(t *testing.T) {
+	h := Make()
+	h.Put("a", []byte("1"))
+	h.Put("b", []byte("2"))
+	// 没有设置过期时间时不创建 expires
+	if h.expires != nil || h.Len() != 2 || h.HasExpires() || h.Persist("a") {
+		t.Fatalf("Make() err: expires should be nil")
+	}
+	if _, ok := h.ExpireTime("a"); ok {
+		t.Errorf("ExpireTime() err: a has no ttl")
+	}
+	if h.Expire("nosuch", time.Now()) || h.expires != nil {
+		t.Errorf("Expire() err: missing field should not create expires")
+	}
+	h.Expire("a", time.Now().Add(-time.Second))
+	if h.expires == nil || h.Len() != 1 || h.Has("a") {
+		t.Errorf("Expire() err: len %d", h.Len())
+	}
+	h.Expire("b", time.Now().Add(time.Hour))
+	if !h.HasExpires() || !h.Persist("b") || h.HasExpires() {
+		t.Errorf("Persist() err")
+	}
+}
@@ -0,0 +1,422 @@
+package hll
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+/*
+ * HyperLogLog 以字符串的形式存储，格式与 Redis 兼容:
+ * +------+---+-----+----------+
+ * | HYLL | E | N/U | Cardin.  |
+ * +------+---+-----+----------+
+ * 4字节魔数，1字节编码(0 dense, 1 sparse)，3字节保留，8字节小端序的基数缓存
+ * 基数缓存最高字节的最高位为1时表示缓存失效
+ */
+
+const (
+	hllP         = 14
+	hllQ         = 64 - hllP
+	hllRegisters = 1 << hllP
+	hllPMask     = hllRegisters - 1
+	hllBits      = 6
+	hllRegMax    = (1 << hllBits) - 1
+	hllHdrSize   = 16
+	hllDenseSize = hllHdrSize + (hllRegisters*hllBits+7)/8
+
+	EncodingDense  = 0
+	EncodingSparse = 1
+
+	hllAlphaInf = 0.721347520444481703680
+)
+
+// sparse 编码的操作码
+const (
+	sparseXZeroBit    = 0x40
+	sparseValBit      = 0x80
+	sparseValMaxValue = 32
+	sparseValMaxLen   = 4
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+)
+
+var magic = []byte("HYLL")
+
+var (
+	ErrInvalid   = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// IsValid 检查头部是否为合法的 HyperLogLog
+func IsValid(data []byte) bool {
+	if len(data) < hllHdrSize || !bytes.Equal(data[:4], magic) {
+		return false
+	}
+	switch data[4] {
+	case EncodingDense:
+		return len(data) == hllDenseSize
+	case EncodingSparse:
+		return true
+	}
+	return false
+}
+
+// Encoding 返回 data 的编码，data 必须是合法的 HyperLogLog
+func Encoding(data []byte) byte {
+	return data[4]
+}
+
+// New 创建一个空的 sparse 编码的 HyperLogLog
+func New() []byte {
+	data := make([]byte, hllHdrSize)
+	copy(data, magic)
+	data[4] = EncodingSparse
+	return appendZeroRun(data, hllRegisters)
+}
+
+func invalidateCache(data []byte) {
+	data[hllHdrSize-1] |= 1 << 7
+}
+
+func cachedCount(data []byte) (uint64, bool) {
+	if data[hllHdrSize-1]&(1<<7) != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(data[8:hllHdrSize]), true
+}
+
+func setCachedCount(data []byte, count uint64) {
+	binary.LittleEndian.PutUint64(data[8:hllHdrSize], count)
+}
+
+// murmurHash64A Redis 使用的 MurmurHash2 64位版本
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m uint64 = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	n := len(key) - len(key)&7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	tail := key[n:]
+	switch len(tail) {
+	case 7:
+		h ^= uint64(tail[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(tail[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(tail[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(tail[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(tail[0])
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// patLen 返回元素对应的寄存器下标，以及哈希值中第一个1出现的位置
+func patLen(element []byte) (index int, count uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index = int(hash & hllPMask)
+	hash >>= hllP
+	hash |= 1 << hllQ
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+func denseGet(regs []byte, index int) uint8 {
+	bit := index * hllBits
+	b := bit / 8
+	fb := uint(bit & 7)
+	b0 := regs[b]
+	var b1 byte
+	if b+1 < len(regs) {
+		b1 = regs[b+1]
+	}
+	return uint8((uint16(b0)>>fb | uint16(b1)<<(8-fb)) & hllRegMax)
+}
+
+func denseSet(regs []byte, index int, val uint8) {
+	bit := index * hllBits
+	b := bit / 8
+	fb := uint(bit & 7)
+	regs[b] &^= byte(hllRegMax << fb)
+	regs[b] |= byte(uint16(val) << fb)
+	if b+1 < len(regs) {
+		regs[b+1] &^= byte(hllRegMax >> (8 - fb))
+		regs[b+1] |= byte(uint16(val) >> (8 - fb))
+	}
+}
+
+// decode 将 dense 或 sparse 编码展开为每个寄存器一个字节
+func decode(data []byte) ([]uint8, error) {
+	if !IsValid(data) {
+		return nil, ErrInvalid
+	}
+	regs := make([]uint8, hllRegisters)
+	body := data[hllHdrSize:]
+	if data[4] == EncodingDense {
+		for i := range regs {
+			regs[i] = denseGet(body, i)
+		}
+		return regs, nil
+	}
+	index := 0
+	for i := 0; i < len(body); i++ {
+		op := body[i]
+		var runLen int
+		var val uint8
+		switch {
+		case op&sparseValBit != 0:
+			val = (op>>2)&0x1f + 1
+			runLen = int(op&0x3) + 1
+		case op&sparseXZeroBit != 0:
+			if i+1 >= len(body) {
+				return nil, ErrCorrupted
+			}
+			runLen = (int(op&0x3f)<<8 | int(body[i+1])) + 1
+			i++
+		default:
+			runLen = int(op&0x3f) + 1
+		}
+		if index+runLen > hllRegisters {
+			return nil, ErrCorrupted
+		}
+		for j := 0; j < runLen; j++ {
+			regs[index+j] = val
+		}
+		index += runLen
+	}
+	if index != hllRegisters {
+		return nil, ErrCorrupted
+	}
+	return regs, nil
+}
+
+func appendZeroRun(data []byte, runLen int) []byte {
+	for runLen > 0 {
+		if runLen <= sparseZeroMaxLen {
+			return append(data, byte(runLen-1))
+		}
+		n := runLen
+		if n > sparseXZeroMaxLen {
+			n = sparseXZeroMaxLen
+		}
+		data = append(data, sparseXZeroBit|byte((n-1)>>8), byte((n-1)&0xff))
+		runLen -= n
+	}
+	return data
+}
+
+func encodeDense(regs []uint8) []byte {
+	data := make([]byte, hllDenseSize)
+	copy(data, magic)
+	data[4] = EncodingDense
+	body := data[hllHdrSize:]
+	for i, val := range regs {
+		denseSet(body, i, val)
+	}
+	return data
+}
+
+// encodeSparse 使用 sparse 编码，寄存器的值超过 sparse 可表示的范围时返回 false
+func encodeSparse(regs []uint8) ([]byte, bool) {
+	data := make([]byte, hllHdrSize)
+	copy(data, magic)
+	data[4] = EncodingSparse
+	for i := 0; i < len(regs); {
+		val := regs[i]
+		if val > sparseValMaxValue {
+			return nil, false
+		}
+		j := i + 1
+		for j < len(regs) && regs[j] == val {
+			j++
+		}
+		runLen := j - i
+		if val == 0 {
+			data = appendZeroRun(data, runLen)
+		} else {
+			for runLen > 0 {
+				n := runLen
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				data = append(data, sparseValBit|(val-1)<<2|byte(n-1))
+				runLen -= n
+			}
+		}
+		i = j
+	}
+	return data, true
+}
+
+// encode 优先使用 sparse 编码，超过 sparseMaxBytes 时转换为 dense
+func encode(regs []uint8, dense bool, sparseMaxBytes int) []byte {
+	if !dense {
+		if data, ok := encodeSparse(regs); ok && len(data) <= sparseMaxBytes {
+			return data
+		}
+	}
+	return encodeDense(regs)
+}
+
+/*
+ * Add 添加元素，返回新的 HyperLogLog 以及是否有寄存器被修改
+ * sparse 编码的长度超过 sparseMaxBytes 时转换为 dense 编码, dense 编码不会再转回 sparse
+ */
+func Add(data []byte, elements [][]byte, sparseMaxBytes int) ([]byte, bool, error) {
+	regs, err := decode(data)
+	if err != nil {
+		return nil, false, err
+	}
+	updated := false
+	for _, element := range elements {
+		index, count := patLen(element)
+		if count > regs[index] {
+			regs[index] = count
+			updated = true
+		}
+	}
+	if !updated {
+		return data, false, nil
+	}
+	result := encode(regs, data[4] == EncodingDense, sparseMaxBytes)
+	invalidateCache(result)
+	return result, true, nil
+}
+
+// Merge 合并多个 HyperLogLog，任意一个为 dense 编码时结果为 dense 编码
+func Merge(datas [][]byte, sparseMaxBytes int) ([]byte, error) {
+	max := make([]uint8, hllRegisters)
+	dense := false
+	for _, data := range datas {
+		regs, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if data[4] == EncodingDense {
+			dense = true
+		}
+		for i, val := range regs {
+			if val > max[i] {
+				max[i] = val
+			}
+		}
+	}
+	result := encode(max, dense, sparseMaxBytes)
+	invalidateCache(result)
+	return result, nil
+}
+
+/*
+ * Count 估算基数，缓存有效时直接返回缓存的值
+ * 缓存失效时重新计算并写入 data 的头部，cacheUpdated 表示 data 是否被修改
+ */
+func Count(data []byte) (count uint64, cacheUpdated bool, err error) {
+	if !IsValid(data) {
+		return 0, false, ErrInvalid
+	}
+	if count, ok := cachedCount(data); ok {
+		return count, false, nil
+	}
+	regs, err := decode(data)
+	if err != nil {
+		return 0, false, err
+	}
+	count = estimate(regs)
+	setCachedCount(data, count)
+	return count, true, nil
+}
+
+// CountUnion 估算多个 HyperLogLog 并集的基数，不修改缓存
+func CountUnion(datas [][]byte) (uint64, error) {
+	max := make([]uint8, hllRegisters)
+	for _, data := range datas {
+		regs, err := decode(data)
+		if err != nil {
+			return 0, err
+		}
+		for i, val := range regs {
+			if val > max[i] {
+				max[i] = val
+			}
+		}
+	}
+	return estimate(max), nil
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	var zPrime float64
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime = z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			break
+		}
+	}
+	return z / 3
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	var zPrime float64
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime = z
+		z += x * y
+		y += y
+		if zPrime == z {
+			break
+		}
+	}
+	return z
+}
+
+// estimate 使用 Otmar Ertl 提出的改进估算方法，与 Redis 的计算结果一致
+func estimate(regs []uint8) uint64 {
+	var histo [64]int
+	for _, val := range regs {
+		histo[val]++
+	}
+	m := float64(hllRegisters)
+	z := m * tau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
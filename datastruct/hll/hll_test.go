@@ -0,0 +1,83 @@
+package hll
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func addRange(t *testing.T, data []byte, from int, to int, sparseMaxBytes int) []byte {
+	elements := make([][]byte, 0, to-from)
+	for i := from; i < to; i++ {
+		elements = append(elements, []byte("element:"+strconv.Itoa(i)))
+	}
+	data, _, err := Add(data, elements, sparseMaxBytes)
+	if err != nil {
+		t.Fatalf("Add() err: %v", err)
+	}
+	return data
+}
+
+func Test_Count(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		data := addRange(t, New(), 0, n, 3000)
+		count, _, err := Count(data)
+		if err != nil {
+			t.Fatalf("Count() err: %v", err)
+		}
+		if math.Abs(float64(count)-float64(n)) > float64(n)*0.02 {
+			t.Errorf("Count() err: reall: %d, want about: %d", count, n)
+		}
+		// 第二次读取缓存
+		cached, updated, _ := Count(data)
+		if cached != count || updated {
+			t.Errorf("Count() cache err: %d, %d, %v", cached, count, updated)
+		}
+	}
+}
+
+func Test_Encoding(t *testing.T) {
+	data := New()
+	if Encoding(data) != EncodingSparse || len(data) != hllHdrSize+2 {
+		t.Fatalf("New() err: encoding %d, len %d", Encoding(data), len(data))
+	}
+	data = addRange(t, data, 0, 100, 3000)
+	if Encoding(data) != EncodingSparse {
+		t.Errorf("encoding err: %d, want sparse", Encoding(data))
+	}
+	sparseRegs, _ := decode(data)
+	data = addRange(t, data, 100, 10000, 3000)
+	if Encoding(data) != EncodingDense || len(data) != hllDenseSize {
+		t.Errorf("encoding err: %d, want dense", Encoding(data))
+	}
+	// dense 与 sparse 编码可以互相转换
+	denseRegs, _ := decode(encodeDense(sparseRegs))
+	if !reflect.DeepEqual(denseRegs, sparseRegs) {
+		t.Errorf("dense round trip err")
+	}
+	if _, _, err := Add([]byte("not a hll"), nil, 3000); err != ErrInvalid {
+		t.Errorf("Add() should reject invalid value, err: %v", err)
+	}
+	corrupted := New()[:hllHdrSize+1]
+	if _, err := CountUnion([][]byte{corrupted}); err != ErrCorrupted {
+		t.Errorf("CountUnion() should reject corrupted value, err: %v", err)
+	}
+}
+
+func Test_Merge(t *testing.T) {
+	a := addRange(t, New(), 0, 5000, 3000)
+	b := addRange(t, New(), 2500, 7500, 3000)
+	merged, err := Merge([][]byte{a, b}, 3000)
+	if err != nil {
+		t.Fatalf("Merge() err: %v", err)
+	}
+	count, _, _ := Count(merged)
+	union, _ := CountUnion([][]byte{a, b})
+	if count != union {
+		t.Errorf("Merge() err: %d, CountUnion(): %d", count, union)
+	}
+	if math.Abs(float64(count)-7500) > 7500*0.02 {
+		t.Errorf("Merge() err: reall: %d, want about: 7500", count)
+	}
+}
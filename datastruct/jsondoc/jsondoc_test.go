@@ -0,0 +1,95 @@
+package jsondoc
+
+import (
+	"testing"
+)
+
+const doc = `{"a":1,"b":{"a":"x","c":[1,2.5,{"a":true}]},"d":null}`
+
+func Test_ParseAndMarshal(t *testing.T) {
+	val, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse() err: %v", err)
+	}
+	if s := string(Marshal(val)); s != doc {
+		t.Errorf("Marshal() err: %s", s)
+	}
+	format := &Format{Indent: "  ", Newline: "\n", Space: " "}
+	if s := string(MarshalFormat(MakeObject(), format)); s != "{}" {
+		t.Errorf("MarshalFormat() err: %s", s)
+	}
+	arr, _ := Parse([]byte(`{"k":[1]}`))
+	if s := string(MarshalFormat(arr, format)); s != "{\n  \"k\": [\n    1\n  ]\n}" {
+		t.Errorf("MarshalFormat() err: %q", s)
+	}
+	for _, invalid := range []string{"", "{", `{"a":1}x`, "[1,]"} {
+		if _, err := Parse([]byte(invalid)); err != ErrInvalidJSON {
+			t.Errorf("Parse(%q) should fail", invalid)
+		}
+	}
+	if s := FormatFloat(3); s != "3.0" {
+		t.Errorf("FormatFloat() err: %s", s)
+	}
+}
+
+func Test_Path(t *testing.T) {
+	testCases := []struct {
+		path   string
+		result string
+	}{
+		{path: "$", result: `[` + doc + `]`},
+		{path: "$.a", result: `[1]`},
+		{path: "$..a", result: `[1,"x",true]`},
+		{path: "$.b.c[-1].a", result: `[true]`},
+		{path: "$['b'][\"c\"][0:2]", result: `[1,2.5]`},
+		{path: "$.b.*", result: `["x",[1,2.5,{"a":true}]]`},
+		{path: "$.b.c[*]", result: `[1,2.5,{"a":true}]`},
+		{path: "$.nope", result: `[]`},
+		{path: "b.c[1]", result: `[2.5]`},
+		{path: ".", result: `[` + doc + `]`},
+	}
+	root, _ := Parse([]byte(doc))
+	for _, tt := range testCases {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := ParsePath(tt.path)
+			if err != nil {
+				t.Fatalf("ParsePath() err: %v", err)
+			}
+			result := &Array{Items: make([]any, 0)}
+			for _, node := range path.Evaluate(root) {
+				result.Items = append(result.Items, node.Value)
+			}
+			if s := string(Marshal(result)); s != tt.result {
+				t.Errorf("Evaluate() err: reall: %s, want: %s", s, tt.result)
+			}
+		})
+	}
+	for _, invalid := range []string{"$.", "$[", "$[x]", "$a", ""} {
+		if _, err := ParsePath(invalid); err == nil {
+			t.Errorf("ParsePath(%q) should fail", invalid)
+		}
+	}
+}
+
+func Test_SetAndDelete(t *testing.T) {
+	root, _ := Parse([]byte(doc))
+	path, _ := ParsePath("$..a")
+	if n := path.Set(root, int64(0), false, false); n != 3 {
+		t.Errorf("Set() err: updated %d", n)
+	}
+	path, _ = ParsePath("$.b.e")
+	if n := path.Set(root, "new", false, true); n != 0 {
+		t.Errorf("Set(XX) should not add member")
+	}
+	if n := path.Set(root, "new", true, false); n != 1 {
+		t.Errorf("Set(NX) err: updated %d", n)
+	}
+	path, _ = ParsePath("$.b.c[0:2]")
+	if n := Delete(path.Evaluate(root)); n != 2 {
+		t.Errorf("Delete() err: deleted %d", n)
+	}
+	want := `{"a":0,"b":{"a":0,"c":[{"a":0}],"e":"new"},"d":null}`
+	if s := string(Marshal(root)); s != want {
+		t.Errorf("result err: %s", s)
+	}
+}
@@ -0,0 +1,367 @@
+package jsondoc
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * 支持的 JSONPath 子集:
+ * $ 根节点，.key 或 ['key'] 成员，[n] 下标(负数从末尾计数)，[start:end] 切片
+ * .* 或 [*] 通配符，..key 递归查找
+ * 不以 $ 开头的路径为旧版路径，如 . 和 a.b[0]，只返回第一个匹配的值
+ */
+
+var ErrInvalidPath = errors.New("ERR invalid JSONPath")
+
+const (
+	segKey = iota
+	segIndex
+	segWildcard
+	segSlice
+)
+
+type segment struct {
+	kind      int
+	key       string
+	index     int
+	start     *int
+	end       *int
+	recursive bool
+}
+
+type Path struct {
+	raw      string
+	legacy   bool
+	segments []segment
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// IsLegacy 是否为旧版路径
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+// IsRoot 路径是否只指向根节点
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+func ParsePath(raw string) (*Path, error) {
+	path := &Path{raw: raw}
+	s := raw
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else {
+		path.legacy = true
+		if s == "." {
+			return path, nil
+		}
+		// 旧版路径可以省略开头的 .
+		if !strings.HasPrefix(s, ".") && !strings.HasPrefix(s, "[") {
+			s = "." + s
+		}
+	}
+	for len(s) > 0 {
+		seg := segment{}
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(s, "."):
+			if !seg.recursive {
+				s = s[1:]
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			if name == "" {
+				return nil, ErrInvalidPath
+			}
+			if name == "*" {
+				seg.kind = segWildcard
+			} else {
+				seg.kind = segKey
+				seg.key = name
+			}
+			path.segments = append(path.segments, seg)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, ErrInvalidPath
+		}
+		// [...]
+		end := closingBracket(s)
+		if end < 0 {
+			return nil, ErrInvalidPath
+		}
+		if err := parseBracket(strings.TrimSpace(s[1:end]), &seg); err != nil {
+			return nil, err
+		}
+		s = s[end+1:]
+		path.segments = append(path.segments, seg)
+	}
+	return path, nil
+}
+
+// closingBracket 返回与 s[0] 的 [ 匹配的 ] 的位置，跳过引号中的内容
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == 0 && c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracket(content string, seg *segment) error {
+	if content == "*" {
+		seg.kind = segWildcard
+		return nil
+	}
+	if len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0] {
+		seg.kind = segKey
+		key := content[1 : len(content)-1]
+		if content[0] == '"' {
+			unquoted, err := strconv.Unquote(content)
+			if err != nil {
+				return ErrInvalidPath
+			}
+			key = unquoted
+		}
+		seg.key = key
+		return nil
+	}
+	if colon := strings.IndexByte(content, ':'); colon >= 0 {
+		seg.kind = segSlice
+		bounds := []**int{&seg.start, &seg.end}
+		for i, part := range []string{content[:colon], content[colon+1:]} {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return ErrInvalidPath
+			}
+			*bounds[i] = &n
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(content)
+	if err != nil {
+		return ErrInvalidPath
+	}
+	seg.kind = segIndex
+	seg.index = n
+	return nil
+}
+
+// Node 路径匹配到的节点，Parent 为 nil 时表示根节点
+type Node struct {
+	Value  any
+	Parent any
+	Key    string
+	Index  int
+}
+
+// Set 替换节点的值
+func (n *Node) Set(val any) {
+	switch parent := n.Parent.(type) {
+	case *Object:
+		parent.Set(n.Key, val)
+	case *Array:
+		parent.Items[n.Index] = val
+	}
+	n.Value = val
+}
+
+// descendants 返回 node 及其所有子孙节点
+func descendants(node *Node) []*Node {
+	result := []*Node{node}
+	for _, child := range children(node) {
+		result = append(result, descendants(child)...)
+	}
+	return result
+}
+
+func children(node *Node) []*Node {
+	result := make([]*Node, 0)
+	switch v := node.Value.(type) {
+	case *Object:
+		for _, key := range v.keys {
+			result = append(result, &Node{Value: v.values[key], Parent: v, Key: key})
+		}
+	case *Array:
+		for i, item := range v.Items {
+			result = append(result, &Node{Value: item, Parent: v, Index: i})
+		}
+	}
+	return result
+}
+
+func normalizeIndex(index int, size int) int {
+	if index < 0 {
+		index += size
+	}
+	return index
+}
+
+func applySegment(node *Node, seg *segment) []*Node {
+	switch seg.kind {
+	case segKey:
+		if obj, ok := node.Value.(*Object); ok {
+			if val, ok := obj.Get(seg.key); ok {
+				return []*Node{{Value: val, Parent: obj, Key: seg.key}}
+			}
+		}
+	case segIndex:
+		if arr, ok := node.Value.(*Array); ok {
+			index := normalizeIndex(seg.index, len(arr.Items))
+			if index >= 0 && index < len(arr.Items) {
+				return []*Node{{Value: arr.Items[index], Parent: arr, Index: index}}
+			}
+		}
+	case segWildcard:
+		return children(node)
+	case segSlice:
+		if arr, ok := node.Value.(*Array); ok {
+			start, end := 0, len(arr.Items)
+			if seg.start != nil {
+				start = normalizeIndex(*seg.start, len(arr.Items))
+			}
+			if seg.end != nil {
+				end = normalizeIndex(*seg.end, len(arr.Items))
+			}
+			if start < 0 {
+				start = 0
+			}
+			if end > len(arr.Items) {
+				end = len(arr.Items)
+			}
+			result := make([]*Node, 0)
+			for i := start; i < end; i++ {
+				result = append(result, &Node{Value: arr.Items[i], Parent: arr, Index: i})
+			}
+			return result
+		}
+	}
+	return nil
+}
+
+func evaluate(root any, segments []segment) []*Node {
+	nodes := []*Node{{Value: root}}
+	for i := range segments {
+		seg := &segments[i]
+		if seg.recursive {
+			expanded := make([]*Node, 0)
+			for _, node := range nodes {
+				expanded = append(expanded, descendants(node)...)
+			}
+			nodes = expanded
+		}
+		next := make([]*Node, 0)
+		for _, node := range nodes {
+			next = append(next, applySegment(node, seg)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Evaluate 返回路径匹配到的所有节点
+func (p *Path) Evaluate(root any) []*Node {
+	return evaluate(root, p.segments)
+}
+
+/*
+ * Set 将路径匹配到的节点替换为 val，返回被修改的节点个数
+ * 没有匹配的节点且路径最后一段为成员名时，在父节点中新增该成员
+ * nx: 只新增不替换, xx: 只替换不新增，根节点的替换由调用方处理
+ */
+func (p *Path) Set(root any, val any, nx bool, xx bool) int {
+	nodes := p.Evaluate(root)
+	if len(nodes) > 0 {
+		if nx {
+			return 0
+		}
+		for _, node := range nodes {
+			node.Set(Clone(val))
+		}
+		return len(nodes)
+	}
+	last := len(p.segments) - 1
+	if xx || last < 0 || p.segments[last].kind != segKey || p.segments[last].recursive {
+		return 0
+	}
+	updated := 0
+	for _, parent := range evaluate(root, p.segments[:last]) {
+		if obj, ok := parent.Value.(*Object); ok {
+			obj.Set(p.segments[last].key, Clone(val))
+			updated++
+		}
+	}
+	return updated
+}
+
+// Delete 删除路径匹配到的节点，返回删除的个数，不能删除根节点
+func Delete(nodes []*Node) int {
+	// 数组元素从后往前删除，保证下标有效
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Index > nodes[j].Index
+	})
+	deleted := 0
+	for _, node := range nodes {
+		switch parent := node.Parent.(type) {
+		case *Object:
+			if parent.Delete(node.Key) {
+				deleted++
+			}
+		case *Array:
+			if node.Index < len(parent.Items) {
+				parent.Items = append(parent.Items[:node.Index], parent.Items[node.Index+1:]...)
+				deleted++
+			}
+		}
+	}
+	return deleted
+}
+
+// Clone 深拷贝值
+func Clone(val any) any {
+	switch v := val.(type) {
+	case *Object:
+		obj := MakeObject()
+		for _, key := range v.keys {
+			obj.Set(key, Clone(v.values[key]))
+		}
+		return obj
+	case *Array:
+		items := make([]any, len(v.Items))
+		for i, item := range v.Items {
+			items[i] = Clone(item)
+		}
+		return &Array{Items: items}
+	}
+	return val
+}
@@ -0,0 +1,258 @@
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+ * JSON 文档以树的形式存储，节点的值为以下类型之一:
+ * *Object, *Array, string, int64, float64, bool, nil
+ * Object 保留键的插入顺序
+ */
+
+var ErrInvalidJSON = errors.New("ERR invalid JSON")
+
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+type Array struct {
+	Items []any
+}
+
+// Document 根节点可以被整体替换，因此单独包装一层
+type Document struct {
+	Root any
+}
+
+// SetNode 替换节点的值，节点为根节点时替换整个文档
+func (d *Document) SetNode(node *Node, val any) {
+	node.Set(val)
+	if node.Parent == nil {
+		d.Root = val
+	}
+}
+
+func MakeObject() *Object {
+	return &Object{
+		values: make(map[string]any),
+	}
+}
+
+func (o *Object) Get(key string) (any, bool) {
+	val, ok := o.values[key]
+	return val, ok
+}
+
+// Set 设置键的值，新的键追加在末尾
+func (o *Object) Set(key string, val any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = val
+}
+
+func (o *Object) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Keys 按插入顺序返回所有的键
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Parse 解析 JSON 文本
+func Parse(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	val, err := parseValue(decoder)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, ErrInvalidJSON
+	}
+	return val, nil
+}
+
+func parseValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := MakeObject()
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				val, err := parseValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				obj.Set(keyToken.(string), val)
+			}
+			_, err = decoder.Token()
+			return obj, err
+		case '[':
+			arr := &Array{Items: make([]any, 0)}
+			for decoder.More() {
+				val, err := parseValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				arr.Items = append(arr.Items, val)
+			}
+			_, err = decoder.Token()
+			return arr, err
+		}
+		return nil, ErrInvalidJSON
+	case json.Number:
+		return parseNumber(string(t))
+	}
+	// string, bool, nil
+	return token, nil
+}
+
+func parseNumber(s string) (any, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if val, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return val, nil
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// TypeName 返回值的类型名称
+func TypeName(val any) string {
+	switch val.(type) {
+	case *Object:
+		return "object"
+	case *Array:
+		return "array"
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// Format 序列化时使用的缩进、换行和冒号后的空格
+type Format struct {
+	Indent  string
+	Newline string
+	Space   string
+}
+
+// Marshal 使用紧凑格式序列化
+func Marshal(val any) []byte {
+	return MarshalFormat(val, &Format{})
+}
+
+func MarshalFormat(val any, format *Format) []byte {
+	buf := &bytes.Buffer{}
+	writeValue(buf, val, format, 0)
+	return buf.Bytes()
+}
+
+func writeIndent(buf *bytes.Buffer, format *Format, level int) {
+	buf.WriteString(format.Newline)
+	for i := 0; i < level; i++ {
+		buf.WriteString(format.Indent)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, val any, format *Format, level int) {
+	switch v := val.(type) {
+	case *Object:
+		if v.Len() == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeIndent(buf, format, level+1)
+			writeString(buf, key)
+			buf.WriteByte(':')
+			buf.WriteString(format.Space)
+			writeValue(buf, v.values[key], format, level+1)
+		}
+		writeIndent(buf, format, level)
+		buf.WriteByte('}')
+	case *Array:
+		if len(v.Items) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteByte('[')
+		for i, item := range v.Items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeIndent(buf, format, level+1)
+			writeValue(buf, item, format, level+1)
+		}
+		writeIndent(buf, format, level)
+		buf.WriteByte(']')
+	case string:
+		writeString(buf, v)
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(FormatFloat(v))
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	default:
+		buf.WriteString("null")
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	encoded := &bytes.Buffer{}
+	encoder := json.NewEncoder(encoded)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	// Encode 会在末尾追加换行
+	buf.Write(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+}
+
+// FormatFloat 浮点数始终带有小数点，与整数区分
+func FormatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
@@ -103,12 +103,12 @@ func (list *LinkedList) removeNode(n *node) {
 	if n.prev == nil {
 		list.first = n.next
 	} else {
-		n.next.prev = n.prev
+		n.prev.next = n.next
 	}
 	if n.next == nil {
 		list.last = n.prev
 	} else {
-		n.prev.next = n.next
+		n.next.prev = n.prev
 	}
 	n.prev = nil
 	n.next = nil
@@ -0,0 +1,34 @@
+package list
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Remove(t *testing.T) {
+	list := Make(0, 1, 2, 3, 4, 5)
+	// 分别删除头部、尾部和中间的节点
+	if val := list.Remove(0); val != 0 {
+		t.Errorf("Remove(0) err: %v", val)
+	}
+	if val := list.RemoveLast(); val != 5 {
+		t.Errorf("RemoveLast() err: %v", val)
+	}
+	if val := list.Remove(1); val != 2 {
+		t.Errorf("Remove(1) err: %v", val)
+	}
+	if vals := list.Range(0, list.Len()); !reflect.DeepEqual(vals, []any{1, 3, 4}) {
+		t.Errorf("Range() err: %v", vals)
+	}
+	list.Add(6)
+	if list.RemoveByVal(3, 1) != 1 || list.Get(1) != 4 || list.Get(list.Len()-1) != 6 {
+		t.Errorf("RemoveByVal() err: %v", list.Range(0, list.Len()))
+	}
+	for list.Len() > 0 {
+		list.RemoveLast()
+	}
+	list.Add(7)
+	if list.Len() != 1 || list.Get(0) != 7 {
+		t.Errorf("Add() after remove err: %v", list.Range(0, list.Len()))
+	}
+}
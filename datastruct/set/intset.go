@@ -0,0 +1,63 @@
+package set
+
+import (
+	"sort"
+	"strconv"
+)
+
+// intSet 有序的整数集合，成员均为整数且数量较少时使用
+type intSet struct {
+	contents []int64
+}
+
+func makeIntSet() *intSet {
+	return &intSet{
+		contents: make([]int64, 0),
+	}
+}
+
+// parseInt 成员能否以整数形式存储，要求转换前后字符串一致，如 "01" 不能存储为 1
+func parseInt(member string) (int64, bool) {
+	val, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(val, 10) != member {
+		return 0, false
+	}
+	return val, true
+}
+
+// search 返回val的位置，不存在时返回应插入的位置
+func (set *intSet) search(val int64) (int, bool) {
+	i := sort.Search(len(set.contents), func(i int) bool {
+		return set.contents[i] >= val
+	})
+	return i, i < len(set.contents) && set.contents[i] == val
+}
+
+func (set *intSet) add(val int64) int {
+	i, found := set.search(val)
+	if found {
+		return 0
+	}
+	set.contents = append(set.contents, 0)
+	copy(set.contents[i+1:], set.contents[i:])
+	set.contents[i] = val
+	return 1
+}
+
+func (set *intSet) remove(val int64) int {
+	i, found := set.search(val)
+	if !found {
+		return 0
+	}
+	set.contents = append(set.contents[:i], set.contents[i+1:]...)
+	return 1
+}
+
+func (set *intSet) has(val int64) bool {
+	_, found := set.search(val)
+	return found
+}
+
+func (set *intSet) len() int {
+	return len(set.contents)
+}
@@ -1,40 +1,98 @@
 package set
 
-import "github.com/jiangh156/godis/datastruct/dict"
+import (
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/datastruct/dict"
+	"math/rand"
+	"strconv"
+)
 
+const (
+	EncodingIntset    = "intset"
+	EncodingHashtable = "hashtable"
+)
+
+// Set 成员均为整数且数量较少时使用intset编码，否则转换为哈希表
 type Set struct {
-	dict dict.Dict
+	intset *intSet
+	dict   dict.Dict // 为nil时表示使用intset编码
 }
 
 func Make() *Set {
 	return &Set{
-		dict: dict.MakeSyncDict(),
+		intset: makeIntSet(),
 	}
 }
 
 func MakeFromVals(members ...string) *Set {
-	set := &Set{
-		dict: dict.MakeSyncDict(),
+	set := Make()
+	for _, member := range members {
+		set.Add(member)
 	}
 	return set
 }
 
+// Encoding 返回当前的底层编码
+func (set *Set) Encoding() string {
+	if set.dict == nil {
+		return EncodingIntset
+	}
+	return EncodingHashtable
+}
+
+// convertToHashtable intset 转换为 hashtable，转换后不再转回
+func (set *Set) convertToHashtable() {
+	d := dict.MakeSyncDict()
+	for _, val := range set.intset.contents {
+		d.Put(strconv.FormatInt(val, 10), struct{}{})
+	}
+	set.dict = d
+	set.intset = nil
+}
+
 func (set *Set) Add(member string) int {
 	if set == nil {
 		panic("set is nil")
 	}
+	if set.dict == nil {
+		val, ok := parseInt(member)
+		if ok && set.intset.has(val) {
+			return 0
+		}
+		if ok && set.intset.len() < config.Properties.SetMaxIntsetEntries {
+			return set.intset.add(val)
+		}
+		set.convertToHashtable()
+	}
+	if _, exists := set.dict.Get(member); exists {
+		return 0
+	}
 	return set.dict.Put(member, struct{}{})
 }
 func (set *Set) Remove(member string) int {
 	if set == nil {
 		panic("set is nil")
 	}
+	if set.dict == nil {
+		val, ok := parseInt(member)
+		if !ok {
+			return 0
+		}
+		return set.intset.remove(val)
+	}
+	if _, exists := set.dict.Get(member); !exists {
+		return 0
+	}
 	return set.dict.Remove(member)
 }
 func (set *Set) Has(member string) bool {
 	if set == nil {
 		panic("set is nil")
 	}
+	if set.dict == nil {
+		val, ok := parseInt(member)
+		return ok && set.intset.has(val)
+	}
 	_, exists := set.dict.Get(member)
 	return exists
 }
@@ -42,25 +100,34 @@ func (set *Set) Len() int {
 	if set == nil {
 		panic("set is nil")
 	}
+	if set.dict == nil {
+		return set.intset.len()
+	}
 	return set.dict.Len()
 }
 func (set *Set) ToSlice() []string {
 	if set == nil {
 		panic("set is nil")
 	}
-	slice := make([]string, set.Len())
-	i := 0
-	set.dict.ForEach(func(member string, value any) bool {
-		if i < len(slice) {
-			slice[i] = member
-		} else {
-			slice = append(slice, member)
-		}
+	slice := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		slice = append(slice, member)
 		return true
 	})
 	return slice
 }
 func (set *Set) ForEach(consumer func(member string) bool) {
+	if set.dict == nil {
+		// 拷贝一份，consumer中可能修改集合
+		contents := make([]int64, len(set.intset.contents))
+		copy(contents, set.intset.contents)
+		for _, val := range contents {
+			if !consumer(strconv.FormatInt(val, 10)) {
+				break
+			}
+		}
+		return
+	}
 	set.dict.ForEach(func(key string, value any) bool {
 		return consumer(key)
 	})
@@ -80,12 +147,25 @@ func (set *Set) Union(another *Set) *Set {
 	})
 	return result
 }
+func (set *Set) Intersect(another *Set) *Set {
+	if set == nil {
+		panic("set is nil")
+	}
+	result := Make()
+	set.ForEach(func(member string) bool {
+		if another.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
 func (set *Set) Diff(another *Set) *Set {
 	if set == nil {
 		panic("set is nil")
 	}
 	result := Make()
-	another.ForEach(func(member string) bool {
+	set.ForEach(func(member string) bool {
 		if !another.Has(member) {
 			result.Add(member)
 		}
@@ -94,8 +174,30 @@ func (set *Set) Diff(another *Set) *Set {
 	return result
 }
 func (set *Set) RandomMembers(limit int) []string {
+	if set.dict == nil {
+		size := set.intset.len()
+		if size == 0 {
+			return []string{}
+		}
+		members := make([]string, limit)
+		for i := range members {
+			members[i] = strconv.FormatInt(set.intset.contents[rand.Intn(size)], 10)
+		}
+		return members
+	}
 	return set.dict.RandomKeys(limit)
 }
 func (set *Set) RandomDistinctMembers(limit int) []string {
+	if set.dict == nil {
+		size := set.intset.len()
+		if limit > size {
+			limit = size
+		}
+		members := make([]string, limit)
+		for i, index := range rand.Perm(size)[:limit] {
+			members[i] = strconv.FormatInt(set.intset.contents[index], 10)
+		}
+		return members
+	}
 	return set.dict.RandomDistinctKeys(limit)
 }
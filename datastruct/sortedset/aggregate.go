@@ -0,0 +1,141 @@
+package sortedset
+
+import (
+	"math"
+	"strings"
+)
+
+// 多个有序集合合并时分数的聚合方式
+const (
+	AggregateSum = "SUM"
+	AggregateMin = "MIN"
+	AggregateMax = "MAX"
+)
+
+// IsAggregate 检查聚合方式是否合法
+func IsAggregate(aggregate string) bool {
+	switch strings.ToUpper(aggregate) {
+	case AggregateSum, AggregateMin, AggregateMax:
+		return true
+	}
+	return false
+}
+
+func aggregateScore(aggregate string, a float64, b float64) float64 {
+	switch aggregate {
+	case AggregateMin:
+		return math.Min(a, b)
+	case AggregateMax:
+		return math.Max(a, b)
+	}
+	sum := a + b
+	// +inf 与 -inf 相加时结果为 0
+	if math.IsNaN(sum) {
+		return 0
+	}
+	return sum
+}
+
+func weightScore(score float64, weight float64) float64 {
+	result := score * weight
+	// inf * 0 时结果为 0
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// getWeight weights 为空时权重为 1
+func getWeight(weights []float64, i int) float64 {
+	if len(weights) == 0 {
+		return 1
+	}
+	return weights[i]
+}
+
+/*
+ * Union 计算多个有序集合的并集
+ * sets 中的 nil 视为空集合, weights 为空时权重均为 1
+ */
+func Union(sets []*SortedSet, weights []float64, aggregate string) *SortedSet {
+	aggregate = strings.ToUpper(aggregate)
+	scores := make(map[string]float64)
+	order := make([]string, 0)
+	for i, set := range sets {
+		if set == nil {
+			continue
+		}
+		weight := getWeight(weights, i)
+		set.ForEach(0, set.Len(), false, func(element *Element) bool {
+			score := weightScore(element.Score, weight)
+			if current, ok := scores[element.Member]; ok {
+				scores[element.Member] = aggregateScore(aggregate, current, score)
+			} else {
+				scores[element.Member] = score
+				order = append(order, element.Member)
+			}
+			return true
+		})
+	}
+	result := Make()
+	for _, member := range order {
+		result.Add(member, scores[member])
+	}
+	return result
+}
+
+/*
+ * Intersect 计算多个有序集合的交集
+ * sets 中的 nil 视为空集合, weights 为空时权重均为 1
+ */
+func Intersect(sets []*SortedSet, weights []float64, aggregate string) *SortedSet {
+	aggregate = strings.ToUpper(aggregate)
+	result := Make()
+	if len(sets) == 0 {
+		return result
+	}
+	for _, set := range sets {
+		if set == nil || set.Len() == 0 {
+			return result
+		}
+	}
+	first := sets[0]
+	first.ForEach(0, first.Len(), false, func(element *Element) bool {
+		score := weightScore(element.Score, getWeight(weights, 0))
+		for i := 1; i < len(sets); i++ {
+			another, ok := sets[i].Get(element.Member)
+			if !ok {
+				return true
+			}
+			score = aggregateScore(aggregate, score, weightScore(another.Score, getWeight(weights, i)))
+		}
+		result.Add(element.Member, score)
+		return true
+	})
+	return result
+}
+
+/*
+ * Diff 计算第一个有序集合与其余有序集合的差集，保留第一个集合中的分数
+ * sets 中的 nil 视为空集合
+ */
+func Diff(sets []*SortedSet) *SortedSet {
+	result := Make()
+	if len(sets) == 0 || sets[0] == nil {
+		return result
+	}
+	first := sets[0]
+	first.ForEach(0, first.Len(), false, func(element *Element) bool {
+		for _, another := range sets[1:] {
+			if another == nil {
+				continue
+			}
+			if _, ok := another.Get(element.Member); ok {
+				return true
+			}
+		}
+		result.Add(element.Member, element.Score)
+		return true
+	})
+	return result
+}
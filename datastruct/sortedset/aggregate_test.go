@@ -0,0 +1,118 @@
+package sortedset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func makeFromElements(elements ...Element) *SortedSet {
+	zSet := Make()
+	for _, e := range elements {
+		zSet.Add(e.Member, e.Score)
+	}
+	return zSet
+}
+
+func Test_aggregate(t *testing.T) {
+	overlapA := makeFromElements(Element{"a", 1}, Element{"b", 2}, Element{"c", 3})
+	overlapB := makeFromElements(Element{"b", 10}, Element{"c", 1}, Element{"d", 4})
+	disjoint := makeFromElements(Element{"x", 5}, Element{"y", 6})
+	empty := Make()
+
+	testCases := []struct {
+		name      string
+		op        string
+		sets      []*SortedSet
+		weights   []float64
+		aggregate string
+		// expect
+		exMembers []string
+	}{
+		{
+			name:      "union overlapping sum",
+			op:        "union",
+			sets:      []*SortedSet{overlapA, overlapB},
+			aggregate: AggregateSum,
+			exMembers: []string{"a:1", "c:4", "d:4", "b:12"},
+		}, {
+			name:      "union overlapping max with weights",
+			op:        "union",
+			sets:      []*SortedSet{overlapA, overlapB},
+			weights:   []float64{2, 1},
+			aggregate: AggregateMax,
+			exMembers: []string{"a:2", "d:4", "c:6", "b:10"},
+		}, {
+			name:      "union disjoint",
+			op:        "union",
+			sets:      []*SortedSet{overlapA, disjoint},
+			aggregate: AggregateSum,
+			exMembers: []string{"a:1", "b:2", "c:3", "x:5", "y:6"},
+		}, {
+			name:      "union empty and missing",
+			op:        "union",
+			sets:      []*SortedSet{empty, nil},
+			aggregate: AggregateSum,
+			exMembers: []string{},
+		}, {
+			name:      "inter overlapping min",
+			op:        "inter",
+			sets:      []*SortedSet{overlapA, overlapB},
+			aggregate: AggregateMin,
+			exMembers: []string{"c:1", "b:2"},
+		}, {
+			name:      "inter overlapping sum with weights",
+			op:        "inter",
+			sets:      []*SortedSet{overlapA, overlapB},
+			weights:   []float64{1, 0.5},
+			aggregate: AggregateSum,
+			exMembers: []string{"c:3.5", "b:7"},
+		}, {
+			name:      "inter disjoint",
+			op:        "inter",
+			sets:      []*SortedSet{overlapA, disjoint},
+			aggregate: AggregateSum,
+			exMembers: []string{},
+		}, {
+			name:      "inter with empty",
+			op:        "inter",
+			sets:      []*SortedSet{overlapA, empty},
+			aggregate: AggregateSum,
+			exMembers: []string{},
+		}, {
+			name:      "diff overlapping",
+			op:        "diff",
+			sets:      []*SortedSet{overlapA, overlapB},
+			exMembers: []string{"a:1"},
+		}, {
+			name:      "diff disjoint",
+			op:        "diff",
+			sets:      []*SortedSet{overlapA, disjoint, nil},
+			exMembers: []string{"a:1", "b:2", "c:3"},
+		}, {
+			name:      "diff empty first",
+			op:        "diff",
+			sets:      []*SortedSet{empty, overlapA},
+			exMembers: []string{},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var result *SortedSet
+			switch tt.op {
+			case "union":
+				result = Union(tt.sets, tt.weights, tt.aggregate)
+			case "inter":
+				result = Intersect(tt.sets, tt.weights, tt.aggregate)
+			case "diff":
+				result = Diff(tt.sets)
+			}
+			members := toMembers(result.Range(0, result.Len(), false))
+			if len(members) == 0 {
+				members = []string{}
+			}
+			if !reflect.DeepEqual(members, tt.exMembers) {
+				t.Errorf("%s err: reall: %v, want: %v", tt.name, members, tt.exMembers)
+			}
+		})
+	}
+}
@@ -1,19 +1,30 @@
 package sortedset
 
-import "strconv"
+import (
+	"errors"
+	"strconv"
+)
 
 const (
 	negativeInf int8 = -1
 	positiveInf int8 = 1
 )
 
+// Border 有序集合区间的边界，分为分数边界和字典序边界
+type Border interface {
+	greater(element *Element) bool // 边界不小于element
+	less(element *Element) bool    // 边界不大于element
+	isEmptyRange(max Border) bool  // 以当前边界为下界, max为上界的区间是否为空
+}
+
 type ScoreBorder struct {
 	Inf     int8
 	Value   float64
 	Exclude bool
 }
 
-func (border *ScoreBorder) greater(value float64) bool {
+func (border *ScoreBorder) greater(element *Element) bool {
+	value := element.Score
 	if border.Inf == negativeInf {
 		return false
 	} else if border.Inf == positiveInf {
@@ -26,7 +37,8 @@ func (border *ScoreBorder) greater(value float64) bool {
 	}
 }
 
-func (border *ScoreBorder) less(value float64) bool {
+func (border *ScoreBorder) less(element *Element) bool {
+	value := element.Score
 	if border.Inf == negativeInf {
 		return true
 	} else if border.Inf == positiveInf {
@@ -39,6 +51,21 @@ func (border *ScoreBorder) less(value float64) bool {
 	}
 }
 
+func (border *ScoreBorder) isEmptyRange(max Border) bool {
+	maxBorder, ok := max.(*ScoreBorder)
+	if !ok {
+		return true
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return true
+	}
+	if border.Inf != 0 || maxBorder.Inf != 0 {
+		return false
+	}
+	return border.Value > maxBorder.Value ||
+		(border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))
+}
+
 var positiveInfBorder = &ScoreBorder{
 	Inf: positiveInf,
 }
@@ -53,7 +80,7 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 	} else if s == "-inf" {
 		return negativeInfBorder, nil
 	}
-	if s[0] == '(' {
+	if len(s) > 0 && s[0] == '(' {
 		value, err := strconv.ParseFloat(s[1:], 64)
 		if err != nil {
 			return nil, err
@@ -74,3 +101,88 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		Exclude: false,
 	}, nil
 }
+
+// LexBorder 字典序边界，用于分数相同的成员
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (border *LexBorder) greater(element *Element) bool {
+	value := element.Member
+	if border.Inf == negativeInf {
+		return false
+	} else if border.Inf == positiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value > value
+	} else {
+		return border.Value >= value
+	}
+}
+
+func (border *LexBorder) less(element *Element) bool {
+	value := element.Member
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < value
+	} else {
+		return border.Value <= value
+	}
+}
+
+func (border *LexBorder) isEmptyRange(max Border) bool {
+	maxBorder, ok := max.(*LexBorder)
+	if !ok {
+		return true
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return true
+	}
+	if border.Inf != 0 || maxBorder.Inf != 0 {
+		return false
+	}
+	return border.Value > maxBorder.Value ||
+		(border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))
+}
+
+var positiveInfLexBorder = &LexBorder{
+	Inf: positiveInf,
+}
+
+var negativeInfLexBorder = &LexBorder{
+	Inf: negativeInf,
+}
+
+var errInvalidLexBorder = errors.New("ERR min or max not valid string range item")
+
+// ParseLexBorder 解析字典序边界: "+" 正无穷, "-" 负无穷, "[a" 包含a, "(a" 不包含a
+func ParseLexBorder(s string) (*LexBorder, error) {
+	if s == "+" {
+		return positiveInfLexBorder, nil
+	} else if s == "-" {
+		return negativeInfLexBorder, nil
+	}
+	if len(s) == 0 {
+		return nil, errInvalidLexBorder
+	}
+	switch s[0] {
+	case '(':
+		return &LexBorder{
+			Value:   s[1:],
+			Exclude: true,
+		}, nil
+	case '[':
+		return &LexBorder{
+			Value:   s[1:],
+			Exclude: false,
+		}, nil
+	}
+	return nil, errInvalidLexBorder
+}
@@ -0,0 +1,87 @@
+package sortedset
+
+import "sort"
+
+// listpack 按 (score, member) 有序存储的紧凑编码，元素较少时使用
+type listpack struct {
+	elements []*Element
+}
+
+func makeListpack() *listpack {
+	return &listpack{
+		elements: make([]*Element, 0),
+	}
+}
+
+func (lp *listpack) len() int64 {
+	return int64(len(lp.elements))
+}
+
+// indexOf 按成员查找下标，不存在时返回 -1
+func (lp *listpack) indexOf(member string) int {
+	for i, e := range lp.elements {
+		if e.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// search 返回第一个不排在 (score, member) 之前的下标
+func (lp *listpack) search(member string, score float64) int {
+	return sort.Search(len(lp.elements), func(i int) bool {
+		return !less(lp.elements[i], score, member)
+	})
+}
+
+func (lp *listpack) insert(member string, score float64) *Element {
+	element := &Element{
+		Member: member,
+		Score:  score,
+	}
+	i := lp.search(member, score)
+	lp.elements = append(lp.elements, nil)
+	copy(lp.elements[i+1:], lp.elements[i:])
+	lp.elements[i] = element
+	return element
+}
+
+func (lp *listpack) removeAt(i int) {
+	lp.elements = append(lp.elements[:i], lp.elements[i+1:]...)
+}
+
+// 删除下标在 [start, stop) 中的元素
+func (lp *listpack) removeRange(start int, stop int) []*Element {
+	removed := make([]*Element, stop-start)
+	copy(removed, lp.elements[start:stop])
+	lp.elements = append(lp.elements[:start], lp.elements[stop:]...)
+	return removed
+}
+
+// 第一个在区间内的下标，不存在时返回 -1
+func (lp *listpack) firstInRange(min Border, max Border) int {
+	if min.isEmptyRange(max) {
+		return -1
+	}
+	i := sort.Search(len(lp.elements), func(i int) bool {
+		return min.less(lp.elements[i])
+	})
+	if i == len(lp.elements) || !max.greater(lp.elements[i]) {
+		return -1
+	}
+	return i
+}
+
+// 最后一个在区间内的下标，不存在时返回 -1
+func (lp *listpack) lastInRange(min Border, max Border) int {
+	if min.isEmptyRange(max) {
+		return -1
+	}
+	i := sort.Search(len(lp.elements), func(i int) bool {
+		return !max.greater(lp.elements[i])
+	}) - 1
+	if i < 0 || !min.less(lp.elements[i]) {
+		return -1
+	}
+	return i
+}
@@ -111,11 +111,15 @@ func (skipList *skipList) insert(member string, score float64) *Node {
 		node.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
 		update[i].level[i].span = rank[0] - rank[i] + 1
 	}
+	// 高于新节点的层，先驱节点的 span 需要加一
+	for i := level; i < skipList.level; i++ {
+		update[i].level[i].span++
+	}
 
 	// 考虑特殊情况：表头、表尾
-	// 考虑当前节点的backward,只需考虑前
-	if update[0] == nil {
-		node.backward = skipList.header
+	// 考虑当前节点的backward,只需考虑前, 第一个节点的backward为nil
+	if update[0] == skipList.header {
+		node.backward = nil
 	} else {
 		node.backward = update[0]
 	}
@@ -130,6 +134,12 @@ func (skipList *skipList) insert(member string, score float64) *Node {
 	return node
 }
 
+// less 按 (score, member) 比较节点是否排在目标之前
+func less(element *Element, score float64, member string) bool {
+	return element.Score < score || (element.Score == score && element.Member < member)
+}
+
+// 返回 0-based 排名，不存在时返回 -1
 func (skipList *skipList) getRank(member string, score float64) int64 {
 	var rank int64 = 0
 	// 寻找先驱节点
@@ -137,193 +147,179 @@ func (skipList *skipList) getRank(member string, score float64) int64 {
 	var n = skipList.header
 	// 从上往下遍历
 	for i := skipList.level - 1; i >= 0; i-- { // 自顶向下遍历
-		// 同一level下不断寻找节点
-		if n.level[i] != nil {
-			// 找到元素位置
-			if n.Element.Score == score && n.Element.Member == member {
-				break
-			}
-			// 同一层次遍历
-			for n.level[i].forward != nil && (n.level[i].forward.Element.Score < score ||
-				(n.level[i].forward.Element.Score == score && n.level[i].forward.Element.Member < member)) { // same score, different member
-				rank += n.level[i].span
-				n = n.level[i].forward
-			}
+		// 同一层次遍历
+		for n.level[i].forward != nil && less(&n.level[i].forward.Element, score, member) {
+			rank += n.level[i].span
+			n = n.level[i].forward
 		}
 	}
+	// rank 为先驱节点的 1-based 排名，即目标节点的 0-based 排名
+	target := n.level[0].forward
+	if target == nil || target.Element.Member != member || target.Element.Score != score {
+		return -1
+	}
 	return rank
 }
 
-// 寻找排名为 rank 的节点
+// 寻找排名为 rank 的节点, 0-based
 func (skipList *skipList) getByRank(rank int64) *Node {
-	var r int64 = -1
-	// 寻找先驱节点
-	// 当前遍历节点
+	if rank < 0 || rank >= skipList.length {
+		return nil
+	}
+	// header 的排名为 0，第一个节点的排名为 1
+	var traversed int64 = 0
+	target := rank + 1
 	var n = skipList.header
 	// 从上往下遍历
 	for i := skipList.level - 1; i >= 0; i-- { // 自顶向下遍历
-
-		if n.level[i] != nil {
-			// 同一层次遍历
-			for n.level[i].forward != nil && (r+n.level[i].span <= rank) { //同一层中存在后续节点
-				// 同一level下不断寻找节点
-				if r == rank {
-					return n
-				}
-				r += n.level[i].span
-				n = n.level[i].forward
-			}
+		// 同一层次遍历
+		for n.level[i].forward != nil && traversed+n.level[i].span <= target {
+			traversed += n.level[i].span
+			n = n.level[i].forward
+		}
+		if traversed == target {
+			return n
 		}
 	}
-	return n
+	return nil
 }
-func (skipList *skipList) hasInRange(min *ScoreBorder, max *ScoreBorder) bool {
-	if min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+
+func (skipList *skipList) hasInRange(min Border, max Border) bool {
+	if skipList.length == 0 {
 		return false
 	}
-	if min.Value > skipList.tail.Element.Score {
+	// min 大于 max 时为空区间
+	if min.isEmptyRange(max) {
 		return false
 	}
-	if max.Value < skipList.header.level[0].forward.Element.Score {
+	// 最大值小于 min
+	if !min.less(&skipList.tail.Element) {
+		return false
+	}
+	// 最小值大于 max
+	if !max.greater(&skipList.header.level[0].forward.Element) {
 		return false
 	}
 	return true
 }
 
 // finish test
-func (skipList *skipList) getFirstInScoreRange(min *ScoreBorder, max *ScoreBorder) *Node {
+func (skipList *skipList) getFirstInRange(min Border, max Border) *Node {
 	if !skipList.hasInRange(min, max) {
 		return nil
 	}
 	// 当前遍历节点
 	var n = skipList.header
-	// 从上往下遍历
+	// 从上往下遍历，找到最后一个小于 min 的节点
 	for i := skipList.level - 1; i >= 0; i-- { // 自顶向下遍历
-		// 同一level下不断寻找节点
-		if n.level[i] != nil {
-			// 同一层次遍历
-			for n.level[i].forward != nil && max.greater(n.level[i].forward.Element.Score) {
-				n = n.level[i].forward
-				// 找到元素位置
-				if min.less(n.Element.Score) { // 大于最小值
-					return n
-				}
-			}
+		for n.level[i].forward != nil && !min.less(&n.level[i].forward.Element) {
+			n = n.level[i].forward
 		}
 	}
+	n = n.level[0].forward
+	if n == nil || !max.greater(&n.Element) {
+		return nil
+	}
 	return n
 }
 
-func (skipList *skipList) getLastInScoreRange(min *ScoreBorder, max *ScoreBorder) *Node {
+func (skipList *skipList) getLastInRange(min Border, max Border) *Node {
 	if !skipList.hasInRange(min, max) {
 		return nil
 	}
 	// 当前遍历节点
 	var n = skipList.header
-	// 从上往下遍历
+	// 从上往下遍历，找到最后一个不大于 max 的节点
 	for i := skipList.level - 1; i >= 0; i-- { // 自顶向下遍历
-		// 同一level下不断寻找节点
-		if n.level[i] != nil {
-			// 同一层次遍历
-			for n.level[i].forward != nil && max.greater(n.level[i].forward.Element.Score) {
-				n = n.level[i].forward
-			}
+		for n.level[i].forward != nil && max.greater(&n.level[i].forward.Element) {
+			n = n.level[i].forward
 		}
 	}
+	if n == skipList.header || !min.less(&n.Element) {
+		return nil
+	}
 	return n
 }
 
 // finish test
-func (skipList *skipList) removeRangeByScore(min *ScoreBorder, max *ScoreBorder) (removed []*Element) {
+func (skipList *skipList) removeRange(min Border, max Border) (removed []*Element) {
 	if !skipList.hasInRange(min, max) {
 		return nil
 	}
-	reNodes := []*Element{}
-
+	update := make([]*Node, maxLevel)
+	removed = make([]*Element, 0)
 	var n = skipList.header
 	for i := skipList.level - 1; i >= 0; i-- {
-		if n.level[i] != nil {
-			for n.level[i].forward != nil && min.Value > n.level[i].forward.Element.Score {
-				n = n.level[i].forward
-			}
+		for n.level[i].forward != nil && !min.less(&n.level[i].forward.Element) {
+			n = n.level[i].forward
 		}
+		update[i] = n
 	}
-
-	for n != nil {
-		if n.level[0] != nil {
-			if !max.greater(n.Element.Score) {
-				break
-			}
-			member := n.Element.Member
-			score := n.Element.Score
-			n = n.level[0].forward
-			if min.less(score) && max.greater(score) {
-				reNodes = append(reNodes, &Element{Member: member, Score: score})
-				skipList.remove(member, score)
-			}
-		}
+	n = n.level[0].forward
+	for n != nil && max.greater(&n.Element) {
+		next := n.level[0].forward
+		removedElement := n.Element
+		removed = append(removed, &removedElement)
+		skipList.removeNode(n, update)
+		n = next
 	}
-	return reNodes
+	return removed
 }
+
+// 删除排名在 [start, stop] 中的节点, 0-based
 func (skipList *skipList) removeRangeByRank(start int64, stop int64) (removed []*Element) {
-	reNodes := []*Element{}
-	if start > skipList.length-1 {
-		return nil
-	}
 	if start < 0 {
 		start = 0
 	}
 	if stop > skipList.length-1 {
 		stop = skipList.length - 1
 	}
+	if start > stop {
+		return nil
+	}
+	update := make([]*Node, maxLevel)
+	removed = make([]*Element, 0, stop-start+1)
 	var n = skipList.header
-	var rank int64 = -1
+	var traversed int64 = 0
 	for i := skipList.level - 1; i >= 0; i-- {
-		if n.level[i] != nil {
-			for n.level[i].forward != nil && rank+n.level[i].span < start {
-				rank += n.level[i].span
-				n = n.level[i].forward
-			}
+		// 找到 1-based 排名为 start 的节点，即第一个删除点的先驱
+		for n.level[i].forward != nil && traversed+n.level[i].span <= start {
+			traversed += n.level[i].span
+			n = n.level[i].forward
 		}
+		update[i] = n
 	}
 	// n定位到第一个删除点
-	if n.level[0].forward != nil {
-		n = n.level[0].forward
-	}
-
-	i := int64(0)
-	l := stop - start + 1
-	for i < l {
-		member := n.Element.Member
-		score := n.Element.Score
-		reNodes = append(reNodes, &Element{Member: member, Score: score})
-		skipList.remove(member, score)
-		i++
-		if n.level[0].forward != nil {
-			n = n.level[0].forward
-		}
-	}
-	return reNodes
+	n = n.level[0].forward
+	for i := start; i <= stop && n != nil; i++ {
+		next := n.level[0].forward
+		removedElement := n.Element
+		removed = append(removed, &removedElement)
+		skipList.removeNode(n, update)
+		n = next
+	}
+	return removed
 }
 
 // finish test
 func (skipList *skipList) removeNode(node *Node, update []*Node) {
-	var level = len(update)
 	// 更新span
-	for i := level - 1; i >= 0; i-- {
-		if update[i] != nil {
-			if update[i].level[i].forward == node {
-				update[i].level[i].span += node.level[i].span - 1
-				update[i].level[i].forward = node.level[i].forward
-			} else {
-				update[i].level[i].span--
-			}
+	for i := int16(0); i < skipList.level; i++ {
+		if update[i].level[i].forward == node {
+			update[i].level[i].span += node.level[i].span - 1
+			update[i].level[i].forward = node.level[i].forward
+		} else {
+			update[i].level[i].span--
 		}
 	}
 	if node.level[0].forward != nil {
-		node.level[0].forward.backward = update[0]
+		node.level[0].forward.backward = node.backward
 	} else {
-		skipList.tail = update[0]
+		skipList.tail = node.backward
+	}
+	// 删除最高层后更新跳表层数
+	for skipList.level > 1 && skipList.header.level[skipList.level-1].forward == nil {
+		skipList.level--
 	}
 	skipList.length--
 }
@@ -336,20 +332,16 @@ func (skipList *skipList) remove(member string, score float64) bool {
 	var n = skipList.header
 	// 从上往下遍历
 	for i := skipList.level - 1; i >= 0; i-- { // 自顶向下遍历
-
 		// 同一level下不断寻找节点
-		if n.level[i] != nil {
-			// 遍历搜索
-			for n.level[i].forward != nil && (n.level[i].forward.Element.Score < score ||
-				(n.level[i].forward.Element.Score == score && n.level[i].forward.Element.Member < member)) { // same score, different member
-				n = n.level[i].forward
-			}
+		for n.level[i].forward != nil && less(&n.level[i].forward.Element, score, member) { // same score, different member
+			n = n.level[i].forward
 		}
 		update[i] = n
 	}
-	if n.level[0].forward == nil || n.level[0].forward.Element.Member != member || n.level[0].forward.Element.Score != score {
+	n = n.level[0].forward
+	if n == nil || n.Element.Member != member || n.Element.Score != score {
 		return false
 	}
-	skipList.removeNode(n.level[0].forward, update)
+	skipList.removeNode(n, update)
 	return true
 }
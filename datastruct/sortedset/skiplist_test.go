@@ -123,7 +123,7 @@ func Test_skipList_getFirstInScoreRange(t *testing.T) {
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			node := skiplist.getFirstInScoreRange(&tt.min, &tt.max)
+			node := skiplist.getFirstInRange(&tt.min, &tt.max)
 			if !reflect.DeepEqual(node.Element.Member, tt.exMember) ||
 				!reflect.DeepEqual(node.Element.Score, tt.exScore) {
 				t.Errorf("%s err: reall: %v, want: %v, %v", tt.name, node, tt.member, tt.score)
@@ -191,7 +191,7 @@ func Test_skipList_getLastInScoreRange(t *testing.T) {
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			node := skiplist.getLastInScoreRange(tt.min, tt.max)
+			node := skiplist.getLastInRange(tt.min, tt.max)
 			if !reflect.DeepEqual(node.Element.Member, tt.exMember) ||
 				!reflect.DeepEqual(node.Element.Score, tt.exScore) {
 				t.Errorf("%s err: reall: %v, want: %s, %f", tt.name, node, tt.member, tt.score)
@@ -335,7 +335,7 @@ func Test_skipList_removeRangeByScore(t *testing.T) {
 			for _, i := range inputCases {
 				skiplist.insert(i.member, i.score)
 			}
-			removed := skiplist.removeRangeByScore(tt.min, tt.max)
+			removed := skiplist.removeRange(tt.min, tt.max)
 			rank := skiplist.getByRank(tt.rank)
 			if !reflect.DeepEqual(rank.Element.Member, tt.exMember) {
 				t.Errorf("1 err: %s, %s", rank.Element.Member, tt.exMember)
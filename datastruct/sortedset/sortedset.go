@@ -1,53 +1,109 @@
 package sortedset
 
-import "strconv"
+import (
+	"github.com/jiangh156/godis/config"
+)
 
+const (
+	EncodingListpack = "listpack"
+	EncodingSkiplist = "skiplist"
+)
+
+// SortedSet 元素较少时使用listpack编码，超过阈值后转换为 dict + skiplist
 type SortedSet struct {
+	listpack *listpack // 为nil时表示使用 dict + skiplist 编码
 	dict     map[string]*Element
 	skiplist *skipList
 }
 
 func Make() *SortedSet {
 	return &SortedSet{
-		dict:     make(map[string]*Element),
-		skiplist: makeSkipList(),
+		listpack: makeListpack(),
+	}
+}
+
+// Encoding 返回当前的底层编码
+func (sortedSet *SortedSet) Encoding() string {
+	if sortedSet.listpack != nil {
+		return EncodingListpack
 	}
+	return EncodingSkiplist
+}
+
+// convertToSkiplist listpack 转换为 dict + skiplist，转换后不再转回
+func (sortedSet *SortedSet) convertToSkiplist() {
+	sortedSet.dict = make(map[string]*Element, len(sortedSet.listpack.elements))
+	sortedSet.skiplist = makeSkipList()
+	for _, element := range sortedSet.listpack.elements {
+		sortedSet.dict[element.Member] = element
+		sortedSet.skiplist.insert(element.Member, element.Score)
+	}
+	sortedSet.listpack = nil
 }
 
 /*
- * return: has inserted new node
+ * return: added 是否新增了成员, changed 已有成员的分数是否被修改
  */
-func (sortedSet *SortedSet) Add(member string, score float64) bool {
+func (sortedSet *SortedSet) Add(member string, score float64) (added bool, changed bool) {
+	if sortedSet.listpack != nil {
+		i := sortedSet.listpack.indexOf(member)
+		if i >= 0 {
+			if sortedSet.listpack.elements[i].Score == score {
+				return false, false
+			}
+			sortedSet.listpack.removeAt(i)
+		}
+		sortedSet.listpack.insert(member, score)
+		if sortedSet.listpack.len() > int64(config.Properties.ZSetMaxListpackEntries) ||
+			len(member) > config.Properties.ZSetMaxListpackValue {
+			sortedSet.convertToSkiplist()
+		}
+		return i < 0, i >= 0
+	}
 	// update dict
 	element, ok := sortedSet.dict[member]
+	if ok && element.Score == score {
+		return false, false
+	}
 	sortedSet.dict[member] = &Element{
 		Member: member,
 		Score:  score,
 	}
 	if ok {
-		if element.Score != score {
-			sortedSet.skiplist.remove(member, element.Score)
-			sortedSet.skiplist.insert(member, score)
-		} else {
-			return false
-		}
-	} else {
 		sortedSet.skiplist.remove(member, element.Score)
-		sortedSet.skiplist.insert(member, score)
 	}
-	return true
+	sortedSet.skiplist.insert(member, score)
+	return !ok, ok
 }
 
 func (sortedSet *SortedSet) Len() int64 {
+	if sortedSet.listpack != nil {
+		return sortedSet.listpack.len()
+	}
 	return int64(len(sortedSet.dict))
 }
 
 func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
+	if sortedSet.listpack != nil {
+		i := sortedSet.listpack.indexOf(member)
+		if i < 0 {
+			return nil, false
+		}
+		return sortedSet.listpack.elements[i], true
+	}
 	element, ok = sortedSet.dict[member]
 	return
 }
 
 func (sortedSet *SortedSet) Remove(member string) bool {
+	if sortedSet.listpack != nil {
+		i := sortedSet.listpack.indexOf(member)
+		if i < 0 {
+			return false
+		}
+		sortedSet.listpack.removeAt(i)
+		return true
+	}
 	element, ok := sortedSet.dict[member]
 	if !ok {
 		return false
@@ -61,49 +117,59 @@ func (sortedSet *SortedSet) Remove(member string) bool {
 }
 
 /**
- * get 0-based rank
+ * get 0-based rank, -1 if member not exists
  */
 func (sortedSet *SortedSet) GetRank(member string, desc bool) (rank int64) {
-	element, ok := sortedSet.dict[member]
+	element, ok := sortedSet.Get(member)
 	if !ok {
 		return -1
 	}
-	r := sortedSet.skiplist.getRank(member, element.Score)
-	if desc {
-		r = sortedSet.skiplist.length - r
+	if sortedSet.listpack != nil {
+		rank = int64(sortedSet.listpack.search(member, element.Score))
 	} else {
-		r--
+		rank = sortedSet.skiplist.getRank(member, element.Score)
+	}
+	if desc {
+		rank = sortedSet.Len() - 1 - rank
 	}
-	return r
+	return rank
 }
 
 /**
  * traverse [start, stop), 0-based rank
+ * desc: rank counts from the element with the highest score
  */
-// TODO start和stop边界问题，都是从0开始
 func (sortedSet *SortedSet) ForEach(start int64, stop int64, desc bool, consumer func(element *Element) bool) {
 	size := sortedSet.Len()
-	if start < 0 || start >= size {
-		panic("illegal start " + strconv.FormatInt(start, 10))
+	if start < 0 {
+		start = 0
 	}
-	if stop < start || stop > size {
-		panic("illegal end " + strconv.FormatInt(stop, 10))
+	if stop > size {
+		stop = size
+	}
+	if start >= stop {
+		return
+	}
+	if sortedSet.listpack != nil {
+		elements := sortedSet.listpack.elements
+		for i := start; i < stop; i++ {
+			index := i
+			if desc {
+				index = size - 1 - i
+			}
+			if !consumer(elements[index]) {
+				break
+			}
+		}
+		return
 	}
 	var node *Node
 	if desc {
-		node = sortedSet.skiplist.tail
-		if start > 0 {
-			node = sortedSet.skiplist.getByRank(int64(size - start - 1)) //TODO
-		}
+		node = sortedSet.skiplist.getByRank(size - 1 - start)
 	} else {
-		node = sortedSet.skiplist.header.level[0].forward
-		if start > 0 {
-			node = sortedSet.skiplist.getByRank(int64(start - 1)) // TODO
-		}
+		node = sortedSet.skiplist.getByRank(start)
 	}
-
-	sliceSize := stop - start - 1
-	for i := int64(0); i < sliceSize; i++ {
+	for i := start; i < stop && node != nil; i++ {
 		if !consumer(&node.Element) {
 			break
 		}
@@ -127,93 +193,160 @@ func (sortedSet *SortedSet) Range(start int64, stop int64, desc bool) []*Element
 	if stop < start || stop > size {
 		return nil
 	}
-	sliceSize := int(stop - start)
-	slice := make([]*Element, sliceSize)
-	i := 0
+	slice := make([]*Element, 0, stop-start)
 	sortedSet.ForEach(start, stop, desc, func(element *Element) bool {
-		slice[i] = element
-		i++
+		slice = append(slice, element)
 		return true
 	})
 	return slice
 }
 
-func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
-	var i = int64(0)
-	sortedSet.ForEach(0, sortedSet.Len(), false, func(element *Element) bool {
-		if !min.less(element.Score) {
-			return true
-		}
-		if !max.greater(element.Score) {
-			return false
+// rangeRanks 返回区间内第一个和最后一个元素的 0-based 排名，区间为空时返回 -1, -1
+func (sortedSet *SortedSet) rangeRanks(min Border, max Border) (first int64, last int64) {
+	if sortedSet.listpack != nil {
+		first = int64(sortedSet.listpack.firstInRange(min, max))
+		if first < 0 {
+			return -1, -1
 		}
-		i++
-		return true
-	})
-	return i
+		return first, int64(sortedSet.listpack.lastInRange(min, max))
+	}
+	firstNode := sortedSet.skiplist.getFirstInRange(min, max)
+	if firstNode == nil {
+		return -1, -1
+	}
+	lastNode := sortedSet.skiplist.getLastInRange(min, max)
+	first = sortedSet.skiplist.getRank(firstNode.Element.Member, firstNode.Element.Score)
+	last = sortedSet.skiplist.getRank(lastNode.Element.Member, lastNode.Element.Score)
+	return first, last
 }
 
-func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
-	var node *Node
-	if desc {
-		node = sortedSet.skiplist.getLastInScoreRange(min, max)
-	} else {
-		node = sortedSet.skiplist.getFirstInScoreRange(min, max)
+func (sortedSet *SortedSet) countInRange(min Border, max Border) int64 {
+	first, last := sortedSet.rangeRanks(min, max)
+	if first < 0 {
+		return 0
 	}
-	for node != nil && offset != 0 {
-		if desc {
-			node = node.backward
-		} else {
-			node = node.level[0].forward
-		}
-		offset--
+	return last - first + 1
+}
+
+// forEachInRange 与 Redis 相同，offset 为负数时没有结果
+func (sortedSet *SortedSet) forEachInRange(min Border, max Border, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	if limit == 0 || offset < 0 {
+		return
 	}
+	first, last := sortedSet.rangeRanks(min, max)
+	if first < 0 {
+		return
+	}
+	start, stop := first, last+1
+	if desc {
+		size := sortedSet.Len()
+		start, stop = size-1-last, size-first
+	}
+	start += offset
 	// A negative limit returns all elements from the offset
-	for i := 0; (i < int(limit) || limit < 0) && node != nil; i++ {
-		if !consumer(&node.Element) {
-			break
-		}
-		if desc {
-			node = node.backward
-		} else {
-			node = node.level[0].forward
-		}
-		if !min.less(node.Element.Score) || !max.greater(node.Element.Score) {
-			break
-		}
+	if limit >= 0 && start+limit < stop {
+		stop = start + limit
 	}
+	sortedSet.ForEach(start, stop, desc, consumer)
 }
 
-/*
- * param limit: <0 means no limit
- */
-func (sortedSet *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool) []*Element {
-	if limit == 0 || offset < 0 {
-		return make([]*Element, 0)
-	}
+func (sortedSet *SortedSet) rangeInRange(min Border, max Border, offset int64, limit int64, desc bool) []*Element {
 	elements := make([]*Element, 0)
-	sortedSet.ForEachByScore(min, max, offset, limit, desc, func(element *Element) bool {
+	sortedSet.forEachInRange(min, max, offset, limit, desc, func(element *Element) bool {
 		elements = append(elements, element)
 		return true
 	})
 	return elements
 }
 
-func (sortedSet *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
-	removed := sortedSet.skiplist.removeRangeByScore(min, max)
-	for _, element := range removed {
-		delete(sortedSet.dict, element.Member)
+func (sortedSet *SortedSet) removeInRange(min Border, max Border) int64 {
+	first, last := sortedSet.rangeRanks(min, max)
+	if first < 0 {
+		return 0
 	}
-	return int64(len(removed))
+	return sortedSet.RemoveByRank(first, last+1)
+}
+
+func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
+	return sortedSet.countInRange(min, max)
+}
+
+func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	sortedSet.forEachInRange(min, max, offset, limit, desc, consumer)
+}
+
+/*
+ * param limit: <0 means no limit
+ */
+func (sortedSet *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool) []*Element {
+	return sortedSet.rangeInRange(min, max, offset, limit, desc)
+}
+
+func (sortedSet *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
+	return sortedSet.removeInRange(min, max)
+}
+
+// 字典序区间仅在所有成员分数相同时有意义
+
+func (sortedSet *SortedSet) LexCount(min *LexBorder, max *LexBorder) int64 {
+	return sortedSet.countInRange(min, max)
+}
+
+func (sortedSet *SortedSet) ForEachByLex(min *LexBorder, max *LexBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	sortedSet.forEachInRange(min, max, offset, limit, desc, consumer)
+}
+
+/*
+ * param limit: <0 means no limit
+ */
+func (sortedSet *SortedSet) RangeByLex(min *LexBorder, max *LexBorder, offset int64, limit int64, desc bool) []*Element {
+	return sortedSet.rangeInRange(min, max, offset, limit, desc)
+}
+
+func (sortedSet *SortedSet) RemoveByLex(min *LexBorder, max *LexBorder) int64 {
+	return sortedSet.removeInRange(min, max)
 }
 
 /*
  * 0-based rank, [start, stop)
  */
 func (sortedSet *SortedSet) RemoveByRank(start int64, stop int64) int64 {
-	removed := sortedSet.skiplist.removeRangeByRank(start, stop)
+	return int64(len(sortedSet.removeByRank(start, stop)))
+}
+
+// removeByRank 删除 [start, stop) 中的元素并按分数从小到大返回
+func (sortedSet *SortedSet) removeByRank(start int64, stop int64) []*Element {
+	size := sortedSet.Len()
+	if start < 0 {
+		start = 0
+	}
+	if stop > size {
+		stop = size
+	}
+	if start >= stop {
+		return nil
+	}
+	if sortedSet.listpack != nil {
+		return sortedSet.listpack.removeRange(int(start), int(stop))
+	}
+	removed := sortedSet.skiplist.removeRangeByRank(start, stop-1)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
 	}
-	return int64(len(removed))
+	return removed
+}
+
+// PopMin 删除并返回分数最小的 count 个元素，按分数从小到大排列
+func (sortedSet *SortedSet) PopMin(count int64) []*Element {
+	return sortedSet.removeByRank(0, count)
+}
+
+// PopMax 删除并返回分数最大的 count 个元素，按分数从大到小排列
+func (sortedSet *SortedSet) PopMax(count int64) []*Element {
+	size := sortedSet.Len()
+	removed := sortedSet.removeByRank(size-count, size)
+	for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+		removed[i], removed[j] = removed[j], removed[i]
+	}
+	return removed
 }
@@ -0,0 +1,194 @@
+package sortedset
+
+import (
+	"github.com/jiangh156/godis/config"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// makeBothEncodings 构造内容相同的listpack编码和skiplist编码的有序集合
+func makeBothEncodings(size int) (*SortedSet, *SortedSet) {
+	lp := Make()
+	sl := Make()
+	sl.convertToSkiplist()
+	for i := 0; i < size; i++ {
+		member := "m" + strconv.Itoa(rand.Intn(size*2))
+		score := float64(rand.Intn(size))
+		lp.Add(member, score)
+		sl.Add(member, score)
+	}
+	return lp, sl
+}
+
+func toMembers(elements []*Element) []string {
+	members := make([]string, len(elements))
+	for i, e := range elements {
+		members[i] = e.Member + ":" + strconv.FormatFloat(e.Score, 'f', -1, 64)
+	}
+	return members
+}
+
+func Test_SortedSet_encodings(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		lp, sl := makeBothEncodings(50)
+		if lp.Encoding() != EncodingListpack || sl.Encoding() != EncodingSkiplist {
+			t.Fatalf("wrong encoding: %s, %s", lp.Encoding(), sl.Encoding())
+		}
+		if lp.Len() != sl.Len() {
+			t.Fatalf("Len() err: %d, %d", lp.Len(), sl.Len())
+		}
+		size := lp.Len()
+		for _, desc := range []bool{false, true} {
+			if !reflect.DeepEqual(toMembers(lp.Range(0, size, desc)), toMembers(sl.Range(0, size, desc))) {
+				t.Errorf("Range() err: desc=%v", desc)
+			}
+			start := rand.Int63n(size)
+			stop := start + rand.Int63n(size-start) + 1
+			if !reflect.DeepEqual(toMembers(lp.Range(start, stop, desc)), toMembers(sl.Range(start, stop, desc))) {
+				t.Errorf("Range(%d, %d) err: desc=%v", start, stop, desc)
+			}
+			min := &ScoreBorder{Value: float64(rand.Intn(25)), Exclude: rand.Intn(2) == 0}
+			max := &ScoreBorder{Value: float64(rand.Intn(25) + 25), Exclude: rand.Intn(2) == 0}
+			if !reflect.DeepEqual(toMembers(lp.RangeByScore(min, max, 1, 10, desc)), toMembers(sl.RangeByScore(min, max, 1, 10, desc))) {
+				t.Errorf("RangeByScore() err: desc=%v", desc)
+			}
+			if lp.Count(min, max) != sl.Count(min, max) {
+				t.Errorf("Count() err: %d, %d", lp.Count(min, max), sl.Count(min, max))
+			}
+		}
+		for _, e := range lp.Range(0, size, false) {
+			for _, desc := range []bool{false, true} {
+				if lp.GetRank(e.Member, desc) != sl.GetRank(e.Member, desc) {
+					t.Errorf("GetRank(%s) err: %d, %d", e.Member, lp.GetRank(e.Member, desc), sl.GetRank(e.Member, desc))
+				}
+			}
+		}
+		min := &ScoreBorder{Value: 10}
+		max := &ScoreBorder{Value: 20, Exclude: true}
+		if lp.RemoveByScore(min, max) != sl.RemoveByScore(min, max) {
+			t.Errorf("RemoveByScore() err")
+		}
+		if lp.RemoveByRank(3, 8) != sl.RemoveByRank(3, 8) {
+			t.Errorf("RemoveByRank() err")
+		}
+		if !reflect.DeepEqual(toMembers(lp.Range(0, lp.Len(), false)), toMembers(sl.Range(0, sl.Len(), false))) {
+			t.Errorf("Range() after remove err")
+		}
+	}
+}
+
+func Test_SortedSet_convert(t *testing.T) {
+	zSet := Make()
+	for i := 0; i < config.Properties.ZSetMaxListpackEntries; i++ {
+		zSet.Add(strconv.Itoa(i), float64(i))
+	}
+	if zSet.Encoding() != EncodingListpack {
+		t.Fatalf("encoding err: %s, want: %s", zSet.Encoding(), EncodingListpack)
+	}
+	zSet.Add("overflow", 0)
+	if zSet.Encoding() != EncodingSkiplist {
+		t.Fatalf("encoding err: %s, want: %s", zSet.Encoding(), EncodingSkiplist)
+	}
+	if zSet.GetRank("overflow", false) != 1 {
+		t.Errorf("GetRank() err: %d, want: 1", zSet.GetRank("overflow", false))
+	}
+}
+
+func Test_SortedSet_lexRange(t *testing.T) {
+	lp := Make()
+	sl := Make()
+	sl.convertToSkiplist()
+	for _, member := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		lp.Add(member, 0)
+		sl.Add(member, 0)
+	}
+	testCases := []struct {
+		min       string
+		max       string
+		offset    int64
+		limit     int64
+		desc      bool
+		exMembers []string
+	}{
+		{min: "-", max: "+", limit: -1, exMembers: []string{"a:0", "b:0", "c:0", "d:0", "e:0", "f:0", "g:0"}},
+		{min: "-", max: "[c", limit: -1, exMembers: []string{"a:0", "b:0", "c:0"}},
+		{min: "-", max: "(c", limit: -1, exMembers: []string{"a:0", "b:0"}},
+		{min: "[aaa", max: "(g", limit: -1, exMembers: []string{"b:0", "c:0", "d:0", "e:0", "f:0"}},
+		{min: "[b", max: "[f", offset: 1, limit: 2, exMembers: []string{"c:0", "d:0"}},
+		{min: "[b", max: "[f", offset: 1, limit: 2, desc: true, exMembers: []string{"e:0", "d:0"}},
+		{min: "[c", max: "[a", limit: -1, exMembers: []string{}},
+		{min: "(c", max: "(c", limit: -1, exMembers: []string{}},
+		{min: "+", max: "-", limit: -1, exMembers: []string{}},
+		{min: "-", max: "+", offset: -1, limit: 2, exMembers: []string{}},
+	}
+	for _, tt := range testCases {
+		min, err := ParseLexBorder(tt.min)
+		if err != nil {
+			t.Fatalf("ParseLexBorder(%s) err: %v", tt.min, err)
+		}
+		max, err := ParseLexBorder(tt.max)
+		if err != nil {
+			t.Fatalf("ParseLexBorder(%s) err: %v", tt.max, err)
+		}
+		for _, zSet := range []*SortedSet{lp, sl} {
+			members := toMembers(zSet.RangeByLex(min, max, tt.offset, tt.limit, tt.desc))
+			if !reflect.DeepEqual(members, tt.exMembers) {
+				t.Errorf("RangeByLex(%s, %s) err: encoding=%s, reall: %v, want: %v", tt.min, tt.max, zSet.Encoding(), members, tt.exMembers)
+			}
+			visited := 0
+			zSet.ForEachByLex(min, max, tt.offset, tt.limit, tt.desc, func(element *Element) bool {
+				visited++
+				return true
+			})
+			if visited != len(tt.exMembers) {
+				t.Errorf("ForEachByLex(%s, %s) err: encoding=%s, reall: %d, want: %d", tt.min, tt.max, zSet.Encoding(), visited, len(tt.exMembers))
+			}
+			if tt.limit < 0 && zSet.LexCount(min, max) != int64(len(tt.exMembers)) {
+				t.Errorf("LexCount(%s, %s) err: encoding=%s, reall: %d, want: %d", tt.min, tt.max, zSet.Encoding(), zSet.LexCount(min, max), len(tt.exMembers))
+			}
+		}
+	}
+	for _, s := range []string{"", "a", "{a"} {
+		if _, err := ParseLexBorder(s); err == nil {
+			t.Errorf("ParseLexBorder(%q) should fail", s)
+		}
+	}
+}
+
+func Test_SortedSet_pop(t *testing.T) {
+	lp, sl := makeBothEncodings(50)
+	for lp.Len() > 0 {
+		count := rand.Int63n(5) + 1
+		exMin := toMembers(lp.Range(0, min64(count, lp.Len()), false))
+		if popped := toMembers(lp.PopMin(count)); !reflect.DeepEqual(popped, exMin) {
+			t.Fatalf("PopMin(%d) err: reall: %v, want: %v", count, popped, exMin)
+		}
+		if popped := toMembers(sl.PopMin(count)); !reflect.DeepEqual(popped, exMin) {
+			t.Fatalf("PopMin(%d) err: reall: %v, want: %v", count, popped, exMin)
+		}
+		exMax := toMembers(lp.Range(0, min64(count, lp.Len()), true))
+		if popped := toMembers(lp.PopMax(count)); !reflect.DeepEqual(popped, exMax) {
+			t.Fatalf("PopMax(%d) err: reall: %v, want: %v", count, popped, exMax)
+		}
+		if popped := toMembers(sl.PopMax(count)); !reflect.DeepEqual(popped, exMax) {
+			t.Fatalf("PopMax(%d) err: reall: %v, want: %v", count, popped, exMax)
+		}
+		for _, e := range lp.Range(0, lp.Len(), false) {
+			if _, ok := sl.Get(e.Member); !ok {
+				t.Fatalf("Get(%s) err: member lost after pop", e.Member)
+			}
+		}
+	}
+	if sl.Len() != 0 || len(sl.PopMin(1)) != 0 || len(sl.PopMax(1)) != 0 {
+		t.Errorf("pop from empty set err")
+	}
+}
+
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
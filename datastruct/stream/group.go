@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"sort"
+	"time"
+)
+
+// PendingEntry 已投递给消费者但尚未确认的消息
+type PendingEntry struct {
+	ID            ID
+	Consumer      string
+	DeliveryTime  time.Time
+	DeliveryCount int64
+}
+
+type Consumer struct {
+	Name     string
+	SeenTime time.Time
+}
+
+// Group 消费者组，pending 为按ID有序的待确认消息列表(PEL)
+type Group struct {
+	Name      string
+	LastID    ID
+	pending   []*PendingEntry
+	consumers map[string]*Consumer
+}
+
+// CreateGroup 创建消费者组，已存在时返回 false
+func (stream *Stream) CreateGroup(name string, lastID ID) (*Group, bool) {
+	if _, ok := stream.groups[name]; ok {
+		return nil, false
+	}
+	group := &Group{
+		Name:      name,
+		LastID:    lastID,
+		pending:   make([]*PendingEntry, 0),
+		consumers: make(map[string]*Consumer),
+	}
+	stream.groups[name] = group
+	return group, true
+}
+
+func (stream *Stream) GetGroup(name string) (*Group, bool) {
+	group, ok := stream.groups[name]
+	return group, ok
+}
+
+func (stream *Stream) DestroyGroup(name string) bool {
+	if _, ok := stream.groups[name]; !ok {
+		return false
+	}
+	delete(stream.groups, name)
+	return true
+}
+
+// GroupNames 按名称排序的所有消费者组
+func (stream *Stream) GroupNames() []string {
+	names := make([]string, 0, len(stream.groups))
+	for name := range stream.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (group *Group) GetConsumer(name string) (*Consumer, bool) {
+	consumer, ok := group.consumers[name]
+	return consumer, ok
+}
+
+// CreateConsumer 创建消费者，已存在时返回已有的消费者和 false
+func (group *Group) CreateConsumer(name string, now time.Time) (*Consumer, bool) {
+	if consumer, ok := group.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{
+		Name:     name,
+		SeenTime: now,
+	}
+	group.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer 删除消费者及其所有待确认消息，返回删除的待确认消息数
+func (group *Group) DeleteConsumer(name string) int64 {
+	if _, ok := group.consumers[name]; !ok {
+		return 0
+	}
+	delete(group.consumers, name)
+	remain := group.pending[:0]
+	var removed int64 = 0
+	for _, pe := range group.pending {
+		if pe.Consumer == name {
+			removed++
+			continue
+		}
+		remain = append(remain, pe)
+	}
+	group.pending = remain
+	return removed
+}
+
+// ConsumerNames 按名称排序的所有消费者
+func (group *Group) ConsumerNames() []string {
+	names := make([]string, 0, len(group.consumers))
+	for name := range group.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (group *Group) PendingLen() int64 {
+	return int64(len(group.pending))
+}
+
+// searchPending 返回第一个ID不小于 id 的待确认消息下标
+func (group *Group) searchPending(id ID) int {
+	return sort.Search(len(group.pending), func(i int) bool {
+		return !group.pending[i].ID.Less(id)
+	})
+}
+
+func (group *Group) GetPending(id ID) (*PendingEntry, bool) {
+	i := group.searchPending(id)
+	if i == len(group.pending) || group.pending[i].ID != id {
+		return nil, false
+	}
+	return group.pending[i], true
+}
+
+// SetPending 添加或替换待确认消息
+func (group *Group) SetPending(pe *PendingEntry) {
+	i := group.searchPending(pe.ID)
+	if i < len(group.pending) && group.pending[i].ID == pe.ID {
+		group.pending[i] = pe
+		return
+	}
+	group.pending = append(group.pending, nil)
+	copy(group.pending[i+1:], group.pending[i:])
+	group.pending[i] = pe
+}
+
+// Ack 确认消息，将其从待确认列表中删除
+func (group *Group) Ack(id ID) bool {
+	i := group.searchPending(id)
+	if i == len(group.pending) || group.pending[i].ID != id {
+		return false
+	}
+	group.pending = append(group.pending[:i], group.pending[i+1:]...)
+	return true
+}
+
+// ForEachPending 从 start 开始按ID遍历待确认消息，consumer 返回 false 时停止
+func (group *Group) ForEachPending(start ID, consumer func(pe *PendingEntry) bool) {
+	for i := group.searchPending(start); i < len(group.pending); i++ {
+		if !consumer(group.pending[i]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ID 消息ID，由毫秒时间戳和同一毫秒内的序号组成
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	MinID = ID{}
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+var errInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id ID) Less(another ID) bool {
+	if id.Ms != another.Ms {
+		return id.Ms < another.Ms
+	}
+	return id.Seq < another.Seq
+}
+
+// Next 返回紧随其后的ID，已经是最大ID时返回自身和false
+func (id ID) Next() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev 返回紧邻其前的ID，已经是最小ID时返回自身和false
+func (id ID) Prev() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+/*
+ * ParseID 解析 ms-seq 格式的ID
+ * 只给出 ms 时序号取 missingSeq，区间查询的起点取 0，终点取最大值
+ */
+func ParseID(s string, missingSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, errInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, errInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+/*
+ * ParseRangeID 解析区间查询的边界: "-" 最小ID, "+" 最大ID, "(" 开头表示不包含该ID
+ * isStart 为 true 时解析区间起点
+ */
+func ParseRangeID(s string, isStart bool) (ID, error) {
+	if s == "-" {
+		return MinID, nil
+	}
+	if s == "+" {
+		return MaxID, nil
+	}
+	exclude := strings.HasPrefix(s, "(")
+	if exclude {
+		s = s[1:]
+	}
+	var missingSeq uint64 = 0
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	id, err := ParseID(s, missingSeq)
+	if err != nil || !exclude {
+		return id, err
+	}
+	if isStart {
+		if id, ok := id.Next(); ok {
+			return id, nil
+		}
+		return ID{}, errors.New("ERR invalid start ID for the interval")
+	}
+	if id, ok := id.Prev(); ok {
+		return id, nil
+	}
+	return ID{}, errors.New("ERR invalid end ID for the interval")
+}
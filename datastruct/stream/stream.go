@@ -0,0 +1,331 @@
+package stream
+
+import (
+	"errors"
+	"sort"
+)
+
+// 每个block最多存放的消息数
+const maxBlockEntries = 128
+
+var (
+	errIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+)
+
+// Entry 一条消息，Fields 依次存放 field1, value1, field2, value2 ...
+type Entry struct {
+	ID     ID
+	Fields []string
+}
+
+// block 一段按ID有序的消息，新消息只会追加到最后一个block
+type block struct {
+	entries []*Entry
+}
+
+func (b *block) lastID() ID {
+	return b.entries[len(b.entries)-1].ID
+}
+
+/*
+ * Stream 由按ID有序的 block 组成的两层结构，类似 B+ 树的叶子层
+ * 查找时先二分定位 block，再在 block 内二分定位消息
+ */
+type Stream struct {
+	blocks       []*block
+	length       int64
+	lastID       ID
+	maxDeletedID ID
+	entriesAdded int64
+	groups       map[string]*Group
+}
+
+func Make() *Stream {
+	return &Stream{
+		blocks: make([]*block, 0),
+		groups: make(map[string]*Group),
+	}
+}
+
+func (stream *Stream) Len() int64 {
+	return stream.length
+}
+
+// LastID 最后一次添加的消息ID，消息被删除后也不会变小
+func (stream *Stream) LastID() ID {
+	return stream.lastID
+}
+
+func (stream *Stream) MaxDeletedID() ID {
+	return stream.maxDeletedID
+}
+
+func (stream *Stream) EntriesAdded() int64 {
+	return stream.entriesAdded
+}
+
+// SetMaxDeletedID 用于 RESTORE 还原元数据
+func (stream *Stream) SetMaxDeletedID(id ID) {
+	stream.maxDeletedID = id
+}
+
+// SetEntriesAdded 用于 RESTORE 还原元数据
+func (stream *Stream) SetEntriesAdded(n int64) {
+	stream.entriesAdded = n
+}
+
+// SetLastID 用于 XSETID 等场景，id 不能小于当前最大的消息ID
+func (stream *Stream) SetLastID(id ID) bool {
+	if stream.length > 0 && id.Less(stream.blocks[len(stream.blocks)-1].lastID()) {
+		return false
+	}
+	stream.lastID = id
+	return true
+}
+
+/*
+ * NextID 按当前时间 ms 生成新的消息ID
+ * 时钟回拨或同一毫秒内生成多个ID时沿用上一个ID的时间戳并递增序号
+ */
+func (stream *Stream) NextID(ms uint64) (ID, bool) {
+	if ms > stream.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	return stream.lastID.Next()
+}
+
+// NextSeqID 为 ms-* 格式的ID生成序号
+func (stream *Stream) NextSeqID(ms uint64) (ID, bool) {
+	if ms > stream.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	if ms == stream.lastID.Ms {
+		next, ok := stream.lastID.Next()
+		return next, ok && next.Ms == ms
+	}
+	return ID{}, false
+}
+
+// Add 追加一条消息，id 必须大于已有的所有ID
+func (stream *Stream) Add(id ID, fields []string) error {
+	if id == MinID {
+		return errIDZero
+	}
+	if !stream.lastID.Less(id) {
+		return errIDTooSmall
+	}
+	entry := &Entry{
+		ID:     id,
+		Fields: fields,
+	}
+	n := len(stream.blocks)
+	if n == 0 || len(stream.blocks[n-1].entries) >= maxBlockEntries {
+		stream.blocks = append(stream.blocks, &block{
+			entries: make([]*Entry, 0, maxBlockEntries),
+		})
+		n++
+	}
+	last := stream.blocks[n-1]
+	last.entries = append(last.entries, entry)
+	stream.length++
+	stream.entriesAdded++
+	stream.lastID = id
+	return nil
+}
+
+// seek 返回第一个ID不小于 id 的消息位置，不存在时 blockIndex 为 len(blocks)
+func (stream *Stream) seek(id ID) (blockIndex int, entryIndex int) {
+	blockIndex = sort.Search(len(stream.blocks), func(i int) bool {
+		return !stream.blocks[i].lastID().Less(id)
+	})
+	if blockIndex == len(stream.blocks) {
+		return blockIndex, 0
+	}
+	entries := stream.blocks[blockIndex].entries
+	entryIndex = sort.Search(len(entries), func(i int) bool {
+		return !entries[i].ID.Less(id)
+	})
+	return blockIndex, entryIndex
+}
+
+func (stream *Stream) Get(id ID) (*Entry, bool) {
+	blockIndex, entryIndex := stream.seek(id)
+	if blockIndex == len(stream.blocks) {
+		return nil, false
+	}
+	entry := stream.blocks[blockIndex].entries[entryIndex]
+	if entry.ID != id {
+		return nil, false
+	}
+	return entry, true
+}
+
+/*
+ * ForEach 按ID遍历 [start, end] 中的消息，consumer 返回 false 时停止
+ * desc 为 true 时从 end 开始倒序遍历
+ */
+func (stream *Stream) ForEach(start ID, end ID, desc bool, consumer func(entry *Entry) bool) {
+	if end.Less(start) {
+		return
+	}
+	if !desc {
+		blockIndex, entryIndex := stream.seek(start)
+		for ; blockIndex < len(stream.blocks); blockIndex++ {
+			entries := stream.blocks[blockIndex].entries
+			for ; entryIndex < len(entries); entryIndex++ {
+				entry := entries[entryIndex]
+				if end.Less(entry.ID) || !consumer(entry) {
+					return
+				}
+			}
+			entryIndex = 0
+		}
+		return
+	}
+	// 从第一个大于 end 的消息向前遍历
+	blockIndex, entryIndex := len(stream.blocks), 0
+	if next, ok := end.Next(); ok {
+		blockIndex, entryIndex = stream.seek(next)
+	}
+	for {
+		if entryIndex > 0 {
+			entryIndex--
+		} else if blockIndex > 0 {
+			blockIndex--
+			entryIndex = len(stream.blocks[blockIndex].entries) - 1
+		} else {
+			return
+		}
+		entry := stream.blocks[blockIndex].entries[entryIndex]
+		if entry.ID.Less(start) || !consumer(entry) {
+			return
+		}
+	}
+}
+
+// Range 返回 [start, end] 中的消息，count <= 0 时不限制数量
+func (stream *Stream) Range(start ID, end ID, count int64, desc bool) []*Entry {
+	entries := make([]*Entry, 0)
+	stream.ForEach(start, end, desc, func(entry *Entry) bool {
+		entries = append(entries, entry)
+		return count <= 0 || int64(len(entries)) < count
+	})
+	return entries
+}
+
+// Delete 删除一条消息，不存在时返回 false
+func (stream *Stream) Delete(id ID) bool {
+	blockIndex, entryIndex := stream.seek(id)
+	if blockIndex == len(stream.blocks) {
+		return false
+	}
+	b := stream.blocks[blockIndex]
+	if b.entries[entryIndex].ID != id {
+		return false
+	}
+	b.entries = append(b.entries[:entryIndex], b.entries[entryIndex+1:]...)
+	if len(b.entries) == 0 {
+		stream.blocks = append(stream.blocks[:blockIndex], stream.blocks[blockIndex+1:]...)
+	}
+	stream.length--
+	stream.updateMaxDeleted(id)
+	return true
+}
+
+/*
+ * trim 从头部删除消息，直到 shouldRemove 返回 false
+ * approx 为 true 时只删除整个 block，limit > 0 时最多删除 limit 条消息
+ */
+func (stream *Stream) trim(approx bool, limit int64, shouldRemove func(b *block, i int) bool) int64 {
+	var removed int64 = 0
+	for len(stream.blocks) > 0 {
+		first := stream.blocks[0]
+		if approx {
+			n := int64(len(first.entries))
+			if !shouldRemove(first, len(first.entries)-1) || (limit > 0 && removed+n > limit) {
+				break
+			}
+			stream.blocks = stream.blocks[1:]
+			removed += n
+			stream.length -= n
+			stream.updateMaxDeleted(first.lastID())
+			continue
+		}
+		i := 0
+		for i < len(first.entries) && shouldRemove(first, i) && (limit <= 0 || removed < limit) {
+			stream.updateMaxDeleted(first.entries[i].ID)
+			i++
+			removed++
+			stream.length--
+		}
+		if i < len(first.entries) {
+			first.entries = first.entries[i:]
+			break
+		}
+		stream.blocks = stream.blocks[1:]
+	}
+	return removed
+}
+
+func (stream *Stream) updateMaxDeleted(id ID) {
+	if stream.maxDeletedID.Less(id) {
+		stream.maxDeletedID = id
+	}
+}
+
+// TrimByLen 删除最早的消息使长度不超过 maxLen，返回删除的数量
+func (stream *Stream) TrimByLen(maxLen int64, approx bool, limit int64) int64 {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	return stream.trim(approx, limit, func(b *block, i int) bool {
+		if approx {
+			// 删除整个 block 后长度不小于 maxLen
+			return stream.length-int64(i+1) >= maxLen
+		}
+		return stream.length > maxLen
+	})
+}
+
+// TrimByMinID 删除ID小于 minID 的消息，返回删除的数量
+func (stream *Stream) TrimByMinID(minID ID, approx bool, limit int64) int64 {
+	return stream.trim(approx, limit, func(b *block, i int) bool {
+		return b.entries[i].ID.Less(minID)
+	})
+}
+
+// Clone 返回不共享消息和消费者组的副本
+func (stream *Stream) Clone() *Stream {
+	c := *stream
+	c.blocks = make([]*block, len(stream.blocks))
+	for i, b := range stream.blocks {
+		entries := make([]*Entry, len(b.entries), maxBlockEntries)
+		for j, entry := range b.entries {
+			entries[j] = &Entry{
+				ID:     entry.ID,
+				Fields: append([]string(nil), entry.Fields...),
+			}
+		}
+		c.blocks[i] = &block{entries: entries}
+	}
+	c.groups = make(map[string]*Group, len(stream.groups))
+	for name, group := range stream.groups {
+		copied := &Group{
+			Name:      group.Name,
+			LastID:    group.LastID,
+			pending:   make([]*PendingEntry, len(group.pending)),
+			consumers: make(map[string]*Consumer, len(group.consumers)),
+		}
+		for i, pe := range group.pending {
+			entry := *pe
+			copied.pending[i] = &entry
+		}
+		for consumerName, consumer := range group.consumers {
+			entry := *consumer
+			copied.consumers[consumerName] = &entry
+		}
+		c.groups[name] = copied
+	}
+	return &c
+}
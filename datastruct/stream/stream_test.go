@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func makeStream(size int) *Stream {
+	stream := Make()
+	for i := 1; i <= size; i++ {
+		_ = stream.Add(ID{Ms: uint64(i)}, []string{"k", "v"})
+	}
+	return stream
+}
+
+func toIDs(entries []*Entry) []uint64 {
+	ids := make([]uint64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID.Ms
+	}
+	return ids
+}
+
+// seq 返回 from 到 to 的连续整数，from > to 时递减
+func seq(from int, to int) []uint64 {
+	ids := make([]uint64, 0)
+	step := 1
+	if from > to {
+		step = -1
+	}
+	for i := from; i != to+step; i += step {
+		ids = append(ids, uint64(i))
+	}
+	return ids
+}
+
+func Test_Stream_range(t *testing.T) {
+	stream := makeStream(300)
+	testCases := []struct {
+		name  string
+		start ID
+		end   ID
+		count int64
+		desc  bool
+		exIDs []uint64
+	}{
+		{name: "all", start: MinID, end: MaxID, exIDs: seq(1, 300)},
+		{name: "across blocks", start: ID{Ms: 120}, end: ID{Ms: 140}, exIDs: seq(120, 140)},
+		{name: "count", start: ID{Ms: 250}, end: MaxID, count: 3, exIDs: seq(250, 252)},
+		{name: "desc across blocks", start: ID{Ms: 120}, end: ID{Ms: 140}, desc: true, exIDs: seq(140, 120)},
+		{name: "desc count", start: MinID, end: MaxID, count: 2, desc: true, exIDs: seq(300, 299)},
+		{name: "desc end between", start: MinID, end: ID{Ms: 2, Seq: 5}, desc: true, exIDs: seq(2, 1)},
+		{name: "empty", start: ID{Ms: 301}, end: MaxID, exIDs: []uint64{}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := toIDs(stream.Range(tt.start, tt.end, tt.count, tt.desc))
+			if !reflect.DeepEqual(ids, tt.exIDs) {
+				t.Errorf("Range() err: reall: %v, want: %v", ids, tt.exIDs)
+			}
+		})
+	}
+}
+
+func Test_Stream_add(t *testing.T) {
+	stream := makeStream(3)
+	if err := stream.Add(ID{Ms: 3}, nil); err == nil {
+		t.Errorf("Add() should reject ID equal to the top item")
+	}
+	if id, _ := stream.NextID(1); id != (ID{Ms: 3, Seq: 1}) {
+		t.Errorf("NextID() err: %v", id)
+	}
+	if id, ok := stream.NextSeqID(2); ok {
+		t.Errorf("NextSeqID() should fail, got: %v", id)
+	}
+	if _, err := ParseRangeID("(18446744073709551615-18446744073709551615", true); err == nil {
+		t.Errorf("ParseRangeID() should reject exclusive max start")
+	}
+	if id, _ := ParseRangeID("5", false); id != (ID{Ms: 5, Seq: MaxID.Seq}) {
+		t.Errorf("ParseRangeID() err: %v", id)
+	}
+}
+
+func Test_Stream_deleteAndTrim(t *testing.T) {
+	stream := makeStream(300)
+	for i := uint64(1); i <= 128; i++ {
+		if !stream.Delete(ID{Ms: i}) {
+			t.Fatalf("Delete(%d) err", i)
+		}
+	}
+	if stream.Delete(ID{Ms: 1}) {
+		t.Errorf("Delete() deleted entry twice")
+	}
+	if stream.Len() != 172 || len(stream.blocks) != 2 {
+		t.Fatalf("Delete() err: len %d, blocks %d", stream.Len(), len(stream.blocks))
+	}
+	// 近似裁剪只删除整个 block
+	if removed := stream.TrimByLen(100, true, 0); removed != 0 {
+		t.Errorf("TrimByLen(~) err: removed %d", removed)
+	}
+	if removed := stream.TrimByLen(100, false, 0); removed != 72 {
+		t.Errorf("TrimByLen() err: removed %d", removed)
+	}
+	if ids := toIDs(stream.Range(MinID, MaxID, 1, false)); ids[0] != 201 {
+		t.Errorf("TrimByLen() err: first %v", ids)
+	}
+	if removed := stream.TrimByMinID(ID{Ms: 290}, false, 0); removed != 89 {
+		t.Errorf("TrimByMinID() err: removed %d", removed)
+	}
+	if stream.MaxDeletedID() != (ID{Ms: 289}) || stream.LastID() != (ID{Ms: 300}) {
+		t.Errorf("deleted id err: %v, %v", stream.MaxDeletedID(), stream.LastID())
+	}
+}
+
+func Test_Group_pending(t *testing.T) {
+	stream := makeStream(10)
+	group, _ := stream.CreateGroup("g", MinID)
+	if _, ok := stream.CreateGroup("g", MinID); ok {
+		t.Errorf("CreateGroup() should reject duplicate group")
+	}
+	now := time.Now()
+	for _, i := range []uint64{5, 1, 3, 9} {
+		consumer := "alice"
+		if i > 4 {
+			consumer = "bob"
+		}
+		group.CreateConsumer(consumer, now)
+		group.SetPending(&PendingEntry{ID: ID{Ms: i}, Consumer: consumer, DeliveryTime: now, DeliveryCount: 1})
+	}
+	ids := make([]uint64, 0)
+	group.ForEachPending(ID{Ms: 2}, func(pe *PendingEntry) bool {
+		ids = append(ids, pe.ID.Ms)
+		return true
+	})
+	if !reflect.DeepEqual(ids, []uint64{3, 5, 9}) {
+		t.Errorf("ForEachPending() err: %v", ids)
+	}
+	if !group.Ack(ID{Ms: 3}) || group.Ack(ID{Ms: 3}) {
+		t.Errorf("Ack() err")
+	}
+	if removed := group.DeleteConsumer("bob"); removed != 2 {
+		t.Errorf("DeleteConsumer() err: removed %d", removed)
+	}
+	if group.PendingLen() != 1 || !reflect.DeepEqual(group.ConsumerNames(), []string{"alice"}) {
+		t.Errorf("pending err: %d, %v", group.PendingLen(), group.ConsumerNames())
+	}
+}
+
+func Test_Stream_clone(t *testing.T) {
+	stream := makeStream(200)
+	group, _ := stream.CreateGroup("g", MinID)
+	group.CreateConsumer("alice", time.Now())
+	group.SetPending(&PendingEntry{ID: ID{Ms: 1}, Consumer: "alice", DeliveryCount: 1})
+	c := stream.Clone()
+	if !reflect.DeepEqual(stream, c) {
+		t.Fatalf("Clone() err")
+	}
+	// 修改原 stream 不影响副本
+	stream.TrimByLen(10, false, 0)
+	_ = stream.Add(ID{Ms: 300}, []string{"k", "v"})
+	group.Ack(ID{Ms: 1})
+	group.LastID = ID{Ms: 5}
+	cGroup, _ := c.GetGroup("g")
+	if c.Len() != 200 || c.LastID() != (ID{Ms: 200}) || cGroup.PendingLen() != 1 || cGroup.LastID != MinID {
+		t.Errorf("Clone() should not share data: len %d, pending %d", c.Len(), cGroup.PendingLen())
+	}
+	if !reflect.DeepEqual(toIDs(c.Range(MinID, MaxID, 0, false)), seq(1, 200)) {
+		t.Errorf("Clone() entries err")
+	}
+}
@@ -0,0 +1,119 @@
+package timeseries
+
+import (
+	"math"
+	"strings"
+)
+
+// aggregator 累积一个时间桶内的样本
+type aggregator struct {
+	aggType string
+	count   int64
+	sum     float64
+	min     float64
+	max     float64
+}
+
+// IsAggregation 检查聚合类型是否合法
+func IsAggregation(aggType string) bool {
+	switch strings.ToLower(aggType) {
+	case "avg", "sum", "min", "max", "count":
+		return true
+	}
+	return false
+}
+
+func makeAggregator(aggType string) *aggregator {
+	return &aggregator{
+		aggType: strings.ToLower(aggType),
+		min:     math.Inf(1),
+		max:     math.Inf(-1),
+	}
+}
+
+func (a *aggregator) add(value float64) {
+	a.count++
+	a.sum += value
+	a.min = math.Min(a.min, value)
+	a.max = math.Max(a.max, value)
+}
+
+func (a *aggregator) result() float64 {
+	switch a.aggType {
+	case "avg":
+		return a.sum / float64(a.count)
+	case "sum":
+		return a.sum
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	}
+	return float64(a.count)
+}
+
+// bucketStart 返回时间戳所在时间桶的起始时间
+func bucketStart(ts int64, bucket int64) int64 {
+	start := ts - ts%bucket
+	if ts < 0 && ts%bucket != 0 {
+		start -= bucket
+	}
+	return start
+}
+
+// Aggregate 将有序的样本按 bucket 毫秒分桶聚合，时间戳为桶的起始时间
+func Aggregate(samples []Sample, aggType string, bucket int64) []Sample {
+	result := make([]Sample, 0)
+	var agg *aggregator
+	var start int64
+	for _, s := range samples {
+		current := bucketStart(s.Timestamp, bucket)
+		if agg != nil && current != start {
+			result = append(result, Sample{Timestamp: start, Value: agg.result()})
+			agg = nil
+		}
+		if agg == nil {
+			agg = makeAggregator(aggType)
+			start = current
+		}
+		agg.add(s.Value)
+	}
+	if agg != nil {
+		result = append(result, Sample{Timestamp: start, Value: agg.result()})
+	}
+	return result
+}
+
+/*
+ * Rule 压缩规则，源序列的样本按时间桶聚合后写入目标序列
+ * 样本进入新的时间桶时，上一个时间桶的结果才会写入目标序列
+ * 乱序写入到已经关闭的时间桶的样本不会更新目标序列
+ */
+type Rule struct {
+	DestKey     string
+	Aggregation string
+	Bucket      int64
+
+	agg   *aggregator
+	start int64
+}
+
+// feed 写入一个样本，返回已经关闭的时间桶的聚合结果
+func (r *Rule) feed(s Sample) (Sample, bool) {
+	current := bucketStart(s.Timestamp, r.Bucket)
+	if r.agg != nil && current < r.start {
+		return Sample{}, false
+	}
+	var closed Sample
+	ok := false
+	if r.agg != nil && current > r.start {
+		closed, ok = Sample{Timestamp: r.start, Value: r.agg.result()}, true
+		r.agg = nil
+	}
+	if r.agg == nil {
+		r.agg = makeAggregator(r.Aggregation)
+		r.start = current
+	}
+	r.agg.add(s.Value)
+	return closed, ok
+}
@@ -0,0 +1,218 @@
+package timeseries
+
+import (
+	"math"
+	"math/bits"
+)
+
+/*
+ * chunk 使用 Gorilla 算法压缩样本:
+ * 时间戳记录二阶差分，值记录与前一个值异或后的有效位
+ */
+
+const maxChunkSamples = 256
+
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+type bstream struct {
+	data []byte
+	free uint8 // 最后一个字节中未使用的位数
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.free == 0 {
+		b.data = append(b.data, 0)
+		b.free = 8
+	}
+	if bit {
+		b.data[len(b.data)-1] |= 1 << (b.free - 1)
+	}
+	b.free--
+}
+
+func (b *bstream) writeBits(u uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.writeBit(u>>uint(i)&1 == 1)
+	}
+}
+
+type breader struct {
+	data []byte
+	pos  int // 已读取的位数
+}
+
+func (r *breader) readBit() bool {
+	bit := r.data[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit
+}
+
+func (r *breader) readBits(n int) uint64 {
+	var u uint64
+	for i := 0; i < n; i++ {
+		u <<= 1
+		if r.readBit() {
+			u |= 1
+		}
+	}
+	return u
+}
+
+type chunk struct {
+	stream  bstream
+	count   int
+	firstTs int64
+	lastTs  int64
+
+	// 编码状态
+	prevDelta    int64
+	prevValue    uint64
+	prevLeading  uint8
+	prevTrailing uint8
+}
+
+// dod 编码的区间，前缀为 n 个 1 加一个 0
+var dodRanges = []struct {
+	bits int
+	min  int64
+	max  int64
+}{
+	{bits: 7, min: -63, max: 64},
+	{bits: 9, min: -255, max: 256},
+	{bits: 12, min: -2047, max: 2048},
+}
+
+func (c *chunk) append(ts int64, value float64) {
+	v := math.Float64bits(value)
+	if c.count == 0 {
+		c.stream.writeBits(uint64(ts), 64)
+		c.stream.writeBits(v, 64)
+		c.firstTs = ts
+		c.prevLeading = 0xff
+	} else {
+		delta := ts - c.lastTs
+		c.writeDod(delta - c.prevDelta)
+		c.prevDelta = delta
+		c.writeXor(v)
+	}
+	c.lastTs = ts
+	c.prevValue = v
+	c.count++
+}
+
+func (c *chunk) writeDod(dod int64) {
+	if dod == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	for i, r := range dodRanges {
+		if dod >= r.min && dod <= r.max {
+			c.stream.writeBits(1<<(i+1)-1, i+1)
+			c.stream.writeBit(false)
+			c.stream.writeBits(uint64(dod), r.bits)
+			return
+		}
+	}
+	c.stream.writeBits(0xf, 4)
+	c.stream.writeBits(uint64(dod), 64)
+}
+
+func (c *chunk) writeXor(v uint64) {
+	xor := v ^ c.prevValue
+	if xor == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	c.stream.writeBit(true)
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		leading = 31
+	}
+	// 有效位落在上一次的区间内时复用前导 0 和末尾 0 的个数
+	if c.prevLeading != 0xff && leading >= c.prevLeading && trailing >= c.prevTrailing {
+		c.stream.writeBit(false)
+		c.stream.writeBits(xor>>c.prevTrailing, 64-int(c.prevLeading)-int(c.prevTrailing))
+		return
+	}
+	c.prevLeading, c.prevTrailing = leading, trailing
+	sigBits := 64 - int(leading) - int(trailing)
+	c.stream.writeBit(true)
+	c.stream.writeBits(uint64(leading), 5)
+	// 有效位为 64 时记为 0
+	c.stream.writeBits(uint64(sigBits)&0x3f, 6)
+	c.stream.writeBits(xor>>trailing, sigBits)
+}
+
+// decodeDod 区间为 [-(2^(n-1)-1), 2^(n-1)]，大于 2^(n-1) 的值为负数
+func decodeDod(u uint64, n int) int64 {
+	if u > 1<<(n-1) {
+		return int64(u) - 1<<n
+	}
+	return int64(u)
+}
+
+// samples 解压出所有的样本
+func (c *chunk) samples() []Sample {
+	result := make([]Sample, 0, c.count)
+	if c.count == 0 {
+		return result
+	}
+	r := &breader{data: c.stream.data}
+	ts := int64(r.readBits(64))
+	v := r.readBits(64)
+	result = append(result, Sample{Timestamp: ts, Value: math.Float64frombits(v)})
+	var delta int64
+	var leading, trailing uint8
+	for i := 1; i < c.count; i++ {
+		// 读取 dod 的前缀
+		n := 0
+		for n < 4 && r.readBit() {
+			n++
+		}
+		var dod int64
+		if n == 4 {
+			dod = int64(r.readBits(64))
+		} else if n > 0 {
+			dod = decodeDod(r.readBits(dodRanges[n-1].bits), dodRanges[n-1].bits)
+		}
+		delta += dod
+		ts += delta
+		if r.readBit() {
+			if r.readBit() {
+				leading = uint8(r.readBits(5))
+				sigBits := int(r.readBits(6))
+				if sigBits == 0 {
+					sigBits = 64
+				}
+				trailing = uint8(64 - int(leading) - sigBits)
+			}
+			sigBits := 64 - int(leading) - int(trailing)
+			v ^= r.readBits(sigBits) << trailing
+		}
+		result = append(result, Sample{Timestamp: ts, Value: math.Float64frombits(v)})
+	}
+	return result
+}
+
+// size 返回压缩后占用的字节数
+func (c *chunk) size() int {
+	return len(c.stream.data)
+}
+
+// encodeChunks 将有序的样本压缩为若干个 chunk
+func encodeChunks(samples []Sample) []*chunk {
+	chunks := make([]*chunk, 0)
+	var current *chunk
+	for _, s := range samples {
+		if current == nil || current.count >= maxChunkSamples {
+			current = &chunk{}
+			chunks = append(chunks, current)
+		}
+		current.append(s.Timestamp, s.Value)
+	}
+	return chunks
+}
@@ -0,0 +1,325 @@
+package timeseries
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var (
+	ErrDuplicate = errors.New("ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+	ErrTooOld    = errors.New("ERR TSDB: Timestamp is older than retention")
+	ErrCorrupt   = errors.New("ERR invalid time series payload")
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Compacted 压缩规则产生的需要写入目标序列的样本
+type Compacted struct {
+	DestKey string
+	Sample  Sample
+}
+
+/*
+ * Series 时间序列，样本按时间戳有序存储在压缩的 chunk 中
+ * retention 大于 0 时，早于最新样本 retention 毫秒的 chunk 会被整体删除，读取时过滤剩余的过期样本
+ */
+type Series struct {
+	retention int64
+	labels    []Label
+	chunks    []*chunk
+	rules     []*Rule
+	srcKey    string // 作为压缩规则的目标序列时，源序列的 key
+}
+
+func Make(retention int64, labels []Label) *Series {
+	return &Series{
+		retention: retention,
+		labels:    labels,
+		chunks:    make([]*chunk, 0),
+	}
+}
+
+func (s *Series) Retention() int64 {
+	return s.retention
+}
+
+func (s *Series) Labels() []Label {
+	return s.labels
+}
+
+// Label 返回标签的值
+func (s *Series) Label(name string) (string, bool) {
+	for _, label := range s.labels {
+		if label.Name == name {
+			return label.Value, true
+		}
+	}
+	return "", false
+}
+
+// Len 返回样本个数，包括尚未删除的过期样本
+func (s *Series) Len() int {
+	n := 0
+	for _, c := range s.chunks {
+		n += c.count
+	}
+	return n
+}
+
+// Size 返回压缩后的样本占用的字节数
+func (s *Series) Size() int {
+	size := 0
+	for _, c := range s.chunks {
+		size += c.size()
+	}
+	return size
+}
+
+func (s *Series) LastTimestamp() (int64, bool) {
+	if len(s.chunks) == 0 {
+		return 0, false
+	}
+	return s.chunks[len(s.chunks)-1].lastTs, true
+}
+
+// minTimestamp 返回未过期的最小时间戳
+func (s *Series) minTimestamp() int64 {
+	last, ok := s.LastTimestamp()
+	if s.retention <= 0 || !ok {
+		return math.MinInt64
+	}
+	return last - s.retention
+}
+
+// Add 写入样本，返回压缩规则产生的样本
+func (s *Series) Add(ts int64, value float64) ([]*Compacted, error) {
+	if ts < s.minTimestamp() {
+		return nil, ErrTooOld
+	}
+	last, ok := s.LastTimestamp()
+	if !ok || ts > last {
+		lastChunk := (*chunk)(nil)
+		if ok {
+			lastChunk = s.chunks[len(s.chunks)-1]
+		}
+		if lastChunk == nil || lastChunk.count >= maxChunkSamples {
+			lastChunk = &chunk{}
+			s.chunks = append(s.chunks, lastChunk)
+		}
+		lastChunk.append(ts, value)
+		s.trim()
+	} else if err := s.insert(ts, value); err != nil {
+		return nil, err
+	}
+	compacted := make([]*Compacted, 0)
+	for _, rule := range s.rules {
+		if sample, ok := rule.feed(Sample{Timestamp: ts, Value: value}); ok {
+			compacted = append(compacted, &Compacted{DestKey: rule.DestKey, Sample: sample})
+		}
+	}
+	return compacted, nil
+}
+
+// insert 乱序写入时解压所在的 chunk，插入后重新压缩
+func (s *Series) insert(ts int64, value float64) error {
+	i := sort.Search(len(s.chunks), func(i int) bool {
+		return s.chunks[i].lastTs >= ts
+	})
+	samples := s.chunks[i].samples()
+	j := sort.Search(len(samples), func(j int) bool {
+		return samples[j].Timestamp >= ts
+	})
+	if j < len(samples) && samples[j].Timestamp == ts {
+		return ErrDuplicate
+	}
+	samples = append(samples, Sample{})
+	copy(samples[j+1:], samples[j:])
+	samples[j] = Sample{Timestamp: ts, Value: value}
+	chunks := append(encodeChunks(samples), s.chunks[i+1:]...)
+	s.chunks = append(s.chunks[:i], chunks...)
+	return nil
+}
+
+// trim 删除所有样本都已过期的 chunk
+func (s *Series) trim() {
+	minTs := s.minTimestamp()
+	i := 0
+	for i < len(s.chunks)-1 && s.chunks[i].lastTs < minTs {
+		i++
+	}
+	s.chunks = s.chunks[i:]
+}
+
+// Range 返回时间戳在 [from, to] 内且未过期的样本
+func (s *Series) Range(from int64, to int64) []Sample {
+	if minTs := s.minTimestamp(); from < minTs {
+		from = minTs
+	}
+	result := make([]Sample, 0)
+	for _, c := range s.chunks {
+		if c.lastTs < from || c.firstTs > to {
+			continue
+		}
+		for _, sample := range c.samples() {
+			if sample.Timestamp >= from && sample.Timestamp <= to {
+				result = append(result, sample)
+			}
+		}
+	}
+	return result
+}
+
+func (s *Series) Rules() []*Rule {
+	return s.rules
+}
+
+func (s *Series) AddRule(rule *Rule) {
+	s.rules = append(s.rules, rule)
+}
+
+func (s *Series) SrcKey() string {
+	return s.srcKey
+}
+
+func (s *Series) SetSrcKey(key string) {
+	s.srcKey = key
+}
+
+// Clone 返回不共享样本的副本，与 RedisTimeSeries 相同，压缩规则和源序列不会被复制
+func (s *Series) Clone() *Series {
+	c := Make(s.retention, append([]Label(nil), s.labels...))
+	for _, ch := range s.chunks {
+		copied := *ch
+		copied.stream.data = append([]byte(nil), ch.stream.data...)
+		c.chunks = append(c.chunks, &copied)
+	}
+	return c
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func readString(reader *bytes.Reader) (string, error) {
+	var n uint64
+	if binary.Read(reader, binary.LittleEndian, &n) != nil || n > uint64(reader.Len()) {
+		return "", ErrCorrupt
+	}
+	b := make([]byte, n)
+	_, _ = reader.Read(b)
+	return string(b), nil
+}
+
+/*
+ * MarshalBinary 序列化为:
+ * retention | 标签个数 | 每个标签的名称, 值 | 源序列的 key | 样本个数 | 每个样本的时间戳, 值 |
+ * 规则个数 | 每个规则的目标 key, 聚合类型, 时间桶, 当前时间桶的起始时间和聚合状态
+ * 字符串为长度加内容，整数均为小端序，样本解压后保存
+ */
+func (s *Series) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, s.retention)
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(s.labels)))
+	for _, label := range s.labels {
+		writeString(buf, label.Name)
+		writeString(buf, label.Value)
+	}
+	writeString(buf, s.srcKey)
+	_ = binary.Write(buf, binary.LittleEndian, uint64(s.Len()))
+	for _, c := range s.chunks {
+		for _, sample := range c.samples() {
+			_ = binary.Write(buf, binary.LittleEndian, sample.Timestamp)
+			_ = binary.Write(buf, binary.LittleEndian, sample.Value)
+		}
+	}
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(s.rules)))
+	for _, rule := range s.rules {
+		writeString(buf, rule.DestKey)
+		writeString(buf, rule.Aggregation)
+		_ = binary.Write(buf, binary.LittleEndian, rule.Bucket)
+		// 没有聚合中的时间桶时 count 为 -1
+		agg := aggregator{count: -1}
+		if rule.agg != nil {
+			agg = *rule.agg
+		}
+		_ = binary.Write(buf, binary.LittleEndian, rule.start)
+		_ = binary.Write(buf, binary.LittleEndian, agg.count)
+		_ = binary.Write(buf, binary.LittleEndian, []float64{agg.sum, agg.min, agg.max})
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Series) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	var n uint64
+	if binary.Read(reader, binary.LittleEndian, &s.retention) != nil ||
+		binary.Read(reader, binary.LittleEndian, &n) != nil || n > uint64(reader.Len()) {
+		return ErrCorrupt
+	}
+	s.labels = make([]Label, n)
+	for i := range s.labels {
+		name, err := readString(reader)
+		if err != nil {
+			return err
+		}
+		value, err := readString(reader)
+		if err != nil {
+			return err
+		}
+		s.labels[i] = Label{Name: name, Value: value}
+	}
+	var err error
+	if s.srcKey, err = readString(reader); err != nil {
+		return err
+	}
+	if binary.Read(reader, binary.LittleEndian, &n) != nil || n > uint64(reader.Len())/16 {
+		return ErrCorrupt
+	}
+	samples := make([]Sample, n)
+	for i := range samples {
+		_ = binary.Read(reader, binary.LittleEndian, &samples[i].Timestamp)
+		_ = binary.Read(reader, binary.LittleEndian, &samples[i].Value)
+		if i > 0 && samples[i].Timestamp <= samples[i-1].Timestamp {
+			return ErrCorrupt
+		}
+	}
+	s.chunks = encodeChunks(samples)
+	if binary.Read(reader, binary.LittleEndian, &n) != nil || n > uint64(reader.Len()) {
+		return ErrCorrupt
+	}
+	s.rules = make([]*Rule, 0, n)
+	for i := uint64(0); i < n; i++ {
+		rule := &Rule{}
+		if rule.DestKey, err = readString(reader); err != nil {
+			return err
+		}
+		if rule.Aggregation, err = readString(reader); err != nil {
+			return err
+		}
+		agg := makeAggregator(rule.Aggregation)
+		values := make([]float64, 3)
+		if binary.Read(reader, binary.LittleEndian, &rule.Bucket) != nil ||
+			binary.Read(reader, binary.LittleEndian, &rule.start) != nil ||
+			binary.Read(reader, binary.LittleEndian, &agg.count) != nil ||
+			binary.Read(reader, binary.LittleEndian, values) != nil ||
+			!IsAggregation(rule.Aggregation) || rule.Bucket <= 0 {
+			return ErrCorrupt
+		}
+		if agg.count >= 0 {
+			agg.sum, agg.min, agg.max = values[0], values[1], values[2]
+			rule.agg = agg
+		}
+		s.rules = append(s.rules, rule)
+	}
+	if reader.Len() != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
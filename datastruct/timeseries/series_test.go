@@ -0,0 +1,116 @@
+package timeseries
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func Test_Chunk(t *testing.T) {
+	samples := make([]Sample, 0)
+	ts := int64(1700000000000)
+	for i := 0; i < 1000; i++ {
+		// 混合规律和不规律的间隔与取值
+		ts += int64(1000 + rand.Intn(3)*rand.Intn(5000))
+		value := float64(i % 7)
+		if i%3 == 0 {
+			value = rand.NormFloat64() * 1e6
+		}
+		samples = append(samples, Sample{Timestamp: ts, Value: value})
+	}
+	samples = append(samples, Sample{Timestamp: ts + 1<<40, Value: math.Inf(1)})
+	result := make([]Sample, 0)
+	for _, c := range encodeChunks(samples) {
+		result = append(result, c.samples()...)
+	}
+	if !reflect.DeepEqual(result, samples) {
+		t.Errorf("chunk round trip err")
+	}
+}
+
+func Test_Series(t *testing.T) {
+	s := Make(0, nil)
+	for _, ts := range []int64{10, 30, 20, 40} {
+		if _, err := s.Add(ts, float64(ts)); err != nil {
+			t.Fatalf("Add(%d) err: %v", ts, err)
+		}
+	}
+	if _, err := s.Add(20, 1); err != ErrDuplicate {
+		t.Errorf("Add() should reject duplicate timestamp, err: %v", err)
+	}
+	want := []Sample{{20, 20}, {30, 30}}
+	if result := s.Range(15, 35); !reflect.DeepEqual(result, want) {
+		t.Errorf("Range() err: %v", result)
+	}
+}
+
+func Test_Series_retention(t *testing.T) {
+	s := Make(1000, nil)
+	for ts := int64(0); ts < 10000; ts += 10 {
+		_, _ = s.Add(ts, 1)
+	}
+	if _, err := s.Add(100, 1); err != ErrTooOld {
+		t.Errorf("Add() should reject old sample, err: %v", err)
+	}
+	result := s.Range(0, math.MaxInt64)
+	if len(result) != 101 || result[0].Timestamp != 8990 {
+		t.Errorf("Range() err: len %d, first %v", len(result), result[0])
+	}
+	if len(s.chunks) > 2 {
+		t.Errorf("trim err: %d chunks", len(s.chunks))
+	}
+}
+
+func Test_Aggregate(t *testing.T) {
+	samples := []Sample{{1, 1}, {5, 3}, {10, 2}, {12, 6}, {31, 5}}
+	testCases := []struct {
+		aggType string
+		want    []Sample
+	}{
+		{aggType: "avg", want: []Sample{{0, 2}, {10, 4}, {30, 5}}},
+		{aggType: "sum", want: []Sample{{0, 4}, {10, 8}, {30, 5}}},
+		{aggType: "min", want: []Sample{{0, 1}, {10, 2}, {30, 5}}},
+		{aggType: "max", want: []Sample{{0, 3}, {10, 6}, {30, 5}}},
+		{aggType: "count", want: []Sample{{0, 2}, {10, 2}, {30, 1}}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.aggType, func(t *testing.T) {
+			if result := Aggregate(samples, tt.aggType, 10); !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("Aggregate() err: %v", result)
+			}
+		})
+	}
+	rule := &Rule{DestKey: "dest", Aggregation: "sum", Bucket: 10}
+	compacted := make([]Sample, 0)
+	for _, sample := range samples {
+		if closed, ok := rule.feed(sample); ok {
+			compacted = append(compacted, closed)
+		}
+	}
+	if want := []Sample{{0, 4}, {10, 8}}; !reflect.DeepEqual(compacted, want) {
+		t.Errorf("Rule err: %v", compacted)
+	}
+}
+
+func Test_Marshal(t *testing.T) {
+	s := Make(0, []Label{{Name: "area", Value: "east"}})
+	s.SetSrcKey("src")
+	s.AddRule(&Rule{DestKey: "avg", Aggregation: "avg", Bucket: 10})
+	s.AddRule(&Rule{DestKey: "max", Aggregation: "max", Bucket: 100})
+	for i := int64(1); i <= 300; i++ {
+		_, _ = s.Add(i*3, float64(i))
+	}
+	data, _ := s.MarshalBinary()
+	s2 := &Series{}
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() err: %v", err)
+	}
+	if !reflect.DeepEqual(s.Range(0, math.MaxInt64), s2.Range(0, math.MaxInt64)) || !reflect.DeepEqual(s.Labels(), s2.Labels()) ||
+		!reflect.DeepEqual(s.Rules(), s2.Rules()) || s2.SrcKey() != "src" {
+		t.Errorf("round trip err")
+	}
+	if err := s2.UnmarshalBinary(data[:len(data)-1]); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary() should reject truncated payload")
+	}
+}
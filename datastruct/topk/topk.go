@@ -0,0 +1,302 @@
+package topk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+const (
+	DefaultWidth = 8
+	DefaultDepth = 7
+	DefaultDecay = 0.9
+
+	// decay^count 的查表范围，更大的 count 衰减概率视为 0
+	decayLookupSize = 256
+	// 固定的随机数种子，AOF 重放时得到相同的状态
+	randSeed = 0x5eed
+)
+
+var ErrCorrupt = errors.New("ERR invalid topk payload")
+
+const (
+	// MaxK top k 的上限
+	MaxK = 1 << 20
+	// MaxBuckets bucket 总数的上限
+	MaxBuckets = 1 << 26
+)
+
+// ValidSize k 和 width*depth 都不超过上限
+func ValidSize(k uint64, width uint64, depth uint64) bool {
+	return k > 0 && k <= MaxK && width > 0 && depth > 0 && width <= MaxBuckets/depth
+}
+
+// splitmix64 状态只有一个整数的随机数生成器，复制和序列化后随机数序列保持不变
+type splitmix64 uint64
+
+func (s *splitmix64) float64() float64 {
+	*s += 0x9e3779b97f4a7c15
+	z := uint64(*s)
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11) / (1 << 53)
+}
+
+type bucket struct {
+	fp    uint32
+	count uint64
+}
+
+type Item struct {
+	Member string
+	Count  uint64
+}
+
+/*
+ * TopK 使用 HeavyKeeper 算法估计出现次数最多的 k 个元素
+ * 计数器冲突时以 decay^count 的概率衰减已有的计数，最小堆维护当前的 top k
+ */
+type TopK struct {
+	k       uint64
+	width   uint64
+	depth   uint64
+	decay   float64
+	buckets []bucket
+	heap    []*Item // 按 Count 排序的最小堆
+	lookup  []float64
+	rand    splitmix64
+}
+
+func Make(k uint64, width uint64, depth uint64, decay float64) *TopK {
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]bucket, width*depth),
+		heap:    make([]*Item, 0, k),
+		lookup:  makeLookup(decay),
+		rand:    randSeed,
+	}
+}
+
+func makeLookup(decay float64) []float64 {
+	lookup := make([]float64, decayLookupSize)
+	for i := range lookup {
+		lookup[i] = math.Pow(decay, float64(i))
+	}
+	return lookup
+}
+
+func (t *TopK) K() uint64 {
+	return t.k
+}
+
+func hash(item []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(item)
+	sum := h.Sum64()
+	mixed := (sum ^ sum>>30) * 0xbf58476d1ce4e5b9
+	mixed = (mixed ^ mixed>>27) * 0x94d049bb133111eb
+	return sum, mixed ^ mixed>>31 | 1
+}
+
+func (t *TopK) decayProb(count uint64) float64 {
+	if count < decayLookupSize {
+		return t.lookup[count]
+	}
+	return 0
+}
+
+func (t *TopK) find(member string) int {
+	for i, item := range t.heap {
+		if item.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *TopK) less(i int, j int) bool {
+	return t.heap[i].Count < t.heap[j].Count
+}
+
+func (t *TopK) swap(i int, j int) {
+	t.heap[i], t.heap[j] = t.heap[j], t.heap[i]
+}
+
+func (t *TopK) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !t.less(i, parent) {
+			break
+		}
+		t.swap(i, parent)
+		i = parent
+	}
+}
+
+func (t *TopK) down(i int) {
+	for {
+		smallest := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(t.heap) && t.less(child, smallest) {
+				smallest = child
+			}
+		}
+		if smallest == i {
+			return
+		}
+		t.swap(i, smallest)
+		i = smallest
+	}
+}
+
+/*
+ * IncrBy 增加元素的计数，元素进入 top k 并挤出其他元素时返回被挤出的元素
+ */
+func (t *TopK) IncrBy(member []byte, increment uint64) (expelled string, ok bool) {
+	h1, h2 := hash(member)
+	fp := uint32(h1 >> 32)
+	var maxCount uint64
+	for row := uint64(0); row < t.depth; row++ {
+		b := &t.buckets[row*t.width+(h1+row*h2)%t.width]
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, increment
+		case b.fp == fp:
+			b.count += increment
+		default:
+			for n := increment; n > 0; n-- {
+				if t.rand.float64() < t.decayProb(b.count) {
+					b.count--
+					if b.count == 0 {
+						b.fp, b.count = fp, n
+						break
+					}
+				}
+			}
+		}
+		if b.fp == fp && b.count > maxCount {
+			maxCount = b.count
+		}
+	}
+	if i := t.find(string(member)); i >= 0 {
+		if maxCount > t.heap[i].Count {
+			t.heap[i].Count = maxCount
+			t.down(i)
+		}
+		return "", false
+	}
+	if uint64(len(t.heap)) < t.k {
+		t.heap = append(t.heap, &Item{Member: string(member), Count: maxCount})
+		t.up(len(t.heap) - 1)
+		return "", false
+	}
+	if maxCount <= t.heap[0].Count {
+		return "", false
+	}
+	expelled = t.heap[0].Member
+	t.heap[0] = &Item{Member: string(member), Count: maxCount}
+	t.down(0)
+	return expelled, true
+}
+
+// Query 返回元素是否在 top k 中
+func (t *TopK) Query(member []byte) bool {
+	return t.find(string(member)) >= 0
+}
+
+// List 按计数从大到小返回 top k 中的元素
+func (t *TopK) List() []*Item {
+	items := make([]*Item, len(t.heap))
+	copy(items, t.heap)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Member < items[j].Member
+	})
+	return items
+}
+
+// Clone 返回不共享计数器的副本
+func (t *TopK) Clone() *TopK {
+	c := *t
+	c.buckets = append([]bucket(nil), t.buckets...)
+	c.heap = make([]*Item, len(t.heap), t.k)
+	for i, item := range t.heap {
+		copied := *item
+		c.heap[i] = &copied
+	}
+	return &c
+}
+
+/*
+ * MarshalBinary 序列化为:
+ * k | width | depth | decay | 随机数状态 | 每个 bucket 的 fp, count | top k 的个数 | 每个元素的长度, 元素, count
+ * 整数均为小端序
+ */
+func (t *TopK) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, []uint64{t.k, t.width, t.depth, math.Float64bits(t.decay), uint64(t.rand)})
+	for _, b := range t.buckets {
+		_ = binary.Write(buf, binary.LittleEndian, b.fp)
+		_ = binary.Write(buf, binary.LittleEndian, b.count)
+	}
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(t.heap)))
+	for _, item := range t.heap {
+		_ = binary.Write(buf, binary.LittleEndian, uint64(len(item.Member)))
+		buf.WriteString(item.Member)
+		_ = binary.Write(buf, binary.LittleEndian, item.Count)
+	}
+	return buf.Bytes(), nil
+}
+
+func (t *TopK) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	header := make([]uint64, 5)
+	if binary.Read(reader, binary.LittleEndian, header) != nil {
+		return ErrCorrupt
+	}
+	k, width, depth := header[0], header[1], header[2]
+	decay := math.Float64frombits(header[3])
+	if !ValidSize(k, width, depth) || width*depth > uint64(reader.Len())/12 || !(decay > 0 && decay <= 1) {
+		return ErrCorrupt
+	}
+	t.k, t.width, t.depth = k, width, depth
+	t.decay = decay
+	t.rand = splitmix64(header[4])
+	t.lookup = makeLookup(t.decay)
+	t.buckets = make([]bucket, width*depth)
+	for i := range t.buckets {
+		_ = binary.Read(reader, binary.LittleEndian, &t.buckets[i].fp)
+		_ = binary.Read(reader, binary.LittleEndian, &t.buckets[i].count)
+	}
+	var n uint64
+	if binary.Read(reader, binary.LittleEndian, &n) != nil || n > k {
+		return ErrCorrupt
+	}
+	t.heap = make([]*Item, 0, k)
+	for i := uint64(0); i < n; i++ {
+		var size uint64
+		if binary.Read(reader, binary.LittleEndian, &size) != nil || size > uint64(reader.Len()) {
+			return ErrCorrupt
+		}
+		member := make([]byte, size)
+		_, _ = reader.Read(member)
+		item := &Item{Member: string(member)}
+		if binary.Read(reader, binary.LittleEndian, &item.Count) != nil {
+			return ErrCorrupt
+		}
+		t.heap = append(t.heap, item)
+	}
+	if reader.Len() != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package topk
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func Test_TopK(t *testing.T) {
+	topK := Make(3, 50, 5, DefaultDecay)
+	// 元素 i 出现 i*10 次，交错添加
+	for round := 0; round < 100; round++ {
+		for i := 1; i <= 10; i++ {
+			if round < i*10 {
+				topK.IncrBy([]byte(strconv.Itoa(i)), 1)
+			}
+		}
+	}
+	members := make([]string, 0)
+	for _, item := range topK.List() {
+		members = append(members, item.Member)
+	}
+	if !reflect.DeepEqual(members, []string{"10", "9", "8"}) {
+		t.Errorf("List() err: %v", members)
+	}
+	if !topK.Query([]byte("10")) || topK.Query([]byte("1")) {
+		t.Errorf("Query() err")
+	}
+	expelled, ok := topK.IncrBy([]byte("heavy"), 1000)
+	if !ok || expelled != "8" {
+		t.Errorf("IncrBy() err: expelled %s, %v", expelled, ok)
+	}
+}
+
+func Test_Marshal(t *testing.T) {
+	topK := Make(3, 20, 4, DefaultDecay)
+	for i := 0; i < 200; i++ {
+		topK.IncrBy([]byte(strconv.Itoa(i%13)), 1)
+	}
+	data, _ := topK.MarshalBinary()
+	topK2 := &TopK{}
+	if err := topK2.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(topK, topK2) {
+		t.Fatalf("round trip err: %v", err)
+	}
+	if err := topK2.UnmarshalBinary(data[:len(data)-1]); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary() should reject truncated payload")
+	}
+	// 随机数状态也被保存，之后的结果与原来的相同
+	_ = topK2.UnmarshalBinary(data)
+	clone := topK.Clone()
+	for i := 0; i < 200; i++ {
+		member := []byte(strconv.Itoa(i % 17))
+		topK.IncrBy(member, 1)
+		topK2.IncrBy(member, 1)
+		clone.IncrBy(member, 1)
+	}
+	if !reflect.DeepEqual(topK, topK2) || !reflect.DeepEqual(topK, clone) {
+		t.Errorf("restored topk diverged")
+	}
+}
+
+func Test_UnmarshalLimits(t *testing.T) {
+	header := func(k, width, depth uint64, decay float64) []byte {
+		data := make([]byte, 40+12*16)
+		for i, v := range []uint64{k, width, depth, math.Float64bits(decay)} {
+			binary.LittleEndian.PutUint64(data[8*i:], v)
+		}
+		return data
+	}
+	testCases := map[string][]byte{
+		"huge k":          header(math.MaxUint64, 4, 4, DefaultDecay),
+		"overflow":        header(1, 1<<62, 1<<2, DefaultDecay),
+		"too many bucket": header(1, MaxBuckets, 2, DefaultDecay),
+		"invalid decay":   header(1, 4, 4, 2),
+	}
+	for name, data := range testCases {
+		if err := (&TopK{}).UnmarshalBinary(data); err != ErrCorrupt {
+			t.Errorf("UnmarshalBinary() should reject %s", name)
+		}
+	}
+}
@@ -2,8 +2,9 @@ module github.com/jiangh156/godis
 
 go 1.20
 
+require github.com/jolestar/go-commons-pool/v2 v2.1.2
+
 require (
-	github.com/jolestar/go-commons-pool/v2 v2.1.2 // indirect
 	golang.org/x/mod v0.12.0 // indirect
 	golang.org/x/sys v0.12.0 // indirect
 	golang.org/x/tools v0.13.0 // indirect
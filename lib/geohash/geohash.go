@@ -0,0 +1,239 @@
+package geohash
+
+import (
+	"math"
+)
+
+/*
+ * geohash 将经纬度交错编码为 52 位整数，作为有序集合的分数存储
+ * 经度占奇数位，纬度占偶数位，编码方式与 Redis 兼容
+ */
+
+const (
+	LatMin  = -85.05112878
+	LatMax  = 85.05112878
+	LngMin  = -180.0
+	LngMax  = 180.0
+	MaxStep = 26
+
+	earthRadius = 6372797.560856 // 地球半径，单位米
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Area geohash 对应的经纬度范围
+type Area struct {
+	LngMin float64
+	LngMax float64
+	LatMin float64
+	LatMax float64
+}
+
+// Range 有序集合的分数区间 [Min, Max)
+type Range struct {
+	Min uint64
+	Max uint64
+}
+
+// Validate 检查经纬度是否在可编码的范围内
+func Validate(lng float64, lat float64) bool {
+	return lng >= LngMin && lng <= LngMax && lat >= LatMin && lat <= LatMax
+}
+
+func interleave(x uint64, y uint64, step uint) uint64 {
+	var hash uint64
+	for i := uint(0); i < step; i++ {
+		hash |= (x >> i & 1) << (2 * i)
+		hash |= (y >> i & 1) << (2*i + 1)
+	}
+	return hash
+}
+
+func deinterleave(hash uint64, step uint) (x uint64, y uint64) {
+	for i := uint(0); i < step; i++ {
+		x |= (hash >> (2 * i) & 1) << i
+		y |= (hash >> (2*i + 1) & 1) << i
+	}
+	return x, y
+}
+
+// offset 将 value 映射到 [0, 2^step) 的整数
+func offset(value float64, min float64, max float64, step uint) uint64 {
+	cells := uint64(1) << step
+	bits := uint64((value - min) / (max - min) * float64(cells))
+	if bits >= cells {
+		bits = cells - 1
+	}
+	return bits
+}
+
+func encode(lng float64, lat float64, latMin float64, latMax float64, step uint) uint64 {
+	latBits := offset(lat, latMin, latMax, step)
+	lngBits := offset(lng, LngMin, LngMax, step)
+	return interleave(latBits, lngBits, step)
+}
+
+func decode(hash uint64, step uint) Area {
+	latBits, lngBits := deinterleave(hash, step)
+	cells := float64(uint64(1) << step)
+	return Area{
+		LngMin: LngMin + float64(lngBits)/cells*(LngMax-LngMin),
+		LngMax: LngMin + float64(lngBits+1)/cells*(LngMax-LngMin),
+		LatMin: LatMin + float64(latBits)/cells*(LatMax-LatMin),
+		LatMax: LatMin + float64(latBits+1)/cells*(LatMax-LatMin),
+	}
+}
+
+// Encode 将经纬度编码为 52 位的 geohash
+func Encode(lng float64, lat float64) uint64 {
+	return encode(lng, lat, LatMin, LatMax, MaxStep)
+}
+
+// Decode 返回 geohash 所在区域的中心点
+func Decode(hash uint64) (lng float64, lat float64) {
+	area := decode(hash, MaxStep)
+	lng = math.Max(LngMin, math.Min(LngMax, (area.LngMin+area.LngMax)/2))
+	lat = math.Max(LatMin, math.Min(LatMax, (area.LatMin+area.LatMax)/2))
+	return lng, lat
+}
+
+// ToString 返回标准的 11 位 geohash 字符串，纬度范围使用 [-90, 90]
+func ToString(hash uint64) string {
+	lng, lat := Decode(hash)
+	bits := encode(lng, lat, -90, 90, MaxStep)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		// 52 位不足 55 位，最后一个字符补 0
+		if i < 10 {
+			idx = int(bits >> (52 - (i+1)*5) & 0x1f)
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance 使用 haversine 公式计算两点间的距离，单位米
+func Distance(lng1 float64, lat1 float64, lng2 float64, lat2 float64) float64 {
+	lat1r := degRad(lat1)
+	lat2r := degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((degRad(lng2) - degRad(lng1)) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// InBox 检查点 (lng, lat) 是否在以 (centerLng, centerLat) 为中心、宽 width 高 height 米的矩形内
+func InBox(centerLng float64, centerLat float64, width float64, height float64, lng float64, lat float64) bool {
+	if earthRadius*math.Abs(degRad(lat)-degRad(centerLat)) > height/2 {
+		return false
+	}
+	return Distance(lng, lat, centerLng, lat) <= width/2
+}
+
+// estimateStep 估算覆盖 radius 米所需的精度
+func estimateStep(radius float64, lat float64) uint {
+	if radius == 0 {
+		return MaxStep
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	step -= 2
+	// 高纬度地区经度方向的范围更大
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxStep {
+		step = MaxStep
+	}
+	return uint(step)
+}
+
+// boundingBox 返回以 (lng, lat) 为中心、宽 width 高 height 米的矩形的经纬度范围
+func boundingBox(lng float64, lat float64, width float64, height float64) Area {
+	latDelta := radDeg(height / 2 / earthRadius)
+	lngDeltaTop := radDeg(width / 2 / earthRadius / math.Cos(degRad(lat+latDelta)))
+	lngDeltaBottom := radDeg(width / 2 / earthRadius / math.Cos(degRad(lat-latDelta)))
+	lngDelta := lngDeltaTop
+	if lat < 0 {
+		lngDelta = lngDeltaBottom
+	}
+	return Area{
+		LngMin: lng - lngDelta,
+		LngMax: lng + lngDelta,
+		LatMin: lat - latDelta,
+		LatMax: lat + latDelta,
+	}
+}
+
+// move 将 geohash 沿经度和纬度方向移动若干个格子，超出范围时回绕
+func move(hash uint64, step uint, dLng int64, dLat int64) uint64 {
+	latBits, lngBits := deinterleave(hash, step)
+	mask := int64(1)<<step - 1
+	latBits = uint64((int64(latBits) + dLat) & mask)
+	lngBits = uint64((int64(lngBits) + dLng) & mask)
+	return interleave(latBits, lngBits, step)
+}
+
+/*
+ * Ranges 返回覆盖以 (lng, lat) 为中心、宽 width 高 height 米的矩形的分数区间
+ * 取中心所在的格子及其 8 个相邻格子，格子不足以覆盖矩形时降低一级精度
+ */
+func Ranges(lng float64, lat float64, width float64, height float64) []Range {
+	bounds := boundingBox(lng, lat, width, height)
+	radius := math.Sqrt(width*width+height*height) / 2
+	step := estimateStep(radius, lat)
+	hash := encode(lng, lat, LatMin, LatMax, step)
+	if step > 1 {
+		north := decode(move(hash, step, 0, 1), step)
+		south := decode(move(hash, step, 0, -1), step)
+		east := decode(move(hash, step, 1, 0), step)
+		west := decode(move(hash, step, -1, 0), step)
+		if north.LatMax < bounds.LatMax || south.LatMin > bounds.LatMin ||
+			east.LngMax < bounds.LngMax || west.LngMin > bounds.LngMin {
+			step--
+			hash = encode(lng, lat, LatMin, LatMax, step)
+		}
+	}
+	area := decode(hash, step)
+	ranges := make([]Range, 0, 9)
+	seen := make(map[uint64]struct{}, 9)
+	for dLat := int64(-1); dLat <= 1; dLat++ {
+		for dLng := int64(-1); dLng <= 1; dLng++ {
+			// 排除不可能与矩形相交的格子
+			if step >= 2 && ((dLat < 0 && area.LatMin < bounds.LatMin) || (dLat > 0 && area.LatMax > bounds.LatMax) ||
+				(dLng < 0 && area.LngMin < bounds.LngMin) || (dLng > 0 && area.LngMax > bounds.LngMax)) {
+				continue
+			}
+			neighbor := move(hash, step, dLng, dLat)
+			if _, ok := seen[neighbor]; ok {
+				continue
+			}
+			seen[neighbor] = struct{}{}
+			shift := 2 * (MaxStep - step)
+			ranges = append(ranges, Range{
+				Min: neighbor << shift,
+				Max: (neighbor + 1) << shift,
+			})
+		}
+	}
+	return ranges
+}
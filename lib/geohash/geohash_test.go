@@ -0,0 +1,66 @@
+package geohash
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func Test_Encode(t *testing.T) {
+	testCases := []struct {
+		name  string
+		lng   float64
+		lat   float64
+		hash  uint64
+		str   string
+		exLng string
+		exLat string
+	}{
+		{name: "Palermo", lng: 13.361389, lat: 38.115556, hash: 3479099956230698, str: "sqc8b49rny0",
+			exLng: "13.36138933897018433", exLat: "38.11555639549629859"},
+		{name: "Catania", lng: 15.087269, lat: 37.502669, hash: 3479447370796909, str: "sqdtr74hyu0",
+			exLng: "15.08726745843887329", exLat: "37.50266842333162032"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := Encode(tt.lng, tt.lat)
+			if hash != tt.hash {
+				t.Errorf("Encode() err: reall: %d, want: %d", hash, tt.hash)
+			}
+			if str := ToString(hash); str != tt.str {
+				t.Errorf("ToString() err: reall: %s, want: %s", str, tt.str)
+			}
+			lng, lat := Decode(hash)
+			if fmt.Sprintf("%.17f", lng) != tt.exLng || fmt.Sprintf("%.17f", lat) != tt.exLat {
+				t.Errorf("Decode() err: reall: %.17f,%.17f", lng, lat)
+			}
+		})
+	}
+	lng1, lat1 := Decode(Encode(13.361389, 38.115556))
+	lng2, lat2 := Decode(Encode(15.087269, 37.502669))
+	if dist := Distance(lng1, lat1, lng2, lat2); math.Abs(dist-166274.1516) > 0.0001 {
+		t.Errorf("Distance() err: %f", dist)
+	}
+}
+
+func Test_Ranges(t *testing.T) {
+	// 范围内的点必须落在某个分数区间内
+	lng, lat := 13.361389, 38.115556
+	for _, radius := range []float64{0, 100, 5000, 200000, 5000000} {
+		ranges := Ranges(lng, lat, radius*2, radius*2)
+		for _, d := range []float64{-0.9, -0.5, 0, 0.5, 0.9} {
+			pLng := lng + radDeg(radius*d/earthRadius/math.Cos(degRad(lat)))
+			pLat := lat + radDeg(radius*d/earthRadius)
+			hash := Encode(pLng, pLat)
+			found := false
+			for _, r := range ranges {
+				if hash >= r.Min && hash < r.Max {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Ranges() err: radius %f, point %f,%f not covered", radius, pLng, pLat)
+			}
+		}
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,15 +36,33 @@ var (
 	logger             *log.Logger
 	logPrefix          = ""
 	levelFlags         = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	// 低于该级别的日志不输出，CONFIG SET 时与其他协程并发读写
+	minLevel atomic.Int32
+	// 设置前缀和输出日志需要一起完成，多个协程同时输出时不会串用前缀
+	mu sync.Mutex
 )
 
+// SetLevel 设置日志级别: debug, info, warning, error
+func SetLevel(level string) {
+	switch strings.ToLower(level) {
+	case "debug":
+		minLevel.Store(int32(DEBUG))
+	case "info":
+		minLevel.Store(int32(INFO))
+	case "warn", "warning":
+		minLevel.Store(int32(WARNING))
+	case "error":
+		minLevel.Store(int32(ERROR))
+	}
+}
+
 func Setup(cfg *LogCfg) {
 	var err error
 	dir := cfg.Path
 	filename := fmt.Sprintf("%s-%s.%s", cfg.Name, time.Now().Format(cfg.TimeFormat), cfg.Ext)
 	logFile, err := mustOpen(filename, dir)
 	if err != nil {
-		fmt.Errorf("logging.Setup err: %s", err)
+		fmt.Printf("logging.Setup err: %s\n", err)
 	}
 	mw := io.MultiWriter(os.Stdout, logFile)
 	logger = log.New(mw, DefaultPrefix, log.LstdFlags)
@@ -58,26 +79,48 @@ func setPrefix(level logLevel) {
 }
 
 func Debug(v ...any) {
+	if logLevel(minLevel.Load()) > DEBUG {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
 	setPrefix(DEBUG)
-	logger.Println(v)
+	logger.Println(v...)
 }
 
 func Info(v ...any) {
+	if logLevel(minLevel.Load()) > INFO {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
 	setPrefix(INFO)
-	logger.Println(v)
+	logger.Println(v...)
 }
 
 func Warn(v ...any) {
+	if logLevel(minLevel.Load()) > WARNING {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
 	setPrefix(WARNING)
-	logger.Println(v)
+	logger.Println(v...)
 }
 
 func Error(v ...any) {
+	if logLevel(minLevel.Load()) > ERROR {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
 	setPrefix(ERROR)
-	logger.Println(v)
+	logger.Println(v...)
 }
 
 func Fatal(v ...any) {
+	mu.Lock()
+	defer mu.Unlock()
 	setPrefix(FATAL)
-	logger.Fatalln(v)
+	logger.Fatalln(v...)
 }
@@ -0,0 +1,73 @@
+package rdb
+
+/*
+ * 模块类型的 value: <module id><opcode><value>...<EOF>
+ * module id 由 9 个字符的类型名和 10 位的编码版本组成，与 Redis 的 moduleTypeEncodeId 相同
+ * godis 内置的扩展数据类型(布隆过滤器、JSON 等)以模块类型保存，类型名与 TYPE 命令的结果相同，
+ * 内容是 godis 自己的二进制格式，编码版本使用最大值，真正的模块会拒绝加载而不是误读
+ */
+
+const (
+	moduleOpcodeEOF    = 0
+	moduleOpcodeString = 5
+
+	moduleEncVer = 1023
+	// 类型名的字符集
+	moduleIDCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+)
+
+func encodeModuleID(name string) uint64 {
+	var id uint64
+	for i := 0; i < len(name); i++ {
+		for j := 0; j < len(moduleIDCharset); j++ {
+			if moduleIDCharset[j] == name[i] {
+				id = id<<6 | uint64(j)
+				break
+			}
+		}
+	}
+	return id<<10 | moduleEncVer
+}
+
+func decodeModuleID(id uint64) (name string, encver uint64) {
+	buf := make([]byte, 9)
+	encver = id & 1023
+	id >>= 10
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = moduleIDCharset[id&63]
+		id >>= 6
+	}
+	return string(buf), encver
+}
+
+// WriteModule 写入模块类型的 value，name 必须是字符集中的 9 个字符，data 作为一个字符串保存
+func (e *Encoder) WriteModule(name string, data []byte) {
+	e.WriteType(TypeModule2)
+	e.WriteLength(encodeModuleID(name))
+	e.WriteLength(moduleOpcodeString)
+	e.WriteString(data)
+	e.WriteLength(moduleOpcodeEOF)
+}
+
+// ReadModule 读取 WriteModule 写入的 value，调用前已经读取了类型
+func (d *Decoder) ReadModule() (name string, data []byte, err error) {
+	id, err := d.ReadLength()
+	if err != nil {
+		return "", nil, err
+	}
+	name, encver := decodeModuleID(id)
+	if encver != moduleEncVer {
+		return "", nil, ErrBadFormat
+	}
+	if opcode, err := d.ReadLength(); err != nil || opcode != moduleOpcodeString {
+		return "", nil, ErrBadFormat
+	}
+	data, err = d.ReadString()
+	if err != nil {
+		return "", nil, err
+	}
+	if opcode, err := d.ReadLength(); err != nil || opcode != moduleOpcodeEOF {
+		return "", nil, ErrBadFormat
+	}
+	return name, data, nil
+}
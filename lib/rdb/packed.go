@@ -0,0 +1,305 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+/*
+ * Redis 紧凑编码的解析，用于读取真实 Redis 导出的 value:
+ * listpack(7.0+), ziplist(7.0 之前) 和 intset
+ * 整数元素统一转换为十进制字符串
+ * stream 只有 listpack 编码，因此还需要生成 listpack
+ */
+
+// lzfDecompress 解压 LZF 压缩的字符串
+func lzfDecompress(in []byte, rawLen int) ([]byte, error) {
+	out := make([]byte, 0, rawLen)
+	for ip := 0; ip < len(in); {
+		ctrl := int(in[ip])
+		ip++
+		if ctrl < 1<<5 {
+			// 字面量
+			n := ctrl + 1
+			if ip+n > len(in) {
+				return nil, ErrBadFormat
+			}
+			out = append(out, in[ip:ip+n]...)
+			ip += n
+			continue
+		}
+		// 回溯引用
+		n := ctrl >> 5
+		if n == 7 {
+			if ip >= len(in) {
+				return nil, ErrBadFormat
+			}
+			n += int(in[ip])
+			ip++
+		}
+		if ip >= len(in) {
+			return nil, ErrBadFormat
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[ip]) - 1
+		ip++
+		if ref < 0 {
+			return nil, ErrBadFormat
+		}
+		// 引用可能与输出重叠，逐字节复制
+		for i := 0; i < n+2; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+	if len(out) != rawLen {
+		return nil, ErrBadFormat
+	}
+	return out, nil
+}
+
+func formatInt(v int64) []byte {
+	return []byte(strconv.FormatInt(v, 10))
+}
+
+// signExtend 将 bits 位的补码转换为有符号整数
+func signExtend(u uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64(u<<shift) >> shift
+}
+
+// ParseListpack 返回 listpack 中的所有元素
+func ParseListpack(lp []byte) ([][]byte, error) {
+	if len(lp) < 7 || int(binary.LittleEndian.Uint32(lp)) != len(lp) || lp[len(lp)-1] != 0xff {
+		return nil, ErrBadFormat
+	}
+	entries := make([][]byte, 0, binary.LittleEndian.Uint16(lp[4:]))
+	pos := 6
+	for lp[pos] != 0xff {
+		start := pos
+		b := lp[pos]
+		var entry []byte
+		var strLen int
+		switch {
+		case b&0x80 == 0:
+			entry = formatInt(int64(b & 0x7f))
+			pos++
+		case b&0xc0 == 0x80:
+			strLen = int(b & 0x3f)
+			pos++
+		case b&0xe0 == 0xc0:
+			if pos+2 > len(lp) {
+				return nil, ErrBadFormat
+			}
+			entry = formatInt(signExtend(uint64(b&0x1f)<<8|uint64(lp[pos+1]), 13))
+			pos += 2
+		case b&0xf0 == 0xe0:
+			if pos+2 > len(lp) {
+				return nil, ErrBadFormat
+			}
+			strLen = int(b&0x0f)<<8 | int(lp[pos+1])
+			pos += 2
+		case b == 0xf0:
+			if pos+5 > len(lp) {
+				return nil, ErrBadFormat
+			}
+			strLen = int(binary.LittleEndian.Uint32(lp[pos+1:]))
+			pos += 5
+		case b >= 0xf1 && b <= 0xf4:
+			size := map[byte]int{0xf1: 2, 0xf2: 3, 0xf3: 4, 0xf4: 8}[b]
+			if pos+1+size > len(lp) {
+				return nil, ErrBadFormat
+			}
+			var u uint64
+			for i := size - 1; i >= 0; i-- {
+				u = u<<8 | uint64(lp[pos+1+i])
+			}
+			entry = formatInt(signExtend(u, uint(size*8)))
+			pos += 1 + size
+		default:
+			return nil, ErrBadFormat
+		}
+		if entry == nil {
+			if strLen < 0 || pos+strLen > len(lp) {
+				return nil, ErrBadFormat
+			}
+			entry = append([]byte{}, lp[pos:pos+strLen]...)
+			pos += strLen
+		}
+		// 跳过 backlen
+		pos += backlenSize(pos - start)
+		if pos >= len(lp) {
+			return nil, ErrBadFormat
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// backlenSize 记录元素长度的 backlen 占用的字节数
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// ParseZiplist 返回 ziplist 中的所有元素
+func ParseZiplist(zl []byte) ([][]byte, error) {
+	if len(zl) < 11 || int(binary.LittleEndian.Uint32(zl)) != len(zl) || zl[len(zl)-1] != 0xff {
+		return nil, ErrBadFormat
+	}
+	entries := make([][]byte, 0, binary.LittleEndian.Uint16(zl[8:]))
+	pos := 10
+	for zl[pos] != 0xff {
+		// 跳过 prevlen
+		if zl[pos] == 0xfe {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(zl) {
+			return nil, ErrBadFormat
+		}
+		b := zl[pos]
+		var entry []byte
+		strLen := -1
+		switch {
+		case b>>6 == 0:
+			strLen = int(b & 0x3f)
+			pos++
+		case b>>6 == 1:
+			if pos+2 > len(zl) {
+				return nil, ErrBadFormat
+			}
+			strLen = int(b&0x3f)<<8 | int(zl[pos+1])
+			pos += 2
+		case b == 0x80:
+			if pos+5 > len(zl) {
+				return nil, ErrBadFormat
+			}
+			strLen = int(binary.BigEndian.Uint32(zl[pos+1:]))
+			pos += 5
+		case b >= 0xf1 && b <= 0xfd:
+			entry = formatInt(int64(b&0x0f) - 1)
+			pos++
+		default:
+			size := map[byte]int{0xc0: 2, 0xd0: 4, 0xe0: 8, 0xf0: 3, 0xfe: 1}[b]
+			if size == 0 || pos+1+size > len(zl) {
+				return nil, ErrBadFormat
+			}
+			var u uint64
+			for i := size - 1; i >= 0; i-- {
+				u = u<<8 | uint64(zl[pos+1+i])
+			}
+			entry = formatInt(signExtend(u, uint(size*8)))
+			pos += 1 + size
+		}
+		if strLen >= 0 {
+			if pos+strLen > len(zl) {
+				return nil, ErrBadFormat
+			}
+			entry = append([]byte(nil), zl[pos:pos+strLen]...)
+			pos += strLen
+		}
+		if pos >= len(zl) {
+			return nil, ErrBadFormat
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ParseIntset 返回 intset 中的所有元素
+func ParseIntset(is []byte) ([][]byte, error) {
+	if len(is) < 8 {
+		return nil, ErrBadFormat
+	}
+	size := int(binary.LittleEndian.Uint32(is))
+	n := int(binary.LittleEndian.Uint32(is[4:]))
+	if (size != 2 && size != 4 && size != 8) || len(is) != 8+size*n {
+		return nil, ErrBadFormat
+	}
+	entries := make([][]byte, n)
+	for i := range entries {
+		b := is[8+i*size:]
+		switch size {
+		case 2:
+			entries[i] = formatInt(int64(int16(binary.LittleEndian.Uint16(b))))
+		case 4:
+			entries[i] = formatInt(int64(int32(binary.LittleEndian.Uint32(b))))
+		default:
+			entries[i] = formatInt(int64(binary.LittleEndian.Uint64(b)))
+		}
+	}
+	return entries, nil
+}
+
+// encodeBacklen 元素长度的反向编码，从后向前读取，每个字节保存 7 位，除第一个字节外最高位为 1
+func encodeBacklen(n int) []byte {
+	size := backlenSize(n)
+	buf := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		buf[i] = byte(n & 127)
+		if i != 0 {
+			buf[i] |= 128
+		}
+		n >>= 7
+	}
+	return buf
+}
+
+// appendListpackEntry 十进制整数使用整数编码，其他使用字符串编码
+func appendListpackEntry(lp []byte, entry []byte) []byte {
+	var encoded []byte
+	v, err := strconv.ParseInt(string(entry), 10, 64)
+	switch {
+	case err != nil || strconv.FormatInt(v, 10) != string(entry):
+		n := len(entry)
+		switch {
+		case n < 1<<6:
+			encoded = append([]byte{0x80 | byte(n)}, entry...)
+		case n < 1<<12:
+			encoded = append([]byte{0xe0 | byte(n>>8), byte(n)}, entry...)
+		default:
+			encoded = binary.LittleEndian.AppendUint32([]byte{0xf0}, uint32(n))
+			encoded = append(encoded, entry...)
+		}
+	case v >= 0 && v <= 127:
+		encoded = []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		encoded = []byte{0xc0 | byte(v>>8)&0x1f, byte(v)}
+	case v >= -1<<15 && v < 1<<15:
+		encoded = binary.LittleEndian.AppendUint16([]byte{0xf1}, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		encoded = []byte{0xf2, byte(v), byte(v >> 8), byte(v >> 16)}
+	case v >= -1<<31 && v < 1<<31:
+		encoded = binary.LittleEndian.AppendUint32([]byte{0xf3}, uint32(v))
+	default:
+		encoded = binary.LittleEndian.AppendUint64([]byte{0xf4}, uint64(v))
+	}
+	lp = append(lp, encoded...)
+	return append(lp, encodeBacklen(len(encoded))...)
+}
+
+// MakeListpack 将元素编码为 listpack，可以由 ParseListpack 读取
+func MakeListpack(entries [][]byte) []byte {
+	lp := make([]byte, 6)
+	for _, entry := range entries {
+		lp = appendListpackEntry(lp, entry)
+	}
+	lp = append(lp, 0xff)
+	binary.LittleEndian.PutUint32(lp, uint32(len(lp)))
+	// 元素个数超过 65535 时记为 65535，读取时需要遍历
+	count := len(entries)
+	if count > 65535 {
+		count = 65535
+	}
+	binary.LittleEndian.PutUint16(lp[4:], uint16(count))
+	return lp
+}
@@ -0,0 +1,346 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math"
+	"strconv"
+)
+
+/*
+ * rdb 实现 DUMP/RESTORE 使用的单个 value 的序列化格式，与 Redis 兼容:
+ * <type><value><rdb version 2字节小端><crc64 8字节小端>
+ * crc64 使用 Jones 多项式，覆盖 type、value 和 version
+ */
+
+// value 的类型
+const (
+	TypeString           = 0
+	TypeList             = 1
+	TypeSet              = 2
+	TypeZSet             = 3
+	TypeHash             = 4
+	TypeZSet2            = 5
+	TypeModule2          = 7
+	TypeHashZipmap       = 9
+	TypeListZiplist      = 10
+	TypeSetIntset        = 11
+	TypeZSetZiplist      = 12
+	TypeHashZiplist      = 13
+	TypeListQuicklist    = 14
+	TypeStreamListpacks  = 15
+	TypeHashListpack     = 16
+	TypeZSetListpack     = 17
+	TypeListQuicklist2   = 18
+	TypeStreamListpacks2 = 19 // 增加了 first id、max deleted id 等元数据
+	TypeSetListpack      = 20
+	TypeStreamListpacks3 = 21 // 增加了消费者的 active time
+	TypeHashMetadata     = 24 // 含有字段过期时间的哈希
+)
+
+// quicklist 节点的类型
+const (
+	QuicklistNodePlain  = 1
+	QuicklistNodePacked = 2
+)
+
+const (
+	// Version 可以读取的最高版本
+	Version = 12
+	// 写入时使用的版本，含有字段过期时间的哈希需要版本 12
+	defaultVersion = 11
+)
+
+var (
+	ErrBadFormat = errors.New("ERR Bad data format")
+	ErrChecksum  = errors.New("ERR DUMP payload version or checksum are wrong")
+)
+
+// Jones 多项式的反转形式
+var crcTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// CRC64 与 Redis 一致，初始值为 0 且不取反
+func CRC64(crc uint64, data []byte) uint64 {
+	return ^crc64.Update(^crc, crcTable, data)
+}
+
+// 长度编码的前缀
+const (
+	len6Bit  = 0
+	len14Bit = 1
+	len32Bit = 0x80
+	len64Bit = 0x81
+	encVal   = 3
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// Encoder 序列化单个 value
+type Encoder struct {
+	buf     []byte
+	version uint16
+}
+
+func MakeEncoder() *Encoder {
+	return &Encoder{version: defaultVersion}
+}
+
+func (e *Encoder) WriteType(t byte) {
+	if t == TypeHashMetadata {
+		e.version = 12
+	}
+	e.buf = append(e.buf, t)
+}
+
+func (e *Encoder) WriteLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.buf = append(e.buf, byte(n))
+	case n < 1<<14:
+		e.buf = append(e.buf, byte(n>>8)|len14Bit<<6, byte(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, len32Bit)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, len64Bit)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+// WriteString 可以表示为 32 位整数的字符串使用整数编码
+func (e *Encoder) WriteString(s []byte) {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(v, 10) == string(s) {
+			e.writeInt(v)
+			return
+		}
+	}
+	e.WriteLength(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *Encoder) writeInt(v int64) {
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		e.buf = append(e.buf, encVal<<6|encInt8, byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		e.buf = append(e.buf, encVal<<6|encInt16)
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(v))
+	default:
+		e.buf = append(e.buf, encVal<<6|encInt32)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(v))
+	}
+}
+
+// WriteDouble 8 字节小端的二进制浮点数
+func (e *Encoder) WriteDouble(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+// WriteMillis 8 字节小端的毫秒时间戳
+func (e *Encoder) WriteMillis(ms int64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(ms))
+}
+
+// WriteRaw 写入不带长度前缀的原始字节，如 stream 的消息ID
+func (e *Encoder) WriteRaw(b []byte) {
+	e.buf = append(e.buf, b...)
+}
+
+// Payload 追加版本号和校验和，返回完整的序列化结果
+func (e *Encoder) Payload() []byte {
+	payload := binary.LittleEndian.AppendUint16(e.buf, e.version)
+	return binary.LittleEndian.AppendUint64(payload, CRC64(0, payload))
+}
+
+// Decoder 反序列化单个 value
+type Decoder struct {
+	data []byte
+	pos  int
+}
+
+// MakeDecoder 校验版本号和校验和
+func MakeDecoder(payload []byte) (*Decoder, error) {
+	if len(payload) < 10 {
+		return nil, ErrChecksum
+	}
+	footer := len(payload) - 10
+	version := binary.LittleEndian.Uint16(payload[footer:])
+	crc := binary.LittleEndian.Uint64(payload[footer+2:])
+	if version > Version || CRC64(0, payload[:footer+2]) != crc {
+		return nil, ErrChecksum
+	}
+	return &Decoder{data: payload[:footer]}, nil
+}
+
+// Done 是否已经读取了全部数据
+func (d *Decoder) Done() bool {
+	return d.pos == len(d.data)
+}
+
+func (d *Decoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, ErrBadFormat
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// ReadRaw 读取 n 个原始字节
+func (d *Decoder) ReadRaw(n int) ([]byte, error) {
+	return d.read(n)
+}
+
+func (d *Decoder) ReadByte() (byte, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) ReadType() (byte, error) {
+	return d.ReadByte()
+}
+
+// readLength 返回长度，或者特殊编码的类型
+func (d *Decoder) readLength() (n uint64, encoded bool, err error) {
+	first, err := d.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case len6Bit:
+		return uint64(first & 0x3f), false, nil
+	case len14Bit:
+		next, err := d.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case encVal:
+		return uint64(first & 0x3f), true, nil
+	}
+	switch first {
+	case len32Bit:
+		b, err := d.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), false, nil
+	case len64Bit:
+		b, err := d.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(b), false, nil
+	}
+	return 0, false, ErrBadFormat
+}
+
+func (d *Decoder) ReadLength() (uint64, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded {
+		return 0, ErrBadFormat
+	}
+	return n, nil
+}
+
+// ReadString 支持整数编码和 LZF 压缩
+func (d *Decoder) ReadString() ([]byte, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		b, err := d.read(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	}
+	switch n {
+	case encInt8:
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int8(b[0])), 10)), nil
+	case encInt16:
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10)), nil
+	case encInt32:
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b))), 10)), nil
+	case encLZF:
+		compressedLen, err := d.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := d.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := d.read(int(compressedLen))
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(rawLen))
+	}
+	return nil, ErrBadFormat
+}
+
+func (d *Decoder) ReadDouble() (float64, error) {
+	b, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+// ReadStringDouble 旧版本有序集合使用的字符串格式的浮点数
+func (d *Decoder) ReadStringDouble() (float64, error) {
+	n, err := d.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	b, err := d.read(int(n))
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, ErrBadFormat
+	}
+	return f, nil
+}
+
+func (d *Decoder) ReadMillis() (int64, error) {
+	b, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(b)), nil
+}
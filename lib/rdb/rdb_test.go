@@ -0,0 +1,135 @@
+package rdb
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func Test_CRC64(t *testing.T) {
+	if crc := CRC64(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("CRC64() err: %x", crc)
+	}
+}
+
+func Test_Decoder(t *testing.T) {
+	// Redis 文档中 SET mykey 10 的 DUMP 结果
+	payload := []byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n")
+	d, err := MakeDecoder(payload)
+	if err != nil {
+		t.Fatalf("MakeDecoder() err: %v", err)
+	}
+	if typ, _ := d.ReadType(); typ != TypeString {
+		t.Errorf("ReadType() err: %d", typ)
+	}
+	if s, _ := d.ReadString(); string(s) != "10" || !d.Done() {
+		t.Errorf("ReadString() err: %q", s)
+	}
+	payload[1] = 0xc1
+	if _, err := MakeDecoder(payload); err != ErrChecksum {
+		t.Errorf("MakeDecoder() should reject bad checksum")
+	}
+}
+
+func Test_Encoder(t *testing.T) {
+	e := MakeEncoder()
+	e.WriteType(TypeZSet2)
+	e.WriteLength(20000)
+	e.WriteString([]byte("-12345"))
+	e.WriteString([]byte("012"))
+	e.WriteString(make([]byte, 100))
+	e.WriteDouble(math.Inf(-1))
+	e.WriteMillis(1700000000000)
+	d, err := MakeDecoder(e.Payload())
+	if err != nil {
+		t.Fatalf("MakeDecoder() err: %v", err)
+	}
+	typ, _ := d.ReadType()
+	n, _ := d.ReadLength()
+	s1, _ := d.ReadString()
+	s2, _ := d.ReadString()
+	s3, _ := d.ReadString()
+	f, _ := d.ReadDouble()
+	ms, _ := d.ReadMillis()
+	if typ != TypeZSet2 || n != 20000 || string(s1) != "-12345" || string(s2) != "012" || len(s3) != 100 ||
+		!math.IsInf(f, -1) || ms != 1700000000000 || !d.Done() {
+		t.Errorf("round trip err")
+	}
+}
+
+func Test_lzfDecompress(t *testing.T) {
+	out, err := lzfDecompress([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02}, 9)
+	if err != nil || string(out) != "abcabcabc" {
+		t.Errorf("lzfDecompress() err: %q, %v", out, err)
+	}
+}
+
+func Test_ParseListpack(t *testing.T) {
+	lp := []byte{0, 0, 0, 0, 4, 0,
+		0x05, 0x01, // 7 位整数 5
+		0x83, 'f', 'o', 'o', 0x04, // 6 位长度的字符串 foo
+		0xdf, 0xff, 0x02, // 13 位整数 -1
+		0xf1, 0x00, 0x80, 0x03, // 16 位整数 -32768
+		0xff}
+	lp[0] = byte(len(lp))
+	entries, err := ParseListpack(lp)
+	want := [][]byte{[]byte("5"), []byte("foo"), []byte("-1"), []byte("-32768")}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseListpack() err: %q, %v", entries, err)
+	}
+}
+
+func Test_MakeListpack(t *testing.T) {
+	entries := [][]byte{[]byte("0"), []byte("127"), []byte("-4096"), []byte("4095"), []byte("-32768"),
+		[]byte("8388607"), []byte("-2147483648"), []byte("9223372036854775807"), []byte("007"), []byte(""),
+		bytes.Repeat([]byte("a"), 100), bytes.Repeat([]byte("b"), 5000)}
+	lp := MakeListpack(entries)
+	parsed, err := ParseListpack(lp)
+	if err != nil || !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("MakeListpack() err: %v", err)
+	}
+	// 与 Redis 编码相同
+	if want := []byte{0x83, 'f', 'o', 'o', 0x04, 0xdf, 0xff, 0x02}; !bytes.Equal(MakeListpack([][]byte{[]byte("foo"), []byte("-1")})[6:14], want) {
+		t.Errorf("MakeListpack() encoding err")
+	}
+	if want := []byte{0x01, 0x88}; !bytes.Equal(encodeBacklen(136), want) {
+		t.Errorf("encodeBacklen() err: %v", encodeBacklen(136))
+	}
+}
+
+func Test_ParseZiplist(t *testing.T) {
+	zl := []byte{0, 0, 0, 0, 0, 0, 0, 0, 3, 0,
+		0x00, 0x02, 'h', 'i', // 字符串 hi
+		0x04, 0xf4, // 立即数 3
+		0x02, 0xfe, 0x9c, // 8 位整数 -100
+		0xff}
+	zl[0] = byte(len(zl))
+	entries, err := ParseZiplist(zl)
+	want := [][]byte{[]byte("hi"), []byte("3"), []byte("-100")}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseZiplist() err: %q, %v", entries, err)
+	}
+}
+
+func Test_ParseIntset(t *testing.T) {
+	entries, err := ParseIntset([]byte{2, 0, 0, 0, 2, 0, 0, 0, 0xff, 0xff, 0x10, 0x00})
+	want := [][]byte{[]byte("-1"), []byte("16")}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseIntset() err: %q, %v", entries, err)
+	}
+}
+
+func Test_Module(t *testing.T) {
+	if name, encver := decodeModuleID(encodeModuleID("MBbloom--")); name != "MBbloom--" || encver != moduleEncVer {
+		t.Errorf("decodeModuleID() err: %s, %d", name, encver)
+	}
+	e := MakeEncoder()
+	e.WriteModule("ReJSON-RL", []byte("12"))
+	d, _ := MakeDecoder(e.Payload())
+	typ, _ := d.ReadType()
+	name, data, err := d.ReadModule()
+	if typ != TypeModule2 || name != "ReJSON-RL" || string(data) != "12" || err != nil || !d.Done() {
+		t.Errorf("ReadModule() err: %s, %q, %v", name, data, err)
+	}
+}
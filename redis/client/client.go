@@ -1,11 +1,14 @@
 package client
 
 import (
+	"errors"
 	"github.com/jiangh156/godis/interface/redis"
 	"github.com/jiangh156/godis/lib/logger"
+	"github.com/jiangh156/godis/lib/sync/atomic"
 	"github.com/jiangh156/godis/lib/sync/wait"
 	"github.com/jiangh156/godis/redis/parser"
 	"github.com/jiangh156/godis/redis/protocol"
+	"io"
 	"net"
 	"runtime/debug"
 	"sync"
@@ -19,6 +22,10 @@ type Client struct {
 	waitingReqs chan *request // waiting response
 	ticker      *time.Ticker
 	addr        string
+	// authArgs 认证成功的 AUTH 命令，重连后重新发送
+	authArgs [][]byte
+	// broken 重连或重新认证失败，连接池不再使用该客户端
+	broken atomic.AtomicBool
 
 	working *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -38,6 +45,8 @@ const (
 	maxWait  = 3 * time.Second
 )
 
+var errConnReset = errors.New("connection reset")
+
 // MakeClient creates a new client
 func MakeClient(addr string) (*Client, error) {
 	conn, err := net.Dial("tcp", addr)
@@ -91,18 +100,85 @@ func (client *Client) handleConnectionError(err error) error {
 			return err1
 		}
 	}
+	// 旧连接上等待回复的请求不会再收到回复，直接失败，避免回复错位
+	client.failWaiting()
 	conn, err1 := net.Dial("tcp", client.addr)
 	if err1 != nil {
 		logger.Error(err1)
+		client.broken.Set(true)
 		return err1
 	}
 	client.conn = conn
 	go func() {
 		_ = client.handleRead()
 	}()
+	if client.authArgs != nil {
+		if err1 = client.reauth(); err1 != nil {
+			logger.Error(err1)
+			client.broken.Set(true)
+			return err1
+		}
+	}
+	client.broken.Set(false)
 	return nil
 }
 
+// failWaiting 让所有等待回复的请求失败
+func (client *Client) failWaiting() {
+	for {
+		select {
+		case req := <-client.waitingReqs:
+			if req == nil {
+				return
+			}
+			req.err = errConnReset
+			req.waiting.Done()
+		default:
+			return
+		}
+	}
+}
+
+// Auth 发送 AUTH 命令，username 为空时使用 default 用户，认证成功后重连时会自动重新认证
+func (client *Client) Auth(username string, password string) error {
+	args := [][]byte{[]byte("AUTH"), []byte(password)}
+	if username != "" {
+		args = [][]byte{[]byte("AUTH"), []byte(username), []byte(password)}
+	}
+	// 在发送请求之前赋值，写协程收到请求后读取
+	client.authArgs = args
+	reply := client.Send(args)
+	if errReply, ok := reply.(redis.ErrReply); ok {
+		return errors.New("auth failed: " + errReply.Error())
+	}
+	return nil
+}
+
+// reauth 在写协程中向新的连接发送 AUTH 并等待结果，之后才发送重连前的请求
+func (client *Client) reauth() error {
+	req := &request{
+		args:    client.authArgs,
+		waiting: &wait.Wait{},
+	}
+	req.waiting.Add(1)
+	if _, err := client.conn.Write(protocol.MakeMultiBulkReply(req.args).ToBytes()); err != nil {
+		return err
+	}
+	client.waitingReqs <- req
+	if !req.waiting.WaitWithTimeout(maxWait) {
+		return errors.New("auth failed: server time out")
+	}
+	if errReply, ok := req.reply.(redis.ErrReply); ok {
+		return errors.New("auth failed: " + errReply.Error())
+	}
+	return nil
+}
+
+// Broken 重连或重新认证失败时返回 true
+func (client *Client) Broken() bool {
+	return client.broken.Get()
+}
+
 func (client *Client) heartbeat() {
 	for range client.ticker.C {
 		client.doHeartbeat()
@@ -194,6 +270,17 @@ func (client *Client) handleRead() error {
 	ch := parser.ParseStream(client.conn)
 	for payload := range ch {
 		if payload.Err != nil {
+			// 连接由客户端关闭，写协程重连时已经处理了等待中的请求
+			if errors.Is(payload.Err, net.ErrClosed) {
+				return nil
+			}
+			// 连接被对端断开，等待中的请求不会再收到回复，连接池不再使用该客户端
+			var netErr net.Error
+			if errors.Is(payload.Err, io.EOF) || errors.As(payload.Err, &netErr) {
+				client.broken.Set(true)
+				client.failWaiting()
+				return nil
+			}
 			client.finishRequest(protocol.MakeErrReply(payload.Err.Error()))
 			continue
 		}
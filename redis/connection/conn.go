@@ -14,6 +14,8 @@ type Connection struct {
 	sendingWait wait.Wait
 
 	password string
+	// 通过 AUTH 登录的 ACL 用户，为空时使用 default 用户
+	username string
 }
 
 var connPool = sync.Pool{
@@ -51,6 +53,13 @@ func (c *Connection) GetPassword() string {
 	return c.password
 }
 
+func (c *Connection) SetUsername(username string) {
+	c.username = username
+}
+func (c *Connection) GetUsername() string {
+	return c.username
+}
+
 func (c *Connection) Close() error {
 	_ = c.sendingWait.WaitWithTimeout(5 * time.Second)
 	c.Conn.Close()
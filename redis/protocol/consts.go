@@ -56,6 +56,20 @@ func (e *EmptyMultiBulkReply) ToBytes() []byte {
 	return emptyMultiBulkBytes
 }
 
+// NullMultiBulk
+type NullMultiBulkReply struct {
+}
+
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
+
+func (n *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
 //	NoReply
 //
 // reply nothing, for commands like subscribe
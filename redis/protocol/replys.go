@@ -113,3 +113,22 @@ func (s *StandardErrorReply) Error() string {
 func IsErrorReply(reply redis.Reply) bool {
 	return reply.ToBytes()[0] == '-'
 }
+
+// MultiRaw Reply, 数组中的元素可以是任意类型的reply
+type MultiRawReply struct {
+	Replies []redis.Reply
+}
+
+func MakeMultiRawReply(replies []redis.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
+	}
+}
+
+func (m *MultiRawReply) ToBytes() []byte {
+	res := "*" + strconv.Itoa(len(m.Replies)) + CRLF
+	for _, reply := range m.Replies {
+		res += string(reply.ToBytes())
+	}
+	return []byte(res)
+}
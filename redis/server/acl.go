@@ -0,0 +1,295 @@
+package server
+
+import (
+	"fmt"
+	"github.com/jiangh156/godis/acl"
+	"github.com/jiangh156/godis/database"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/connection"
+	"github.com/jiangh156/godis/redis/protocol"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handlerCommands 由连接处理器直接执行的命令及其 ACL 分类
+var handlerCommands = map[string][]string{
+	"acl":   {"admin", "slow", "dangerous"},
+	"auth":  {"fast", "connection"},
+	"hello": {"fast", "connection"},
+	"quit":  {"fast", "connection"},
+}
+
+// aclSafeSubCommands 不需要管理权限的 ACL 子命令
+var aclSafeSubCommands = map[string]bool{
+	"whoami": true,
+	"cat":    true,
+	"help":   true,
+}
+
+var noPermKeyErrReply = protocol.MakeErrReply("NOPERM No permissions to access a key")
+
+var aclHelp = []string{
+	"ACL <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CAT [<category>]",
+	"    List all commands that belong to <category>, or all command categories",
+	"    when no category is specified.",
+	"DELUSER <username> [<username> ...]",
+	"    Delete a list of users.",
+	"GETUSER <username>",
+	"    Get the user's details.",
+	"LIST",
+	"    Show users details in config file format.",
+	"LOAD",
+	"    Reload users from the ACL file.",
+	"LOG [<count> | RESET]",
+	"    Show the ACL log entries.",
+	"SAVE",
+	"    Save the current config to the ACL file.",
+	"SETUSER <username> <attribute> [<attribute> ...]",
+	"    Create or modify a user with the specified attributes.",
+	"USERS",
+	"    List all the registered usernames.",
+	"WHOAMI",
+	"    Return the current connection username.",
+	"HELP",
+	"    Print this help.",
+}
+
+func init() {
+	acl.SetCommandChecker(func(cmdName string) bool {
+		_, ok := handlerCommands[cmdName]
+		return ok || database.CommandExists(cmdName)
+	})
+}
+
+// commandCategories 返回命令的 ACL 分类，命令不存在时 ok 为 false
+func commandCategories(args [][]byte) (categories []string, ok bool) {
+	cmdName := strings.ToLower(string(args[0]))
+	if cmdName == "acl" && len(args) > 1 && aclSafeSubCommands[strings.ToLower(string(args[1]))] {
+		return []string{"slow"}, true
+	}
+	if categories, ok = handlerCommands[cmdName]; ok {
+		return categories, true
+	}
+	if !database.CommandExists(cmdName) {
+		return nil, false
+	}
+	return database.CommandCategories(cmdName), true
+}
+
+// checkPermission 检查用户能否执行命令以及访问命令中的 key，不存在的命令交给数据库返回错误
+func checkPermission(c *connection.Connection, user *acl.User, args [][]byte) redis.Reply {
+	categories, ok := commandCategories(args)
+	if !ok {
+		return nil
+	}
+	cmdName := strings.ToLower(string(args[0]))
+	if !user.CanExecute(cmdName, categories) {
+		acl.AddLog(acl.ReasonCommand, cmdName, user.Name, clientInfo(c))
+		return protocol.MakeErrReply(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user.Name, cmdName))
+	}
+	if database.CommandAccessesAllKeys(args) && !user.CanAccessAllKeys() {
+		acl.AddLog(acl.ReasonKey, cmdName, user.Name, clientInfo(c))
+		return noPermKeyErrReply
+	}
+	for _, key := range database.CommandKeys(args) {
+		if !user.CanAccessKey(string(key)) {
+			acl.AddLog(acl.ReasonKey, string(key), user.Name, clientInfo(c))
+			return noPermKeyErrReply
+		}
+	}
+	return nil
+}
+
+// ACL SETUSER|GETUSER|DELUSER|LIST|USERS|WHOAMI|CAT|LOG|SAVE|LOAD|HELP
+func execACL(c *connection.Connection, args [][]byte) redis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToUpper(string(args[1]))
+	switch subCmd {
+	case "SETUSER":
+		if len(args) < 3 {
+			return protocol.MakeArgNumErrReply("acl|setuser")
+		}
+		rules := make([]string, 0, len(args)-3)
+		for _, arg := range args[3:] {
+			rules = append(rules, string(arg))
+		}
+		if err := acl.SetUser(string(args[2]), rules); err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	case "GETUSER":
+		if len(args) != 3 {
+			return protocol.MakeArgNumErrReply("acl|getuser")
+		}
+		return execACLGetUser(string(args[2]))
+	case "DELUSER":
+		if len(args) < 3 {
+			return protocol.MakeArgNumErrReply("acl|deluser")
+		}
+		names := make([]string, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			names = append(names, string(arg))
+		}
+		deleted, err := acl.DelUser(names...)
+		if err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		return protocol.MakeIntReply(int64(deleted))
+	case "LIST", "USERS":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("acl|" + strings.ToLower(subCmd))
+		}
+		users := acl.Users()
+		result := make([][]byte, len(users))
+		for i, u := range users {
+			if subCmd == "LIST" {
+				result[i] = []byte(u.Describe())
+			} else {
+				result[i] = []byte(u.Name)
+			}
+		}
+		return protocol.MakeMultiBulkReply(result)
+	case "WHOAMI":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("acl|whoami")
+		}
+		username := c.GetUsername()
+		if username == "" {
+			username = acl.DefaultUser
+		}
+		return protocol.MakeBulkReply([]byte(username))
+	case "CAT":
+		if len(args) > 3 {
+			return protocol.MakeArgNumErrReply("acl|cat")
+		}
+		return execACLCat(args[2:])
+	case "LOG":
+		if len(args) > 3 {
+			return protocol.MakeArgNumErrReply("acl|log")
+		}
+		return execACLLog(args[2:])
+	case "SAVE", "LOAD":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("acl|" + strings.ToLower(subCmd))
+		}
+		var err error
+		if subCmd == "SAVE" {
+			err = acl.Save()
+		} else {
+			err = acl.Load()
+		}
+		if err != nil {
+			// 错误信息中不能有换行
+			return protocol.MakeErrReply("ERR " + strings.ReplaceAll(err.Error(), "\n", " "))
+		}
+		return protocol.MakeOkReply()
+	case "HELP":
+		result := make([][]byte, len(aclHelp))
+		for i, line := range aclHelp {
+			result[i] = []byte(line)
+		}
+		return protocol.MakeMultiBulkReply(result)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[1]) + "'. Try ACL HELP.")
+}
+
+// ACL GETUSER username，用户不存在时返回 nil
+func execACLGetUser(name string) redis.Reply {
+	u := acl.GetUser(name)
+	if u == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	flags := make([][]byte, 0)
+	for _, flag := range u.Flags() {
+		flags = append(flags, []byte(flag))
+	}
+	passwords := make([][]byte, 0)
+	for _, p := range u.Passwords() {
+		passwords = append(passwords, []byte(p))
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte("flags")), protocol.MakeMultiBulkReply(flags),
+		protocol.MakeBulkReply([]byte("passwords")), protocol.MakeMultiBulkReply(passwords),
+		protocol.MakeBulkReply([]byte("commands")), protocol.MakeBulkReply([]byte(u.Commands())),
+		protocol.MakeBulkReply([]byte("keys")), protocol.MakeBulkReply([]byte(u.Keys())),
+		protocol.MakeBulkReply([]byte("channels")), protocol.MakeBulkReply([]byte(u.Channels())),
+		protocol.MakeBulkReply([]byte("selectors")), protocol.MakeEmptyMultiBulkReply(),
+	})
+}
+
+// ACL CAT [category]，不指定分类时返回所有分类
+func execACLCat(args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		result := make([][]byte, len(acl.Categories))
+		for i, category := range acl.Categories {
+			result[i] = []byte(category)
+		}
+		return protocol.MakeMultiBulkReply(result)
+	}
+	category := strings.ToLower(string(args[0]))
+	found := false
+	for _, c := range acl.Categories {
+		if c == category {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return protocol.MakeErrReply("ERR Unknown category '" + string(args[0]) + "'")
+	}
+	names := database.CommandsInCategory(category)
+	for name, categories := range handlerCommands {
+		for _, c := range categories {
+			if c == category {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	result := make([][]byte, len(names))
+	for i, name := range names {
+		result[i] = []byte(name)
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// ACL LOG [count | RESET]，默认返回最新的 10 条记录
+func execACLLog(args [][]byte) redis.Reply {
+	count := 10
+	if len(args) == 1 {
+		if strings.ToUpper(string(args[0])) == "RESET" {
+			acl.ResetLog()
+			return protocol.MakeOkReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	now := time.Now()
+	entries := acl.Logs(count)
+	result := make([]redis.Reply, len(entries))
+	for i, e := range entries {
+		age := strconv.FormatFloat(now.Sub(e.Created).Seconds(), 'f', 3, 64)
+		result[i] = protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte("count")), protocol.MakeIntReply(int64(e.Count)),
+			protocol.MakeBulkReply([]byte("reason")), protocol.MakeBulkReply([]byte(e.Reason)),
+			protocol.MakeBulkReply([]byte("context")), protocol.MakeBulkReply([]byte(e.Context)),
+			protocol.MakeBulkReply([]byte("object")), protocol.MakeBulkReply([]byte(e.Object)),
+			protocol.MakeBulkReply([]byte("username")), protocol.MakeBulkReply([]byte(e.Username)),
+			protocol.MakeBulkReply([]byte("age-seconds")), protocol.MakeBulkReply([]byte(age)),
+			protocol.MakeBulkReply([]byte("client-info")), protocol.MakeBulkReply([]byte(e.ClientInfo)),
+			protocol.MakeBulkReply([]byte("entry-id")), protocol.MakeIntReply(e.EntryID),
+			protocol.MakeBulkReply([]byte("timestamp-created")), protocol.MakeIntReply(e.Created.UnixMilli()),
+			protocol.MakeBulkReply([]byte("timestamp-last-updated")), protocol.MakeIntReply(e.Updated.UnixMilli()),
+		})
+	}
+	return protocol.MakeMultiRawReply(result)
+}
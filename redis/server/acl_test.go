@@ -0,0 +1,96 @@
+package server
+
+import (
+	"github.com/jiangh156/godis/acl"
+	"github.com/jiangh156/godis/database"
+	"github.com/jiangh156/godis/lib/utils"
+	"github.com/jiangh156/godis/redis/connection"
+	"strings"
+	"testing"
+)
+
+func makeTestHandler(t *testing.T) *RedisHandler {
+	if err := acl.Setup("", ""); err != nil {
+		t.Fatalf("Setup() err: %v", err)
+	}
+	acl.ResetLog()
+	handler := &RedisHandler{DB: database.NewSingleServer()}
+	t.Cleanup(func() {
+		handler.DB.Close()
+		_ = acl.Setup("", "")
+	})
+	return handler
+}
+
+// exec 执行以空格分隔的命令，返回 RESP 格式的结果
+func exec(handler *RedisHandler, c *connection.Connection, line string) string {
+	return string(handler.exec(c, utils.ToCmdLine(strings.Fields(line)...)).ToBytes())
+}
+
+func Test_Auth(t *testing.T) {
+	handler := makeTestHandler(t)
+	c := &connection.Connection{}
+	// default 用户不需要密码时不需要认证
+	if reply := exec(handler, c, "set a 1"); reply != "+OK\r\n" {
+		t.Errorf("set err: %q", reply)
+	}
+	if reply := exec(handler, c, "auth pw"); !strings.HasPrefix(reply, "-ERR AUTH <password> called without") {
+		t.Errorf("auth err: %q", reply)
+	}
+	acl.SetDefaultPassword("pw")
+	c = &connection.Connection{}
+	if reply := exec(handler, c, "get a") + exec(handler, c, "ping"); reply != "-NOAUTH Authentication required.\r\n+PONG\r\n" {
+		t.Errorf("noauth err: %q", reply)
+	}
+	if reply := exec(handler, c, "auth wrong"); !strings.HasPrefix(reply, "-WRONGPASS") {
+		t.Errorf("auth err: %q", reply)
+	}
+	if reply := exec(handler, c, "auth pw") + exec(handler, c, "get a"); reply != "+OK\r\n$1\r\n1\r\n" {
+		t.Errorf("auth err: %q", reply)
+	}
+	if entries := acl.Logs(10); len(entries) != 1 || entries[0].Reason != acl.ReasonAuth {
+		t.Errorf("auth log err: %+v", entries)
+	}
+}
+
+func Test_CheckPermission(t *testing.T) {
+	handler := makeTestHandler(t)
+	admin := &connection.Connection{}
+	if reply := exec(handler, admin, "acl setuser alice on >pw ~cache:* +@all -@dangerous +sort +sort_ro"); reply != "+OK\r\n" {
+		t.Fatalf("acl setuser err: %q", reply)
+	}
+	c := &connection.Connection{}
+	if reply := exec(handler, c, "auth alice pw") + exec(handler, c, "acl whoami"); reply != "+OK\r\n$5\r\nalice\r\n" {
+		t.Fatalf("auth err: %q", reply)
+	}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"set cache:1 v", "+OK\r\n"},
+		{"rpush cache:list 1 2", ":2\r\n"},
+		{"set user:1 v", "-NOPERM No permissions to access a key\r\n"},
+		{"rename cache:1 user:1", "-NOPERM No permissions to access a key\r\n"},
+		{"keys *", "-NOPERM User alice has no permissions to run the 'keys' command\r\n"},
+		{"acl setuser bob on", "-NOPERM User alice has no permissions to run the 'acl' command\r\n"},
+		{"ts.mrange - + FILTER a=b", "-NOPERM No permissions to access a key\r\n"},
+		{"sort_ro cache:list BY user:*", "-NOPERM No permissions to access a key\r\n"},
+		{"sort_ro cache:list GET # DESC", "*2\r\n$1\r\n2\r\n$1\r\n1\r\n"},
+		{"sort_ro cache:list LIMIT 0 1", "*1\r\n$1\r\n1\r\n"},
+		{"sort cache:list STORE user:list", "-NOPERM No permissions to access a key\r\n"},
+	}
+	for _, tt := range tests {
+		if reply := exec(handler, c, tt.line); reply != tt.want {
+			t.Errorf("%s err: %q", tt.line, reply)
+		}
+	}
+	// 拥有所有 key 权限的用户可以使用 SORT 的 BY 模式
+	if reply := exec(handler, admin, "sort_ro cache:list BY nosuch_*"); !strings.HasPrefix(reply, "*2\r\n") {
+		t.Errorf("sort_ro err: %q", reply)
+	}
+	// 禁用用户后需要重新认证
+	exec(handler, admin, "acl setuser alice off")
+	if reply := exec(handler, c, "get cache:1"); reply != "-NOAUTH Authentication required.\r\n" {
+		t.Errorf("disabled user err: %q", reply)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"github.com/jiangh156/godis/acl"
+	"github.com/jiangh156/godis/config"
+	"github.com/jiangh156/godis/interface/redis"
+	"github.com/jiangh156/godis/redis/connection"
+	"github.com/jiangh156/godis/redis/protocol"
+	"strconv"
+	"strings"
+)
+
+// noAuthCommands 未认证的客户端可以执行的命令
+var noAuthCommands = map[string]bool{
+	"auth":  true,
+	"hello": true,
+	"quit":  true,
+	"ping":  true,
+}
+
+var (
+	noAuthErrReply    = protocol.MakeErrReply("NOAUTH Authentication required.")
+	wrongPassErrReply = protocol.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+// clientInfo 用于 ACL LOG 中标识客户端
+func clientInfo(c *connection.Connection) string {
+	username := c.GetUsername()
+	if username == "" {
+		username = acl.DefaultUser
+	}
+	return fmt.Sprintf("addr=%s user=%s db=%d", c.Name(), username, c.GetDBIndex())
+}
+
+/*
+ * currentUser 返回连接当前的用户，未认证时返回 nil
+ * 没有通过 AUTH 登录的连接在 default 用户不需要密码时以 default 用户的身份执行命令
+ * 登录的用户被删除或禁用后连接需要重新认证
+ */
+func currentUser(c *connection.Connection) *acl.User {
+	name := c.GetUsername()
+	if name == "" {
+		u := acl.GetUser(acl.DefaultUser)
+		if u.Enabled() && u.NoPass() {
+			return u
+		}
+		return nil
+	}
+	u := acl.GetUser(name)
+	if u == nil || !u.Enabled() {
+		return nil
+	}
+	return u
+}
+
+// authenticate 校验用户名和密码，成功后记录在连接上
+func authenticate(c *connection.Connection, username string, password string) redis.Reply {
+	if acl.Authenticate(username, password) == nil {
+		acl.AddLog(acl.ReasonAuth, "AUTH", username, clientInfo(c))
+		return wrongPassErrReply
+	}
+	c.SetUsername(username)
+	return nil
+}
+
+// AUTH [username] password，只有密码时使用 default 用户
+func execAuth(c *connection.Connection, args [][]byte) redis.Reply {
+	if len(args) != 2 && len(args) != 3 {
+		return protocol.MakeArgNumErrReply("auth")
+	}
+	username, password := acl.DefaultUser, string(args[1])
+	if len(args) == 3 {
+		username, password = string(args[1]), string(args[2])
+	} else if u := acl.GetUser(acl.DefaultUser); u.Enabled() && u.NoPass() {
+		return protocol.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. " +
+			"Are you sure your configuration is correct?")
+	}
+	if errReply := authenticate(c, username, password); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]，只支持 RESP2
+func execHello(c *connection.Connection, args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		version, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			return protocol.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if version != 2 {
+			return protocol.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			if errReply := authenticate(c, string(args[i+1]), string(args[i+2])); errReply != nil {
+				return errReply
+			}
+			i += 2
+		case "SETNAME":
+			// 不支持客户端名称，忽略
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			i++
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if currentUser(c) == nil {
+		return protocol.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	mode := "standalone"
+	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+		mode = "cluster"
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte("server")), protocol.MakeBulkReply([]byte("godis")),
+		protocol.MakeBulkReply([]byte("proto")), protocol.MakeIntReply(2),
+		protocol.MakeBulkReply([]byte("mode")), protocol.MakeBulkReply([]byte(mode)),
+		protocol.MakeBulkReply([]byte("role")), protocol.MakeBulkReply([]byte("master")),
+		protocol.MakeBulkReply([]byte("modules")), protocol.MakeEmptyMultiBulkReply(),
+	})
+}
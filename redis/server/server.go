@@ -7,6 +7,7 @@ import (
 	"github.com/jiangh156/godis/config"
 	"github.com/jiangh156/godis/database"
 	"github.com/jiangh156/godis/interface/db"
+	"github.com/jiangh156/godis/interface/redis"
 	"github.com/jiangh156/godis/lib/logger"
 	"github.com/jiangh156/godis/lib/sync/atomic"
 	"github.com/jiangh156/godis/lib/sync/wait"
@@ -15,14 +16,30 @@ import (
 	"github.com/jiangh156/godis/redis/protocol"
 	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	unknownErrReplyBytes = []byte("-ERR unknown\r\n")
 )
 
+// idleReader 每次读取前根据 timeout 配置设置读超时，空闲超时的连接将被关闭
+type idleReader struct {
+	net.Conn
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	var deadline time.Time
+	if timeout := config.Timeout(); timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout) * time.Second)
+	}
+	_ = r.Conn.SetReadDeadline(deadline)
+	return r.Conn.Read(p)
+}
+
 type RedisHandler struct {
 	ActiveConn     sync.Map
 	DB             db.DataBase
@@ -40,12 +57,13 @@ func (handler *RedisHandler) Handle(ctx context.Context, conn net.Conn) {
 	}()
 	client := connection.NewConn(conn)
 	handler.ActiveConn.Store(client, struct{}{})
-	ch := parser.ParseStream(conn)
+	ch := parser.ParseStream(idleReader{conn})
 label:
 	for payload := range ch {
 		if payload.Err != nil {
 			// conn close
 			if payload.Err == io.EOF || errors.Is(payload.Err, io.ErrUnexpectedEOF) ||
+				errors.Is(payload.Err, os.ErrDeadlineExceeded) ||
 				strings.Contains(payload.Err.Error(), "use of closed network connection") {
 				handler.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr())
@@ -81,7 +99,15 @@ label:
 				logger.Info("require Bulk or multiBulk")
 				continue label
 			}
-			result := handler.DB.Exec(client, args)
+			if len(args) == 0 {
+				continue label
+			}
+			if strings.ToLower(string(args[0])) == "quit" {
+				_, _ = client.Write(protocol.MakeOkReply().ToBytes())
+				handler.closeClient(client)
+				return
+			}
+			result := handler.exec(client, args)
 			if result != nil {
 				_, _ = client.Write(result.ToBytes())
 			} else {
@@ -92,6 +118,31 @@ label:
 
 }
 
+// exec 认证通过并且用户有权限执行命令、访问命令中的 key 后才将命令交给数据库执行
+func (handler *RedisHandler) exec(client *connection.Connection, args [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	switch cmdName {
+	case "auth":
+		return execAuth(client, args)
+	case "hello":
+		return execHello(client, args)
+	}
+	user := currentUser(client)
+	if user == nil {
+		if !noAuthCommands[cmdName] {
+			return noAuthErrReply
+		}
+		return handler.DB.Exec(client, args)
+	}
+	if errReply := checkPermission(client, user, args); errReply != nil {
+		return errReply
+	}
+	if cmdName == "acl" {
+		return execACL(client, args)
+	}
+	return handler.DB.Exec(client, args)
+}
+
 func (handler *RedisHandler) closeClient(client *connection.Connection) {
 	_ = client.Close()
 	handler.DB.AfterClientClose(client)
@@ -125,7 +176,19 @@ func MakeRedisHandler() *RedisHandler {
 		DB = database.NewSingleServer()
 	}
 	// 单节点
-	return &RedisHandler{
+	handler := &RedisHandler{
 		DB: DB,
 	}
+	database.SetClientCounter(handler.ClientCount)
+	return handler
+}
+
+// ClientCount 返回当前的连接数
+func (handler *RedisHandler) ClientCount() int {
+	count := 0
+	handler.ActiveConn.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	return count
 }